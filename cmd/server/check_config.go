@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dmitastr/yp_observability_service/internal/app"
+	"github.com/spf13/cobra"
+)
+
+// newCheckConfigCmd creates command validating config without opening storages
+func newCheckConfigCmd(loadConfig configLoader) *cobra.Command {
+	return &cobra.Command{
+		Use:   "check-config",
+		Short: "Validate flags, env arguments and config file",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			storage, err := app.CheckConfig(cfg)
+			if err != nil {
+				return fmt.Errorf("invalid config: %w", err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "config is valid, storage: %s\n", storage)
+			return nil
+		},
+	}
+}
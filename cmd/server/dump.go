@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dmitastr/yp_observability_service/internal/app"
+	"github.com/dmitastr/yp_observability_service/internal/domain/dump"
+	"github.com/dmitastr/yp_observability_service/internal/domain/service"
+	"github.com/spf13/cobra"
+)
+
+// parseDumpFormat returns format set by flag or by file extension, json by default
+func parseDumpFormat(format, file string) (dump.Format, error) {
+	if format == "" && file != "" {
+		format = strings.TrimPrefix(filepath.Ext(file), ".")
+	}
+	return dump.ParseFormat(format)
+}
+
+// newExportCmd creates command writing all metrics and metadata to the file or stdout
+func newExportCmd(loadConfig configLoader) *cobra.Command {
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export metrics and metadata from storage",
+		Args:  cobra.NoArgs,
+	}
+	format := exportCmd.Flags().String("format", "", "dump format: json, ndjson or csv, by default taken from file extension or json")
+	file := exportCmd.Flags().String("file", "", "path of the dump, stdout by default")
+
+	exportCmd.RunE = func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		dumpFormat, err := parseDumpFormat(*format, *file)
+		if err != nil {
+			return err
+		}
+
+		w := cmd.OutOrStdout()
+		if *file != "" {
+			f, err := os.Create(*file)
+			if err != nil {
+				return fmt.Errorf("error creating dump file: %w", err)
+			}
+			defer f.Close()
+			w = f
+		}
+		return app.Export(cmd.Context(), cfg, w, dumpFormat)
+	}
+	return exportCmd
+}
+
+// newImportCmd creates command reading metrics and metadata from the file or stdin
+func newImportCmd(loadConfig configLoader) *cobra.Command {
+	importCmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import metrics and metadata into storage",
+		Args:  cobra.NoArgs,
+	}
+	format := importCmd.Flags().String("format", "", "dump format: json, ndjson or csv, by default taken from file extension or json")
+	file := importCmd.Flags().String("file", "", "path of the dump, stdin by default")
+	mode := importCmd.Flags().String("mode", string(service.ImportMerge), "merge adds metrics to the stored ones, replace deletes stored metrics first")
+
+	importCmd.RunE = func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		dumpFormat, err := parseDumpFormat(*format, *file)
+		if err != nil {
+			return err
+		}
+		importMode, err := service.ParseImportMode(*mode)
+		if err != nil {
+			return err
+		}
+
+		r := cmd.InOrStdin()
+		if *file != "" {
+			f, err := os.Open(*file)
+			if err != nil {
+				return fmt.Errorf("error opening dump file: %w", err)
+			}
+			defer f.Close()
+			r = f
+		}
+		result, err := app.Import(cmd.Context(), cfg, r, dumpFormat, importMode)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "imported %d metrics and %d metadata, deleted %d metrics\n", result.Metrics, result.Metadata, result.Deleted)
+		return nil
+	}
+	return importCmd
+}
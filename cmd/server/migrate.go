@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/dmitastr/yp_observability_service/internal/app"
+	postgresstorage "github.com/dmitastr/yp_observability_service/internal/repository/postgres_storage"
+	"github.com/spf13/cobra"
+)
+
+// newMigrateCmd creates commands applying postgres migrations without starting the server
+func newMigrateCmd(loadConfig configLoader) *cobra.Command {
+	migrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply postgres schema migrations",
+	}
+
+	// withMigrator runs fnc with migrator of configured database and prints the resulting schema version
+	withMigrator := func(cmd *cobra.Command, fnc func(*postgresstorage.Migrator) error) (err error) {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		migrator, err := app.NewMigrator(cfg)
+		if err != nil {
+			return err
+		}
+		defer func() { err = errors.Join(err, migrator.Close()) }()
+
+		if err := fnc(migrator); err != nil {
+			return err
+		}
+		status, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), status)
+		return nil
+	}
+
+	upCmd := &cobra.Command{
+		Use:   "up",
+		Short: "Apply all pending migrations",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withMigrator(cmd, (*postgresstorage.Migrator).Up)
+		},
+	}
+
+	downCmd := &cobra.Command{
+		Use:   "down",
+		Short: "Roll back applied migrations",
+		Args:  cobra.NoArgs,
+	}
+	steps := downCmd.Flags().Int("steps", 1, "number of migrations to roll back")
+	all := downCmd.Flags().Bool("all", false, "roll back all migrations")
+	downCmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if !*all && *steps < 1 {
+			return fmt.Errorf("steps must be positive, got %d", *steps)
+		}
+		return withMigrator(cmd, func(migrator *postgresstorage.Migrator) error {
+			if *all {
+				return migrator.Down(0)
+			}
+			return migrator.Down(*steps)
+		})
+	}
+
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Print applied and latest schema versions",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withMigrator(cmd, func(*postgresstorage.Migrator) error { return nil })
+		},
+	}
+
+	forceCmd := &cobra.Command{
+		Use:   "force VERSION",
+		Short: "Set schema version and clear dirty state without running migrations",
+		Long: "Set schema version and clear dirty state without running migrations. " +
+			"Use it after a failed migration was completed or reverted by hand, version 0 means no migration was applied",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			version, err := strconv.ParseUint(args[0], 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid version '%s': %w", args[0], err)
+			}
+			return withMigrator(cmd, func(migrator *postgresstorage.Migrator) error {
+				return migrator.Force(uint(version))
+			})
+		},
+	}
+
+	migrateCmd.AddCommand(upCmd, downCmd, statusCmd, forceCmd)
+	return migrateCmd
+}
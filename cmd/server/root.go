@@ -0,0 +1,40 @@
+package main
+
+import (
+	serverenvconfig "github.com/dmitastr/yp_observability_service/internal/config/env_parser/server/server_env_config"
+	"github.com/spf13/cobra"
+)
+
+// configLoader reads config from parsed flags, env arguments and config file
+type configLoader func() (*serverenvconfig.Config, error)
+
+// newRootCmd creates command tree of the server. Config flags are shared by all commands. Root command
+// without subcommand starts the server like serve
+func newRootCmd() *cobra.Command {
+	configFlags := serverenvconfig.NewFlagSet("server")
+	loadConfig := func() (*serverenvconfig.Config, error) {
+		return serverenvconfig.FromFlags(configFlags)
+	}
+
+	serveCmd := newServeCmd(loadConfig)
+	rootCmd := &cobra.Command{
+		Use:           "server",
+		Short:         "YP observability server",
+		Args:          cobra.NoArgs,
+		RunE:          serveCmd.RunE,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		// the tree is limited to server commands
+		CompletionOptions: cobra.CompletionOptions{DisableDefaultCmd: true},
+	}
+	rootCmd.PersistentFlags().AddFlagSet(configFlags)
+	rootCmd.AddCommand(
+		serveCmd,
+		newMigrateCmd(loadConfig),
+		newExportCmd(loadConfig),
+		newImportCmd(loadConfig),
+		newCheckConfigCmd(loadConfig),
+		newVersionCmd(),
+	)
+	return rootCmd
+}
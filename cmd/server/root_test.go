@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/app"
+	serverenvconfig "github.com/dmitastr/yp_observability_service/internal/config/env_parser/server/server_env_config"
+	"github.com/dmitastr/yp_observability_service/internal/mocks/testhelpers"
+	"github.com/dmitastr/yp_observability_service/internal/repository/memstorage"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// execute runs command tree with args and returns its output
+func execute(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	var out bytes.Buffer
+	rootCmd := newRootCmd()
+	rootCmd.SetOut(&out)
+	rootCmd.SetArgs(args)
+	err := rootCmd.Execute()
+	return out.String(), err
+}
+
+func TestVersionCmd(t *testing.T) {
+	out, err := execute(t, "version")
+	require.NoError(t, err)
+	assert.Equal(t, "Build version: N/A\nBuild date: N/A\nBuild commit: N/A\n", out)
+}
+
+func TestCheckConfigCmd(t *testing.T) {
+	dir := t.TempDir()
+	validConfig := filepath.Join(dir, "valid.json")
+	require.NoError(t, os.WriteFile(validConfig, []byte(`{"derived_metrics": [{"name": "Ratio", "expr": "A / B"}]}`), 0o600))
+	invalidConfig := filepath.Join(dir, "invalid.json")
+	require.NoError(t, os.WriteFile(invalidConfig, []byte(`{"derived_metrics": [{"name": "Ratio", "expr": "A /"}]}`), 0o600))
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			args: []string{"check-config"},
+			want: "config is valid, storage: memory with file backup ./data/data.json\n",
+		},
+		{
+			name: "postgres by flag",
+			args: []string{"check-config", "-d", "postgres://localhost/metrics"},
+			want: "config is valid, storage: postgres\n",
+		},
+		{
+			name: "config file",
+			args: []string{"check-config", "-c", validConfig, "--kv_path", "metrics.db"},
+			want: "config is valid, storage: key-value database metrics.db\n",
+		},
+		{
+			name:    "invalid flag value",
+			args:    []string{"check-config", "--type_conflict_policy", "ignore"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid config file",
+			args:    []string{"check-config", "-c", invalidConfig},
+			wantErr: true,
+		},
+		{
+			name:    "missing config file",
+			args:    []string{"check-config", "-c", filepath.Join(dir, "missing.json")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := execute(t, tt.args...)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, out)
+		})
+	}
+}
+
+func TestMigrateCmd_NoDatabase(t *testing.T) {
+	for _, args := range [][]string{{"migrate", "up"}, {"migrate", "down"}, {"migrate", "status"}} {
+		_, err := execute(t, args...)
+		assert.ErrorContains(t, err, "database url is not set")
+	}
+}
+
+func TestMigrateCmd_DownSteps(t *testing.T) {
+	_, err := execute(t, "migrate", "down", "--steps", "0", "-d", "postgres://localhost/metrics")
+	assert.ErrorContains(t, err, "steps must be positive")
+}
+
+func TestMigrateCmd_ForceVersion(t *testing.T) {
+	_, err := execute(t, "migrate", "force", "dirty", "-d", "postgres://localhost/metrics")
+	assert.ErrorContains(t, err, "invalid version")
+
+	_, err = execute(t, "migrate", "force")
+	assert.Error(t, err)
+}
+
+func newTestApp() *app.App {
+	interval, restore := 0, false
+	storage := memstorage.NewStorage(&serverenvconfig.Config{StoreInterval: &interval, Restore: &restore}, testhelpers.NopBackupManager{})
+	return &app.App{Server: &http.Server{Addr: "127.0.0.1:0", ReadHeaderTimeout: time.Second}, Storage: storage}
+}
+
+func TestServe(t *testing.T) {
+	application := newTestApp()
+	application.Jobs = []app.Job{{Name: "failing", Run: func(context.Context) error { return errors.New("error") }}}
+	err := serve(t.Context(), application)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failing error")
+
+	ctx, cancel := context.WithCancel(t.Context())
+	application = newTestApp()
+	application.Jobs = []app.Job{{Name: "stopped", Run: func(ctx context.Context) error {
+		cancel()
+		<-ctx.Done()
+		return ctx.Err()
+	}}}
+	assert.NoError(t, serve(ctx, application), "shutdown is not a failure")
+}
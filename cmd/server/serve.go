@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	_ "net/http/pprof"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/app"
+	"github.com/dmitastr/yp_observability_service/internal/logger"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+func newServeCmd(loadConfig configLoader) *cobra.Command {
+	return &cobra.Command{
+		Use:   "serve",
+		Short: "Start the server",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			logger.Infof("Build version: %s\n", buildVersion)
+			logger.Infof("Build data: %s\n", buildDate)
+			logger.Infof("Build commit: %s\n", buildCommit)
+
+			application, err := app.NewApp(cmd.Context(), cfg)
+			if err != nil {
+				return err
+			}
+			return serve(cmd.Context(), application)
+		},
+	}
+}
+
+// serve runs the server and background jobs until ctx is canceled or any of them fails, the failure is returned.
+// Requests are served with the context of the group, so they are canceled on shutdown as well
+func serve(ctx context.Context, application *app.App) error {
+	defer logger.Info("Received an interrupt, shutting down...")
+	server, db := application.Server, application.Storage
+
+	g, gCtx := errgroup.WithContext(ctx)
+	server.BaseContext = func(net.Listener) context.Context {
+		return gCtx
+	}
+	// Server goroutine
+	g.Go(func() error {
+		logger.Infof("Starting app on address: %s\n", server.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("app error: %w", err)
+		}
+		logger.Info("Server stopped")
+		return nil
+	})
+
+	// Background jobs, e.g. periodic backup or retention. Failure of a job stops the app
+	for _, job := range application.Jobs {
+		g.Go(func() error {
+			if err := job.Run(gCtx); err != nil {
+				return fmt.Errorf("%s error: %w", job.Name, err)
+			}
+			return nil
+		})
+	}
+
+	// Shutdown goroutine: stop accepting requests first, then drain buffered writes, save the final backup
+	// and close database
+	g.Go(func() error {
+		<-gCtx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdownErr := server.Shutdown(shutdownCtx)
+		return errors.Join(shutdownErr, db.Close())
+	})
+
+	if err := g.Wait(); err != nil && !errors.Is(err, context.Canceled) {
+		return fmt.Errorf("server stopped: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func newVersionCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "Print build version",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Fprintf(cmd.OutOrStdout(), "Build version: %s\n", buildVersion)
+			fmt.Fprintf(cmd.OutOrStdout(), "Build date: %s\n", buildDate)
+			fmt.Fprintf(cmd.OutOrStdout(), "Build commit: %s\n", buildCommit)
+		},
+	}
+}
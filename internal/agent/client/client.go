@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	crand "crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -88,6 +90,7 @@ func NewAgent(cfg config.Config) (*Agent, error) {
 	client.Backoff = func(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
 		return time.Second * time.Duration(2*attemptNum+1)
 	}
+	client.CheckRetry = checkRetry
 
 	address := *cfg.Address
 	if !strings.Contains(address, "http") {
@@ -186,7 +189,9 @@ func (agent *Agent) UpdateMetrics() error {
 	return nil
 }
 
-func (agent *Agent) Post(url string, data []byte, compressed bool) (resp *http.Response, err error) {
+// Post compresses, encrypts and signs data and sends it to url. Values from header are added to the request,
+// they are kept the same on every retry
+func (agent *Agent) Post(url string, data []byte, compressed bool, header http.Header) (resp *http.Response, err error) {
 	var postData bytes.Buffer
 	var compression string
 
@@ -223,6 +228,11 @@ func (agent *Agent) Post(url string, data []byte, compressed bool) (resp *http.R
 		req.Header.Set(common.HashHeaderKey, hashSignature)
 	}
 
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
 	req.Header.Set("Content-Encoding", compression)
 	req.Header.Set("Content-Type", "application/json")
 	resp, err = agent.Client.Do(req)
@@ -246,7 +256,7 @@ func (agent *Agent) SendMetric(key string) error {
 		return errs.ErrorWrongPath
 	}
 
-	if resp, err := agent.Post(postPath, data, true); err != nil {
+	if resp, err := agent.Post(postPath, data, true, nil); err != nil {
 		if resp != nil {
 			resp.Body.Close()
 		}
@@ -262,8 +272,15 @@ func (agent *Agent) SendMetricsBatch(metrics []model.Metric) error {
 	}
 	logger.Infof("Sending batch metrics count=%d size=%d\n", len(metrics), len(data))
 
+	idempotencyKey, err := newIdempotencyKey()
+	if err != nil {
+		return fmt.Errorf("failed to generate idempotency key: %w", err)
+	}
+	header := http.Header{}
+	header.Set(common.IdempotencyHeaderKey, idempotencyKey)
+
 	postPath := agent.address + "/updates/"
-	resp, err := agent.Post(postPath, data, true)
+	resp, err := agent.Post(postPath, data, true, header)
 	if err != nil {
 		if resp != nil {
 			resp.Body.Close()
@@ -281,6 +298,24 @@ func (agent *Agent) SendMetricsBatch(metrics []model.Metric) error {
 	return nil
 }
 
+// checkRetry retries requests like [retryablehttp.DefaultRetryPolicy] and conflicts with Retry-After,
+// they are returned for a batch whose previous attempt is still being applied by the server
+func checkRetry(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	if err == nil && resp.StatusCode == http.StatusConflict && resp.Header.Get("Retry-After") != "" {
+		return true, nil
+	}
+	return retryablehttp.DefaultRetryPolicy(ctx, resp, err)
+}
+
+// newIdempotencyKey generates random key which identifies a single batch across retries
+func newIdempotencyKey() (string, error) {
+	key := make([]byte, 16)
+	if _, err := crand.Read(key); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
+
 func (agent *Agent) toList() (metrics []model.Metric) {
 	for _, metric := range agent.Metrics {
 		metrics = append(metrics, metric)
@@ -5,7 +5,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/dmitastr/yp_observability_service/internal/common"
 	agentenvconfig "github.com/dmitastr/yp_observability_service/internal/config/env_parser/agent/agent_env_config"
 	"github.com/stretchr/testify/assert"
 )
@@ -132,3 +134,43 @@ func TestAgent_SendMetric(t *testing.T) {
 		})
 	}
 }
+
+func TestAgent_SendMetricsBatch_IdempotencyKey(t *testing.T) {
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get(common.IdempotencyHeaderKey))
+	}))
+	defer srv.Close()
+
+	cfg := agentenvconfig.New(srv.URL, 0, 0, "", 1)
+	agent, _ := NewAgent(cfg)
+	agent.UpdateMetricValueCounter("abc", 1)
+
+	assert.NoError(t, agent.SendMetricsBatch(agent.toList()))
+	assert.NoError(t, agent.SendMetricsBatch(agent.toList()))
+
+	assert.Len(t, keys, 2)
+	assert.NotEmpty(t, keys[0])
+	assert.NotEqual(t, keys[0], keys[1])
+}
+
+func TestAgent_SendMetricsBatch_RetriesInProgress(t *testing.T) {
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get(common.IdempotencyHeaderKey))
+		if len(keys) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusConflict)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := agentenvconfig.New(srv.URL, 0, 0, "", 1)
+	agent, _ := NewAgent(cfg)
+	agent.Client.Backoff = func(time.Duration, time.Duration, int, *http.Response) time.Duration { return 0 }
+	agent.UpdateMetricValueCounter("abc", 1)
+
+	assert.NoError(t, agent.SendMetricsBatch(agent.toList()))
+	assert.Len(t, keys, 2, "batch is retried while the previous attempt is in progress")
+	assert.Equal(t, keys[0], keys[1])
+}
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	serverenvconfig "github.com/dmitastr/yp_observability_service/internal/config/env_parser/server/server_env_config"
+	"github.com/dmitastr/yp_observability_service/internal/domain/audit"
+	"github.com/dmitastr/yp_observability_service/internal/domain/dump"
+	postgrespinger "github.com/dmitastr/yp_observability_service/internal/domain/pinger/postgres_pinger"
+	"github.com/dmitastr/yp_observability_service/internal/domain/service"
+)
+
+// Export writes all metrics and metadata of the backend selected by config. Metrics kept in memory
+// are read from the file backup
+func Export(ctx context.Context, cfg *serverenvconfig.Config, w io.Writer, format dump.Format) (err error) {
+	storages, observabilityService, err := openService(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, storages.Database.Close()) }()
+
+	d, err := observabilityService.Export(ctx)
+	if err != nil {
+		return err
+	}
+	return dump.Encode(w, format, d)
+}
+
+// Import reads metrics and metadata into the backend selected by config. Metrics kept in memory
+// are read from the file backup and saved back to it
+func Import(ctx context.Context, cfg *serverenvconfig.Config, r io.Reader, format dump.Format, mode service.ImportMode) (result service.ImportResult, err error) {
+	d, err := dump.Decode(r, format)
+	if err != nil {
+		return result, err
+	}
+	storages, observabilityService, err := openService(ctx, cfg)
+	if err != nil {
+		return result, err
+	}
+	defer func() { err = errors.Join(err, storages.Database.Close()) }()
+
+	return observabilityService.Import(ctx, d, mode)
+}
+
+// openService opens storages without serving requests, file backup is always restored
+func openService(ctx context.Context, cfg *serverenvconfig.Config) (*Storages, *service.Service, error) {
+	opts, err := parseOptions(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	restore := true
+	cfg.Restore = &restore
+	storages, err := OpenStorages(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	observabilityService := service.NewService(storages.Database, postgrespinger.New(), audit.NewAuditor()).
+		WithMetadataStore(storages.Metadata).
+		WithTypeConflictPolicy(opts.typeConflictPolicy)
+	return storages, observabilityService, nil
+}
@@ -2,58 +2,71 @@ package app
 
 import (
 	"context"
-	"fmt"
-	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"time"
 
 	"github.com/dmitastr/yp_observability_service/internal/domain/audit"
 	"github.com/dmitastr/yp_observability_service/internal/domain/audit/listener"
-	"github.com/dmitastr/yp_observability_service/internal/domain/pinger/postgres_pinger"
+	"github.com/dmitastr/yp_observability_service/internal/domain/live"
+	postgrespinger "github.com/dmitastr/yp_observability_service/internal/domain/pinger/postgres_pinger"
+	"github.com/dmitastr/yp_observability_service/internal/domain/rates"
+	"github.com/dmitastr/yp_observability_service/internal/presentation/middleware/adminauth"
 	"github.com/dmitastr/yp_observability_service/internal/presentation/middleware/certdecode"
 	"github.com/dmitastr/yp_observability_service/internal/presentation/middleware/hash"
 	dbinterface "github.com/dmitastr/yp_observability_service/internal/repository"
-	"github.com/dmitastr/yp_observability_service/internal/repository/filestorage"
-	db "github.com/dmitastr/yp_observability_service/internal/repository/memstorage"
-	"github.com/dmitastr/yp_observability_service/internal/repository/postgres_storage"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
-	"github.com/dmitastr/yp_observability_service/internal/config/env_parser/server/server_env_config"
+	serverenvconfig "github.com/dmitastr/yp_observability_service/internal/config/env_parser/server/server_env_config"
 	"github.com/dmitastr/yp_observability_service/internal/domain/service"
-	"github.com/dmitastr/yp_observability_service/internal/presentation/handlers/get_metric"
-	"github.com/dmitastr/yp_observability_service/internal/presentation/handlers/list_metric"
+	"github.com/dmitastr/yp_observability_service/internal/presentation/handlers/aggregate"
+	deletemetric "github.com/dmitastr/yp_observability_service/internal/presentation/handlers/delete_metric"
+	dumpmetrics "github.com/dmitastr/yp_observability_service/internal/presentation/handlers/dump_metrics"
+	exprquery "github.com/dmitastr/yp_observability_service/internal/presentation/handlers/expr_query"
+	getmetric "github.com/dmitastr/yp_observability_service/internal/presentation/handlers/get_metric"
+	listmetric "github.com/dmitastr/yp_observability_service/internal/presentation/handlers/list_metric"
+	"github.com/dmitastr/yp_observability_service/internal/presentation/handlers/metadata"
+	metricsapi "github.com/dmitastr/yp_observability_service/internal/presentation/handlers/metrics_api"
 	pingdatabase "github.com/dmitastr/yp_observability_service/internal/presentation/handlers/ping_database"
-	"github.com/dmitastr/yp_observability_service/internal/presentation/handlers/update_metric"
+	resetcounter "github.com/dmitastr/yp_observability_service/internal/presentation/handlers/reset_counter"
+	"github.com/dmitastr/yp_observability_service/internal/presentation/handlers/snapshots"
+	"github.com/dmitastr/yp_observability_service/internal/presentation/handlers/subscribe"
+	updatemetric "github.com/dmitastr/yp_observability_service/internal/presentation/handlers/update_metric"
 	updatemetricsbatch "github.com/dmitastr/yp_observability_service/internal/presentation/handlers/update_metrics_batch"
 	"github.com/dmitastr/yp_observability_service/internal/presentation/middleware/compress"
 	requestlogger "github.com/dmitastr/yp_observability_service/internal/presentation/middleware/request_logger"
+	"github.com/dmitastr/yp_observability_service/web"
 )
 
+// Job is a background work of the app, it runs until ctx is canceled
+type Job struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// App is a configured server with its storage and background jobs. Storage must be closed
+// after the server is shut down
+type App struct {
+	Server  *http.Server
+	Storage dbinterface.Database
+	Jobs    []Job
+}
+
 // NewApp creates a new app, register all handlers and middleware
 // and inject necessary dependencies
-func NewApp(ctx context.Context) (*http.Server, dbinterface.Database, error) {
-	cfg, err := serverenvconfig.New()
+func NewApp(ctx context.Context, cfg *serverenvconfig.Config) (*App, error) {
+	opts, err := parseOptions(cfg)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	var storage dbinterface.Database
-	if cfg.DBUrl == nil || *cfg.DBUrl == "" {
-		fileStorage := filestorage.New(cfg)
-		storage = db.NewStorage(cfg, fileStorage)
-	} else {
-		storage, err = postgresstorage.NewPG(ctx, cfg)
-		if err != nil {
-			return nil, storage, fmt.Errorf("error creating postgres storage: %w", err)
-		}
-	}
-
-	if err = storage.Init("file://migrations"); err != nil {
-		return nil, storage, fmt.Errorf("error initializing postgres storage: %w", err)
+	storages, err := OpenStorages(ctx, cfg)
+	if err != nil {
+		return nil, err
 	}
+	storage, snapshotRestorer := storages.Database, storages.SnapshotRestorer
 
 	router := chi.NewRouter()
 
@@ -62,12 +75,26 @@ func NewApp(ctx context.Context) (*http.Server, dbinterface.Database, error) {
 		AddListener(listener.NewListener(listener.FileListenerType, cfg.AuditFile)).
 		AddListener(listener.NewListener(listener.URLListenerType, cfg.AuditURL))
 
-	observabilityService := service.NewService(storage, pinger, auditor)
+	observabilityService := service.NewService(storage, pinger, auditor).
+		WithIdempotencyStore(storages.Idempotency).
+		WithMetadataStore(storages.Metadata).
+		WithTypeConflictPolicy(opts.typeConflictPolicy).
+		WithDerivedMetrics(opts.derivedMetrics).
+		WithHub(live.NewHub(*cfg.SubscriberBuffer)).
+		WithRates(rates.NewTracker(time.Duration(*cfg.RateWindow) * time.Second))
 
 	metricHandler := updatemetric.NewHandler(observabilityService)
 	metricBatchHandler := updatemetricsbatch.NewHandler(observabilityService)
 	getMetricHandler := getmetric.NewHandler(observabilityService)
+	deleteMetricHandler := deletemetric.NewHandler(observabilityService)
+	resetCounterHandler := resetcounter.NewHandler(observabilityService)
+	metadataHandler := metadata.NewHandler(observabilityService)
+	metricsAPIHandler := metricsapi.NewHandler(observabilityService)
+	aggregateHandler := aggregate.NewHandler(observabilityService)
+	queryHandler := exprquery.NewHandler(observabilityService)
 	listMetricsHandler := listmetric.NewHandler(observabilityService)
+	subscribeHandler := subscribe.NewHandler(observabilityService)
+	dumpHandler := dumpmetrics.NewHandler(observabilityService)
 	pingHandler := pingdatabase.New(observabilityService)
 	signedCheckHandler := hash.NewSignedChecker(cfg)
 	rsaDecodeHandler := certdecode.NewCertDecoder(*cfg.PrivateKeyPath)
@@ -86,6 +113,7 @@ func NewApp(ctx context.Context) (*http.Server, dbinterface.Database, error) {
 	router.Group(func(r chi.Router) {
 		r.Use(compress.HandleCompression)
 		r.Get(`/`, listMetricsHandler.ServeHTTP)
+		r.Handle(`/static/*`, http.FileServerFS(web.FS))
 
 		r.Route(`/update`, func(r chi.Router) {
 			r.Post(`/`, metricHandler.ServeHTTP)
@@ -105,16 +133,76 @@ func NewApp(ctx context.Context) (*http.Server, dbinterface.Database, error) {
 			r.Get(`/{mtype}/{name}`, getMetricHandler.ServeHTTP)
 		})
 
+		r.Get(`/api/metrics`, metricsAPIHandler.ServeHTTP)
+		r.Get(`/api/aggregate`, aggregateHandler.ServeHTTP)
+		r.Get(`/query`, queryHandler.ServeHTTP)
+
+		r.Route(`/meta`, func(r chi.Router) {
+			r.Get(`/`, metadataHandler.ServeHTTP)
+			r.Get(`/{name}`, metadataHandler.ServeHTTP)
+			r.Put(`/{name}`, metadataHandler.ServeHTTP)
+		})
+
 	})
+
+	// subscriptions are streamed event by event, so they are not compressed
+	router.Get(`/subscribe`, subscribeHandler.ServeHTTP)
+	// /events is kept for clients of the unfiltered stream it served before /subscribe
+	router.Get(`/events`, subscribeHandler.ServeHTTP)
+
+	// administrative endpoints change or expose the whole store, they are disabled unless admin key is set
+	if *cfg.AdminKey != "" {
+		router.Group(func(r chi.Router) {
+			r.Use(adminauth.New(*cfg.AdminKey).Handle)
+
+			r.Group(func(r chi.Router) {
+				r.Use(compress.HandleDecompression)
+				r.Delete(`/value/{mtype}/{name}`, deleteMetricHandler.ServeHTTP)
+				r.Delete(`/api/metrics`, deleteMetricHandler.ServeHTTP)
+				r.Post(`/api/counters/reset`, resetCounterHandler.ServeHTTP)
+				r.Post(`/api/counters/{name}/reset`, resetCounterHandler.ServeHTTP)
+				r.Post(`/admin/import`, dumpHandler.ServeHTTP)
+			})
+
+			r.With(compress.HandleCompression).Get(`/admin/export`, dumpHandler.ServeHTTP)
+
+			// snapshots are available only for file backend
+			if snapshotRestorer != nil {
+				snapshotsHandler := snapshots.NewHandler(snapshotRestorer)
+				r.Route(`/admin/snapshots`, func(r chi.Router) {
+					r.Get(`/`, snapshotsHandler.ServeHTTP)
+					r.Post(`/{name}`, snapshotsHandler.ServeHTTP)
+				})
+			}
+		})
+	}
+
 	server := &http.Server{
 		Addr:              *cfg.Address,
 		ReadHeaderTimeout: 5 * time.Second,
 		ReadTimeout:       5 * time.Second,
 		Handler:           router,
-		BaseContext: func(listener net.Listener) context.Context {
-			return ctx
-		},
 	}
 
-	return server, storage, nil
+	app := &App{Server: server, Storage: storage}
+	if runner, ok := storage.(dbinterface.Runner); ok {
+		app.Jobs = append(app.Jobs, Job{Name: "storage", Run: runner.Run})
+	}
+	if runner, ok := storages.Idempotency.(dbinterface.Runner); ok {
+		app.Jobs = append(app.Jobs, Job{Name: "idempotency keys purge", Run: runner.Run})
+	}
+	if *cfg.Retention > 0 {
+		retention := time.Duration(*cfg.Retention) * time.Second
+		interval := time.Duration(*cfg.RetentionCheck) * time.Second
+		app.Jobs = append(app.Jobs, Job{Name: "retention", Run: func(ctx context.Context) error {
+			return observabilityService.RunRetention(ctx, retention, interval)
+		}})
+	}
+	for i, reset := range cfg.CounterResets {
+		schedule, filter := opts.resetSchedules[i], dbinterface.Filter{Names: reset.Names, Prefix: reset.Prefix}
+		app.Jobs = append(app.Jobs, Job{Name: "counter reset", Run: func(ctx context.Context) error {
+			return observabilityService.RunCounterReset(ctx, schedule, filter)
+		}})
+	}
+	return app, nil
 }
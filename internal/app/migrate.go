@@ -0,0 +1,17 @@
+package app
+
+import (
+	"errors"
+
+	serverenvconfig "github.com/dmitastr/yp_observability_service/internal/config/env_parser/server/server_env_config"
+	postgresstorage "github.com/dmitastr/yp_observability_service/internal/repository/postgres_storage"
+)
+
+// NewMigrator creates migrator applying embedded migrations to postgres database set by config,
+// it must be closed after use
+func NewMigrator(cfg *serverenvconfig.Config) (*postgresstorage.Migrator, error) {
+	if cfg.DBUrl == nil || *cfg.DBUrl == "" {
+		return nil, errors.New("migrations are applied only to postgres, database url is not set")
+	}
+	return postgresstorage.NewMigrator(*cfg.DBUrl, "")
+}
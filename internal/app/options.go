@@ -0,0 +1,58 @@
+package app
+
+import (
+	"fmt"
+
+	serverenvconfig "github.com/dmitastr/yp_observability_service/internal/config/env_parser/server/server_env_config"
+	"github.com/dmitastr/yp_observability_service/internal/domain/service"
+)
+
+// options are service settings parsed from config
+type options struct {
+	typeConflictPolicy service.TypeConflictPolicy
+	resetSchedules     []service.DailySchedule
+	derivedMetrics     []service.DerivedMetric
+}
+
+// parseOptions parses config values which are not used as is
+func parseOptions(cfg *serverenvconfig.Config) (options, error) {
+	var opts options
+	var err error
+	if opts.typeConflictPolicy, err = service.ParseTypeConflictPolicy(*cfg.TypeConflict); err != nil {
+		return options{}, err
+	}
+	opts.resetSchedules = make([]service.DailySchedule, 0, len(cfg.CounterResets))
+	for _, reset := range cfg.CounterResets {
+		schedule, err := service.ParseDailySchedule(reset.At, reset.Location)
+		if err != nil {
+			return options{}, fmt.Errorf("error parsing counter reset schedule: %w", err)
+		}
+		opts.resetSchedules = append(opts.resetSchedules, schedule)
+	}
+	opts.derivedMetrics = make([]service.DerivedMetric, 0, len(cfg.DerivedMetrics))
+	for _, d := range cfg.DerivedMetrics {
+		derived, err := service.ParseDerivedMetric(d.Name, d.Expr)
+		if err != nil {
+			return options{}, fmt.Errorf("error parsing derived metrics: %w", err)
+		}
+		opts.derivedMetrics = append(opts.derivedMetrics, derived)
+	}
+	return opts, nil
+}
+
+// CheckConfig validates config without opening storages and returns the name of the selected backend
+func CheckConfig(cfg *serverenvconfig.Config) (string, error) {
+	if _, err := parseOptions(cfg); err != nil {
+		return "", err
+	}
+	switch {
+	case cfg.DBUrl != nil && *cfg.DBUrl != "":
+		return "postgres", nil
+	case cfg.KVPath != nil && *cfg.KVPath != "":
+		return "key-value database " + *cfg.KVPath, nil
+	case cfg.FileStoragePath != nil && *cfg.FileStoragePath != "":
+		return "memory with file backup " + *cfg.FileStoragePath, nil
+	default:
+		return "memory", nil
+	}
+}
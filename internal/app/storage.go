@@ -0,0 +1,81 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	serverenvconfig "github.com/dmitastr/yp_observability_service/internal/config/env_parser/server/server_env_config"
+	dbinterface "github.com/dmitastr/yp_observability_service/internal/repository"
+	"github.com/dmitastr/yp_observability_service/internal/repository/boltstorage"
+	"github.com/dmitastr/yp_observability_service/internal/repository/cache"
+	"github.com/dmitastr/yp_observability_service/internal/repository/filestorage"
+	db "github.com/dmitastr/yp_observability_service/internal/repository/memstorage"
+	postgresstorage "github.com/dmitastr/yp_observability_service/internal/repository/postgres_storage"
+	"github.com/dmitastr/yp_observability_service/internal/repository/writebehind"
+)
+
+// Storages are the stores of configured backend. SnapshotRestorer is nil unless metrics are kept in memory
+// with file backup
+type Storages struct {
+	Database         dbinterface.Database
+	Idempotency      dbinterface.IdempotencyStore
+	Metadata         dbinterface.MetadataStore
+	SnapshotRestorer dbinterface.SnapshotRestorer
+}
+
+// OpenStorages creates and initializes storages of the backend selected by config: postgres when database url
+// is set, then embedded key-value database, then memory with file backup
+func OpenStorages(ctx context.Context, cfg *serverenvconfig.Config) (*Storages, error) {
+	var storages Storages
+	var storage dbinterface.Database
+	idempotencyTTL := time.Duration(*cfg.IdempotencyTTL) * time.Second
+	if (cfg.DBUrl == nil || *cfg.DBUrl == "") && cfg.KVPath != nil && *cfg.KVPath != "" {
+		boltStorage := boltstorage.New(cfg)
+		storage = boltStorage
+		storages.Metadata = boltStorage
+		storages.Idempotency = db.NewIdempotencyCache(*cfg.IdempotencySize, idempotencyTTL)
+	} else if cfg.DBUrl == nil || *cfg.DBUrl == "" {
+		fileStorage := filestorage.New(cfg)
+		if err := fileStorage.Init(); err != nil {
+			return nil, err
+		}
+		memStorage := db.NewStorage(cfg, fileStorage)
+		storage = memStorage
+		storages.SnapshotRestorer = memStorage
+		metadataRegistry := db.NewMetadataRegistry(fileStorage)
+		if err := metadataRegistry.Init(); err != nil {
+			return nil, err
+		}
+		storages.Metadata = metadataRegistry
+		storages.Idempotency = db.NewIdempotencyCache(*cfg.IdempotencySize, idempotencyTTL)
+	} else {
+		pg, err := postgresstorage.NewPG(ctx, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("error creating postgres storage: %w", err)
+		}
+		storage = pg
+		storages.Idempotency = postgresstorage.NewIdempotencyStore(pg, idempotencyTTL)
+		storages.Metadata = postgresstorage.NewMetadataStore(pg)
+
+		if *cfg.CacheTTL > 0 {
+			metricsCache := cache.New(pg, time.Duration(*cfg.CacheTTL)*time.Second)
+			if *cfg.CacheNotify {
+				metricsCache.WithNotifier(postgresstorage.NewNotifier(pg))
+			}
+			storage = metricsCache
+		}
+	}
+
+	if *cfg.BufferInterval > 0 {
+		storage = writebehind.New(storage, time.Duration(*cfg.BufferInterval)*time.Second, *cfg.BufferSize)
+	}
+
+	// postgres applies embedded migrations
+	if err := storage.Init(""); err != nil {
+		return nil, fmt.Errorf("error initializing storage: %w", err)
+	}
+
+	storages.Database = storage
+	return &storages, nil
+}
@@ -2,6 +2,9 @@ package common
 
 var HashHeaderKey = "HashSHA256"
 
+// IdempotencyHeaderKey is set by agent on every batch so that server can skip replayed requests
+var IdempotencyHeaderKey = "Idempotency-Key"
+
 const (
 	GAUGE   = "gauge"
 	COUNTER = "counter"
@@ -5,6 +5,10 @@ import "net/http"
 type SenderInfo struct {
 }
 
+// IdempotencyKey is a context key for the value of [IdempotencyHeaderKey] header
+type IdempotencyKey struct {
+}
+
 // ExtractIP check header and remote address for IP value of a request
 func ExtractIP(r *http.Request) (ip string) {
 	forwarded := r.Header.Get("X-Forwarded-For")
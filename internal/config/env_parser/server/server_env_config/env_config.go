@@ -2,45 +2,97 @@ package serverenvconfig
 
 import (
 	"fmt"
-	"os"
 	"strings"
 
-	"github.com/dmitastr/yp_observability_service/internal/logger"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Address         *string `env:"ADDRESS" mapstructure:"address"`
-	StoreInterval   *int    `env:"STORE_INTERVAL" mapstructure:"store_interval"`
-	FileStoragePath *string `env:"FILE_STORAGE_PATH" mapstructure:"store_file"`
-	Restore         *bool   `env:"RESTORE" mapstructure:"restore"`
-	DBUrl           *string `env:"DATABASE_DSN" mapstructure:"database_dsn"`
-	Key             *string `env:"KEY" mapstructure:"k"`
-	AuditFile       *string `env:"AUDIT_FILE" mapstructure:"audit-file"`
-	AuditURL        *string `env:"AUDIT_URL" mapstructure:"audit-url"`
-	PrivateKeyPath  *string `env:"CRYPTO_KEY" mapstructure:"crypto-key"`
+	Address          *string `env:"ADDRESS" mapstructure:"address"`
+	StoreInterval    *int    `env:"STORE_INTERVAL" mapstructure:"store_interval"`
+	FileStoragePath  *string `env:"FILE_STORAGE_PATH" mapstructure:"store_file"`
+	Restore          *bool   `env:"RESTORE" mapstructure:"restore"`
+	DBUrl            *string `env:"DATABASE_DSN" mapstructure:"database_dsn"`
+	AutoMigrate      *bool   `env:"AUTO_MIGRATE" mapstructure:"auto_migrate"`
+	KVPath           *string `env:"KV_STORAGE_PATH" mapstructure:"kv_path"`
+	Key              *string `env:"KEY" mapstructure:"k"`
+	AuditFile        *string `env:"AUDIT_FILE" mapstructure:"audit-file"`
+	AuditURL         *string `env:"AUDIT_URL" mapstructure:"audit-url"`
+	PrivateKeyPath   *string `env:"CRYPTO_KEY" mapstructure:"crypto-key"`
+	IdempotencyTTL   *int    `env:"IDEMPOTENCY_TTL" mapstructure:"idempotency_ttl"`
+	IdempotencySize  *int    `env:"IDEMPOTENCY_CACHE_SIZE" mapstructure:"idempotency_cache_size"`
+	BufferInterval   *int    `env:"WRITE_BUFFER_INTERVAL" mapstructure:"write_buffer_interval"`
+	BufferSize       *int    `env:"WRITE_BUFFER_SIZE" mapstructure:"write_buffer_size"`
+	CacheTTL         *int    `env:"CACHE_TTL" mapstructure:"cache_ttl"`
+	CacheNotify      *bool   `env:"CACHE_NOTIFY" mapstructure:"cache_notify"`
+	SnapshotKeep     *int    `env:"SNAPSHOT_KEEP" mapstructure:"snapshot_keep"`
+	SnapshotGzip     *bool   `env:"SNAPSHOT_GZIP" mapstructure:"snapshot_gzip"`
+	RestoreSnapshot  *string `env:"RESTORE_SNAPSHOT" mapstructure:"restore_snapshot"`
+	TypeConflict     *string `env:"TYPE_CONFLICT_POLICY" mapstructure:"type_conflict_policy"`
+	Retention        *int    `env:"RETENTION" mapstructure:"retention"`
+	RetentionCheck   *int    `env:"RETENTION_CHECK_INTERVAL" mapstructure:"retention_check_interval"`
+	SubscriberBuffer *int    `env:"SUBSCRIBER_BUFFER" mapstructure:"subscriber_buffer"`
+	RateWindow       *int    `env:"RATE_WINDOW" mapstructure:"rate_window"`
+	AdminKey         *string `env:"ADMIN_KEY" mapstructure:"admin_key"`
+	// CounterResets is read only from config file
+	CounterResets []CounterReset `mapstructure:"counter_resets"`
+	// DerivedMetrics is read only from config file
+	DerivedMetrics []DerivedMetric `mapstructure:"derived_metrics"`
 }
 
-// New reads command line and env arguments, reads config file if any
-// and creates [Config] instance
-func New() (*Config, error) {
-	flagSet := pflag.NewFlagSet("observability", pflag.ExitOnError)
+// CounterReset schedules a daily reset of counters selected by names or prefix, all counters when both are empty
+type CounterReset struct {
+	// At is a time of day in 15:04 format
+	At string `mapstructure:"at"`
+	// Location is an IANA time zone name, server local time zone is used when empty
+	Location string   `mapstructure:"location"`
+	Names    []string `mapstructure:"names"`
+	Prefix   string   `mapstructure:"prefix"`
+}
+
+// DerivedMetric is a gauge computed by expression over other metrics when any of them changes
+type DerivedMetric struct {
+	Name string `mapstructure:"name"`
+	Expr string `mapstructure:"expr"`
+}
+
+// NewFlagSet creates flags of all config fields
+func NewFlagSet(name string) *pflag.FlagSet {
+	flagSet := pflag.NewFlagSet(name, pflag.ExitOnError)
 	flagSet.StringP("address", "a", "localhost:8080", "set app host and port")
 	flagSet.IntP("store_interval", "i", 300, "interval for storing data to the file in seconds, 0=stream writing")
 	flagSet.BoolP("restore", "r", false, "restore data from file")
 	flagSet.StringP("store_file", "f", "./data/data.json", "path for writing data")
 	flagSet.StringP("database_dsn", "d", "", "postgres connection url")
+	flagSet.Bool("auto_migrate", true, "apply pending postgres migrations at startup, otherwise only check the schema version")
+	flagSet.String("kv_path", "", "path to embedded key-value database, used when postgres url is not set")
 	flagSet.StringP("key", "k", "", "key for request signing")
 	flagSet.String("audit-file", "", "file path for audit logs")
 	flagSet.String("audit-url", "", "url for audit logs")
 	flagSet.String("crypto-key", "", "path to file with private key")
+	flagSet.Int("idempotency_ttl", 300, "time in seconds to remember idempotency keys of applied batches")
+	flagSet.Int("idempotency_cache_size", 10000, "max number of idempotency keys kept in memory")
+	flagSet.Int("write_buffer_interval", 0, "interval for flushing buffered updates to storage in seconds, 0=write synchronously")
+	flagSet.Int("write_buffer_size", 1000, "number of buffered metrics which triggers a flush")
+	flagSet.Int("cache_ttl", 0, "time in seconds to cache metrics read from postgres, 0=no cache")
+	flagSet.Bool("cache_notify", false, "invalidate cache of other replicas with postgres LISTEN/NOTIFY")
+	flagSet.Int("snapshot_keep", 0, "number of timestamped snapshots kept next to the storage file, 0=keep none")
+	flagSet.Bool("snapshot_gzip", false, "compress timestamped snapshots with gzip")
+	flagSet.String("restore_snapshot", "", "name of timestamped snapshot to restore at startup")
+	flagSet.String("type_conflict_policy", "reject", "handling of updates changing metric type: reject or replace")
+	flagSet.Int("retention", 0, "time in seconds after which metrics not updated are deleted, 0=keep forever")
+	flagSet.Int("retention_check_interval", 60, "interval for purging metrics exceeding retention in seconds")
+	flagSet.Int("subscriber_buffer", 64, "number of change events queued for a subscriber before it is evicted as too slow")
+	flagSet.Int("rate_window", 60, "time window in seconds for smoothing counter rates")
+	flagSet.String("admin_key", "", "key required in X-Admin-Key header by administrative endpoints, empty=endpoints disabled")
 	flagSet.StringP("config", "c", "", "path to config file")
+	return flagSet
+}
 
-	if err := flagSet.Parse(os.Args[1:]); err != nil {
-		return nil, fmt.Errorf("error parsing flags: %w", err)
-	}
-
+// FromFlags reads flagSet created by [NewFlagSet] after it is parsed, env arguments and config file if any
+// and creates [Config] instance
+func FromFlags(flagSet *pflag.FlagSet) (*Config, error) {
 	_ = viper.BindPFlags(flagSet)
 
 	viper.AutomaticEnv()
@@ -51,16 +103,33 @@ func New() (*Config, error) {
 	_ = viper.BindEnv("f", "FILE_STORAGE_PATH")
 	_ = viper.BindEnv("r", "RESTORE")
 	_ = viper.BindEnv("d", "DATABASE_DSN")
+	_ = viper.BindEnv("auto_migrate", "AUTO_MIGRATE")
+	_ = viper.BindEnv("kv_path", "KV_STORAGE_PATH")
 	_ = viper.BindEnv("k", "KEY")
 	_ = viper.BindEnv("audit-file", "AUDIT_FILE")
 	_ = viper.BindEnv("audit-url", "AUDIT_URL")
 	_ = viper.BindEnv("crypto-key", "CRYPTO_KEY")
+	_ = viper.BindEnv("idempotency_ttl", "IDEMPOTENCY_TTL")
+	_ = viper.BindEnv("idempotency_cache_size", "IDEMPOTENCY_CACHE_SIZE")
+	_ = viper.BindEnv("write_buffer_interval", "WRITE_BUFFER_INTERVAL")
+	_ = viper.BindEnv("write_buffer_size", "WRITE_BUFFER_SIZE")
+	_ = viper.BindEnv("cache_ttl", "CACHE_TTL")
+	_ = viper.BindEnv("cache_notify", "CACHE_NOTIFY")
+	_ = viper.BindEnv("snapshot_keep", "SNAPSHOT_KEEP")
+	_ = viper.BindEnv("snapshot_gzip", "SNAPSHOT_GZIP")
+	_ = viper.BindEnv("restore_snapshot", "RESTORE_SNAPSHOT")
+	_ = viper.BindEnv("type_conflict_policy", "TYPE_CONFLICT_POLICY")
+	_ = viper.BindEnv("retention", "RETENTION")
+	_ = viper.BindEnv("retention_check_interval", "RETENTION_CHECK_INTERVAL")
+	_ = viper.BindEnv("subscriber_buffer", "SUBSCRIBER_BUFFER")
+	_ = viper.BindEnv("rate_window", "RATE_WINDOW")
+	_ = viper.BindEnv("admin_key", "ADMIN_KEY")
 	_ = viper.BindEnv("config", "CONFIG")
 
 	if cfgPath := viper.GetString("config"); cfgPath != "" {
 		viper.SetConfigFile(cfgPath)
 		if err := viper.ReadInConfig(); err != nil {
-			logger.Errorf("error reading config file, %s\n", err)
+			return nil, fmt.Errorf("error reading config file: %w", err)
 		}
 	}
 
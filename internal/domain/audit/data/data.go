@@ -7,10 +7,38 @@ import (
 	"github.com/dmitastr/yp_observability_service/internal/domain/models"
 )
 
+// EventTypeConflict is sent when an update changes type of a stored metric
+const EventTypeConflict = "type_conflict"
+
+// EventDelete is sent when metrics are deleted on request or purged by retention policy
+const EventDelete = "delete"
+
+// EventCounterReset is sent when counters are reset to zero
+const EventCounterReset = "counter_reset"
+
+// CounterReset holds the value of a counter before reset
+type CounterReset struct {
+	Name     string `json:"name"`
+	Previous int64  `json:"previous_value"`
+}
+
+// TypeConflict describes an update with a type different from the stored one
+type TypeConflict struct {
+	Name     string `json:"name"`
+	Stored   string `json:"stored_type"`
+	Received string `json:"received_type"`
+}
+
 type Data struct {
-	MetricNames []string `json:"metrics"`
-	IP          string   `json:"ip_address"`
-	Timestamp   int64    `json:"ts"`
+	// Event is empty for regular updates
+	Event       string         `json:"event,omitempty"`
+	MetricNames []string       `json:"metrics"`
+	IP          string         `json:"ip_address"`
+	Timestamp   int64          `json:"ts"`
+	Conflicts   []TypeConflict `json:"type_conflicts,omitempty"`
+	Resets      []CounterReset `json:"counter_resets,omitempty"`
+	// Action tells how the event was handled
+	Action string `json:"action,omitempty"`
 }
 
 func NewData(metrics []models.Metrics, ipAddress string) *Data {
@@ -26,6 +54,57 @@ func NewData(metrics []models.Metrics, ipAddress string) *Data {
 	}
 }
 
+// NewTypeConflictData creates an event about updates which tried to change metric types
+func NewTypeConflictData(conflicts []TypeConflict, action, ipAddress string) *Data {
+	names := make([]string, 0, len(conflicts))
+	for _, c := range conflicts {
+		names = append(names, c.Name)
+	}
+
+	return &Data{
+		Event:       EventTypeConflict,
+		MetricNames: names,
+		IP:          ipAddress,
+		Timestamp:   time.Now().Unix(),
+		Conflicts:   conflicts,
+		Action:      action,
+	}
+}
+
+// NewDeleteData creates an event about deleted metrics
+func NewDeleteData(names []string, action, ipAddress string) *Data {
+	return &Data{
+		Event:       EventDelete,
+		MetricNames: names,
+		IP:          ipAddress,
+		Timestamp:   time.Now().Unix(),
+		Action:      action,
+	}
+}
+
+// NewCounterResetData creates an event about reset counters with their previous values
+func NewCounterResetData(previous []models.Metrics, action, ipAddress string) *Data {
+	names := make([]string, 0, len(previous))
+	resets := make([]CounterReset, 0, len(previous))
+	for _, m := range previous {
+		names = append(names, m.ID)
+		reset := CounterReset{Name: m.ID}
+		if m.Delta != nil {
+			reset.Previous = *m.Delta
+		}
+		resets = append(resets, reset)
+	}
+
+	return &Data{
+		Event:       EventCounterReset,
+		MetricNames: names,
+		IP:          ipAddress,
+		Timestamp:   time.Now().Unix(),
+		Resets:      resets,
+		Action:      action,
+	}
+}
+
 func (data Data) Marshal() ([]byte, error) {
 	payload, err := json.Marshal(data)
 	if err != nil {
@@ -0,0 +1,205 @@
+package dump
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+
+	"github.com/dmitastr/yp_observability_service/internal/common"
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+)
+
+// Format is an encoding of dump
+type Format string
+
+const (
+	// FormatJSON is a single object with metrics and metadata lists
+	FormatJSON Format = "json"
+	// FormatNDJSON is a line per metric or metadata, like {"metric":{...}} or {"metadata":{...}}
+	FormatNDJSON Format = "ndjson"
+	// FormatCSV is a row per metric or metadata with columns of csvHeader
+	FormatCSV Format = "csv"
+)
+
+// ParseFormat checks format name, empty name means JSON
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(name); f {
+	case "":
+		return FormatJSON, nil
+	case FormatJSON, FormatNDJSON, FormatCSV:
+		return f, nil
+	default:
+		return "", errs.InvalidArgument(fmt.Errorf("unknown format '%s', expected json, ndjson or csv", name))
+	}
+}
+
+// ContentType returns media type of encoded dump
+func (f Format) ContentType() string {
+	switch f {
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatCSV:
+		return "text/csv"
+	default:
+		return "application/json"
+	}
+}
+
+// Dump is the content of the whole store. Metadata may describe metrics which are not stored
+type Dump struct {
+	Metrics  []models.Metrics  `json:"metrics"`
+	Metadata []models.Metadata `json:"metadata"`
+}
+
+// record is a line of NDJSON dump, only one of the fields is set
+type record struct {
+	Metric   *models.Metrics  `json:"metric,omitempty"`
+	Metadata *models.Metadata `json:"metadata,omitempty"`
+}
+
+// Kinds of CSV rows
+const (
+	kindMetric   = "metric"
+	kindMetadata = "metadata"
+)
+
+// csvHeader is the first row of CSV dump. Type of metadata row is the expected metric type, value is empty
+var csvHeader = []string{"kind", "name", "type", "value", "help", "unit", "owner"}
+
+// Encode writes dump in the given format
+func Encode(w io.Writer, format Format, d Dump) error {
+	switch format {
+	case FormatNDJSON:
+		encoder := json.NewEncoder(w)
+		for i := range d.Metrics {
+			if err := encoder.Encode(record{Metric: &d.Metrics[i]}); err != nil {
+				return err
+			}
+		}
+		for i := range d.Metadata {
+			if err := encoder.Encode(record{Metadata: &d.Metadata[i]}); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		_ = writer.Write(csvHeader)
+		for _, m := range d.Metrics {
+			value, err := m.GetValueString()
+			if err != nil {
+				return fmt.Errorf("metric %s: %w", m.ID, err)
+			}
+			_ = writer.Write([]string{kindMetric, m.ID, m.MType, value, "", "", ""})
+		}
+		for _, md := range d.Metadata {
+			_ = writer.Write([]string{kindMetadata, md.Name, md.Type, "", md.Help, md.Unit, md.Owner})
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		if d.Metrics == nil {
+			d.Metrics = []models.Metrics{}
+		}
+		if d.Metadata == nil {
+			d.Metadata = []models.Metadata{}
+		}
+		return json.NewEncoder(w).Encode(d)
+	}
+}
+
+// Decode reads dump in the given format. Values are not validated, it is done on import
+func Decode(r io.Reader, format Format) (Dump, error) {
+	var d Dump
+	switch format {
+	case FormatNDJSON:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(nil, 1<<20)
+		for line := 1; scanner.Scan(); line++ {
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+			var rec record
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+				return Dump{}, errs.InvalidArgument(fmt.Errorf("line %d: %w", line, err))
+			}
+			switch {
+			case rec.Metric != nil && rec.Metadata == nil:
+				d.Metrics = append(d.Metrics, *rec.Metric)
+			case rec.Metadata != nil && rec.Metric == nil:
+				d.Metadata = append(d.Metadata, *rec.Metadata)
+			default:
+				return Dump{}, errs.InvalidArgument(fmt.Errorf("line %d: expected either metric or metadata", line))
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return Dump{}, errs.InvalidArgument(err)
+		}
+	case FormatCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = len(csvHeader)
+		header, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return d, nil
+		}
+		if err != nil {
+			return Dump{}, errs.InvalidArgument(err)
+		}
+		if !slices.Equal(header, csvHeader) {
+			return Dump{}, errs.InvalidArgument(fmt.Errorf("unexpected header %v, expected %v", header, csvHeader))
+		}
+		for {
+			row, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return Dump{}, errs.InvalidArgument(err)
+			}
+			if err := d.addRow(row); err != nil {
+				line, _ := reader.FieldPos(0)
+				return Dump{}, errs.InvalidArgument(fmt.Errorf("line %d: %w", line, err))
+			}
+		}
+	default:
+		if err := json.NewDecoder(r).Decode(&d); err != nil {
+			return Dump{}, errs.InvalidArgument(err)
+		}
+	}
+	return d, nil
+}
+
+// addRow parses CSV row
+func (d *Dump) addRow(row []string) error {
+	kind, name, mtype, value := row[0], row[1], row[2], row[3]
+	switch kind {
+	case kindMetric:
+		metric := models.Metrics{ID: name, MType: mtype}
+		switch mtype {
+		case common.GAUGE:
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("invalid gauge value '%s'", value)
+			}
+			metric.Value = &v
+		case common.COUNTER:
+			v, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid counter value '%s'", value)
+			}
+			metric.Delta = &v
+		}
+		d.Metrics = append(d.Metrics, metric)
+	case kindMetadata:
+		d.Metadata = append(d.Metadata, models.Metadata{Name: name, Type: mtype, Help: row[4], Unit: row[5], Owner: row[6]})
+	default:
+		return fmt.Errorf("unknown kind '%s', expected metric or metadata", kind)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package dump
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testDump() Dump {
+	value, delta := 0.1, int64(42)
+	return Dump{
+		Metrics: []models.Metrics{
+			{ID: "Alloc", MType: "gauge", Value: &value},
+			{ID: "PollCount", MType: "counter", Delta: &delta},
+		},
+		Metadata: []models.Metadata{
+			{Name: "Alloc", Help: "allocated, \"heap\" bytes", Unit: "bytes", Owner: "runtime", Type: "gauge"},
+			{Name: "Unknown", Help: "metadata of a metric not sent yet"},
+		},
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	for _, format := range []Format{FormatJSON, FormatNDJSON, FormatCSV} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, Encode(&buf, format, testDump()))
+			d, err := Decode(&buf, format)
+			require.NoError(t, err)
+			assert.Equal(t, testDump(), d)
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, Encode(&buf, FormatCSV, testDump()))
+	assert.Equal(t, `kind,name,type,value,help,unit,owner
+metric,Alloc,gauge,0.1,,,
+metric,PollCount,counter,42,,,
+metadata,Alloc,gauge,,"allocated, ""heap"" bytes",bytes,runtime
+metadata,Unknown,,,metadata of a metric not sent yet,,
+`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, Encode(&buf, FormatNDJSON, Dump{Metrics: testDump().Metrics[1:]}))
+	assert.Equal(t, `{"metric":{"id":"PollCount","type":"counter","delta":42}}`+"\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, Encode(&buf, FormatJSON, Dump{}))
+	assert.JSONEq(t, `{"metrics":[],"metadata":[]}`, buf.String())
+}
+
+func TestDecode_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		input  string
+		want   string
+	}{
+		{name: "json", format: FormatJSON, input: `{"metrics":`, want: "unexpected EOF"},
+		{name: "ndjson line", format: FormatNDJSON, input: "{\"metric\":{\"id\":\"a\"}}\n{", want: "line 2"},
+		{name: "ndjson empty record", format: FormatNDJSON, input: `{}`, want: "expected either metric or metadata"},
+		{name: "csv header", format: FormatCSV, input: "name,type,value,help,unit,owner,kind\n", want: "unexpected header"},
+		{name: "csv kind", format: FormatCSV, input: "kind,name,type,value,help,unit,owner\nlabel,a,,,,,\n", want: "line 2: unknown kind 'label'"},
+		{name: "csv value", format: FormatCSV, input: "kind,name,type,value,help,unit,owner\nmetric,a,counter,1.5,,,\n", want: "invalid counter value '1.5'"},
+		{name: "csv columns", format: FormatCSV, input: "kind,name,type,value,help,unit,owner\nmetric,a\n", want: "wrong number of fields"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode(strings.NewReader(tt.input), tt.format)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+			assert.Equal(t, errs.KindInvalidArgument, errs.KindOf(err))
+		})
+	}
+
+	_, err := ParseFormat("xml")
+	assert.Error(t, err)
+}
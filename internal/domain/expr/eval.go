@@ -0,0 +1,307 @@
+package expr
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/common"
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+)
+
+// PageSize is the number of metrics read from source at once
+var PageSize = 1000
+
+// Source provides metrics to expressions, it is implemented by the service
+type Source interface {
+	ListMetrics(context.Context, repository.ListQuery) ([]models.DescribedMetric, *repository.Cursor, error)
+	History(ctx context.Context, name string) ([]models.Sample, error)
+}
+
+// Series is a value of a single metric. Name is empty for values computed by aggregations
+type Series struct {
+	Name  string  `json:"name,omitempty"`
+	Value float64 `json:"value"`
+}
+
+// Result is a value of expression: a scalar held as the only unnamed element of Vector or a vector of series
+type Result struct {
+	Scalar bool
+	Vector []Series
+}
+
+// scalar makes a scalar result
+func scalar(v float64) Result {
+	return Result{Scalar: true, Vector: []Series{{Value: v}}}
+}
+
+// Evaluator computes expressions over metrics of the source at the given moment
+type Evaluator struct {
+	source Source
+	now    time.Time
+}
+
+// NewEvaluator creates evaluator computing rates up to now
+func NewEvaluator(source Source, now time.Time) *Evaluator {
+	return &Evaluator{source: source, now: now}
+}
+
+// Eval computes value of parsed expression
+func (e *Evaluator) Eval(ctx context.Context, node Node) (Result, error) {
+	switch n := node.(type) {
+	case NumberLiteral:
+		return scalar(n.Value), nil
+	case Selector:
+		return e.selectMetrics(ctx, n)
+	case Neg:
+		result, err := e.Eval(ctx, n.Expr)
+		if err != nil {
+			return Result{}, err
+		}
+		for i := range result.Vector {
+			result.Vector[i].Value = -result.Vector[i].Value
+		}
+		return result, nil
+	case BinaryExpr:
+		return e.evalBinary(ctx, n)
+	case Call:
+		return e.evalCall(ctx, n)
+	default:
+		return Result{}, fmt.Errorf("unknown expression node %T", node)
+	}
+}
+
+// Pattern returns the regexp matching names selected by glob
+func (s Selector) Pattern() *regexp.Regexp {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	for _, r := range s.Glob {
+		switch r {
+		case '*':
+			pattern.WriteString(".*")
+		case '?':
+			pattern.WriteString(".")
+		default:
+			pattern.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	pattern.WriteString("$")
+	return regexp.MustCompile(pattern.String())
+}
+
+// Selectors returns all metric selectors of expression
+func Selectors(node Node) []Selector {
+	switch n := node.(type) {
+	case Selector:
+		return []Selector{n}
+	case Neg:
+		return Selectors(n.Expr)
+	case BinaryExpr:
+		return append(Selectors(n.LHS), Selectors(n.RHS)...)
+	case Call:
+		var selectors []Selector
+		for _, arg := range n.Args {
+			selectors = append(selectors, Selectors(arg)...)
+		}
+		return selectors
+	default:
+		return nil
+	}
+}
+
+// list reads all metrics matched by selector ordered by name
+func (e *Evaluator) list(ctx context.Context, selector Selector) ([]models.Metrics, error) {
+	filter := repository.Filter{Names: []string{selector.Glob}}
+	if strings.ContainsAny(selector.Glob, "*?") {
+		filter = repository.Filter{Pattern: selector.Pattern()}
+	}
+
+	var metrics []models.Metrics
+	query := repository.ListQuery{Filter: filter, Sort: repository.SortByName, Limit: PageSize}
+	for {
+		page, next, err := e.source.ListMetrics(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range page {
+			metrics = append(metrics, m.Metrics)
+		}
+		if next == nil {
+			return metrics, nil
+		}
+		query.Cursor = next
+	}
+}
+
+// selectMetrics returns current values of metrics matched by selector
+func (e *Evaluator) selectMetrics(ctx context.Context, selector Selector) (Result, error) {
+	metrics, err := e.list(ctx, selector)
+	if err != nil {
+		return Result{}, err
+	}
+	result := Result{Vector: make([]Series, 0, len(metrics))}
+	for _, m := range metrics {
+		if v, ok := m.FloatValue(); ok {
+			result.Vector = append(result.Vector, Series{Name: m.ID, Value: v})
+		}
+	}
+	return result, nil
+}
+
+// evalBinary applies operator to scalars, to every element of a vector or to elements of vectors with
+// the same names. A vector of a single element is applied to every element of the other vector like a scalar,
+// its name is dropped
+func (e *Evaluator) evalBinary(ctx context.Context, n BinaryExpr) (Result, error) {
+	lhs, err := e.Eval(ctx, n.LHS)
+	if err != nil {
+		return Result{}, err
+	}
+	rhs, err := e.Eval(ctx, n.RHS)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if lhs.Scalar && rhs.Scalar {
+		if n.Op == '/' && rhs.Vector[0].Value == 0 {
+			return Result{}, errs.New(errs.KindInvalidArgument, "division by zero")
+		}
+		return scalar(apply(n.Op, lhs.Vector[0].Value, rhs.Vector[0].Value)), nil
+	}
+
+	result := Result{Vector: []Series{}}
+	add := func(name string, value float64) {
+		if !math.IsNaN(value) && !math.IsInf(value, 0) {
+			result.Vector = append(result.Vector, Series{Name: name, Value: value})
+		}
+	}
+	switch {
+	case lhs.Scalar || len(lhs.Vector) == 1 && len(rhs.Vector) != 1:
+		for _, s := range rhs.Vector {
+			add(s.Name, apply(n.Op, lhs.Vector[0].Value, s.Value))
+		}
+	case rhs.Scalar || len(rhs.Vector) == 1:
+		for _, s := range lhs.Vector {
+			add(s.Name, apply(n.Op, s.Value, rhs.Vector[0].Value))
+		}
+	default:
+		values := make(map[string]float64, len(rhs.Vector))
+		for _, s := range rhs.Vector {
+			values[s.Name] = s.Value
+		}
+		for _, s := range lhs.Vector {
+			if v, ok := values[s.Name]; ok {
+				add(s.Name, apply(n.Op, s.Value, v))
+			}
+		}
+	}
+	return result, nil
+}
+
+func apply(op byte, a, b float64) float64 {
+	switch op {
+	case '+':
+		return a + b
+	case '-':
+		return a - b
+	case '*':
+		return a * b
+	default:
+		return a / b
+	}
+}
+
+func (e *Evaluator) evalCall(ctx context.Context, call Call) (Result, error) {
+	if call.Func == FuncRate {
+		return e.rate(ctx, call.Args[0].(Selector))
+	}
+
+	arg, err := e.Eval(ctx, call.Args[len(call.Args)-1])
+	if err != nil {
+		return Result{}, err
+	}
+	values := arg.Vector
+	if arg.Scalar {
+		return Result{}, errs.InvalidArgument(fmt.Errorf("%s is applied to metrics, got scalar", call.Func))
+	}
+
+	if call.Func == FuncTopK {
+		k := int(call.Args[0].(NumberLiteral).Value)
+		slices.SortFunc(values, func(a, b Series) int {
+			return cmp.Or(cmp.Compare(b.Value, a.Value), cmp.Compare(a.Name, b.Name))
+		})
+		return Result{Vector: values[:min(k, len(values))]}, nil
+	}
+
+	if len(values) == 0 {
+		if call.Func == FuncSum || call.Func == FuncCount {
+			return Result{Vector: []Series{{Value: 0}}}, nil
+		}
+		return Result{Vector: []Series{}}, nil
+	}
+	var value float64
+	switch call.Func {
+	case FuncSum, FuncAvg:
+		for _, s := range values {
+			value += s.Value
+		}
+		if call.Func == FuncAvg {
+			value /= float64(len(values))
+		}
+	case FuncMin:
+		value = slices.MinFunc(values, func(a, b Series) int { return cmp.Compare(a.Value, b.Value) }).Value
+	case FuncMax:
+		value = slices.MaxFunc(values, func(a, b Series) int { return cmp.Compare(a.Value, b.Value) }).Value
+	case FuncCount:
+		value = float64(len(values))
+	}
+	return Result{Vector: []Series{{Value: value}}}, nil
+}
+
+// rate computes per second increase of counters matched by selector over the range. Counter resets
+// are detected by decreasing values. Counters with less than two samples in the range are skipped
+func (e *Evaluator) rate(ctx context.Context, selector Selector) (Result, error) {
+	metrics, err := e.list(ctx, selector)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{Vector: []Series{}}
+	for _, m := range metrics {
+		if m.MType != common.COUNTER {
+			continue
+		}
+		samples, err := e.source.History(ctx, m.ID)
+		if err != nil {
+			return Result{}, err
+		}
+		if selector.Range > 0 {
+			from := e.now.Add(-selector.Range)
+			samples = slices.DeleteFunc(samples, func(s models.Sample) bool { return s.Time.Before(from) })
+		}
+		if len(samples) < 2 {
+			continue
+		}
+
+		var increase float64
+		for i := 1; i < len(samples); i++ {
+			if samples[i].Value >= samples[i-1].Value {
+				increase += samples[i].Value - samples[i-1].Value
+			} else {
+				increase += samples[i].Value
+			}
+		}
+		seconds := samples[len(samples)-1].Time.Sub(samples[0].Time).Seconds()
+		if seconds <= 0 {
+			continue
+		}
+		result.Vector = append(result.Vector, Series{Name: m.ID, Value: increase / seconds})
+	}
+	return result, nil
+}
@@ -0,0 +1,136 @@
+package expr
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/mocks/testhelpers"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// fakeSource keeps metrics and their history in memory
+type fakeSource struct {
+	metrics []models.Metrics
+	history map[string][]models.Sample
+}
+
+func (f fakeSource) ListMetrics(_ context.Context, query repository.ListQuery) ([]models.DescribedMetric, *repository.Cursor, error) {
+	metrics := slices.DeleteFunc(slices.Clone(f.metrics), func(m models.Metrics) bool { return !query.Filter.Match(m, time.Time{}) })
+	page := repository.Paginate(metrics, query)
+	described := make([]models.DescribedMetric, 0, len(page.Metrics))
+	for _, m := range page.Metrics {
+		described = append(described, models.DescribedMetric{Metrics: m})
+	}
+	return described, page.Next, nil
+}
+
+func (f fakeSource) History(_ context.Context, name string) ([]models.Sample, error) {
+	return f.history[name], nil
+}
+
+func samples(seconds ...float64) []models.Sample {
+	var result []models.Sample
+	for i := 0; i < len(seconds); i += 2 {
+		result = append(result, models.Sample{Time: now.Add(time.Duration(seconds[i]) * time.Second), Value: seconds[i+1]})
+	}
+	return result
+}
+
+func TestEvaluator_Eval(t *testing.T) {
+	source := fakeSource{
+		metrics: []models.Metrics{
+			testhelpers.Gauge("HeapAlloc", 4),
+			testhelpers.Gauge("HeapIdle", 2),
+			testhelpers.Gauge("HeapInuse", 6),
+			testhelpers.Gauge("Sys", 10),
+			testhelpers.Counter("PollCount", 30),
+			testhelpers.Counter("Requests", 7),
+		},
+		history: map[string][]models.Sample{
+			// 10 per second
+			"PollCount": samples(-120, 0, -60, 10, -10, 20, 0, 30),
+			// reset at -20s, increase is 4 + 3
+			"Requests": samples(-40, 0, -30, 4, -20, 1, 0, 3),
+		},
+	}
+	// read metrics by pages
+	PageSize = 2
+	t.Cleanup(func() { PageSize = 1000 })
+
+	tests := []struct {
+		input  string
+		scalar bool
+		want   []Series
+	}{
+		{input: "1 + 2 * 3", scalar: true, want: []Series{{Value: 7}}},
+		{input: "Sys", want: []Series{{Name: "Sys", Value: 10}}},
+		{input: "Missing", want: []Series{}},
+		{input: `"Heap*"`, want: []Series{{Name: "HeapAlloc", Value: 4}, {Name: "HeapIdle", Value: 2}, {Name: "HeapInuse", Value: 6}}},
+		{input: `"Heap?dle"`, want: []Series{{Name: "HeapIdle", Value: 2}}},
+		{input: `-"Heap*" * 2`, want: []Series{{Name: "HeapAlloc", Value: -8}, {Name: "HeapIdle", Value: -4}, {Name: "HeapInuse", Value: -12}}},
+		{input: "HeapAlloc / Sys", want: []Series{{Name: "HeapAlloc", Value: 0.4}}},
+		{input: `"Heap*" / Sys`, want: []Series{{Name: "HeapAlloc", Value: 0.4}, {Name: "HeapIdle", Value: 0.2}, {Name: "HeapInuse", Value: 0.6}}},
+		{input: `"Heap*" - "Heap[AI]*"`, want: []Series{}},
+		{input: `"Heap*" - "*Alloc"`, want: []Series{{Name: "HeapAlloc", Value: 0}, {Name: "HeapIdle", Value: -2}, {Name: "HeapInuse", Value: 2}}},
+		{input: `"Heap*" + "*e"`, want: []Series{{Name: "HeapIdle", Value: 4}, {Name: "HeapInuse", Value: 12}}},
+		{input: `"Heap*" / 0`, want: []Series{}},
+		{input: `sum("Heap*")`, want: []Series{{Value: 12}}},
+		{input: `avg("Heap*")`, want: []Series{{Value: 4}}},
+		{input: `min("Heap*")`, want: []Series{{Value: 2}}},
+		{input: `max("Heap*") / Sys`, want: []Series{{Value: 0.6}}},
+		{input: `count("Heap*")`, want: []Series{{Value: 3}}},
+		{input: `sum("None*")`, want: []Series{{Value: 0}}},
+		{input: `avg("None*")`, want: []Series{}},
+		{input: `topk(2, "*")`, want: []Series{{Name: "PollCount", Value: 30}, {Name: "Sys", Value: 10}}},
+		{input: "rate(PollCount)", want: []Series{{Name: "PollCount", Value: 0.25}}},
+		{input: "rate(PollCount[1m]) * 60", want: []Series{{Name: "PollCount", Value: 20}}},
+		{input: `rate("*"[1m])`, want: []Series{{Name: "PollCount", Value: 1.0 / 3}, {Name: "Requests", Value: 7.0 / 40}}},
+		{input: "rate(PollCount[5s])", want: []Series{}},
+		{input: "rate(Sys)", want: []Series{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			node, err := Parse(tt.input)
+			require.NoError(t, err)
+			result, err := NewEvaluator(source, now).Eval(t.Context(), node)
+			require.NoError(t, err)
+			assert.Equal(t, tt.scalar, result.Scalar)
+			assert.InDeltaSlice(t, values(tt.want), values(result.Vector), 1e-9)
+			assert.Equal(t, names(tt.want), names(result.Vector))
+		})
+	}
+}
+
+func values(series []Series) []float64 {
+	result := make([]float64, 0, len(series))
+	for _, s := range series {
+		result = append(result, s.Value)
+	}
+	return result
+}
+
+func names(series []Series) []string {
+	result := make([]string, 0, len(series))
+	for _, s := range series {
+		result = append(result, s.Name)
+	}
+	return result
+}
+
+func TestEvaluator_EvalErrors(t *testing.T) {
+	for _, input := range []string{"1 / (2 - 2)", "sum(1)"} {
+		t.Run(input, func(t *testing.T) {
+			node, err := Parse(input)
+			require.NoError(t, err)
+			_, err = NewEvaluator(fakeSource{}, now).Eval(t.Context(), node)
+			assert.Error(t, err)
+		})
+	}
+}
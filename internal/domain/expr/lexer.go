@@ -0,0 +1,112 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	// tokenName is a function name or an exact metric name
+	tokenName
+	// tokenString is a quoted metric name glob, it may contain any characters
+	tokenString
+	tokenNumber
+	// tokenRange is a duration in square brackets
+	tokenRange
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+	// number holds the value of tokenNumber
+	number float64
+	// duration holds the value of tokenRange
+	duration time.Duration
+}
+
+// isNameChar reports that r may be a part of unquoted metric name. Wildcards are allowed only in quoted globs,
+// since * is also multiplication
+func isNameChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.:", r)
+}
+
+// lex splits expression into tokens
+func lex(input string) ([]token, error) {
+	var tokens []token
+	runes := []rune(input)
+	for pos := 0; pos < len(runes); {
+		r := runes[pos]
+		start := pos
+		switch {
+		case unicode.IsSpace(r):
+			pos++
+			continue
+		case strings.ContainsRune("+-*/", r):
+			tokens = append(tokens, token{kind: tokenOperator, text: string(r), pos: start})
+			pos++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: start})
+			pos++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: start})
+			pos++
+		case r == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", pos: start})
+			pos++
+		case r == '"':
+			pos++
+			for pos < len(runes) && runes[pos] != '"' {
+				pos++
+			}
+			if pos == len(runes) {
+				return nil, syntaxError(start, "unterminated string")
+			}
+			pos++
+			tokens = append(tokens, token{kind: tokenString, text: string(runes[start+1 : pos-1]), pos: start})
+		case r == '[':
+			end := start + 1
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, syntaxError(start, "unterminated range")
+			}
+			text := strings.TrimSpace(string(runes[start+1 : end]))
+			d, err := time.ParseDuration(text)
+			if err != nil || d <= 0 {
+				return nil, syntaxError(start, fmt.Sprintf("invalid range '%s', expected a positive duration like 5m", text))
+			}
+			tokens = append(tokens, token{kind: tokenRange, text: text, pos: start, duration: d})
+			pos = end + 1
+		case unicode.IsDigit(r):
+			for pos < len(runes) && (unicode.IsDigit(runes[pos]) || runes[pos] == '.') {
+				pos++
+			}
+			text := string(runes[start:pos])
+			value, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, syntaxError(start, fmt.Sprintf("invalid number '%s'", text))
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: text, pos: start, number: value})
+		case isNameChar(r):
+			for pos < len(runes) && isNameChar(runes[pos]) {
+				pos++
+			}
+			tokens = append(tokens, token{kind: tokenName, text: string(runes[start:pos]), pos: start})
+		default:
+			return nil, syntaxError(start, fmt.Sprintf("unexpected character '%c'", r))
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(runes)}), nil
+}
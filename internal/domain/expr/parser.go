@@ -0,0 +1,305 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+)
+
+// Node is a node of parsed expression
+type Node interface {
+	String() string
+}
+
+// NumberLiteral is a scalar constant
+type NumberLiteral struct {
+	Value float64
+}
+
+func (n NumberLiteral) String() string {
+	return strconv.FormatFloat(n.Value, 'g', -1, 64)
+}
+
+// Selector selects metrics by name glob, where * matches any characters and ? matches a single one.
+// Range limits history read by rate, zero range means all the history kept by the server
+type Selector struct {
+	Glob  string
+	Range time.Duration
+}
+
+func (s Selector) String() string {
+	text := s.Glob
+	if !isName(s.Glob) {
+		text = strconv.Quote(s.Glob)
+	}
+	if s.Range > 0 {
+		text += "[" + s.Range.String() + "]"
+	}
+	return text
+}
+
+// Neg negates the value of expression
+type Neg struct {
+	Expr Node
+}
+
+func (n Neg) String() string {
+	return "-" + n.Expr.String()
+}
+
+// BinaryExpr applies arithmetic operator to results of two expressions
+type BinaryExpr struct {
+	Op  byte
+	LHS Node
+	RHS Node
+}
+
+func (b BinaryExpr) String() string {
+	return "(" + b.LHS.String() + " " + string(b.Op) + " " + b.RHS.String() + ")"
+}
+
+// Call applies function to its arguments
+type Call struct {
+	Func string
+	Args []Node
+}
+
+func (c Call) String() string {
+	args := make([]string, 0, len(c.Args))
+	for _, arg := range c.Args {
+		args = append(args, arg.String())
+	}
+	return c.Func + "(" + strings.Join(args, ", ") + ")"
+}
+
+// Functions supported by expressions
+const (
+	FuncRate  = "rate"
+	FuncSum   = "sum"
+	FuncAvg   = "avg"
+	FuncMin   = "min"
+	FuncMax   = "max"
+	FuncCount = "count"
+	FuncTopK  = "topk"
+)
+
+// syntaxError is an error in expression text at the given position
+func syntaxError(pos int, msg string) error {
+	return errs.InvalidArgument(fmt.Errorf("syntax error at position %d: %s", pos, msg))
+}
+
+// isName reports that glob can be written without quotes
+func isName(glob string) bool {
+	if glob == "" {
+		return false
+	}
+	for i, r := range glob {
+		if !isNameChar(r) || (i == 0 && r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Parse parses expression like
+//
+//	sum("heap.*") / count("heap.*")
+//	rate(PollCount[5m]) * 60
+//	topk(3, "*Bytes")
+//
+// Operators + - * / have the usual precedence. Unquoted metric names select a single metric,
+// quoted names are globs
+func Parse(input string) (Node, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	node, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, syntaxError(t.pos, fmt.Sprintf("unexpected '%s'", t.text))
+	}
+	return node, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, unexpected(t, what)
+	}
+	return t, nil
+}
+
+// unexpected reports token found instead of the expected one
+func unexpected(t token, what string) error {
+	if t.kind == tokenEOF {
+		return syntaxError(t.pos, "unexpected end of expression, expected "+what)
+	}
+	return syntaxError(t.pos, fmt.Sprintf("unexpected '%s', expected %s", t.text, what))
+}
+
+// parseExpr parses a sum of terms
+func (p *parser) parseExpr() (Node, error) {
+	lhs, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t.kind == tokenOperator && (t.text == "+" || t.text == "-"); t = p.peek() {
+		p.next()
+		rhs, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		lhs = BinaryExpr{Op: t.text[0], LHS: lhs, RHS: rhs}
+	}
+	return lhs, nil
+}
+
+// parseTerm parses a product of unary expressions
+func (p *parser) parseTerm() (Node, error) {
+	lhs, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t.kind == tokenOperator && (t.text == "*" || t.text == "/"); t = p.peek() {
+		p.next()
+		rhs, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		lhs = BinaryExpr{Op: t.text[0], LHS: lhs, RHS: rhs}
+	}
+	return lhs, nil
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if t := p.peek(); t.kind == tokenOperator && t.text == "-" {
+		p.next()
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if n, ok := node.(NumberLiteral); ok {
+			return NumberLiteral{Value: -n.Value}, nil
+		}
+		return Neg{Expr: node}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		return NumberLiteral{Value: t.number}, nil
+	case tokenString:
+		if t.text == "" {
+			return nil, syntaxError(t.pos, "empty metric name")
+		}
+		return p.parseSelector(t)
+	case tokenName:
+		if p.peek().kind == tokenLParen {
+			return p.parseCall(t)
+		}
+		return p.parseSelector(t)
+	case tokenLParen:
+		node, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokenRParen, "')'"); err != nil {
+			return nil, err
+		}
+		return node, nil
+	default:
+		return nil, unexpected(t, "number, metric name or function")
+	}
+}
+
+// parseSelector parses metric selector, range is allowed only in rate
+func (p *parser) parseSelector(name token) (Node, error) {
+	if t := p.peek(); t.kind == tokenRange {
+		return nil, syntaxError(t.pos, "range is allowed only in rate")
+	}
+	return Selector{Glob: name.text}, nil
+}
+
+func (p *parser) parseCall(name token) (Node, error) {
+	switch name.text {
+	case FuncRate, FuncSum, FuncAvg, FuncMin, FuncMax, FuncCount, FuncTopK:
+	default:
+		return nil, syntaxError(name.pos, fmt.Sprintf("unknown function '%s'", name.text))
+	}
+	p.next() // (
+
+	call := Call{Func: name.text}
+	if name.text == FuncTopK {
+		k, err := p.expect(tokenNumber, "k")
+		if err != nil {
+			return nil, err
+		}
+		if k.number < 1 || k.number != math.Trunc(k.number) {
+			return nil, syntaxError(k.pos, "k must be a positive integer")
+		}
+		if _, err := p.expect(tokenComma, "','"); err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, NumberLiteral{Value: k.number})
+	}
+
+	if name.text == FuncRate {
+		selector, err := p.parseRateArg()
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, selector)
+	} else {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+	}
+	if _, err := p.expect(tokenRParen, "')'"); err != nil {
+		return nil, err
+	}
+	return call, nil
+}
+
+// parseRateArg parses metric selector with optional range
+func (p *parser) parseRateArg() (Selector, error) {
+	t := p.next()
+	if t.kind != tokenName && t.kind != tokenString || t.text == "" {
+		return Selector{}, unexpected(t, "metric selector")
+	}
+	selector := Selector{Glob: t.text}
+	if r := p.peek(); r.kind == tokenRange {
+		p.next()
+		selector.Range = r.duration
+	}
+	return selector, nil
+}
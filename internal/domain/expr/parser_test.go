@@ -0,0 +1,64 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "Alloc", want: "Alloc"},
+		{input: `"heap*"`, want: `"heap*"`},
+		{input: "1 + 2 * 3", want: "(1 + (2 * 3))"},
+		{input: "(1 + 2) * 3", want: "((1 + 2) * 3)"},
+		{input: "a - b - c", want: "((a - b) - c)"},
+		{input: "-Alloc / -2", want: "(-Alloc / -2)"},
+		{input: `sum("heap.*") / count("heap.*")`, want: `(sum("heap.*") / count("heap.*"))`},
+		{input: "rate(PollCount[5m]) * 60", want: "(rate(PollCount[5m0s]) * 60)"},
+		{input: `topk(3, "*Bytes")`, want: `topk(3, "*Bytes")`},
+		{input: "max(Alloc * 2 + Sys)", want: "max(((Alloc * 2) + Sys))"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			node, err := Parse(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, node.String())
+		})
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "", want: "position 0: unexpected end of expression"},
+		{input: "Alloc +", want: "position 7: unexpected end of expression"},
+		{input: "Alloc Sys", want: "position 6: unexpected 'Sys'"},
+		{input: "(Alloc", want: "position 6: unexpected end of expression, expected ')'"},
+		{input: `"heap*`, want: "position 0: unterminated string"},
+		{input: "Alloc % 2", want: "position 6: unexpected character '%'"},
+		{input: "median(Alloc)", want: "position 0: unknown function 'median'"},
+		{input: "Alloc[5m]", want: "position 5: range is allowed only in rate"},
+		{input: "sum(PollCount[5m])", want: "position 13: range is allowed only in rate"},
+		{input: "rate(PollCount[-1m])", want: "position 14: invalid range '-1m'"},
+		{input: "rate(PollCount * 2)", want: "position 15: unexpected '*', expected ')'"},
+		{input: "rate(2)", want: "position 5: unexpected '2', expected metric selector"},
+		{input: "topk(1.5, Alloc)", want: "position 5: k must be a positive integer"},
+		{input: "topk(Alloc)", want: "position 5: unexpected 'Alloc', expected k"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := Parse(tt.input)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+			assert.Equal(t, errs.KindInvalidArgument, errs.KindOf(err))
+		})
+	}
+}
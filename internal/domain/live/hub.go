@@ -0,0 +1,178 @@
+package live
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+)
+
+// HistorySize is the number of recent values kept for each metric
+var HistorySize = 60
+
+// Event is a change of metrics. Updated metrics hold their current values, not deltas.
+// Rates holds rates of updated counters when they are known
+type Event struct {
+	Time    time.Time                     `json:"time"`
+	Updated []models.Metrics              `json:"updated,omitempty"`
+	Deleted []string                      `json:"deleted,omitempty"`
+	Rates   map[string]models.CounterRate `json:"rates,omitempty"`
+}
+
+// Subscription is a stream of events selected by filter. Events is closed when the subscription context
+// is done or when the subscriber falls behind and is evicted
+type Subscription struct {
+	Events  <-chan Event
+	events  chan Event
+	filter  repository.Filter
+	evicted atomic.Bool
+}
+
+// Evicted reports that Events was closed because its buffer was full
+func (s *Subscription) Evicted() bool {
+	return s.evicted.Load()
+}
+
+// selectEvent leaves only metrics matching subscription filter. Deleted metrics are selected
+// regardless of type, since it is not known after deletion
+func (s *Subscription) selectEvent(event Event) (Event, bool) {
+	if s.filter.IsEmpty() {
+		return event, true
+	}
+	selected := Event{Time: event.Time}
+	for _, metric := range event.Updated {
+		if s.filter.Match(metric, time.Time{}) {
+			selected.Updated = append(selected.Updated, metric)
+			if rate, ok := event.Rates[metric.ID]; ok {
+				if selected.Rates == nil {
+					selected.Rates = make(map[string]models.CounterRate)
+				}
+				selected.Rates[metric.ID] = rate
+			}
+		}
+	}
+	byName := s.filter
+	byName.Type = ""
+	for _, name := range event.Deleted {
+		if byName.Match(models.Metrics{ID: name}, time.Time{}) {
+			selected.Deleted = append(selected.Deleted, name)
+		}
+	}
+	return selected, len(selected.Updated)+len(selected.Deleted) > 0
+}
+
+// series is the recent values of a metric, it is restarted when metric changes type
+type series struct {
+	mtype   string
+	samples []models.Sample
+}
+
+// Hub fans out metric changes to subscribers and keeps recent values of every changed metric.
+// Every subscriber has its own buffer, a subscriber falling behind by more events is evicted,
+// so a slow client never blocks updates
+type Hub struct {
+	mu            sync.Mutex
+	bufferSize    int
+	history       map[string]*series
+	subscriptions map[*Subscription]struct{}
+}
+
+func NewHub(bufferSize int) *Hub {
+	return &Hub{
+		bufferSize:    max(bufferSize, 1),
+		history:       make(map[string]*series),
+		subscriptions: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish records updated values and sends event to subscribers without blocking
+func (h *Hub) Publish(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, metric := range event.Updated {
+		h.record(metric, event.Time)
+	}
+	for _, name := range event.Deleted {
+		delete(h.history, name)
+	}
+
+	for s := range h.subscriptions {
+		selected, ok := s.selectEvent(event)
+		if !ok {
+			continue
+		}
+		select {
+		case s.events <- selected:
+		default:
+			s.evicted.Store(true)
+			h.unsubscribe(s)
+		}
+	}
+}
+
+func (h *Hub) record(metric models.Metrics, at time.Time) {
+	value, ok := metric.FloatValue()
+	if !ok || HistorySize <= 0 {
+		return
+	}
+	s, ok := h.history[metric.ID]
+	if !ok || s.mtype != metric.MType {
+		s = &series{mtype: metric.MType, samples: make([]models.Sample, 0, HistorySize)}
+		h.history[metric.ID] = s
+	}
+	if len(s.samples) >= HistorySize {
+		n := copy(s.samples, s.samples[len(s.samples)-HistorySize+1:])
+		s.samples = s.samples[:n]
+	}
+	s.samples = append(s.samples, models.Sample{Time: at, Value: value})
+}
+
+// Idle reports whether published events are dropped: there are no subscribers and no history is kept
+func (h *Hub) Idle() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscriptions) == 0 && HistorySize <= 0
+}
+
+// Subscribe returns a subscription to events published after the call, only metrics matching filter
+// are delivered. Empty filter selects all metrics
+func (h *Hub) Subscribe(ctx context.Context, filter repository.Filter) *Subscription {
+	events := make(chan Event, h.bufferSize)
+	s := &Subscription{Events: events, events: events, filter: filter}
+	h.mu.Lock()
+	h.subscriptions[s] = struct{}{}
+	h.mu.Unlock()
+
+	context.AfterFunc(ctx, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.unsubscribe(s)
+	})
+	return s
+}
+
+// unsubscribe closes subscription once, h.mu must be held
+func (h *Hub) unsubscribe(s *Subscription) {
+	if _, ok := h.subscriptions[s]; ok {
+		delete(h.subscriptions, s)
+		close(s.events)
+	}
+}
+
+// History returns recent values of metric from the oldest to the newest
+func (h *Hub) History(name string) []models.Sample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.history[name]
+	if !ok {
+		return nil
+	}
+	samples := make([]models.Sample, len(s.samples))
+	copy(samples, s.samples)
+	return samples
+}
@@ -0,0 +1,114 @@
+package live
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/common"
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/mocks/testhelpers"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func values(samples []models.Sample) []float64 {
+	var result []float64
+	for _, s := range samples {
+		result = append(result, s.Value)
+	}
+	return result
+}
+
+func TestHub_History(t *testing.T) {
+	defer func(size int) { HistorySize = size }(HistorySize)
+	HistorySize = 3
+
+	hub := NewHub(1)
+	now := time.Now()
+	for i := range 5 {
+		hub.Publish(Event{Time: now.Add(time.Duration(i) * time.Second), Updated: []models.Metrics{testhelpers.Gauge("load", float64(i))}})
+	}
+	history := hub.History("load")
+	assert.Equal(t, []float64{2, 3, 4}, values(history))
+	assert.Equal(t, now.Add(4*time.Second), history[2].Time)
+
+	hub.Publish(Event{Time: now, Updated: []models.Metrics{testhelpers.Counter("load", 10)}})
+	assert.Equal(t, []float64{10}, values(hub.History("load")), "type change restarts history")
+
+	hub.Publish(Event{Time: now, Deleted: []string{"load"}})
+	assert.Nil(t, hub.History("load"))
+	assert.Nil(t, hub.History("unknown"))
+}
+
+func TestHub_Idle(t *testing.T) {
+	defer func(size int) { HistorySize = size }(HistorySize)
+	HistorySize = 0
+
+	hub := NewHub(1)
+	assert.True(t, hub.Idle())
+	ctx, cancel := context.WithCancel(t.Context())
+	hub.Subscribe(ctx, repository.Filter{})
+	assert.False(t, hub.Idle())
+	cancel()
+	require.Eventually(t, hub.Idle, time.Second, 10*time.Millisecond)
+
+	HistorySize = 3
+	assert.False(t, hub.Idle(), "history is kept without subscribers")
+}
+
+func TestHub_Subscribe(t *testing.T) {
+	hub := NewHub(10)
+	ctx, cancel := context.WithCancel(t.Context())
+	subscription := hub.Subscribe(ctx, repository.Filter{})
+
+	event := Event{Time: time.Now(), Updated: []models.Metrics{testhelpers.Counter("requests", 3)}}
+	hub.Publish(event)
+	assert.Equal(t, event, <-subscription.Events)
+
+	cancel()
+	require.Eventually(t, func() bool {
+		_, ok := <-subscription.Events
+		return !ok
+	}, time.Second, 10*time.Millisecond, "channel is closed when context is done")
+	assert.False(t, subscription.Evicted())
+	hub.Publish(event)
+}
+
+func TestHub_SubscribeFilter(t *testing.T) {
+	hub := NewHub(10)
+	byName := hub.Subscribe(t.Context(), repository.Filter{Names: []string{"a", "b"}})
+	byType := hub.Subscribe(t.Context(), repository.Filter{Type: common.GAUGE, Prefix: "b"})
+
+	now := time.Now()
+	hub.Publish(Event{Time: now, Updated: []models.Metrics{testhelpers.Gauge("a", 1), testhelpers.Counter("b", 2), testhelpers.Gauge("c", 3)}})
+	hub.Publish(Event{Time: now, Updated: []models.Metrics{testhelpers.Gauge("c", 4)}})
+	hub.Publish(Event{Time: now, Deleted: []string{"b", "c"}})
+
+	assert.Equal(t, Event{Time: now, Updated: []models.Metrics{testhelpers.Gauge("a", 1), testhelpers.Counter("b", 2)}}, <-byName.Events)
+	assert.Equal(t, Event{Time: now, Deleted: []string{"b"}}, <-byName.Events, "events without selected metrics are skipped")
+	assert.Equal(t, Event{Time: now, Deleted: []string{"b"}}, <-byType.Events, "deleted metrics are selected by name only")
+	assert.Empty(t, byName.Events)
+	assert.Empty(t, byType.Events)
+}
+
+func TestHub_SlowSubscriber(t *testing.T) {
+	hub := NewHub(2)
+	slow, fast := hub.Subscribe(t.Context(), repository.Filter{}), hub.Subscribe(t.Context(), repository.Filter{})
+	for range 3 {
+		hub.Publish(Event{Deleted: []string{"a"}})
+		<-fast.Events
+	}
+
+	received := 0
+	for range slow.Events {
+		received++
+	}
+	assert.Equal(t, 2, received, "slow subscriber is evicted after its buffer is full")
+	assert.True(t, slow.Evicted())
+
+	hub.Publish(Event{Deleted: []string{"b"}})
+	assert.Equal(t, Event{Deleted: []string{"b"}}, <-fast.Events)
+	assert.False(t, fast.Evicted())
+}
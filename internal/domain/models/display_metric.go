@@ -1,10 +1,24 @@
 package models
 
+import "time"
+
 // DisplayMetric used to represent metrics on web page and store value as string
 type DisplayMetric struct {
-	Name        string
-	Type        string
-	StringValue string
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	StringValue string   `json:"value"`
+	Help        string   `json:"help,omitempty"`
+	Unit        string   `json:"unit,omitempty"`
+	Owner       string   `json:"owner,omitempty"`
+	History     []Sample `json:"history,omitempty"`
+	// Rate is set for counters with known rate
+	Rate *CounterRate `json:"rate,omitempty"`
+}
+
+// Sample is a metric value at the moment of update
+type Sample struct {
+	Time  time.Time `json:"t"`
+	Value float64   `json:"v"`
 }
 
 // ModelToDisplay converts [models.Metrics] to [models.DisplayMetric] and converts metric value to string
@@ -15,3 +29,8 @@ func ModelToDisplay(m Metrics) DisplayMetric {
 	}
 	return DisplayMetric{Name: m.ID, Type: m.MType, StringValue: val}
 }
+
+// SetMetadata adds description of the metric
+func (dm *DisplayMetric) SetMetadata(md Metadata) {
+	dm.Help, dm.Unit, dm.Owner = md.Help, md.Unit, md.Owner
+}
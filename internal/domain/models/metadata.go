@@ -0,0 +1,17 @@
+package models
+
+// Metadata describes a metric: what it means, its unit, the team owning it and the type it is expected to have
+type Metadata struct {
+	Name  string `json:"name" db:"name"`
+	Help  string `json:"help,omitempty" db:"help"`
+	Unit  string `json:"unit,omitempty" db:"unit"`
+	Owner string `json:"owner,omitempty" db:"owner"`
+	// Type is the expected metric type, empty when any type is expected
+	Type string `json:"type,omitempty" db:"mtype"`
+}
+
+// DescribedMetric is a metric with its metadata, Meta is nil when metadata was not set
+type DescribedMetric struct {
+	Metrics
+	Meta *Metadata `json:"meta,omitempty"`
+}
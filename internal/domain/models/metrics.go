@@ -60,6 +60,17 @@ func (m *Metrics) GetValueString() (val string, err error) {
 	return val, err
 }
 
+// FloatValue returns metric value of any type as float64, ok is false when the value is not set
+func (m *Metrics) FloatValue() (value float64, ok bool) {
+	switch {
+	case m.MType == common.GAUGE && m.Value != nil:
+		return *m.Value, true
+	case m.MType == common.COUNTER && m.Delta != nil:
+		return float64(*m.Delta), true
+	}
+	return 0, false
+}
+
 func (m *Metrics) String() string {
 	strVal, err := m.GetValueString()
 	if err != nil {
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// CounterRate is a per second increase of a counter. Instant is computed from the last two updates,
+// EWMA is smoothed over a time window. UpdatedAt is the moment of the last update
+type CounterRate struct {
+	Instant   float64   `json:"instant"`
+	EWMA      float64   `json:"ewma"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,88 @@
+package rates
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+)
+
+// counter is the last observed value of a counter and its rates
+type counter struct {
+	value int64
+	at    time.Time
+	rate  models.CounterRate
+	// known is set after the second observation
+	known bool
+}
+
+// Tracker computes per second rates of counters from their totals observed on updates.
+// Rates are kept in memory and are not known until a counter is updated twice after start
+type Tracker struct {
+	mu       sync.Mutex
+	window   time.Duration
+	counters map[string]*counter
+}
+
+// NewTracker creates tracker smoothing rates over window, an update after window contributes
+// 1-1/e of the difference between the new instant rate and the previous EWMA
+func NewTracker(window time.Duration) *Tracker {
+	return &Tracker{window: max(window, time.Second), counters: make(map[string]*counter)}
+}
+
+// Observe records counter total at the given moment. Totals of concurrent updates may be observed
+// out of order, so a total below the previous one is ignored within window, after window it means
+// the counter was reset and the increase is counted from zero. Observations at the same moment
+// or earlier are merged into the next one
+func (t *Tracker) Observe(name string, total int64, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c, ok := t.counters[name]
+	if !ok {
+		t.counters[name] = &counter{value: total, at: at}
+		return
+	}
+	elapsed := at.Sub(c.at)
+	if elapsed <= 0 || total < c.value && elapsed < t.window {
+		return
+	}
+
+	increase := total - c.value
+	if total < c.value {
+		increase = total
+	}
+	instant := float64(increase) / elapsed.Seconds()
+	if !c.known {
+		c.rate.EWMA = instant
+	} else {
+		alpha := 1 - math.Exp(-elapsed.Seconds()/t.window.Seconds())
+		c.rate.EWMA += alpha * (instant - c.rate.EWMA)
+	}
+	c.rate.Instant = instant
+	c.rate.UpdatedAt = at
+	c.value, c.at, c.known = total, at, true
+}
+
+// Delete forgets counters, they are deleted or are not counters anymore
+func (t *Tracker) Delete(names ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, name := range names {
+		delete(t.counters, name)
+	}
+}
+
+// Get returns rate of the counter, it is false until the counter is observed twice
+func (t *Tracker) Get(name string) (models.CounterRate, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c, ok := t.counters[name]
+	if !ok || !c.known {
+		return models.CounterRate{}, false
+	}
+	return c.rate, true
+}
@@ -0,0 +1,81 @@
+package rates
+
+import (
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracker(t *testing.T) {
+	start := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	tracker := NewTracker(time.Minute)
+
+	tracker.Observe("PollCount", 100, start)
+	_, ok := tracker.Get("PollCount")
+	assert.False(t, ok, "rate needs two observations")
+
+	tracker.Observe("PollCount", 200, start.Add(10*time.Second))
+	rate, ok := tracker.Get("PollCount")
+	require.True(t, ok)
+	assert.Equal(t, 10.0, rate.Instant)
+	assert.Equal(t, 10.0, rate.EWMA, "the first rate starts the average")
+	assert.Equal(t, start.Add(10*time.Second), rate.UpdatedAt)
+
+	// updates at the same moment are merged into the next one
+	tracker.Observe("PollCount", 250, start.Add(10*time.Second))
+	tracker.Observe("PollCount", 800, start.Add(70*time.Second))
+	rate, _ = tracker.Get("PollCount")
+	assert.Equal(t, 10.0, rate.Instant)
+	assert.Equal(t, 10.0, rate.EWMA)
+
+	// total of a concurrent update observed late is ignored
+	tracker.Observe("PollCount", 700, start.Add(71*time.Second))
+	rate, _ = tracker.Get("PollCount")
+	assert.Equal(t, 10.0, rate.Instant)
+
+	// counter was reset and then increased by 60 in a minute
+	tracker.Observe("PollCount", 60, start.Add(130*time.Second))
+	rate, _ = tracker.Get("PollCount")
+	assert.Equal(t, 1.0, rate.Instant)
+	assert.InDelta(t, 10-9*(1-math.Exp(-1)), rate.EWMA, 1e-9)
+
+	tracker.Delete("PollCount")
+	_, ok = tracker.Get("PollCount")
+	assert.False(t, ok)
+}
+
+func TestTracker_ConcurrentObservations(t *testing.T) {
+	const workers, updates = 8, 500
+	start := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	tracker := NewTracker(time.Minute)
+
+	// like the service, totals are taken from storage and observed later with their own moments,
+	// so concurrent updates are observed in any order
+	var total, clock atomic.Int64
+	var maxRate atomic.Int64
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range updates {
+				value := total.Add(1)
+				runtime.Gosched()
+				tracker.Observe("PollCount", value, start.Add(time.Duration(clock.Add(1))*time.Second))
+				if rate, ok := tracker.Get("PollCount"); ok && int64(rate.Instant) > maxRate.Load() {
+					maxRate.Store(int64(rate.Instant))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// every second the total grows by one, reordering of concurrent updates adds at most workers
+	assert.LessOrEqual(t, maxRate.Load(), int64(workers), "out of order totals must not be taken for resets")
+}
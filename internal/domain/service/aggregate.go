@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	dbinterface "github.com/dmitastr/yp_observability_service/internal/repository"
+)
+
+// DefaultTopK is the number of metrics selected by topk when k is not set
+var DefaultTopK = 10
+
+// Aggregate applies aggregate function to metrics selected by filter. Filter type defaults to the type
+// the function is applied to. The storage computes aggregation when it can, otherwise selected metrics
+// are read and aggregated by the service
+func (service Service) Aggregate(ctx context.Context, query dbinterface.AggregateQuery) (dbinterface.Aggregation, error) {
+	if _, err := dbinterface.ParseAggregateFunc(string(query.Func)); err != nil {
+		return dbinterface.Aggregation{}, err
+	}
+	if !query.Filter.UpdatedBefore.IsZero() {
+		return dbinterface.Aggregation{}, errs.New(errs.KindInvalidArgument, "aggregation can not select metrics by update time")
+	}
+	if mtype := query.Func.MetricType(); mtype != "" {
+		if query.Filter.Type != "" && query.Filter.Type != mtype {
+			return dbinterface.Aggregation{}, errs.InvalidArgument(fmt.Errorf("%s is applied to %s metrics, got type %s", query.Func, mtype, query.Filter.Type))
+		}
+		query.Filter.Type = mtype
+	}
+	if query.Func == dbinterface.AggregateTopK {
+		if query.K == 0 {
+			query.K = DefaultTopK
+		}
+		if query.K < 1 || query.K > MaxListLimit {
+			return dbinterface.Aggregation{}, errs.InvalidArgument(fmt.Errorf("k must be between 1 and %d", MaxListLimit))
+		}
+	}
+
+	if aggregator, ok := service.db.(dbinterface.Aggregator); ok {
+		result, err := aggregator.Aggregate(ctx, query)
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return result, err
+		}
+	}
+
+	metrics, err := service.db.GetAll(ctx)
+	if err != nil {
+		return dbinterface.Aggregation{}, err
+	}
+	metrics = slices.DeleteFunc(metrics, func(m models.Metrics) bool { return !query.Filter.Match(m, time.Time{}) })
+	return aggregate(metrics, query), nil
+}
+
+// aggregate applies query function to selected metrics
+func aggregate(metrics []models.Metrics, query dbinterface.AggregateQuery) dbinterface.Aggregation {
+	result := dbinterface.Aggregation{Count: len(metrics)}
+	if query.Func == dbinterface.AggregateTopK {
+		slices.SortFunc(metrics, dbinterface.CompareTop)
+		result.Top = metrics[:min(query.K, len(metrics))]
+		return result
+	}
+
+	var value float64
+	switch query.Func {
+	case dbinterface.AggregateCount:
+		value = float64(len(metrics))
+	case dbinterface.AggregateSum, dbinterface.AggregateTotal, dbinterface.AggregateAvg:
+		for _, m := range metrics {
+			v, _ := m.FloatValue()
+			value += v
+		}
+		if query.Func == dbinterface.AggregateAvg {
+			if len(metrics) == 0 {
+				return result
+			}
+			value /= float64(len(metrics))
+		}
+	case dbinterface.AggregateMin, dbinterface.AggregateMax:
+		if len(metrics) == 0 {
+			return result
+		}
+		values := make([]float64, 0, len(metrics))
+		for _, m := range metrics {
+			v, _ := m.FloatValue()
+			values = append(values, v)
+		}
+		value = slices.Min(values)
+		if query.Func == dbinterface.AggregateMax {
+			value = slices.Max(values)
+		}
+	}
+	result.Value = &value
+	return result
+}
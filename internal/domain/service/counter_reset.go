@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/common"
+	"github.com/dmitastr/yp_observability_service/internal/domain/audit/data"
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/logger"
+	dbinterface "github.com/dmitastr/yp_observability_service/internal/repository"
+)
+
+// Audit actions of counter reset events
+const (
+	resetActionManual    = "manual"
+	resetActionScheduled = "scheduled"
+)
+
+// DailySchedule is a time of day in a time zone
+type DailySchedule struct {
+	hour, minute int
+	loc          *time.Location
+}
+
+// ParseDailySchedule parses time of day in 15:04 format. Empty location means server local time zone
+func ParseDailySchedule(at, location string) (DailySchedule, error) {
+	t, err := time.Parse("15:04", at)
+	if err != nil {
+		return DailySchedule{}, fmt.Errorf("invalid time of day '%s', expected HH:MM: %w", at, err)
+	}
+	loc := time.Local
+	if location != "" {
+		if loc, err = time.LoadLocation(location); err != nil {
+			return DailySchedule{}, fmt.Errorf("invalid location '%s': %w", location, err)
+		}
+	}
+	return DailySchedule{hour: t.Hour(), minute: t.Minute(), loc: loc}, nil
+}
+
+// Next returns the first scheduled moment after the given one
+func (s DailySchedule) Next(after time.Time) time.Time {
+	local := after.In(s.loc)
+	next := time.Date(local.Year(), local.Month(), local.Day(), s.hour, s.minute, 0, 0, s.loc)
+	if !next.After(local) {
+		next = time.Date(local.Year(), local.Month(), local.Day()+1, s.hour, s.minute, 0, 0, s.loc)
+	}
+	return next
+}
+
+// ResetCounter sets a single counter to zero and returns its previous value
+func (service Service) ResetCounter(ctx context.Context, name string) (int64, error) {
+	if name == "" {
+		return 0, errs.ErrorEmptyName
+	}
+	previous, err := service.ResetCounters(ctx, dbinterface.Filter{Names: []string{name}})
+	if err != nil {
+		return 0, err
+	}
+	if len(previous) == 0 || previous[0].Delta == nil {
+		return 0, fmt.Errorf("counter %s: %w", name, errs.ErrorMetricDoesNotExist)
+	}
+	return *previous[0].Delta, nil
+}
+
+// ResetCounters sets counters selected by filter to zero, empty filter selects all counters.
+// Previous values are reported to audit
+func (service Service) ResetCounters(ctx context.Context, filter dbinterface.Filter) ([]models.Metrics, error) {
+	return service.resetCounters(ctx, filter, resetActionManual)
+}
+
+func (service Service) resetCounters(ctx context.Context, filter dbinterface.Filter, action string) ([]models.Metrics, error) {
+	previous, err := service.db.ResetCounters(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(previous) == 0 {
+		return previous, nil
+	}
+
+	logger.Infof("Reset %d counters (%s)", len(previous), action)
+	service.publishReset(previous)
+	ip, _ := ctx.Value(common.SenderInfo{}).(string)
+	if err := service.auditor.Notify(data.NewCounterResetData(previous, action, ip)); err != nil {
+		logger.Error(err)
+	}
+	return previous, nil
+}
+
+// RunCounterReset resets counters selected by filter on schedule until ctx is canceled.
+// Failed resets are logged and retried at the next scheduled time
+func (service Service) RunCounterReset(ctx context.Context, schedule DailySchedule, filter dbinterface.Filter) error {
+	for {
+		timer := time.NewTimer(time.Until(schedule.Next(time.Now())))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+		if _, err := service.resetCounters(ctx, filter, resetActionScheduled); err != nil {
+			logger.Errorf("error resetting counters on schedule: %v", err)
+		}
+	}
+}
+
+// publishReset publishes reset counters with zero values. Their rates start over, the tracker would
+// take zero for a stale observation otherwise
+func (service Service) publishReset(previous []models.Metrics) {
+	reset := make([]models.Metrics, 0, len(previous))
+	for _, m := range previous {
+		var zero int64
+		reset = append(reset, models.Metrics{ID: m.ID, MType: m.MType, Delta: &zero})
+		if service.rates != nil {
+			service.rates.Delete(m.ID)
+		}
+	}
+	service.publish(reset, nil)
+}
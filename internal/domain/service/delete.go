@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/common"
+	"github.com/dmitastr/yp_observability_service/internal/domain/audit/data"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/logger"
+	dbinterface "github.com/dmitastr/yp_observability_service/internal/repository"
+)
+
+// Audit actions of deletion events
+const (
+	deleteActionDeleted = "deleted"
+	deleteActionExpired = "expired"
+)
+
+// DeleteMetric deletes a single metric of the given type
+func (service Service) DeleteMetric(ctx context.Context, mtype, name string) error {
+	if name == "" {
+		return errs.ErrorEmptyName
+	}
+	if mtype != common.GAUGE && mtype != common.COUNTER {
+		return fmt.Errorf("metric %s has type '%s': %w", name, mtype, errs.ErrorWrongUpdateType)
+	}
+
+	names, err := service.DeleteMetrics(ctx, dbinterface.Filter{Names: []string{name}, Type: mtype})
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("metric %s of type %s: %w", name, mtype, errs.ErrorMetricDoesNotExist)
+	}
+	return nil
+}
+
+// DeleteMetrics deletes metrics selected by filter and reports them to audit
+func (service Service) DeleteMetrics(ctx context.Context, filter dbinterface.Filter) ([]string, error) {
+	return service.delete(ctx, filter, deleteActionDeleted)
+}
+
+// PurgeStale deletes metrics which were not updated for maxAge
+func (service Service) PurgeStale(ctx context.Context, maxAge time.Duration) ([]string, error) {
+	return service.delete(ctx, dbinterface.Filter{UpdatedBefore: time.Now().Add(-maxAge)}, deleteActionExpired)
+}
+
+func (service Service) delete(ctx context.Context, filter dbinterface.Filter, action string) ([]string, error) {
+	if filter.IsEmpty() {
+		return nil, errs.ErrorEmptyFilter
+	}
+	names, err := service.db.Delete(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return names, nil
+	}
+
+	logger.Infof("Metrics %s: %v", action, names)
+	service.publish(nil, names)
+	ip, _ := ctx.Value(common.SenderInfo{}).(string)
+	if err := service.auditor.Notify(data.NewDeleteData(names, action, ip)); err != nil {
+		logger.Error(err)
+	}
+	return names, nil
+}
+
+// RunRetention purges metrics not updated for maxAge every interval until ctx is canceled.
+// Failed purges are logged and retried with the next tick
+func (service Service) RunRetention(ctx context.Context, maxAge, interval time.Duration) error {
+	if maxAge <= 0 || interval <= 0 {
+		return nil
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		if _, err := service.PurgeStale(ctx, maxAge); err != nil {
+			logger.Errorf("error purging stale metrics: %v", err)
+		}
+	}
+}
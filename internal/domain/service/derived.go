@@ -0,0 +1,136 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/common"
+	"github.com/dmitastr/yp_observability_service/internal/domain/expr"
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/logger"
+	dbinterface "github.com/dmitastr/yp_observability_service/internal/repository"
+)
+
+// DerivedMetric is a gauge computed from other metrics by expression
+type DerivedMetric struct {
+	Name string
+	Expr expr.Node
+	// inputs match names of metrics the expression reads
+	inputs []*regexp.Regexp
+}
+
+// ParseDerivedMetric parses expression computing gauge name, like (TotalMemory - FreeMemory) / TotalMemory * 100.
+// The expression must read at least one metric, it is recalculated when any of them changes
+func ParseDerivedMetric(name, text string) (DerivedMetric, error) {
+	if name == "" {
+		return DerivedMetric{}, fmt.Errorf("derived metric '%s': metric name is empty", text)
+	}
+	node, err := expr.Parse(text)
+	if err != nil {
+		return DerivedMetric{}, fmt.Errorf("derived metric %s: %w", name, err)
+	}
+	selectors := expr.Selectors(node)
+	if len(selectors) == 0 {
+		return DerivedMetric{}, fmt.Errorf("derived metric %s does not read any metric", name)
+	}
+	derived := DerivedMetric{Name: name, Expr: node}
+	for _, selector := range selectors {
+		pattern := selector.Pattern()
+		if pattern.MatchString(name) {
+			return DerivedMetric{}, fmt.Errorf("derived metric %s reads itself with %s", name, selector)
+		}
+		derived.inputs = append(derived.inputs, pattern)
+	}
+	return derived, nil
+}
+
+// WithDerivedMetrics enables computing of derived metrics. They are updated in order, so a derived metric
+// may read the ones defined before it
+func (service *Service) WithDerivedMetrics(derived []DerivedMetric) *Service {
+	service.derived = derived
+	return service
+}
+
+// readsAny reports that derived metric reads any of the named metrics
+func (d DerivedMetric) readsAny(names []string) bool {
+	return slices.ContainsFunc(d.inputs, func(input *regexp.Regexp) bool {
+		return slices.ContainsFunc(names, input.MatchString)
+	})
+}
+
+// updateDerived recalculates derived metrics reading any of the changed metrics. A derived metric is skipped
+// when its inputs are missing, errors are logged since the changes were already applied
+func (service Service) updateDerived(ctx context.Context, changed []string) {
+	if len(service.derived) == 0 {
+		return
+	}
+
+	evaluator := expr.NewEvaluator(storageSource{service: service}, time.Now())
+	var updated []models.Metrics
+	for _, derived := range service.derived {
+		if !derived.readsAny(changed) {
+			continue
+		}
+		result, err := evaluator.Eval(ctx, derived.Expr)
+		if err != nil {
+			logger.Errorf("error computing derived metric %s: %v", derived.Name, err)
+			continue
+		}
+		if len(result.Vector) == 0 {
+			continue
+		}
+		if len(result.Vector) > 1 {
+			logger.Errorf("derived metric %s has %d values, expected a single one", derived.Name, len(result.Vector))
+			continue
+		}
+
+		value := result.Vector[0].Value
+		metric := models.Metrics{ID: derived.Name, MType: common.GAUGE, Value: &value}
+		err = service.write(ctx, []models.Metrics{metric}, func(ctx context.Context, metrics []models.Metrics) error {
+			return service.db.Update(ctx, metrics[0])
+		})
+		if err != nil {
+			logger.Errorf("error saving derived metric %s: %v", derived.Name, err)
+			continue
+		}
+		updated = append(updated, metric)
+		changed = append(changed, derived.Name)
+	}
+	service.publish(updated, nil)
+}
+
+// storageSource reads inputs of derived metrics from storage by names, or all metrics for globs. Unlike
+// [Service.ListMetrics] it neither flushes write-behind buffer nor loads metadata. All matched metrics
+// are returned in a single page
+type storageSource struct {
+	service Service
+}
+
+func (s storageSource) ListMetrics(ctx context.Context, query dbinterface.ListQuery) ([]models.DescribedMetric, *dbinterface.Cursor, error) {
+	var metrics []models.Metrics
+	var err error
+	if query.Filter.Pattern != nil {
+		metrics, err = s.service.db.GetAll(ctx)
+		metrics = slices.DeleteFunc(metrics, func(m models.Metrics) bool { return !query.Filter.Pattern.MatchString(m.ID) })
+	} else {
+		metrics, err = s.service.db.GetByID(ctx, query.Filter.Names)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	slices.SortFunc(metrics, func(a, b models.Metrics) int { return cmp.Compare(a.ID, b.ID) })
+
+	described := make([]models.DescribedMetric, 0, len(metrics))
+	for _, m := range metrics {
+		described = append(described, models.DescribedMetric{Metrics: m})
+	}
+	return described, nil, nil
+}
+
+func (s storageSource) History(ctx context.Context, name string) ([]models.Sample, error) {
+	return s.service.History(ctx, name)
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/dmitastr/yp_observability_service/internal/common"
+	"github.com/dmitastr/yp_observability_service/internal/domain/dump"
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/logger"
+	dbinterface "github.com/dmitastr/yp_observability_service/internal/repository"
+)
+
+// ImportMode defines how imported metrics are combined with the stored ones
+type ImportMode string
+
+const (
+	// ImportMerge applies imported metrics like an update: gauges are replaced, counters are added
+	// to the stored values, other metrics are kept
+	ImportMerge ImportMode = "merge"
+	// ImportReplace deletes all stored metrics before import, so counters get the imported values
+	ImportReplace ImportMode = "replace"
+)
+
+// ParseImportMode checks mode name, empty name means merge
+func ParseImportMode(name string) (ImportMode, error) {
+	switch mode := ImportMode(name); mode {
+	case "":
+		return ImportMerge, nil
+	case ImportMerge, ImportReplace:
+		return mode, nil
+	default:
+		return "", errs.InvalidArgument(fmt.Errorf("unknown import mode '%s', expected merge or replace", name))
+	}
+}
+
+// ImportResult is the number of imported metrics and metadata and the number of metrics deleted by replace
+type ImportResult struct {
+	Metrics  int `json:"metrics"`
+	Metadata int `json:"metadata"`
+	Deleted  int `json:"deleted"`
+}
+
+// Export returns all metrics and metadata ordered by name. Metadata is empty when registry is not configured
+func (service Service) Export(ctx context.Context) (dump.Dump, error) {
+	metrics, err := service.db.GetAll(ctx)
+	if err != nil {
+		return dump.Dump{}, err
+	}
+	slices.SortFunc(metrics, func(a, b models.Metrics) int { return cmp.Compare(a.ID, b.ID) })
+
+	d := dump.Dump{Metrics: metrics}
+	if service.metadata != nil {
+		if d.Metadata, err = service.metadata.ListMetadata(ctx); err != nil {
+			return dump.Dump{}, err
+		}
+		slices.SortFunc(d.Metadata, func(a, b models.Metadata) int { return cmp.Compare(a.Name, b.Name) })
+	}
+	return d, nil
+}
+
+// Import writes dumped metrics and metadata. The dump is validated before anything is written.
+// Replace mode deletes metrics only, stored metadata is replaced by the imported one of the same metric.
+// Import is not atomic, a failed one may be partially applied
+func (service Service) Import(ctx context.Context, d dump.Dump, mode ImportMode) (ImportResult, error) {
+	for _, metric := range d.Metrics {
+		if err := validate(metric); err != nil {
+			return ImportResult{}, err
+		}
+	}
+	for _, md := range d.Metadata {
+		if md.Name == "" {
+			return ImportResult{}, errs.ErrorEmptyName
+		}
+		if md.Type != "" && md.Type != common.GAUGE && md.Type != common.COUNTER {
+			return ImportResult{}, fmt.Errorf("metadata of %s has type '%s': %w", md.Name, md.Type, errs.ErrorWrongUpdateType)
+		}
+	}
+	if len(d.Metadata) > 0 && service.metadata == nil {
+		return ImportResult{}, errMetadataDisabled
+	}
+
+	var result ImportResult
+	if mode == ImportReplace {
+		deleted, err := service.deleteAll(ctx)
+		if err != nil {
+			return result, err
+		}
+		result.Deleted = deleted
+	}
+
+	if len(d.Metrics) > 0 {
+		if err := service.applyBatch(ctx, d.Metrics); err != nil {
+			return result, err
+		}
+		result.Metrics = len(d.Metrics)
+	}
+	for _, md := range d.Metadata {
+		if err := service.metadata.PutMetadata(ctx, md); err != nil {
+			return result, err
+		}
+		result.Metadata++
+	}
+	logger.Infof("Imported %d metrics and %d metadata in %s mode, %d metrics deleted", result.Metrics, result.Metadata, mode, result.Deleted)
+	return result, nil
+}
+
+// deleteAll deletes all stored metrics and returns their number
+func (service Service) deleteAll(ctx context.Context) (int, error) {
+	metrics, err := service.db.GetAll(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(metrics) == 0 {
+		return 0, nil
+	}
+	names := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		names = append(names, m.ID)
+	}
+	deleted, err := service.db.Delete(ctx, dbinterface.Filter{Names: names})
+	if err != nil {
+		return 0, err
+	}
+	service.publish(nil, deleted)
+	return len(deleted), nil
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	dbinterface "github.com/dmitastr/yp_observability_service/internal/repository"
+)
+
+// DefaultListLimit is a page size used when limit is not set, MaxListLimit is the largest allowed page size
+var (
+	DefaultListLimit = 100
+	MaxListLimit     = 1000
+)
+
+// ListMetrics returns a page of metrics with their metadata and the cursor of the next page,
+// which is nil on the last page
+func (service Service) ListMetrics(ctx context.Context, query dbinterface.ListQuery) ([]models.DescribedMetric, *dbinterface.Cursor, error) {
+	if query.Sort == "" {
+		query.Sort = dbinterface.SortByName
+	}
+	if query.Limit == 0 {
+		query.Limit = DefaultListLimit
+	}
+	if query.Limit < 0 || query.Limit > MaxListLimit {
+		return nil, nil, errs.New(errs.KindInvalidArgument, "limit is out of range")
+	}
+	if query.Cursor != nil && query.Cursor.Sort != query.Sort {
+		return nil, nil, errs.New(errs.KindInvalidArgument, "cursor belongs to a listing with another sort")
+	}
+
+	page, err := service.db.List(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var metadata map[string]models.Metadata
+	if len(page.Metrics) > 0 {
+		names := make([]string, 0, len(page.Metrics))
+		for _, m := range page.Metrics {
+			names = append(names, m.ID)
+		}
+		metadata = service.metadataByName(ctx, names)
+	}
+	metrics := make([]models.DescribedMetric, 0, len(page.Metrics))
+	for _, m := range page.Metrics {
+		described := models.DescribedMetric{Metrics: m}
+		if md, ok := metadata[m.ID]; ok {
+			described.Meta = &md
+		}
+		metrics = append(metrics, described)
+	}
+	return metrics, page.Next, nil
+}
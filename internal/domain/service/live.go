@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/common"
+	"github.com/dmitastr/yp_observability_service/internal/domain/live"
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/logger"
+	dbinterface "github.com/dmitastr/yp_observability_service/internal/repository"
+)
+
+// WithHub enables live updates: metric changes are published to hub and recent values are added to displayed metrics
+func (service *Service) WithHub(hub *live.Hub) *Service {
+	service.hub = hub
+	return service
+}
+
+// errLiveDisabled is returned when service has no hub
+var errLiveDisabled = errs.New(errs.KindUnavailable, "live updates are not configured")
+
+// Subscribe returns changes of metrics selected by filter until ctx is done or the subscriber is evicted
+// for falling behind. Empty filter selects all metrics
+func (service Service) Subscribe(ctx context.Context, filter dbinterface.Filter) (*live.Subscription, error) {
+	if service.hub == nil {
+		return nil, errLiveDisabled
+	}
+	if !filter.UpdatedBefore.IsZero() {
+		return nil, errs.New(errs.KindInvalidArgument, "subscription can not select metrics by update time")
+	}
+	return service.hub.Subscribe(ctx, filter), nil
+}
+
+// publish sends metrics with their current values and names of deleted metrics to the hub
+// and to the rate tracker
+func (service Service) publish(updated []models.Metrics, deleted []string) {
+	if service.idle() || len(updated)+len(deleted) == 0 {
+		return
+	}
+	event := live.Event{Time: time.Now(), Updated: updated, Deleted: deleted}
+	if service.rates != nil {
+		event.Rates = service.observeRates(event)
+	}
+	if service.hub != nil {
+		service.hub.Publish(event)
+	}
+}
+
+// idle reports whether nothing consumes published changes, so they are not collected
+func (service Service) idle() bool {
+	return (service.hub == nil || service.hub.Idle()) && service.rates == nil
+}
+
+// publishBatch publishes applied batch. The batch holds counter deltas, so current values of counters
+// are read back from the storage unless nothing consumes them. The last value of a metric repeated in the batch wins
+func (service Service) publishBatch(ctx context.Context, metrics []models.Metrics) {
+	if service.idle() {
+		return
+	}
+
+	latest := make(map[string]models.Metrics, len(metrics))
+	var names, counters []string
+	for _, metric := range metrics {
+		if _, ok := latest[metric.ID]; !ok {
+			names = append(names, metric.ID)
+		}
+		latest[metric.ID] = metric
+	}
+	for _, name := range names {
+		if latest[name].MType == common.COUNTER {
+			counters = append(counters, name)
+		}
+	}
+
+	if len(counters) > 0 {
+		current, err := service.db.GetByID(ctx, counters)
+		if err != nil {
+			logger.Errorf("error reading counters for live update: %v", err)
+		}
+		for _, name := range counters {
+			delete(latest, name)
+		}
+		for _, metric := range current {
+			latest[metric.ID] = metric
+		}
+	}
+
+	updated := make([]models.Metrics, 0, len(names))
+	for _, name := range names {
+		if metric, ok := latest[name]; ok {
+			updated = append(updated, metric)
+		}
+	}
+	service.publish(updated, nil)
+}
+
+// History returns recent values of metric kept for live updates, the oldest first
+func (service Service) History(_ context.Context, name string) ([]models.Sample, error) {
+	if service.hub == nil {
+		return nil, errLiveDisabled
+	}
+	return service.hub.History(name), nil
+}
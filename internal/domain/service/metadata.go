@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dmitastr/yp_observability_service/internal/common"
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/logger"
+	dbinterface "github.com/dmitastr/yp_observability_service/internal/repository"
+)
+
+// WithMetadataStore enables metadata registry, metadata is added to displayed metrics
+func (service *Service) WithMetadataStore(store dbinterface.MetadataStore) *Service {
+	service.metadata = store
+	return service
+}
+
+// errMetadataDisabled is returned when service has no metadata store
+var errMetadataDisabled = errs.New(errs.KindUnavailable, "metadata registry is not configured")
+
+// SetMetadata replaces metadata of the metric. Expected type is optional
+func (service Service) SetMetadata(ctx context.Context, md models.Metadata) error {
+	if service.metadata == nil {
+		return errMetadataDisabled
+	}
+	if md.Name == "" {
+		return errs.ErrorEmptyName
+	}
+	if md.Type != "" && md.Type != common.GAUGE && md.Type != common.COUNTER {
+		return fmt.Errorf("metadata of %s has type '%s': %w", md.Name, md.Type, errs.ErrorWrongUpdateType)
+	}
+	if err := service.metadata.PutMetadata(ctx, md); err != nil {
+		return err
+	}
+	logger.Infof("Metadata of %s updated", md.Name)
+	return nil
+}
+
+func (service Service) GetMetadata(ctx context.Context, name string) (*models.Metadata, error) {
+	if service.metadata == nil {
+		return nil, errMetadataDisabled
+	}
+	return service.metadata.GetMetadata(ctx, name)
+}
+
+func (service Service) ListMetadata(ctx context.Context) ([]models.Metadata, error) {
+	if service.metadata == nil {
+		return nil, errMetadataDisabled
+	}
+	return service.metadata.ListMetadata(ctx)
+}
+
+// checkMetadataTypes rejects updates of metrics whose metadata expects another type with [errs.ErrorMetadataTypeConflict]
+func (service Service) checkMetadataTypes(ctx context.Context, metrics []models.Metrics) error {
+	if service.metadata == nil {
+		return nil
+	}
+	names := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		names = append(names, m.ID)
+	}
+	list, err := service.metadata.GetMetadataByNames(ctx, names)
+	if err != nil {
+		return fmt.Errorf("error reading metadata: %w", err)
+	}
+
+	expected := make(map[string]string, len(list))
+	for _, md := range list {
+		expected[md.Name] = md.Type
+	}
+	for _, m := range metrics {
+		if mtype := expected[m.ID]; mtype != "" && mtype != m.MType {
+			return fmt.Errorf("metric %s is %s, metadata expects %s: %w", m.ID, m.MType, mtype, errs.ErrorMetadataTypeConflict)
+		}
+	}
+	return nil
+}
+
+// metadataByName returns metadata of metrics with given names keyed by metric name, nil names select all metadata.
+// Metrics are displayed without metadata if it can not be read
+func (service Service) metadataByName(ctx context.Context, names []string) map[string]models.Metadata {
+	if service.metadata == nil {
+		return nil
+	}
+	var list []models.Metadata
+	var err error
+	if names == nil {
+		list, err = service.metadata.ListMetadata(ctx)
+	} else {
+		list, err = service.metadata.GetMetadataByNames(ctx, names)
+	}
+	if err != nil {
+		logger.Errorf("error reading metadata: %v", err)
+		return nil
+	}
+	byName := make(map[string]models.Metadata, len(list))
+	for _, md := range list {
+		byName[md.Name] = md
+	}
+	return byName
+}
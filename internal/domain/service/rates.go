@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dmitastr/yp_observability_service/internal/common"
+	"github.com/dmitastr/yp_observability_service/internal/domain/live"
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/domain/rates"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+)
+
+// WithRates enables computing per second rates of counters
+func (service *Service) WithRates(tracker *rates.Tracker) *Service {
+	service.rates = tracker
+	return service
+}
+
+// errRateUnknown is returned for counters updated less than twice since start
+var errRateUnknown = errs.New(errs.KindNotFound, "rate is not known yet, counter must be updated twice")
+
+// CounterRate returns per second rate of the counter
+func (service Service) CounterRate(ctx context.Context, name string) (models.CounterRate, error) {
+	if service.rates == nil {
+		return models.CounterRate{}, errs.New(errs.KindUnavailable, "counter rates are not configured")
+	}
+	metric, err := service.db.Get(ctx, name)
+	if err != nil {
+		return models.CounterRate{}, err
+	}
+	if metric == nil {
+		return models.CounterRate{}, errs.ErrorMetricDoesNotExist
+	}
+	if metric.MType != common.COUNTER {
+		return models.CounterRate{}, fmt.Errorf("metric %s is %s: %w", name, metric.MType, errs.ErrorMetricDoesNotExist)
+	}
+	rate, ok := service.rates.Get(name)
+	if !ok {
+		return models.CounterRate{}, errRateUnknown
+	}
+	return rate, nil
+}
+
+// observeRates records current values of counters of the event and returns their rates.
+// Metrics which are deleted or are not counters anymore are forgotten
+func (service Service) observeRates(event live.Event) map[string]models.CounterRate {
+	service.rates.Delete(event.Deleted...)
+	var result map[string]models.CounterRate
+	for _, metric := range event.Updated {
+		if metric.MType != common.COUNTER || metric.Delta == nil {
+			service.rates.Delete(metric.ID)
+			continue
+		}
+		service.rates.Observe(metric.ID, *metric.Delta, event.Time)
+		if rate, ok := service.rates.Get(metric.ID); ok {
+			if result == nil {
+				result = make(map[string]models.CounterRate)
+			}
+			result[metric.ID] = rate
+		}
+	}
+	return result
+}
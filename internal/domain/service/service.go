@@ -2,83 +2,212 @@ package service
 
 import (
 	"context"
-	"errors"
+	"fmt"
 	"slices"
 
 	"github.com/dmitastr/yp_observability_service/internal/common"
 	"github.com/dmitastr/yp_observability_service/internal/domain/audit"
 	"github.com/dmitastr/yp_observability_service/internal/domain/audit/data"
+	"github.com/dmitastr/yp_observability_service/internal/domain/live"
 	"github.com/dmitastr/yp_observability_service/internal/domain/models"
 	"github.com/dmitastr/yp_observability_service/internal/domain/pinger"
+	"github.com/dmitastr/yp_observability_service/internal/domain/rates"
 	"github.com/dmitastr/yp_observability_service/internal/errs"
 	"github.com/dmitastr/yp_observability_service/internal/logger"
 	"github.com/dmitastr/yp_observability_service/internal/presentation/update"
 	dbinterface "github.com/dmitastr/yp_observability_service/internal/repository"
-	"github.com/jackc/pgx/v5"
 )
 
 type Service struct {
-	db      dbinterface.Database
-	pinger  pinger.Pinger
-	auditor audit.IAuditor
+	db          dbinterface.Database
+	pinger      pinger.Pinger
+	auditor     audit.IAuditor
+	idempotency dbinterface.IdempotencyStore
+	metadata    dbinterface.MetadataStore
+	hub         *live.Hub
+	rates       *rates.Tracker
+	derived     []DerivedMetric
+	// typeConflict is zero until set, it is handled as [TypeConflictReject]
+	typeConflict TypeConflictPolicy
 }
 
 func NewService(db dbinterface.Database, pinger pinger.Pinger, auditor audit.IAuditor) *Service {
-	return &Service{db: db, pinger: pinger, auditor: auditor}
+	service := &Service{db: db, pinger: pinger, auditor: auditor, typeConflict: TypeConflictReject}
+	if notifier, ok := db.(dbinterface.TypeConflictNotifier); ok {
+		notifier.OnTypeConflicts(func(ctx context.Context, conflicts []dbinterface.TypeConflict) {
+			service.reportTypeConflicts(ctx, conflicts, "dropped")
+		})
+	}
+	return service
+}
+
+// WithIdempotencyStore enables deduplication of batches sent with the same idempotency key
+func (service *Service) WithIdempotencyStore(store dbinterface.IdempotencyStore) *Service {
+	service.idempotency = store
+	return service
+}
+
+// validate checks that metric has a name, a known type and a value of that type
+func validate(metric models.Metrics) error {
+	if metric.ID == "" {
+		return errs.ErrorEmptyName
+	}
+	switch {
+	case metric.MType == common.GAUGE && metric.Value == nil, metric.MType == common.COUNTER && metric.Delta == nil:
+		return fmt.Errorf("metric %s: %w", metric.ID, errs.ErrorMissingValue)
+	case metric.MType != common.GAUGE && metric.MType != common.COUNTER:
+		return fmt.Errorf("metric %s has type '%s': %w", metric.ID, metric.MType, errs.ErrorWrongUpdateType)
+	}
+	return nil
 }
 
+// ProcessUpdate saves a single metric. Counter delta is accumulated by the storage atomically. A metric
+// whose metadata expects another type is rejected with [errs.ErrorMetadataTypeConflict]
 func (service Service) ProcessUpdate(ctx context.Context, upd update.MetricUpdate) error {
 	logger.Infof("Processing update: %s", upd)
 	metricNew := models.FromUpdate(upd)
-	metricExist, err := service.db.Get(ctx, metricNew.ID)
-	if err != nil {
+	if err := validate(metricNew); err != nil {
 		return err
 	}
-	if metricExist != nil && metricExist.Delta != nil {
-		metricNew.UpdateDelta(*metricExist.Delta)
+	if err := service.checkMetadataTypes(ctx, []models.Metrics{metricNew}); err != nil {
+		return err
+	}
+	if metricNew.MType == common.COUNTER && metricNew.Delta != nil {
+		var total int64
+		err := service.write(ctx, []models.Metrics{metricNew}, func(ctx context.Context, metrics []models.Metrics) (err error) {
+			total, err = service.db.Increment(ctx, metricNew.ID, *metricNew.Delta)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		logger.Infof("Counter %s incremented to %d", metricNew.ID, total)
+		metricNew.Delta = &total
+		service.publish([]models.Metrics{metricNew}, nil)
+		service.updateDerived(ctx, []string{metricNew.ID})
+		return nil
 	}
 
-	return service.db.Update(ctx, metricNew)
+	err := service.write(ctx, []models.Metrics{metricNew}, func(ctx context.Context, metrics []models.Metrics) error {
+		return service.db.Update(ctx, metrics[0])
+	})
+	if err != nil {
+		return err
+	}
+	service.publish([]models.Metrics{metricNew}, nil)
+	service.updateDerived(ctx, []string{metricNew.ID})
+	return nil
 }
 
+// BatchUpdate applies a list of metrics. If context holds [common.IdempotencyKey] which was already applied,
+// the batch is skipped and the original successful result is returned. A batch with the key which is still
+// being applied is rejected with [errs.ErrorRequestInProgress], it can be retried later. The whole batch is rejected
+// if metadata of any metric expects another type
 func (service Service) BatchUpdate(ctx context.Context, metrics []models.Metrics) error {
-	for i, m := range metrics {
-		if m.MType != common.COUNTER {
-			continue
+	for _, metric := range metrics {
+		if err := validate(metric); err != nil {
+			return err
 		}
+	}
+	if err := service.checkMetadataTypes(ctx, metrics); err != nil {
+		return err
+	}
 
-		mExist, err := service.db.Get(ctx, m.ID)
-		if errors.Is(err, pgx.ErrNoRows) {
-			logger.Warn("No rows returned")
-		} else if err != nil {
-			continue
-		}
+	key, _ := ctx.Value(common.IdempotencyKey{}).(string)
+	if key == "" || service.idempotency == nil {
+		return service.applyBatch(ctx, metrics)
+	}
+
+	state, err := service.idempotency.Reserve(ctx, key)
+	if err != nil {
+		return fmt.Errorf("error reserving idempotency key: %w", err)
+	}
+	switch state {
+	case dbinterface.IdempotencyDone:
+		logger.Infof("Batch with idempotency key=%s was already applied, skipping", key)
+		return nil
+	case dbinterface.IdempotencyPending:
+		return fmt.Errorf("batch with idempotency key=%s: %w", key, errs.ErrorRequestInProgress)
+	}
+
+	// a store sharing transactions with the storage completes the key atomically with the batch
+	inTx := func(ctx context.Context, fnc func(context.Context) error) error { return fnc(ctx) }
+	transactor, shared := service.idempotency.(dbinterface.Transactor)
+	if shared {
+		inTx = transactor.InTx
+	}
 
-		if mExist != nil && mExist.Delta != nil {
-			metrics[i].UpdateDelta(*mExist.Delta)
+	var written []models.Metrics
+	err = inTx(ctx, func(ctx context.Context) (err error) {
+		if written, err = service.writeBatch(ctx, metrics); err != nil {
+			return err
 		}
+		err = service.idempotency.Complete(ctx, key)
+		if err != nil && !shared {
+			// the batch is applied, a key left pending only makes retries wait until it expires
+			logger.Errorf("error completing idempotency key=%s: %v", key, err)
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		if releaseErr := service.idempotency.Release(ctx, key); releaseErr != nil {
+			logger.Errorf("error releasing idempotency key=%s: %v", key, releaseErr)
+		}
+		return err
 	}
+	service.batchApplied(ctx, written)
+	return nil
+}
 
-	if err := service.db.BulkUpdate(ctx, metrics); errors.Is(err, pgx.ErrNoRows) {
-		logger.Warn("No rows returned")
-	} else if err != nil {
-		logger.Errorf("Bulk Update Error: %v", err)
+func (service Service) applyBatch(ctx context.Context, metrics []models.Metrics) error {
+	written, err := service.writeBatch(ctx, metrics)
+	if err != nil {
 		return err
 	}
+	service.batchApplied(ctx, written)
+	return nil
+}
+
+// writeBatch writes metrics and returns the written ones, type conflict policy may drop some of them
+func (service Service) writeBatch(ctx context.Context, metrics []models.Metrics) ([]models.Metrics, error) {
+	err := service.write(ctx, metrics, func(ctx context.Context, written []models.Metrics) error {
+		metrics = written
+		return service.db.BulkUpdate(ctx, written)
+	})
+	if err != nil {
+		logger.Errorf("Bulk Update Error: %v", err)
+		return nil, err
+	}
+	return metrics, nil
+}
+
+// batchApplied publishes written metrics, updates derived ones and notifies audit
+func (service Service) batchApplied(ctx context.Context, metrics []models.Metrics) {
+	service.publishBatch(ctx, metrics)
+	if len(service.derived) > 0 {
+		names := make([]string, 0, len(metrics))
+		for _, metric := range metrics {
+			names = append(names, metric.ID)
+		}
+		service.updateDerived(ctx, names)
+	}
 
-	ip := ctx.Value(common.SenderInfo{}).(string)
+	ip, _ := ctx.Value(common.SenderInfo{}).(string)
 	auditData := data.NewData(metrics, ip)
 	if err := service.auditor.Notify(auditData); err != nil {
 		logger.Error(err)
 	}
-	return nil
 }
 
 func (service Service) GetMetric(ctx context.Context, upd update.MetricUpdate) (metric *models.Metrics, err error) {
 	metric, err = service.db.Get(ctx, upd.MetricName)
-	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+	if err != nil {
 		return nil, err
 	}
+	if metric != nil && upd.MType != "" && metric.MType != upd.MType {
+		return nil, fmt.Errorf("metric %s is %s: %w", upd.MetricName, metric.MType, errs.ErrorMetricDoesNotExist)
+	}
 
 	if metric == nil {
 		err = errs.ErrorMetricDoesNotExist
@@ -88,12 +217,22 @@ func (service Service) GetMetric(ctx context.Context, upd update.MetricUpdate) (
 
 func (service Service) GetAll(ctx context.Context) (metricLst []models.DisplayMetric, err error) {
 	metricDB, err := service.db.GetAll(ctx)
-	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+	if err != nil {
 		return nil, err
 	}
 
+	metadata := service.metadataByName(ctx, nil)
 	for _, m := range metricDB {
 		md := models.ModelToDisplay(m)
+		md.SetMetadata(metadata[m.ID])
+		if service.hub != nil {
+			md.History = service.hub.History(m.ID)
+		}
+		if service.rates != nil && m.MType == common.COUNTER {
+			if rate, ok := service.rates.Get(m.ID); ok {
+				md.Rate = &rate
+			}
+		}
 		metricLst = append(metricLst, md)
 	}
 	if len(metricLst) == 0 {
@@ -109,5 +248,5 @@ func (service Service) GetAll(ctx context.Context) (metricLst []models.DisplayMe
 }
 
 func (service Service) Ping(ctx context.Context) error {
-	return service.pinger.Ping(ctx, service.db)
+	return errs.Unavailable(service.pinger.Ping(ctx, service.db))
 }
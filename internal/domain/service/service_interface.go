@@ -3,14 +3,31 @@ package service
 import (
 	"context"
 
+	"github.com/dmitastr/yp_observability_service/internal/domain/dump"
+	"github.com/dmitastr/yp_observability_service/internal/domain/live"
 	"github.com/dmitastr/yp_observability_service/internal/domain/models"
 	"github.com/dmitastr/yp_observability_service/internal/presentation/update"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
 )
 
 type IService interface {
 	ProcessUpdate(context.Context, update.MetricUpdate) error
 	BatchUpdate(context.Context, []models.Metrics) error
 	GetMetric(context.Context, update.MetricUpdate) (*models.Metrics, error)
+	CounterRate(context.Context, string) (models.CounterRate, error)
 	GetAll(context.Context) ([]models.DisplayMetric, error)
+	ListMetrics(context.Context, repository.ListQuery) ([]models.DescribedMetric, *repository.Cursor, error)
+	Aggregate(context.Context, repository.AggregateQuery) (repository.Aggregation, error)
 	Ping(context.Context) error
+	DeleteMetric(ctx context.Context, mtype, name string) error
+	DeleteMetrics(context.Context, repository.Filter) ([]string, error)
+	ResetCounter(context.Context, string) (int64, error)
+	ResetCounters(context.Context, repository.Filter) ([]models.Metrics, error)
+	SetMetadata(context.Context, models.Metadata) error
+	GetMetadata(context.Context, string) (*models.Metadata, error)
+	ListMetadata(context.Context) ([]models.Metadata, error)
+	Export(context.Context) (dump.Dump, error)
+	Import(context.Context, dump.Dump, ImportMode) (ImportResult, error)
+	Subscribe(context.Context, repository.Filter) (*live.Subscription, error)
+	History(ctx context.Context, name string) ([]models.Sample, error)
 }
@@ -1,15 +1,33 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/common"
+	serverenvconfig "github.com/dmitastr/yp_observability_service/internal/config/env_parser/server/server_env_config"
+	"github.com/dmitastr/yp_observability_service/internal/domain/audit/data"
+	"github.com/dmitastr/yp_observability_service/internal/domain/dump"
+	"github.com/dmitastr/yp_observability_service/internal/domain/live"
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/domain/rates"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
 
 	mockaudit "github.com/dmitastr/yp_observability_service/internal/mocks/audit"
 	mockpinger "github.com/dmitastr/yp_observability_service/internal/mocks/pinger"
 	"github.com/dmitastr/yp_observability_service/internal/mocks/storage"
+	"github.com/dmitastr/yp_observability_service/internal/mocks/testhelpers"
 	"github.com/dmitastr/yp_observability_service/internal/presentation/update"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+	"github.com/dmitastr/yp_observability_service/internal/repository/boltstorage"
+	"github.com/dmitastr/yp_observability_service/internal/repository/memstorage"
+	"github.com/dmitastr/yp_observability_service/internal/repository/writebehind"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestService_ProcessUpdate(t *testing.T) {
@@ -35,17 +53,35 @@ func TestService_ProcessUpdate(t *testing.T) {
 			args:    args{mType: "gauge", mName: "abc", mValue: 10},
 			wantErr: false,
 		},
+		{
+			name:    "counter input",
+			args:    args{mType: "counter", mName: "abc", mDelta: 10},
+			wantErr: false,
+		},
+		{
+			name:    "storage error",
+			args:    args{mType: "counter", mName: "abc", mDelta: 10},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			upd := update.MetricUpdate{MetricName: tt.args.mName, MType: tt.args.mType, Value: &tt.args.mValue}
+			upd := update.MetricUpdate{MetricName: tt.args.mName, MType: tt.args.mType}
+			if tt.args.mType == "counter" {
+				upd.Delta = &tt.args.mDelta
+			} else {
+				upd.Value = &tt.args.mValue
+			}
 
 			var dbErr error
 			if tt.wantErr {
 				dbErr = errors.New("error")
 			}
-			db.EXPECT().Get(t.Context(), upd.MetricName).Return(nil, dbErr).AnyTimes()
-			db.EXPECT().Update(t.Context(), gomock.Any()).Return(dbErr).AnyTimes()
+			if upd.Delta != nil {
+				db.EXPECT().Increment(t.Context(), upd.MetricName, *upd.Delta).Return(*upd.Delta, dbErr).Times(1)
+			} else {
+				db.EXPECT().Update(t.Context(), gomock.Any()).Return(dbErr).Times(1)
+			}
 
 			observabilityService := NewService(db, pinger, auditor)
 
@@ -59,3 +95,855 @@ func TestService_ProcessUpdate(t *testing.T) {
 		})
 	}
 }
+
+func TestService_BatchUpdate_Idempotency(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	auditor := mockaudit.NewMockIAuditor(ctrl)
+	pinger := mockpinger.NewMockPinger(ctrl)
+	db := storage.NewMockDatabase(ctrl)
+
+	value := 1.5
+	metrics := []models.Metrics{{ID: "abc", MType: "gauge", Value: &value}}
+
+	db.EXPECT().BulkUpdate(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+	auditor.EXPECT().Notify(gomock.Any()).Return(nil).Times(1)
+
+	observabilityService := NewService(db, pinger, auditor).
+		WithIdempotencyStore(memstorage.NewIdempotencyCache(10, time.Minute))
+
+	ctx := context.WithValue(t.Context(), common.IdempotencyKey{}, "key")
+	assert.NoError(t, observabilityService.BatchUpdate(ctx, metrics))
+	assert.NoError(t, observabilityService.BatchUpdate(ctx, metrics), "replayed batch must succeed without update")
+}
+
+func TestService_BatchUpdate_IdempotencyRelease(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	auditor := mockaudit.NewMockIAuditor(ctrl)
+	pinger := mockpinger.NewMockPinger(ctrl)
+	db := storage.NewMockDatabase(ctrl)
+
+	value := 1.5
+	metrics := []models.Metrics{{ID: "abc", MType: "gauge", Value: &value}}
+
+	gomock.InOrder(
+		db.EXPECT().BulkUpdate(gomock.Any(), gomock.Any()).Return(errors.New("error")),
+		db.EXPECT().BulkUpdate(gomock.Any(), gomock.Any()).Return(nil),
+	)
+	auditor.EXPECT().Notify(gomock.Any()).Return(nil).Times(1)
+
+	observabilityService := NewService(db, pinger, auditor).
+		WithIdempotencyStore(memstorage.NewIdempotencyCache(10, time.Minute))
+
+	ctx := context.WithValue(t.Context(), common.IdempotencyKey{}, "key")
+	assert.Error(t, observabilityService.BatchUpdate(ctx, metrics))
+	assert.NoError(t, observabilityService.BatchUpdate(ctx, metrics), "failed batch must be applied on retry")
+}
+
+func TestService_BatchUpdate_IdempotencyInFlight(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	auditor := mockaudit.NewMockIAuditor(ctrl)
+	db := storage.NewMockDatabase(ctrl)
+
+	value := 1.5
+	metrics := []models.Metrics{{ID: "abc", MType: "gauge", Value: &value}}
+	ctx := context.WithValue(t.Context(), common.IdempotencyKey{}, "key")
+	observabilityService := NewService(db, mockpinger.NewMockPinger(ctrl), auditor).
+		WithIdempotencyStore(memstorage.NewIdempotencyCache(10, time.Minute))
+
+	// retry arrives while the first attempt is being applied
+	var retryErr error
+	gomock.InOrder(
+		db.EXPECT().BulkUpdate(gomock.Any(), gomock.Any()).DoAndReturn(func(context.Context, []models.Metrics) error {
+			retryErr = observabilityService.BatchUpdate(ctx, metrics)
+			return errors.New("error")
+		}),
+		db.EXPECT().BulkUpdate(gomock.Any(), gomock.Any()).Return(nil),
+	)
+	auditor.EXPECT().Notify(gomock.Any()).Return(nil).Times(1)
+
+	assert.Error(t, observabilityService.BatchUpdate(ctx, metrics))
+	assert.ErrorIs(t, retryErr, errs.ErrorRequestInProgress)
+	assert.Equal(t, errs.KindConflict, errs.KindOf(retryErr))
+	assert.NoError(t, observabilityService.BatchUpdate(ctx, metrics), "batch is not lost when the first attempt fails")
+}
+
+type txKey struct{}
+
+// transactionalStore is an idempotency store sharing transactions with the storage, the transaction
+// is marked in context and fails if the key is not completed in it
+type transactionalStore struct {
+	*memstorage.IdempotencyCache
+	completeErr error
+}
+
+func (s *transactionalStore) InTx(ctx context.Context, fnc func(context.Context) error) error {
+	return fnc(context.WithValue(ctx, txKey{}, true))
+}
+
+func (s *transactionalStore) Complete(ctx context.Context, key string) error {
+	if ctx.Value(txKey{}) == nil {
+		return errors.New("key is completed outside of transaction")
+	}
+	if s.completeErr != nil {
+		return s.completeErr
+	}
+	return s.IdempotencyCache.Complete(ctx, key)
+}
+
+func TestService_BatchUpdate_IdempotencyInTransaction(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	auditor := mockaudit.NewMockIAuditor(ctrl)
+	db := storage.NewMockDatabase(ctrl)
+	store := &transactionalStore{
+		IdempotencyCache: memstorage.NewIdempotencyCache(10, time.Minute),
+		completeErr:      errors.New("error"),
+	}
+
+	value := 1.5
+	metrics := []models.Metrics{{ID: "abc", MType: "gauge", Value: &value}}
+	ctx := context.WithValue(t.Context(), common.IdempotencyKey{}, "key")
+	observabilityService := NewService(db, mockpinger.NewMockPinger(ctrl), auditor).WithIdempotencyStore(store)
+
+	inTx := func(ctx context.Context, _ []models.Metrics) error {
+		assert.NotNil(t, ctx.Value(txKey{}), "batch must be written in the transaction of the key")
+		return nil
+	}
+	db.EXPECT().BulkUpdate(gomock.Any(), gomock.Any()).DoAndReturn(inTx).Times(2)
+	auditor.EXPECT().Notify(gomock.Any()).Return(nil).Times(1)
+
+	assert.Error(t, observabilityService.BatchUpdate(ctx, metrics), "batch fails with its key")
+
+	store.completeErr = nil
+	assert.NoError(t, observabilityService.BatchUpdate(ctx, metrics), "key of failed batch must be released")
+	assert.NoError(t, observabilityService.BatchUpdate(ctx, metrics), "replayed batch must succeed without update")
+}
+
+func TestService_ValidatesInput(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := storage.NewMockDatabase(ctrl)
+	observabilityService := NewService(db, mockpinger.NewMockPinger(ctrl), mockaudit.NewMockIAuditor(ctrl))
+
+	value := 1.0
+	tests := []struct {
+		name string
+		upd  update.MetricUpdate
+	}{
+		{name: "empty name", upd: update.MetricUpdate{MType: "gauge", Value: &value}},
+		{name: "missing value", upd: update.MetricUpdate{MetricName: "abc", MType: "gauge"}},
+		{name: "unknown type", upd: update.MetricUpdate{MetricName: "abc", MType: "histogram", Value: &value}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := observabilityService.ProcessUpdate(t.Context(), tt.upd)
+			assert.Equal(t, errs.KindInvalidArgument, errs.KindOf(err))
+
+			err = observabilityService.BatchUpdate(t.Context(), []models.Metrics{models.FromUpdate(tt.upd)})
+			assert.Equal(t, errs.KindInvalidArgument, errs.KindOf(err))
+		})
+	}
+}
+
+func TestService_TypeConflict(t *testing.T) {
+	delta := int64(2)
+	counterUpd := update.MetricUpdate{MetricName: "abc", MType: "counter", Delta: &delta}
+	conflict := &repository.TypeConflictError{Conflicts: []repository.TypeConflict{{Name: "abc", Stored: "gauge", Received: "counter"}}}
+
+	tests := []struct {
+		name    string
+		policy  TypeConflictPolicy
+		wantErr bool
+		action  string
+	}{
+		{name: "reject", policy: TypeConflictReject, wantErr: true, action: "rejected"},
+		{name: "replace", policy: TypeConflictReplace, wantErr: false, action: "replaced"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			db := storage.NewMockDatabase(ctrl)
+			auditor := mockaudit.NewMockIAuditor(ctrl)
+
+			auditor.EXPECT().Notify(gomock.Any()).DoAndReturn(func(d *data.Data) error {
+				assert.Equal(t, data.EventTypeConflict, d.Event)
+				assert.Equal(t, tt.action, d.Action)
+				assert.Equal(t, []data.TypeConflict{{Name: "abc", Stored: "gauge", Received: "counter"}}, d.Conflicts)
+				return nil
+			})
+			if tt.wantErr {
+				db.EXPECT().Increment(gomock.Any(), "abc", delta).Return(int64(0), conflict)
+			} else {
+				gomock.InOrder(
+					db.EXPECT().Increment(gomock.Any(), "abc", delta).Return(int64(0), conflict),
+					db.EXPECT().Delete(gomock.Any(), repository.Filter{Names: []string{"abc"}}).Return([]string{"abc"}, nil),
+					db.EXPECT().Increment(gomock.Any(), "abc", delta).Return(delta, nil),
+				)
+			}
+
+			observabilityService := NewService(db, mockpinger.NewMockPinger(ctrl), auditor).WithTypeConflictPolicy(tt.policy)
+			err := observabilityService.ProcessUpdate(t.Context(), counterUpd)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, errs.ErrorTypeConflict)
+				assert.Equal(t, errs.KindConflict, errs.KindOf(err))
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+// notifyingDatabase is a storage reporting type conflicts found after updates were accepted
+type notifyingDatabase struct {
+	*storage.MockDatabase
+	report func(context.Context, []repository.TypeConflict)
+}
+
+func (db *notifyingDatabase) OnTypeConflicts(fnc func(context.Context, []repository.TypeConflict)) {
+	db.report = fnc
+}
+
+func TestService_AuditsDroppedTypeConflicts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	db := &notifyingDatabase{MockDatabase: storage.NewMockDatabase(ctrl)}
+	auditor := mockaudit.NewMockIAuditor(ctrl)
+	NewService(db, mockpinger.NewMockPinger(ctrl), auditor)
+	require.NotNil(t, db.report)
+
+	auditor.EXPECT().Notify(gomock.Any()).DoAndReturn(func(d *data.Data) error {
+		assert.Equal(t, data.EventTypeConflict, d.Event)
+		assert.Equal(t, "dropped", d.Action)
+		assert.Equal(t, []data.TypeConflict{{Name: "Alloc", Stored: "counter", Received: "gauge"}}, d.Conflicts)
+		return nil
+	})
+	db.report(t.Context(), []repository.TypeConflict{{Name: "Alloc", Stored: "counter", Received: "gauge"}})
+}
+
+func TestService_TypeConflictReplaceRetriesAreBounded(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	db := storage.NewMockDatabase(ctrl)
+	auditor := mockaudit.NewMockIAuditor(ctrl)
+
+	value := 1.5
+	conflict := &repository.TypeConflictError{Conflicts: []repository.TypeConflict{{Name: "abc", Stored: "counter", Received: "gauge"}}}
+	db.EXPECT().Update(gomock.Any(), gomock.Any()).Return(conflict).Times(typeConflictRetries + 1)
+	db.EXPECT().Delete(gomock.Any(), gomock.Any()).Return([]string{"abc"}, nil).Times(typeConflictRetries)
+	auditor.EXPECT().Notify(gomock.Any()).DoAndReturn(func(d *data.Data) error {
+		assert.Equal(t, "rejected", d.Action, "update which was not applied must not be audited as replaced")
+		return nil
+	})
+
+	observabilityService := NewService(db, mockpinger.NewMockPinger(ctrl), auditor).WithTypeConflictPolicy(TypeConflictReplace)
+	err := observabilityService.ProcessUpdate(t.Context(), update.MetricUpdate{MetricName: "abc", MType: "gauge", Value: &value})
+	assert.ErrorIs(t, err, errs.ErrorTypeConflict)
+}
+
+func TestService_TypeConflictReplacePublishesDeletion(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	path := filepath.Join(t.TempDir(), "metrics.db")
+	db := boltstorage.New(&serverenvconfig.Config{KVPath: &path})
+	require.NoError(t, db.Init(""))
+	defer db.Close()
+	require.NoError(t, db.Update(t.Context(), testhelpers.Counter("abc", 1)))
+
+	auditor := mockaudit.NewMockIAuditor(ctrl)
+	auditor.EXPECT().Notify(gomock.Any()).Return(nil).AnyTimes()
+	observabilityService := NewService(db, mockpinger.NewMockPinger(ctrl), auditor).
+		WithTypeConflictPolicy(TypeConflictReplace).
+		WithHub(live.NewHub(10))
+	subscription, err := observabilityService.Subscribe(t.Context(), repository.Filter{})
+	require.NoError(t, err)
+
+	value := 1.5
+	require.NoError(t, observabilityService.ProcessUpdate(t.Context(), update.MetricUpdate{MetricName: "abc", MType: "gauge", Value: &value}))
+	assert.Equal(t, []string{"abc"}, (<-subscription.Events).Deleted, "replaced metric must be published as deleted first")
+	assert.Equal(t, []models.Metrics{testhelpers.Gauge("abc", value)}, (<-subscription.Events).Updated)
+}
+
+func TestService_BatchTypeConflictWithinBatch(t *testing.T) {
+	value, first, last := 1.5, int64(2), int64(3)
+	metrics := []models.Metrics{
+		{ID: "abc", MType: "counter", Delta: &first},
+		{ID: "abc", MType: "gauge", Value: &value},
+		{ID: "def", MType: "gauge", Value: &value},
+		{ID: "abc", MType: "counter", Delta: &last},
+	}
+
+	t.Run("reject", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		db := storage.NewMockDatabase(ctrl)
+		auditor := mockaudit.NewMockIAuditor(ctrl)
+
+		conflict := &repository.TypeConflictError{Conflicts: []repository.TypeConflict{{Name: "abc", Stored: "counter", Received: "gauge"}}}
+		db.EXPECT().BulkUpdate(gomock.Any(), metrics).Return(conflict)
+		auditor.EXPECT().Notify(gomock.Any()).Return(nil)
+
+		err := NewService(db, mockpinger.NewMockPinger(ctrl), auditor).BatchUpdate(t.Context(), metrics)
+		assert.ErrorIs(t, err, errs.ErrorTypeConflict)
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		db := storage.NewMockDatabase(ctrl)
+		auditor := mockaudit.NewMockIAuditor(ctrl)
+
+		db.EXPECT().BulkUpdate(gomock.Any(), metrics[2:]).Return(nil)
+		db.EXPECT().GetByID(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+		gomock.InOrder(
+			auditor.EXPECT().Notify(gomock.Any()).DoAndReturn(func(d *data.Data) error {
+				assert.Equal(t, []data.TypeConflict{{Name: "abc", Stored: "gauge", Received: "counter"}}, d.Conflicts)
+				return nil
+			}),
+			auditor.EXPECT().Notify(gomock.Any()).Return(nil),
+		)
+
+		service := NewService(db, mockpinger.NewMockPinger(ctrl), auditor).WithTypeConflictPolicy(TypeConflictReplace)
+		assert.NoError(t, service.BatchUpdate(t.Context(), metrics))
+	})
+}
+
+func TestParseTypeConflictPolicy(t *testing.T) {
+	policy, err := ParseTypeConflictPolicy("")
+	assert.NoError(t, err)
+	assert.Equal(t, TypeConflictReject, policy)
+
+	policy, err = ParseTypeConflictPolicy("replace")
+	assert.NoError(t, err)
+	assert.Equal(t, TypeConflictReplace, policy)
+
+	_, err = ParseTypeConflictPolicy("ignore")
+	assert.Error(t, err)
+}
+
+func TestService_DeleteMetric(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	db := storage.NewMockDatabase(ctrl)
+	auditor := mockaudit.NewMockIAuditor(ctrl)
+	observabilityService := NewService(db, mockpinger.NewMockPinger(ctrl), auditor)
+
+	db.EXPECT().Delete(gomock.Any(), repository.Filter{Names: []string{"abc"}, Type: "gauge"}).Return([]string{"abc"}, nil)
+	auditor.EXPECT().Notify(gomock.Any()).DoAndReturn(func(d *data.Data) error {
+		assert.Equal(t, data.EventDelete, d.Event)
+		assert.Equal(t, "deleted", d.Action)
+		assert.Equal(t, []string{"abc"}, d.MetricNames)
+		return nil
+	})
+	assert.NoError(t, observabilityService.DeleteMetric(t.Context(), "gauge", "abc"))
+
+	db.EXPECT().Delete(gomock.Any(), gomock.Any()).Return(nil, nil)
+	assert.ErrorIs(t, observabilityService.DeleteMetric(t.Context(), "gauge", "missing"), errs.ErrorMetricDoesNotExist)
+
+	assert.ErrorIs(t, observabilityService.DeleteMetric(t.Context(), "histogram", "abc"), errs.ErrorWrongUpdateType)
+	_, err := observabilityService.DeleteMetrics(t.Context(), repository.Filter{})
+	assert.ErrorIs(t, err, errs.ErrorEmptyFilter)
+}
+
+func TestService_PurgeStale(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	db := storage.NewMockDatabase(ctrl)
+	auditor := mockaudit.NewMockIAuditor(ctrl)
+	observabilityService := NewService(db, mockpinger.NewMockPinger(ctrl), auditor)
+
+	start := time.Now()
+	db.EXPECT().Delete(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, filter repository.Filter) ([]string, error) {
+		assert.WithinRange(t, filter.UpdatedBefore, start.Add(-time.Hour), time.Now().Add(-time.Hour))
+		return []string{"old"}, nil
+	})
+	auditor.EXPECT().Notify(gomock.Any()).DoAndReturn(func(d *data.Data) error {
+		assert.Equal(t, "expired", d.Action)
+		return nil
+	})
+
+	names, err := observabilityService.PurgeStale(t.Context(), time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"old"}, names)
+}
+
+func TestService_ResetCounters(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	db := storage.NewMockDatabase(ctrl)
+	auditor := mockaudit.NewMockIAuditor(ctrl)
+	observabilityService := NewService(db, mockpinger.NewMockPinger(ctrl), auditor)
+
+	delta := int64(42)
+	db.EXPECT().ResetCounters(gomock.Any(), repository.Filter{Names: []string{"quota"}}).
+		Return([]models.Metrics{{ID: "quota", MType: "counter", Delta: &delta}}, nil)
+	auditor.EXPECT().Notify(gomock.Any()).DoAndReturn(func(d *data.Data) error {
+		assert.Equal(t, data.EventCounterReset, d.Event)
+		assert.Equal(t, "manual", d.Action)
+		assert.Equal(t, []data.CounterReset{{Name: "quota", Previous: 42}}, d.Resets)
+		return nil
+	})
+	previous, err := observabilityService.ResetCounter(t.Context(), "quota")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), previous)
+
+	db.EXPECT().ResetCounters(gomock.Any(), gomock.Any()).Return(nil, nil)
+	_, err = observabilityService.ResetCounter(t.Context(), "missing")
+	assert.ErrorIs(t, err, errs.ErrorMetricDoesNotExist)
+}
+
+func TestDailySchedule_Next(t *testing.T) {
+	schedule, err := ParseDailySchedule("00:00", "UTC")
+	assert.NoError(t, err)
+
+	after := time.Date(2026, 3, 10, 15, 30, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC), schedule.Next(after))
+	assert.Equal(t, time.Date(2026, 3, 12, 0, 0, 0, 0, time.UTC), schedule.Next(time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC)))
+
+	schedule, err = ParseDailySchedule("18:45", "UTC")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 3, 10, 18, 45, 0, 0, time.UTC), schedule.Next(after))
+
+	_, err = ParseDailySchedule("25:00", "")
+	assert.Error(t, err)
+	_, err = ParseDailySchedule("00:00", "Nowhere/City")
+	assert.Error(t, err)
+}
+
+func TestService_Metadata(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	db := storage.NewMockDatabase(ctrl)
+	observabilityService := NewService(db, mockpinger.NewMockPinger(ctrl), mockaudit.NewMockIAuditor(ctrl)).
+		WithMetadataStore(memstorage.NewMetadataRegistry(nil))
+
+	assert.ErrorIs(t, observabilityService.SetMetadata(t.Context(), models.Metadata{Name: "abc", Type: "histogram"}), errs.ErrorWrongUpdateType)
+	assert.ErrorIs(t, observabilityService.SetMetadata(t.Context(), models.Metadata{Help: "no name"}), errs.ErrorEmptyName)
+	assert.NoError(t, observabilityService.SetMetadata(t.Context(), models.Metadata{Name: "abc", Help: "test gauge", Unit: "bytes", Owner: "team"}))
+
+	value := 1.5
+	db.EXPECT().GetAll(gomock.Any()).Return([]models.Metrics{{ID: "abc", MType: "gauge", Value: &value}, {ID: "def", MType: "gauge", Value: &value}}, nil)
+	metrics, err := observabilityService.GetAll(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, []models.DisplayMetric{
+		{Name: "abc", Type: "gauge", StringValue: "1.5", Help: "test gauge", Unit: "bytes", Owner: "team"},
+		{Name: "def", Type: "gauge", StringValue: "1.5"},
+	}, metrics)
+}
+
+func TestService_RejectsTypeUnexpectedByMetadata(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	db := storage.NewMockDatabase(ctrl)
+	auditor := mockaudit.NewMockIAuditor(ctrl)
+	registry := memstorage.NewMetadataRegistry(nil)
+	observabilityService := NewService(db, mockpinger.NewMockPinger(ctrl), auditor).WithMetadataStore(registry)
+	require.NoError(t, registry.PutMetadata(t.Context(), models.Metadata{Name: "hits", Type: "counter"}))
+	require.NoError(t, registry.PutMetadata(t.Context(), models.Metadata{Name: "load", Unit: "percent"}))
+
+	value, delta := 1.5, int64(1)
+	err := observabilityService.ProcessUpdate(t.Context(), update.MetricUpdate{MetricName: "hits", MType: "gauge", Value: &value})
+	assert.ErrorIs(t, err, errs.ErrorMetadataTypeConflict)
+	assert.Equal(t, errs.KindConflict, errs.KindOf(err))
+
+	batch := []models.Metrics{testhelpers.Gauge("load", value), testhelpers.Gauge("hits", value)}
+	assert.ErrorIs(t, observabilityService.BatchUpdate(t.Context(), batch), errs.ErrorMetadataTypeConflict, "whole batch is rejected")
+
+	db.EXPECT().Increment(gomock.Any(), "hits", delta).Return(delta, nil)
+	db.EXPECT().BulkUpdate(gomock.Any(), gomock.Any()).Return(nil)
+	auditor.EXPECT().Notify(gomock.Any()).Return(nil)
+	assert.NoError(t, observabilityService.ProcessUpdate(t.Context(), update.MetricUpdate{MetricName: "hits", MType: "counter", Delta: &delta}))
+	assert.NoError(t, observabilityService.BatchUpdate(t.Context(), []models.Metrics{testhelpers.Gauge("load", value), testhelpers.Gauge("other", value)}),
+		"metadata without type accepts any type")
+}
+
+// pageMetadataStore fails reading the whole metadata, pages must look up metadata of their metrics only
+type pageMetadataStore struct {
+	*memstorage.MetadataRegistry
+}
+
+func (pageMetadataStore) ListMetadata(context.Context) ([]models.Metadata, error) {
+	return nil, errors.New("whole metadata is read")
+}
+
+func TestService_ListMetrics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	db := storage.NewMockDatabase(ctrl)
+	registry := pageMetadataStore{memstorage.NewMetadataRegistry(nil)}
+	observabilityService := NewService(db, mockpinger.NewMockPinger(ctrl), mockaudit.NewMockIAuditor(ctrl)).
+		WithMetadataStore(registry)
+	assert.NoError(t, registry.PutMetadata(t.Context(), models.Metadata{Name: "abc", Unit: "bytes"}))
+
+	value := 1.5
+	next := repository.Cursor{Sort: repository.SortByName, Name: "abc"}
+	db.EXPECT().List(gomock.Any(), repository.ListQuery{Sort: repository.SortByName, Limit: DefaultListLimit}).
+		Return(repository.Page{Metrics: []models.Metrics{{ID: "abc", MType: "gauge", Value: &value}}, Next: &next}, nil)
+
+	metrics, cursor, err := observabilityService.ListMetrics(t.Context(), repository.ListQuery{})
+	assert.NoError(t, err)
+	assert.Equal(t, &next, cursor)
+	assert.Equal(t, []models.DescribedMetric{{
+		Metrics: models.Metrics{ID: "abc", MType: "gauge", Value: &value},
+		Meta:    &models.Metadata{Name: "abc", Unit: "bytes"},
+	}}, metrics)
+
+	_, _, err = observabilityService.ListMetrics(t.Context(), repository.ListQuery{Limit: MaxListLimit + 1})
+	assert.Equal(t, errs.KindInvalidArgument, errs.KindOf(err))
+	_, _, err = observabilityService.ListMetrics(t.Context(), repository.ListQuery{Sort: repository.SortByType, Cursor: &next})
+	assert.Equal(t, errs.KindInvalidArgument, errs.KindOf(err))
+}
+
+func TestService_PublishesChanges(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	interval, restore := 0, false
+	db := memstorage.NewStorage(&serverenvconfig.Config{StoreInterval: &interval, Restore: &restore}, testhelpers.NopBackupManager{})
+	auditor := mockaudit.NewMockIAuditor(ctrl)
+	auditor.EXPECT().Notify(gomock.Any()).Return(nil).AnyTimes()
+	hub := live.NewHub(10)
+	observabilityService := NewService(db, mockpinger.NewMockPinger(ctrl), auditor).WithHub(hub)
+
+	subscription, err := observabilityService.Subscribe(t.Context(), repository.Filter{})
+	require.NoError(t, err)
+	events := subscription.Events
+
+	delta, value := int64(2), 1.5
+	require.NoError(t, observabilityService.ProcessUpdate(t.Context(), update.MetricUpdate{MetricName: "hits", MType: "counter", Delta: &delta}))
+	event := <-events
+	assert.Equal(t, []models.Metrics{{ID: "hits", MType: "counter", Delta: &delta}}, event.Updated)
+
+	total, other := int64(6), 2.5
+	require.NoError(t, observabilityService.BatchUpdate(t.Context(), []models.Metrics{
+		{ID: "hits", MType: "counter", Delta: &delta},
+		{ID: "load", MType: "gauge", Value: &value},
+		{ID: "hits", MType: "counter", Delta: &delta},
+		{ID: "load", MType: "gauge", Value: &other},
+	}))
+	event = <-events
+	assert.Equal(t, []models.Metrics{
+		{ID: "hits", MType: "counter", Delta: &total},
+		{ID: "load", MType: "gauge", Value: &other},
+	}, event.Updated, "counters are published with their current values")
+
+	_, err = observabilityService.DeleteMetrics(t.Context(), repository.Filter{Names: []string{"load"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"load"}, (<-events).Deleted)
+
+	metrics, err := observabilityService.GetAll(t.Context())
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, []float64{2, 6}, []float64{metrics[0].History[0].Value, metrics[0].History[1].Value})
+
+	_, err = observabilityService.Subscribe(t.Context(), repository.Filter{UpdatedBefore: time.Now()})
+	assert.Equal(t, errs.KindInvalidArgument, errs.KindOf(err))
+	_, err = NewService(db, mockpinger.NewMockPinger(ctrl), auditor).Subscribe(t.Context(), repository.Filter{})
+	assert.Equal(t, errs.KindUnavailable, errs.KindOf(err))
+}
+
+func TestService_IdleHubSkipsCounterReads(t *testing.T) {
+	defer func(size int) { live.HistorySize = size }(live.HistorySize)
+	live.HistorySize = 0
+
+	ctrl := gomock.NewController(t)
+	db := storage.NewMockDatabase(ctrl)
+	auditor := mockaudit.NewMockIAuditor(ctrl)
+	auditor.EXPECT().Notify(gomock.Any()).Return(nil).AnyTimes()
+	observabilityService := NewService(db, mockpinger.NewMockPinger(ctrl), auditor).WithHub(live.NewHub(10))
+
+	delta := int64(2)
+	batch := []models.Metrics{{ID: "hits", MType: "counter", Delta: &delta}}
+	db.EXPECT().BulkUpdate(gomock.Any(), batch).Return(nil)
+	// GetByID is not expected: there are no subscribers, no history and no rates
+	require.NoError(t, observabilityService.BatchUpdate(t.Context(), batch))
+}
+
+// aggregatingDatabase is a storage computing aggregations itself
+type aggregatingDatabase struct {
+	*storage.MockDatabase
+	aggregate func(repository.AggregateQuery) (repository.Aggregation, error)
+}
+
+func (db aggregatingDatabase) Aggregate(_ context.Context, query repository.AggregateQuery) (repository.Aggregation, error) {
+	return db.aggregate(query)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestService_Aggregate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	interval, restore := 0, false
+	db := memstorage.NewStorage(&serverenvconfig.Config{StoreInterval: &interval, Restore: &restore}, testhelpers.NopBackupManager{})
+	observabilityService := NewService(db, mockpinger.NewMockPinger(ctrl), mockaudit.NewMockIAuditor(ctrl))
+
+	heap1, heap2, other := 10.0, 30.0, 5.0
+	hits, misses := int64(7), int64(3)
+	require.NoError(t, db.BulkUpdate(t.Context(), []models.Metrics{
+		{ID: "heap.a", MType: "gauge", Value: &heap1},
+		{ID: "heap.b", MType: "gauge", Value: &heap2},
+		{ID: "load", MType: "gauge", Value: &other},
+		{ID: "heap.hits", MType: "counter", Delta: &hits},
+		{ID: "misses", MType: "counter", Delta: &misses},
+	}))
+
+	heap := repository.Filter{Prefix: "heap."}
+	tests := []struct {
+		query repository.AggregateQuery
+		value *float64
+		count int
+	}{
+		{query: repository.AggregateQuery{Func: repository.AggregateSum, Filter: heap}, value: ptr(40.0), count: 2},
+		{query: repository.AggregateQuery{Func: repository.AggregateAvg, Filter: heap}, value: ptr(20.0), count: 2},
+		{query: repository.AggregateQuery{Func: repository.AggregateMin}, value: ptr(5.0), count: 3},
+		{query: repository.AggregateQuery{Func: repository.AggregateMax}, value: ptr(30.0), count: 3},
+		{query: repository.AggregateQuery{Func: repository.AggregateCount, Filter: heap}, value: ptr(2.0), count: 2},
+		{query: repository.AggregateQuery{Func: repository.AggregateTotal}, value: ptr(10.0), count: 2},
+		{query: repository.AggregateQuery{Func: repository.AggregateSum, Filter: repository.Filter{Prefix: "none"}}, value: ptr(0.0)},
+		{query: repository.AggregateQuery{Func: repository.AggregateMax, Filter: repository.Filter{Prefix: "none"}}},
+	}
+	for _, tt := range tests {
+		result, err := observabilityService.Aggregate(t.Context(), tt.query)
+		require.NoError(t, err)
+		assert.Equal(t, tt.value, result.Value, tt.query.Func)
+		assert.Equal(t, tt.count, result.Count, tt.query.Func)
+	}
+
+	result, err := observabilityService.Aggregate(t.Context(), repository.AggregateQuery{Func: repository.AggregateTopK, K: 2})
+	require.NoError(t, err)
+	assert.Equal(t, 5, result.Count)
+	assert.Equal(t, []models.Metrics{
+		{ID: "heap.b", MType: "gauge", Value: &heap2},
+		{ID: "heap.a", MType: "gauge", Value: &heap1},
+	}, result.Top)
+
+	_, err = observabilityService.Aggregate(t.Context(), repository.AggregateQuery{Func: repository.AggregateSum, Filter: repository.Filter{Type: "counter"}})
+	assert.Equal(t, errs.KindInvalidArgument, errs.KindOf(err))
+	_, err = observabilityService.Aggregate(t.Context(), repository.AggregateQuery{Func: repository.AggregateTopK, K: MaxListLimit + 1})
+	assert.Equal(t, errs.KindInvalidArgument, errs.KindOf(err))
+	_, err = observabilityService.Aggregate(t.Context(), repository.AggregateQuery{Func: "median"})
+	assert.Equal(t, errs.KindInvalidArgument, errs.KindOf(err))
+}
+
+func TestService_AggregatePushdown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockDB := storage.NewMockDatabase(ctrl)
+	total := 42.0
+	var pushed []repository.AggregateQuery
+	db := aggregatingDatabase{MockDatabase: mockDB, aggregate: func(query repository.AggregateQuery) (repository.Aggregation, error) {
+		pushed = append(pushed, query)
+		if query.Func == repository.AggregateTopK {
+			return repository.Aggregation{}, errors.ErrUnsupported
+		}
+		return repository.Aggregation{Value: &total, Count: 3}, nil
+	}}
+	observabilityService := NewService(db, mockpinger.NewMockPinger(ctrl), mockaudit.NewMockIAuditor(ctrl))
+
+	result, err := observabilityService.Aggregate(t.Context(), repository.AggregateQuery{Func: repository.AggregateTotal})
+	require.NoError(t, err)
+	assert.Equal(t, repository.Aggregation{Value: &total, Count: 3}, result)
+
+	mockDB.EXPECT().GetAll(gomock.Any()).Return(nil, nil)
+	result, err = observabilityService.Aggregate(t.Context(), repository.AggregateQuery{Func: repository.AggregateTopK})
+	require.NoError(t, err, "unsupported pushdown falls back to the service")
+	assert.Empty(t, result.Top)
+
+	assert.Equal(t, []repository.AggregateQuery{
+		{Func: repository.AggregateTotal, Filter: repository.Filter{Type: "counter"}},
+		{Func: repository.AggregateTopK, K: DefaultTopK},
+	}, pushed)
+}
+
+func TestService_DerivedMetrics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	interval, restore := 0, false
+	db := memstorage.NewStorage(&serverenvconfig.Config{StoreInterval: &interval, Restore: &restore}, testhelpers.NopBackupManager{})
+	auditor := mockaudit.NewMockIAuditor(ctrl)
+	auditor.EXPECT().Notify(gomock.Any()).Return(nil).AnyTimes()
+
+	usedPct, err := ParseDerivedMetric("MemUsedPct", "(TotalMemory - FreeMemory) / TotalMemory * 100")
+	require.NoError(t, err)
+	usedMB, err := ParseDerivedMetric("MemUsedMB", "MemUsedPct * TotalMemory / 100 / 1024 / 1024")
+	require.NoError(t, err)
+	observabilityService := NewService(db, mockpinger.NewMockPinger(ctrl), auditor).
+		WithDerivedMetrics([]DerivedMetric{usedPct, usedMB})
+
+	total, free := float64(8<<20), float64(6<<20)
+	require.NoError(t, observabilityService.BatchUpdate(t.Context(), []models.Metrics{
+		{ID: "TotalMemory", MType: "gauge", Value: &total},
+	}))
+	_, err = db.Get(t.Context(), "MemUsedPct")
+	assert.Error(t, err, "derived metric is not computed while inputs are missing")
+
+	require.NoError(t, observabilityService.BatchUpdate(t.Context(), []models.Metrics{
+		{ID: "FreeMemory", MType: "gauge", Value: &free},
+	}))
+	metric, err := observabilityService.GetMetric(t.Context(), update.MetricUpdate{MetricName: "MemUsedPct", MType: "gauge"})
+	require.NoError(t, err)
+	assert.InDelta(t, 25, *metric.Value, 1e-9)
+	metric, err = observabilityService.GetMetric(t.Context(), update.MetricUpdate{MetricName: "MemUsedMB", MType: "gauge"})
+	require.NoError(t, err)
+	assert.InDelta(t, 2, *metric.Value, 1e-9, "derived metrics may read the ones defined before")
+
+	free = 2 << 20
+	require.NoError(t, observabilityService.ProcessUpdate(t.Context(), update.MetricUpdate{MetricName: "FreeMemory", MType: "gauge", Value: &free}))
+	metric, err = observabilityService.GetMetric(t.Context(), update.MetricUpdate{MetricName: "MemUsedPct", MType: "gauge"})
+	require.NoError(t, err)
+	assert.InDelta(t, 75, *metric.Value, 1e-9)
+}
+
+func TestService_DerivedMetricsDoNotFlushBuffer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	interval, restore := 0, false
+	inner := memstorage.NewStorage(&serverenvconfig.Config{StoreInterval: &interval, Restore: &restore}, testhelpers.NopBackupManager{})
+	buffer := writebehind.New(inner, time.Hour, 1000)
+	auditor := mockaudit.NewMockIAuditor(ctrl)
+	auditor.EXPECT().Notify(gomock.Any()).Return(nil).AnyTimes()
+
+	usedHeapPct, err := ParseDerivedMetric("UsedHeapPct", `sum("Heap*") / Sys * 100`)
+	require.NoError(t, err)
+	observabilityService := NewService(buffer, mockpinger.NewMockPinger(ctrl), auditor).
+		WithDerivedMetrics([]DerivedMetric{usedHeapPct})
+
+	heapAlloc, heapIdle, sys := float64(10), float64(30), float64(80)
+	require.NoError(t, observabilityService.BatchUpdate(t.Context(), []models.Metrics{
+		{ID: "HeapAlloc", MType: "gauge", Value: &heapAlloc},
+		{ID: "HeapIdle", MType: "gauge", Value: &heapIdle},
+		{ID: "Sys", MType: "gauge", Value: &sys},
+	}))
+
+	metric, err := buffer.Get(t.Context(), "UsedHeapPct")
+	require.NoError(t, err)
+	assert.InDelta(t, 50, *metric.Value, 1e-9)
+	stored, err := inner.GetAll(t.Context())
+	require.NoError(t, err)
+	assert.Empty(t, stored, "updates stay buffered")
+}
+
+func TestParseDerivedMetric(t *testing.T) {
+	_, err := ParseDerivedMetric("", "Alloc")
+	assert.Error(t, err)
+	_, err = ParseDerivedMetric("Half", "Alloc /")
+	assert.Error(t, err)
+	_, err = ParseDerivedMetric("Constant", "1 + 2")
+	assert.Error(t, err)
+	_, err = ParseDerivedMetric("Total", `sum("*")`)
+	assert.Error(t, err, "derived metric must not read itself")
+	_, err = ParseDerivedMetric("Counter", "Counter + 1")
+	assert.Error(t, err, "derived metric must not read itself")
+
+	derived, err := ParseDerivedMetric("UsedHeapPct", `sum("Heap*") / Sys`)
+	require.NoError(t, err)
+	assert.True(t, derived.readsAny([]string{"Alloc", "HeapIdle"}))
+	assert.False(t, derived.readsAny([]string{"Alloc", "SysBytes"}))
+}
+
+func TestService_CounterRate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	interval, restore := 0, false
+	db := memstorage.NewStorage(&serverenvconfig.Config{StoreInterval: &interval, Restore: &restore}, testhelpers.NopBackupManager{})
+	auditor := mockaudit.NewMockIAuditor(ctrl)
+	auditor.EXPECT().Notify(gomock.Any()).Return(nil).AnyTimes()
+	hub := live.NewHub(10)
+	observabilityService := NewService(db, mockpinger.NewMockPinger(ctrl), auditor).
+		WithHub(hub).
+		WithRates(rates.NewTracker(time.Minute))
+
+	subscription, err := observabilityService.Subscribe(t.Context(), repository.Filter{})
+	require.NoError(t, err)
+
+	delta, value := int64(5), 1.5
+	require.NoError(t, observabilityService.ProcessUpdate(t.Context(), update.MetricUpdate{MetricName: "PollCount", MType: "counter", Delta: &delta}))
+	assert.Empty(t, (<-subscription.Events).Rates)
+	_, err = observabilityService.CounterRate(t.Context(), "PollCount")
+	assert.Equal(t, errs.KindNotFound, errs.KindOf(err), "rate is unknown after a single update")
+
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, observabilityService.BatchUpdate(t.Context(), []models.Metrics{
+		{ID: "PollCount", MType: "counter", Delta: &delta},
+		{ID: "Alloc", MType: "gauge", Value: &value},
+	}))
+	rate, err := observabilityService.CounterRate(t.Context(), "PollCount")
+	require.NoError(t, err)
+	assert.Positive(t, rate.Instant)
+	assert.Equal(t, rate.Instant, rate.EWMA)
+	assert.Equal(t, map[string]models.CounterRate{"PollCount": rate}, (<-subscription.Events).Rates)
+
+	metrics, err := observabilityService.GetAll(t.Context())
+	require.NoError(t, err)
+	for _, m := range metrics {
+		if m.Name == "PollCount" {
+			assert.Equal(t, &rate, m.Rate)
+		} else {
+			assert.Nil(t, m.Rate, "gauges have no rate")
+		}
+	}
+
+	_, err = observabilityService.CounterRate(t.Context(), "Alloc")
+	assert.ErrorIs(t, err, errs.ErrorMetricDoesNotExist)
+
+	_, err = observabilityService.DeleteMetrics(t.Context(), repository.Filter{Names: []string{"PollCount"}})
+	require.NoError(t, err)
+	require.NoError(t, observabilityService.ProcessUpdate(t.Context(), update.MetricUpdate{MetricName: "PollCount", MType: "counter", Delta: &delta}))
+	_, err = observabilityService.CounterRate(t.Context(), "PollCount")
+	assert.ErrorIs(t, err, errRateUnknown, "rate of a deleted counter starts over")
+
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, observabilityService.ProcessUpdate(t.Context(), update.MetricUpdate{MetricName: "PollCount", MType: "counter", Delta: &delta}))
+	_, err = observabilityService.ResetCounters(t.Context(), repository.Filter{Names: []string{"PollCount"}})
+	require.NoError(t, err)
+	_, err = observabilityService.CounterRate(t.Context(), "PollCount")
+	assert.ErrorIs(t, err, errRateUnknown, "rate of a reset counter starts over")
+
+	_, err = NewService(db, mockpinger.NewMockPinger(ctrl), auditor).CounterRate(t.Context(), "PollCount")
+	assert.Equal(t, errs.KindUnavailable, errs.KindOf(err))
+}
+
+func TestService_ExportImport(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	interval, restore := 0, false
+	newService := func() *Service {
+		db := memstorage.NewStorage(&serverenvconfig.Config{StoreInterval: &interval, Restore: &restore}, testhelpers.NopBackupManager{})
+		auditor := mockaudit.NewMockIAuditor(ctrl)
+		auditor.EXPECT().Notify(gomock.Any()).Return(nil).AnyTimes()
+		return NewService(db, mockpinger.NewMockPinger(ctrl), auditor).WithMetadataStore(memstorage.NewMetadataRegistry(nil))
+	}
+
+	source := newService()
+	sys, alloc, delta := 10.0, 2.5, int64(3)
+	require.NoError(t, source.BatchUpdate(t.Context(), []models.Metrics{
+		{ID: "Sys", MType: "gauge", Value: &sys},
+		{ID: "PollCount", MType: "counter", Delta: &delta},
+		{ID: "Alloc", MType: "gauge", Value: &alloc},
+	}))
+	require.NoError(t, source.SetMetadata(t.Context(), models.Metadata{Name: "Alloc", Unit: "bytes"}))
+
+	exported, err := source.Export(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Alloc", "PollCount", "Sys"}, []string{exported.Metrics[0].ID, exported.Metrics[1].ID, exported.Metrics[2].ID})
+	assert.Equal(t, []models.Metadata{{Name: "Alloc", Unit: "bytes"}}, exported.Metadata)
+
+	target := newService()
+	other, stored := 1.0, int64(4)
+	require.NoError(t, target.BatchUpdate(t.Context(), []models.Metrics{
+		{ID: "Other", MType: "gauge", Value: &other},
+		{ID: "PollCount", MType: "counter", Delta: &stored},
+	}))
+
+	result, err := target.Import(t.Context(), exported, ImportMerge)
+	require.NoError(t, err)
+	assert.Equal(t, ImportResult{Metrics: 3, Metadata: 1}, result)
+	metric, err := target.GetMetric(t.Context(), update.MetricUpdate{MetricName: "PollCount"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), *metric.Delta, "merge adds imported counters")
+	_, err = target.GetMetric(t.Context(), update.MetricUpdate{MetricName: "Other"})
+	assert.NoError(t, err, "merge keeps metrics missing from dump")
+
+	result, err = target.Import(t.Context(), exported, ImportReplace)
+	require.NoError(t, err)
+	assert.Equal(t, ImportResult{Metrics: 3, Metadata: 1, Deleted: 4}, result)
+	replaced, err := target.Export(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, exported, replaced)
+
+	_, err = target.Import(t.Context(), dump.Dump{Metrics: []models.Metrics{{ID: "Broken", MType: "gauge"}}}, ImportReplace)
+	assert.ErrorIs(t, err, errs.ErrorMissingValue)
+	_, err = target.GetMetric(t.Context(), update.MetricUpdate{MetricName: "Sys"})
+	assert.NoError(t, err, "invalid dump is rejected before anything is deleted")
+}
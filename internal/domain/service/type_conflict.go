@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/dmitastr/yp_observability_service/internal/common"
+	"github.com/dmitastr/yp_observability_service/internal/domain/audit/data"
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/logger"
+	dbinterface "github.com/dmitastr/yp_observability_service/internal/repository"
+)
+
+// TypeConflictPolicy defines handling of updates which change type of a stored metric
+type TypeConflictPolicy string
+
+const (
+	// TypeConflictReject rejects the whole update with [errs.ErrorTypeConflict]
+	TypeConflictReject TypeConflictPolicy = "reject"
+	// TypeConflictReplace replaces the stored metric, counter starts from the received delta
+	TypeConflictReplace TypeConflictPolicy = "replace"
+)
+
+// ParseTypeConflictPolicy checks policy name, empty name means [TypeConflictReject]
+func ParseTypeConflictPolicy(name string) (TypeConflictPolicy, error) {
+	switch policy := TypeConflictPolicy(name); policy {
+	case "":
+		return TypeConflictReject, nil
+	case TypeConflictReject, TypeConflictReplace:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown type conflict policy '%s', expected %s or %s", name, TypeConflictReject, TypeConflictReplace)
+	}
+}
+
+// WithTypeConflictPolicy sets handling of updates which change metric type
+func (service *Service) WithTypeConflictPolicy(policy TypeConflictPolicy) *Service {
+	service.typeConflict = policy
+	return service
+}
+
+// typeConflictRetries limits writes retried under [TypeConflictReplace] after deleting conflicting metrics,
+// another writer may store a metric of the old type between deletion and retry
+var typeConflictRetries = 3
+
+// write runs fnc writing metrics and applies type conflict policy to updates rejected by storage.
+// Under [TypeConflictReplace] type changes within the batch are collapsed to the last type, conflicting
+// stored metrics are deleted and the write is retried, in a single transaction if storage supports them.
+// Deletions are published once the transaction is committed. Conflicts are reported to audit in any case
+func (service Service) write(ctx context.Context, metrics []models.Metrics, fnc func(context.Context, []models.Metrics) error) error {
+	var conflict *dbinterface.TypeConflictError
+	if service.typeConflict != TypeConflictReplace {
+		err := fnc(ctx, metrics)
+		if errors.As(err, &conflict) {
+			service.reportTypeConflicts(ctx, conflict.Conflicts, "rejected")
+		}
+		return err
+	}
+
+	metrics, collapsed := collapseTypeChanges(metrics)
+	service.reportTypeConflicts(ctx, collapsed, "replaced")
+	var replaced []dbinterface.TypeConflict
+	var deleted []string
+	err := service.inTx(ctx, func(ctx context.Context) error {
+		// a transaction retried by storage starts over
+		replaced, deleted = nil, nil
+		for attempt := 0; ; attempt++ {
+			err := fnc(ctx, metrics)
+			if !errors.As(err, &conflict) || attempt == typeConflictRetries {
+				return err
+			}
+			replaced = append(replaced, conflict.Conflicts...)
+			names, err := service.db.Delete(ctx, dbinterface.Filter{Names: conflict.Names()})
+			if err != nil {
+				return fmt.Errorf("error deleting metrics of another type: %w", err)
+			}
+			deleted = append(deleted, names...)
+		}
+	})
+	if err != nil {
+		// deletions are rolled back or could not help, the update is not applied
+		if errors.As(err, &conflict) {
+			service.reportTypeConflicts(ctx, conflict.Conflicts, "rejected")
+		}
+		return err
+	}
+	// write may be a part of a transaction started by the caller
+	applied := func() {
+		service.reportTypeConflicts(ctx, replaced, "replaced")
+		service.publish(nil, deleted)
+	}
+	if !dbinterface.OnCommit(ctx, applied) {
+		applied()
+	}
+	return nil
+}
+
+// inTx runs fnc in a storage transaction if storage supports them, otherwise fnc is called directly
+func (service Service) inTx(ctx context.Context, fnc func(context.Context) error) error {
+	if transactor, ok := service.db.(dbinterface.Transactor); ok {
+		return transactor.InTx(ctx, fnc)
+	}
+	return fnc(ctx)
+}
+
+// collapseTypeChanges drops updates made before the last type change of a metric within the batch,
+// so the metric is replaced with the last type. Returns conflicts of dropped updates with the kept ones
+func collapseTypeChanges(metrics []models.Metrics) ([]models.Metrics, []dbinterface.TypeConflict) {
+	last := make(map[string]string, len(metrics))
+	cut := make(map[string]bool)
+	var conflicts []dbinterface.TypeConflict
+	kept := make([]models.Metrics, 0, len(metrics))
+	for i := len(metrics) - 1; i >= 0; i-- {
+		m := metrics[i]
+		mtype, ok := last[m.ID]
+		switch {
+		case !ok:
+			last[m.ID] = m.MType
+		case cut[m.ID]:
+			continue
+		case mtype != m.MType:
+			cut[m.ID] = true
+			conflicts = append(conflicts, dbinterface.TypeConflict{Name: m.ID, Stored: m.MType, Received: mtype})
+			continue
+		}
+		kept = append(kept, m)
+	}
+	if len(conflicts) == 0 {
+		return metrics, nil
+	}
+	slices.Reverse(kept)
+	return kept, conflicts
+}
+
+// reportTypeConflicts notifies audit about type conflicts handled with the given action: rejected, replaced,
+// or dropped by storage after the update was accepted. Replaced ones are logged
+func (service Service) reportTypeConflicts(ctx context.Context, conflicts []dbinterface.TypeConflict, action string) {
+	if len(conflicts) == 0 {
+		return
+	}
+	events := make([]data.TypeConflict, 0, len(conflicts))
+	for _, c := range conflicts {
+		events = append(events, data.TypeConflict{Name: c.Name, Stored: c.Stored, Received: c.Received})
+		if action == "replaced" {
+			logger.Warnf("Metric %s type changed from %s to %s", c.Name, c.Stored, c.Received)
+		}
+	}
+	ip, _ := ctx.Value(common.SenderInfo{}).(string)
+	if err := service.auditor.Notify(data.NewTypeConflictData(events, action, ip)); err != nil {
+		logger.Error(err)
+	}
+}
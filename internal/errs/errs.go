@@ -2,8 +2,16 @@ package errs
 
 import "errors"
 
-var ErrorWrongPath error = errors.New("path is not supported")
-var ErrorWrongUpdateType error = errors.New("update type is not supported")
-var ErrorMetricDoesNotExist error = errors.New("metric was not found")
-var ErrorMetricTableEmpty error = errors.New("no metrics added yet")
+var ErrorWrongPath error = New(KindNotFound, "path is not supported")
+var ErrorWrongUpdateType error = New(KindInvalidArgument, "update type is not supported")
+var ErrorMetricDoesNotExist error = New(KindNotFound, "metric was not found")
+var ErrorMetricTableEmpty error = New(KindNotFound, "no metrics added yet")
 var ErrorValueFromEmptyMetric = errors.New("getting value from empty metric is not allowed")
+var ErrorSnapshotDoesNotExist = New(KindNotFound, "snapshot was not found")
+var ErrorMissingValue error = New(KindInvalidArgument, "metric value is missing")
+var ErrorEmptyName error = New(KindInvalidArgument, "metric name is empty")
+var ErrorTypeConflict error = New(KindConflict, "metric type does not match the stored one")
+var ErrorRequestInProgress error = New(KindConflict, "request with the same idempotency key is being applied")
+var ErrorEmptyFilter error = New(KindInvalidArgument, "filter selecting metrics to delete is empty")
+var ErrorMetadataDoesNotExist error = New(KindNotFound, "metric metadata was not found")
+var ErrorMetadataTypeConflict error = New(KindConflict, "metric type does not match the one expected by its metadata")
@@ -0,0 +1,88 @@
+package errs
+
+import "errors"
+
+// Kind classifies an error by what a client can do about it
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindNotFound
+	KindInvalidArgument
+	KindConflict
+	KindUnavailable
+	KindUnauthorized
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindNotFound:
+		return "not_found"
+	case KindInvalidArgument:
+		return "invalid_argument"
+	case KindConflict:
+		return "conflict"
+	case KindUnavailable:
+		return "unavailable"
+	case KindUnauthorized:
+		return "unauthorized"
+	default:
+		return "internal"
+	}
+}
+
+// Error is an error of a known [Kind]
+type Error struct {
+	Kind Kind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New creates an error of the given kind with text
+func New(kind Kind, text string) error {
+	return &Error{Kind: kind, Err: errors.New(text)}
+}
+
+// Wrap marks err with the given kind, nil is returned as is
+func Wrap(kind Kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+func NotFound(err error) error {
+	return Wrap(KindNotFound, err)
+}
+
+func InvalidArgument(err error) error {
+	return Wrap(KindInvalidArgument, err)
+}
+
+func Conflict(err error) error {
+	return Wrap(KindConflict, err)
+}
+
+func Unavailable(err error) error {
+	return Wrap(KindUnavailable, err)
+}
+
+func Unauthorized(err error) error {
+	return Wrap(KindUnauthorized, err)
+}
+
+// KindOf returns kind of the outermost typed error in the chain, errors without kind are internal
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return KindInternal
+}
@@ -0,0 +1,37 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Kind
+	}{
+		{name: "plain error", err: errors.New("error"), want: KindInternal},
+		{name: "sentinel", err: ErrorMetricDoesNotExist, want: KindNotFound},
+		{name: "wrapped sentinel", err: fmt.Errorf("metric abc: %w", ErrorMissingValue), want: KindInvalidArgument},
+		{name: "outermost kind wins", err: Unavailable(fmt.Errorf("query: %w", ErrorMetricDoesNotExist)), want: KindUnavailable},
+		{name: "unauthorized", err: Unauthorized(errors.New("bad signature")), want: KindUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, KindOf(tt.err))
+		})
+	}
+}
+
+func TestWrap(t *testing.T) {
+	assert.NoError(t, Wrap(KindConflict, nil))
+
+	cause := errors.New("cause")
+	err := Conflict(cause)
+	assert.ErrorIs(t, err, cause)
+	assert.Equal(t, "cause", err.Error())
+}
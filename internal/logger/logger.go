@@ -34,27 +34,30 @@ func (zl *ZapSugarLogger) Log(ctx context.Context, level tracelog.LogLevel, msg
 	}
 }
 
+var (
+	initOnce sync.Once
+	initErr  error
+)
+
+// Initialize builds the global logger once, concurrent callers wait for it
 func Initialize() error {
-	var err error
-	sync.OnceFunc(func() {
+	initOnce.Do(func() {
 		cfg := zap.NewDevelopmentConfig()
 		cfg.Level = zap.NewAtomicLevelAt(zap.DebugLevel)
 
 		logger, errLogger := cfg.Build(zap.AddCallerSkip(1))
 		if errLogger != nil {
-			err = fmt.Errorf("could not initialize zap logger: %w", errLogger)
+			initErr = fmt.Errorf("could not initialize zap logger: %w", errLogger)
+			return
 		}
 
 		sLog = &ZapSugarLogger{SugaredLogger: logger.Sugar()}
-	})()
-	return err
+	})
+	return initErr
 }
 
 func GetLogger() *ZapSugarLogger {
-	if sLog == nil {
-		_ = Initialize()
-		return sLog
-	}
+	_ = Initialize()
 	return sLog
 }
 
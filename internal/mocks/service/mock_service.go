@@ -8,8 +8,12 @@ import (
 	context "context"
 	reflect "reflect"
 
+	dump "github.com/dmitastr/yp_observability_service/internal/domain/dump"
+	live "github.com/dmitastr/yp_observability_service/internal/domain/live"
 	models "github.com/dmitastr/yp_observability_service/internal/domain/models"
+	service "github.com/dmitastr/yp_observability_service/internal/domain/service"
 	update "github.com/dmitastr/yp_observability_service/internal/presentation/update"
+	repository "github.com/dmitastr/yp_observability_service/internal/repository"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -36,6 +40,21 @@ func (m *MockIService) EXPECT() *MockIServiceMockRecorder {
 	return m.recorder
 }
 
+// Aggregate mocks base method.
+func (m *MockIService) Aggregate(arg0 context.Context, arg1 repository.AggregateQuery) (repository.Aggregation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Aggregate", arg0, arg1)
+	ret0, _ := ret[0].(repository.Aggregation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Aggregate indicates an expected call of Aggregate.
+func (mr *MockIServiceMockRecorder) Aggregate(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Aggregate", reflect.TypeOf((*MockIService)(nil).Aggregate), arg0, arg1)
+}
+
 // BatchUpdate mocks base method.
 func (m *MockIService) BatchUpdate(arg0 context.Context, arg1 []models.Metrics) error {
 	m.ctrl.T.Helper()
@@ -50,6 +69,65 @@ func (mr *MockIServiceMockRecorder) BatchUpdate(arg0, arg1 interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BatchUpdate", reflect.TypeOf((*MockIService)(nil).BatchUpdate), arg0, arg1)
 }
 
+// CounterRate mocks base method.
+func (m *MockIService) CounterRate(arg0 context.Context, arg1 string) (models.CounterRate, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CounterRate", arg0, arg1)
+	ret0, _ := ret[0].(models.CounterRate)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CounterRate indicates an expected call of CounterRate.
+func (mr *MockIServiceMockRecorder) CounterRate(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CounterRate", reflect.TypeOf((*MockIService)(nil).CounterRate), arg0, arg1)
+}
+
+// DeleteMetric mocks base method.
+func (m *MockIService) DeleteMetric(ctx context.Context, mtype, name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMetric", ctx, mtype, name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteMetric indicates an expected call of DeleteMetric.
+func (mr *MockIServiceMockRecorder) DeleteMetric(ctx, mtype, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMetric", reflect.TypeOf((*MockIService)(nil).DeleteMetric), ctx, mtype, name)
+}
+
+// DeleteMetrics mocks base method.
+func (m *MockIService) DeleteMetrics(arg0 context.Context, arg1 repository.Filter) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMetrics", arg0, arg1)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteMetrics indicates an expected call of DeleteMetrics.
+func (mr *MockIServiceMockRecorder) DeleteMetrics(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMetrics", reflect.TypeOf((*MockIService)(nil).DeleteMetrics), arg0, arg1)
+}
+
+// Export mocks base method.
+func (m *MockIService) Export(arg0 context.Context) (dump.Dump, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Export", arg0)
+	ret0, _ := ret[0].(dump.Dump)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Export indicates an expected call of Export.
+func (mr *MockIServiceMockRecorder) Export(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Export", reflect.TypeOf((*MockIService)(nil).Export), arg0)
+}
+
 // GetAll mocks base method.
 func (m *MockIService) GetAll(arg0 context.Context) ([]models.DisplayMetric, error) {
 	m.ctrl.T.Helper()
@@ -65,6 +143,21 @@ func (mr *MockIServiceMockRecorder) GetAll(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAll", reflect.TypeOf((*MockIService)(nil).GetAll), arg0)
 }
 
+// GetMetadata mocks base method.
+func (m *MockIService) GetMetadata(arg0 context.Context, arg1 string) (*models.Metadata, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMetadata", arg0, arg1)
+	ret0, _ := ret[0].(*models.Metadata)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMetadata indicates an expected call of GetMetadata.
+func (mr *MockIServiceMockRecorder) GetMetadata(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMetadata", reflect.TypeOf((*MockIService)(nil).GetMetadata), arg0, arg1)
+}
+
 // GetMetric mocks base method.
 func (m *MockIService) GetMetric(arg0 context.Context, arg1 update.MetricUpdate) (*models.Metrics, error) {
 	m.ctrl.T.Helper()
@@ -80,6 +173,67 @@ func (mr *MockIServiceMockRecorder) GetMetric(arg0, arg1 interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMetric", reflect.TypeOf((*MockIService)(nil).GetMetric), arg0, arg1)
 }
 
+// History mocks base method.
+func (m *MockIService) History(ctx context.Context, name string) ([]models.Sample, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "History", ctx, name)
+	ret0, _ := ret[0].([]models.Sample)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// History indicates an expected call of History.
+func (mr *MockIServiceMockRecorder) History(ctx, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "History", reflect.TypeOf((*MockIService)(nil).History), ctx, name)
+}
+
+// Import mocks base method.
+func (m *MockIService) Import(arg0 context.Context, arg1 dump.Dump, arg2 service.ImportMode) (service.ImportResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Import", arg0, arg1, arg2)
+	ret0, _ := ret[0].(service.ImportResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Import indicates an expected call of Import.
+func (mr *MockIServiceMockRecorder) Import(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Import", reflect.TypeOf((*MockIService)(nil).Import), arg0, arg1, arg2)
+}
+
+// ListMetadata mocks base method.
+func (m *MockIService) ListMetadata(arg0 context.Context) ([]models.Metadata, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListMetadata", arg0)
+	ret0, _ := ret[0].([]models.Metadata)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListMetadata indicates an expected call of ListMetadata.
+func (mr *MockIServiceMockRecorder) ListMetadata(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListMetadata", reflect.TypeOf((*MockIService)(nil).ListMetadata), arg0)
+}
+
+// ListMetrics mocks base method.
+func (m *MockIService) ListMetrics(arg0 context.Context, arg1 repository.ListQuery) ([]models.DescribedMetric, *repository.Cursor, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListMetrics", arg0, arg1)
+	ret0, _ := ret[0].([]models.DescribedMetric)
+	ret1, _ := ret[1].(*repository.Cursor)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ListMetrics indicates an expected call of ListMetrics.
+func (mr *MockIServiceMockRecorder) ListMetrics(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListMetrics", reflect.TypeOf((*MockIService)(nil).ListMetrics), arg0, arg1)
+}
+
 // Ping mocks base method.
 func (m *MockIService) Ping(arg0 context.Context) error {
 	m.ctrl.T.Helper()
@@ -107,3 +261,62 @@ func (mr *MockIServiceMockRecorder) ProcessUpdate(arg0, arg1 interface{}) *gomoc
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProcessUpdate", reflect.TypeOf((*MockIService)(nil).ProcessUpdate), arg0, arg1)
 }
+
+// ResetCounter mocks base method.
+func (m *MockIService) ResetCounter(arg0 context.Context, arg1 string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetCounter", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ResetCounter indicates an expected call of ResetCounter.
+func (mr *MockIServiceMockRecorder) ResetCounter(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetCounter", reflect.TypeOf((*MockIService)(nil).ResetCounter), arg0, arg1)
+}
+
+// ResetCounters mocks base method.
+func (m *MockIService) ResetCounters(arg0 context.Context, arg1 repository.Filter) ([]models.Metrics, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetCounters", arg0, arg1)
+	ret0, _ := ret[0].([]models.Metrics)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ResetCounters indicates an expected call of ResetCounters.
+func (mr *MockIServiceMockRecorder) ResetCounters(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetCounters", reflect.TypeOf((*MockIService)(nil).ResetCounters), arg0, arg1)
+}
+
+// SetMetadata mocks base method.
+func (m *MockIService) SetMetadata(arg0 context.Context, arg1 models.Metadata) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetMetadata", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetMetadata indicates an expected call of SetMetadata.
+func (mr *MockIServiceMockRecorder) SetMetadata(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMetadata", reflect.TypeOf((*MockIService)(nil).SetMetadata), arg0, arg1)
+}
+
+// Subscribe mocks base method.
+func (m *MockIService) Subscribe(arg0 context.Context, arg1 repository.Filter) (*live.Subscription, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Subscribe", arg0, arg1)
+	ret0, _ := ret[0].(*live.Subscription)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Subscribe indicates an expected call of Subscribe.
+func (mr *MockIServiceMockRecorder) Subscribe(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Subscribe", reflect.TypeOf((*MockIService)(nil).Subscribe), arg0, arg1)
+}
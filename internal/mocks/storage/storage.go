@@ -9,6 +9,7 @@ import (
 	reflect "reflect"
 
 	models "github.com/dmitastr/yp_observability_service/internal/domain/models"
+	repository "github.com/dmitastr/yp_observability_service/internal/repository"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -63,6 +64,21 @@ func (mr *MockDatabaseMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockDatabase)(nil).Close))
 }
 
+// Delete mocks base method.
+func (m *MockDatabase) Delete(arg0 context.Context, arg1 repository.Filter) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", arg0, arg1)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockDatabaseMockRecorder) Delete(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockDatabase)(nil).Delete), arg0, arg1)
+}
+
 // Get mocks base method.
 func (m *MockDatabase) Get(arg0 context.Context, arg1 string) (*models.Metrics, error) {
 	m.ctrl.T.Helper()
@@ -108,6 +124,21 @@ func (mr *MockDatabaseMockRecorder) GetByID(arg0, arg1 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByID", reflect.TypeOf((*MockDatabase)(nil).GetByID), arg0, arg1)
 }
 
+// Increment mocks base method.
+func (m *MockDatabase) Increment(arg0 context.Context, arg1 string, arg2 int64) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Increment", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Increment indicates an expected call of Increment.
+func (mr *MockDatabaseMockRecorder) Increment(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Increment", reflect.TypeOf((*MockDatabase)(nil).Increment), arg0, arg1, arg2)
+}
+
 // Init mocks base method.
 func (m *MockDatabase) Init(arg0 string) error {
 	m.ctrl.T.Helper()
@@ -122,6 +153,21 @@ func (mr *MockDatabaseMockRecorder) Init(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Init", reflect.TypeOf((*MockDatabase)(nil).Init), arg0)
 }
 
+// List mocks base method.
+func (m *MockDatabase) List(arg0 context.Context, arg1 repository.ListQuery) (repository.Page, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", arg0, arg1)
+	ret0, _ := ret[0].(repository.Page)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockDatabaseMockRecorder) List(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockDatabase)(nil).List), arg0, arg1)
+}
+
 // Ping mocks base method.
 func (m *MockDatabase) Ping(arg0 context.Context) error {
 	m.ctrl.T.Helper()
@@ -136,6 +182,21 @@ func (mr *MockDatabaseMockRecorder) Ping(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockDatabase)(nil).Ping), arg0)
 }
 
+// ResetCounters mocks base method.
+func (m *MockDatabase) ResetCounters(arg0 context.Context, arg1 repository.Filter) ([]models.Metrics, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetCounters", arg0, arg1)
+	ret0, _ := ret[0].([]models.Metrics)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ResetCounters indicates an expected call of ResetCounters.
+func (mr *MockDatabaseMockRecorder) ResetCounters(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetCounters", reflect.TypeOf((*MockDatabase)(nil).ResetCounters), arg0, arg1)
+}
+
 // Update mocks base method.
 func (m *MockDatabase) Update(arg0 context.Context, arg1 models.Metrics) error {
 	m.ctrl.T.Helper()
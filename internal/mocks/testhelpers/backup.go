@@ -0,0 +1,24 @@
+package testhelpers
+
+import (
+	"context"
+
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+)
+
+// NopBackupManager is a [repository.BackupManager] which does not save anything
+type NopBackupManager struct{}
+
+func (NopBackupManager) Run(context.Context, func() repository.Snapshot) error { return nil }
+func (NopBackupManager) Load() (repository.Snapshot, error)                    { return repository.Snapshot{}, nil }
+func (NopBackupManager) Flush(repository.Snapshot) error                       { return nil }
+func (NopBackupManager) Append([]models.Metrics) (uint64, error)               { return 0, nil }
+func (NopBackupManager) Remove([]string) (uint64, error)                       { return 0, nil }
+func (NopBackupManager) Replace([]models.Metrics) (uint64, error)              { return 0, nil }
+func (NopBackupManager) List() ([]repository.SnapshotInfo, error)              { return nil, nil }
+func (NopBackupManager) LoadSnapshot(string) (repository.Snapshot, error) {
+	return repository.Snapshot{}, errs.ErrorSnapshotDoesNotExist
+}
+func (NopBackupManager) Close() error { return nil }
@@ -38,3 +38,18 @@ func CreatePostgresContainer(ctx context.Context) (*PostgresContainer, error) {
 		ConnectionString:  connStr,
 	}, nil
 }
+
+// ProviderAvailable reports whether docker is running, so containers for tests can be created
+func ProviderAvailable(ctx context.Context) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			ok = false
+		}
+	}()
+
+	provider, err := testcontainers.ProviderDocker.GetProvider()
+	if err != nil {
+		return false
+	}
+	return provider.Health(ctx) == nil
+}
@@ -0,0 +1,16 @@
+package testhelpers
+
+import (
+	"github.com/dmitastr/yp_observability_service/internal/common"
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+)
+
+// Gauge returns gauge metric with value
+func Gauge(name string, value float64) models.Metrics {
+	return models.Metrics{ID: name, MType: common.GAUGE, Value: &value}
+}
+
+// Counter returns counter metric with delta
+func Counter(name string, delta int64) models.Metrics {
+	return models.Metrics{ID: name, MType: common.COUNTER, Delta: &delta}
+}
@@ -0,0 +1,92 @@
+package aggregate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	srv "github.com/dmitastr/yp_observability_service/internal/domain/service"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/logger"
+	"github.com/dmitastr/yp_observability_service/internal/presentation/problem"
+	"github.com/dmitastr/yp_observability_service/internal/presentation/query"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+)
+
+// AggregateHandler handles requests for aggregating sets of metrics
+type AggregateHandler struct {
+	service srv.IService
+}
+
+func NewHandler(s srv.IService) *AggregateHandler {
+	return &AggregateHandler{service: s}
+}
+
+// aggregateResponse is a result of aggregation. Value is omitted for topk and for avg, min and max
+// when no metrics were selected
+type aggregateResponse struct {
+	Func    repository.AggregateFunc `json:"func"`
+	Value   *float64                 `json:"value,omitempty"`
+	Count   int                      `json:"count"`
+	Metrics []models.Metrics         `json:"metrics,omitempty"`
+}
+
+// ServeHTTP accepts GET requests with query params:
+//   - func - one of sum, avg, min, max, count of gauges, total of counters or topk
+//   - names, type, prefix, regex - select metrics
+//   - k - number of metrics selected by topk
+func (handler AggregateHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	aggregateQuery, err := parseAggregateQuery(req)
+	if err != nil {
+		problem.Render(res, req, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), 10*time.Second)
+	defer cancel()
+	result, err := handler.service.Aggregate(ctx, aggregateQuery)
+	if err != nil {
+		problem.Render(res, req, err)
+		return
+	}
+
+	response := aggregateResponse{Func: aggregateQuery.Func, Value: result.Value, Count: result.Count, Metrics: result.Top}
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(res).Encode(response); err != nil {
+		logger.Errorf("error encoding aggregation: %v", err)
+	}
+}
+
+func parseAggregateQuery(req *http.Request) (repository.AggregateQuery, error) {
+	values := req.URL.Query()
+	fun, err := repository.ParseAggregateFunc(values.Get("func"))
+	if err != nil {
+		return repository.AggregateQuery{}, err
+	}
+	filter, err := query.Filter(values)
+	if err != nil {
+		return repository.AggregateQuery{}, err
+	}
+	filter.Names = query.Names(values)
+
+	aggregateQuery := repository.AggregateQuery{Func: fun, Filter: filter}
+	if k := values.Get("k"); k != "" {
+		if fun != repository.AggregateTopK {
+			return repository.AggregateQuery{}, errs.New(errs.KindInvalidArgument, "k is used only by topk")
+		}
+		if aggregateQuery.K, err = strconv.Atoi(k); err != nil || aggregateQuery.K <= 0 {
+			return repository.AggregateQuery{}, errs.InvalidArgument(fmt.Errorf("k must be a positive number, got '%s'", k))
+		}
+	}
+	return aggregateQuery, nil
+}
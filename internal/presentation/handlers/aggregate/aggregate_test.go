@@ -0,0 +1,77 @@
+package aggregate
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/mocks/service"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregateHandler_ServeHTTP(t *testing.T) {
+	sum, value := 3.5, 2.0
+
+	tests := []struct {
+		name   string
+		url    string
+		query  repository.AggregateQuery
+		result repository.Aggregation
+		want   string
+	}{
+		{
+			name:   "sum by regex",
+			url:    "/api/aggregate?func=sum&regex=Heap",
+			query:  repository.AggregateQuery{Func: repository.AggregateSum, Filter: repository.Filter{Pattern: regexp.MustCompile("Heap")}},
+			result: repository.Aggregation{Value: &sum, Count: 2},
+			want:   `{"func":"sum","value":3.5,"count":2}`,
+		},
+		{
+			name:   "avg of nothing",
+			url:    "/api/aggregate?func=avg&prefix=none",
+			query:  repository.AggregateQuery{Func: repository.AggregateAvg, Filter: repository.Filter{Prefix: "none"}},
+			result: repository.Aggregation{},
+			want:   `{"func":"avg","count":0}`,
+		},
+		{
+			name:  "topk by names",
+			url:   "/api/aggregate?func=topk&k=1&names=a,b",
+			query: repository.AggregateQuery{Func: repository.AggregateTopK, K: 1, Filter: repository.Filter{Names: []string{"a", "b"}}},
+			result: repository.Aggregation{Count: 2, Top: []models.Metrics{
+				{ID: "b", MType: "gauge", Value: &value},
+			}},
+			want: `{"func":"topk","count":2,"metrics":[{"id":"b","type":"gauge","value":2}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSrv := service.NewMockIService(gomock.NewController(t))
+			mockSrv.EXPECT().Aggregate(gomock.Any(), tt.query).Return(tt.result, nil)
+
+			rr := httptest.NewRecorder()
+			NewHandler(mockSrv).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.url, nil))
+
+			require.Equal(t, http.StatusOK, rr.Code)
+			assert.JSONEq(t, tt.want, rr.Body.String())
+		})
+	}
+}
+
+func TestAggregateHandler_BadQuery(t *testing.T) {
+	for _, q := range []string{"", "?func=median", "?func=sum&k=3", "?func=topk&k=0", "?func=sum&regex=("} {
+		t.Run(q, func(t *testing.T) {
+			mockSrv := service.NewMockIService(gomock.NewController(t))
+
+			rr := httptest.NewRecorder()
+			NewHandler(mockSrv).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/aggregate"+q, nil))
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+		})
+	}
+}
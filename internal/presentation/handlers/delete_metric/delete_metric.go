@@ -0,0 +1,88 @@
+package deletemetric
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/common"
+	srv "github.com/dmitastr/yp_observability_service/internal/domain/service"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/logger"
+	"github.com/dmitastr/yp_observability_service/internal/presentation/problem"
+	"github.com/dmitastr/yp_observability_service/internal/presentation/query"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+)
+
+// DeleteMetricHandler handles the requests for deleting metrics
+type DeleteMetricHandler struct {
+	service srv.IService
+}
+
+func NewHandler(s srv.IService) *DeleteMetricHandler {
+	return &DeleteMetricHandler{service: s}
+}
+
+// deleteResult is a response to bulk deletion
+type deleteResult struct {
+	Deleted []string `json:"deleted"`
+}
+
+// ServeHTTP handles DELETE requests:
+//   - with path params {mtype}/{name} - deletes a single metric
+//   - with query params prefix, regex and type - deletes all matching metrics, returns json list of their names.
+//     At least prefix or regex must be set
+func (handler DeleteMetricHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodDelete {
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), 10*time.Second)
+	defer cancel()
+	ctx = context.WithValue(ctx, common.SenderInfo{}, common.ExtractIP(req))
+
+	if name := req.PathValue("name"); name != "" {
+		if err := handler.service.DeleteMetric(ctx, req.PathValue("mtype"), name); err != nil {
+			problem.Render(res, req, err)
+			return
+		}
+		res.WriteHeader(http.StatusOK)
+		return
+	}
+
+	filter, err := parseFilter(req)
+	if err != nil {
+		problem.Render(res, req, err)
+		return
+	}
+	names, err := handler.service.DeleteMetrics(ctx, filter)
+	if err != nil {
+		problem.Render(res, req, err)
+		return
+	}
+	if names == nil {
+		names = []string{}
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(res).Encode(deleteResult{Deleted: names}); err != nil {
+		logger.Errorf("error encoding deleted metrics: %v", err)
+	}
+}
+
+// parseFilter reads bulk deletion filter from query params. Type alone is not enough,
+// so all metrics of a type are not deleted by mistake
+func parseFilter(req *http.Request) (repository.Filter, error) {
+	filter, err := query.Filter(req.URL.Query())
+	if err != nil {
+		return filter, err
+	}
+	if filter.Prefix == "" && filter.Pattern == nil {
+		return filter, errs.InvalidArgument(fmt.Errorf("prefix or regex is required: %w", errs.ErrorEmptyFilter))
+	}
+	return filter, nil
+}
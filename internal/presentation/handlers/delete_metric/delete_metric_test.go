@@ -0,0 +1,77 @@
+package deletemetric
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/mocks/service"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteMetricHandler_Single(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		serviceErr error
+		wantCode   int
+	}{
+		{name: "Deleted", method: http.MethodDelete, wantCode: http.StatusOK},
+		{name: "Missing metric", method: http.MethodDelete, serviceErr: errs.ErrorMetricDoesNotExist, wantCode: http.StatusNotFound},
+		{name: "Wrong type", method: http.MethodDelete, serviceErr: errs.ErrorWrongUpdateType, wantCode: http.StatusBadRequest},
+		{name: "Wrong method", method: http.MethodGet, wantCode: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockSrv := service.NewMockIService(ctrl)
+			if tt.method == http.MethodDelete {
+				mockSrv.EXPECT().DeleteMetric(gomock.Any(), "gauge", "Alloc").Return(tt.serviceErr)
+			}
+
+			req := httptest.NewRequest(tt.method, "/value/gauge/Alloc", nil)
+			req.SetPathValue("mtype", "gauge")
+			req.SetPathValue("name", "Alloc")
+			rr := httptest.NewRecorder()
+			NewHandler(mockSrv).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantCode, rr.Code)
+		})
+	}
+}
+
+func TestDeleteMetricHandler_Bulk(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockSrv := service.NewMockIService(ctrl)
+	mockSrv.EXPECT().DeleteMetrics(gomock.Any(), repository.Filter{Prefix: "host1.", Type: "gauge", Pattern: regexp.MustCompile(`cpu$`)}).
+		Return([]string{"host1.cpu"}, nil)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/metrics?prefix=host1.&type=gauge&regex=cpu$", nil)
+	rr := httptest.NewRecorder()
+	NewHandler(mockSrv).ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	var result deleteResult
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&result))
+	assert.Equal(t, []string{"host1.cpu"}, result.Deleted)
+}
+
+func TestDeleteMetricHandler_BulkRejectsBadFilter(t *testing.T) {
+	for _, query := range []string{"", "?type=gauge", "?regex=("} {
+		t.Run(query, func(t *testing.T) {
+			mockSrv := service.NewMockIService(gomock.NewController(t))
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/metrics"+query, nil)
+			rr := httptest.NewRecorder()
+			NewHandler(mockSrv).ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package dumpmetrics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/domain/dump"
+	srv "github.com/dmitastr/yp_observability_service/internal/domain/service"
+	"github.com/dmitastr/yp_observability_service/internal/logger"
+	"github.com/dmitastr/yp_observability_service/internal/presentation/problem"
+)
+
+// DumpHandler handles admin requests for exporting and importing the whole metric store
+type DumpHandler struct {
+	service srv.IService
+}
+
+func NewHandler(s srv.IService) *DumpHandler {
+	return &DumpHandler{service: s}
+}
+
+// ServeHTTP handles the request, format query param is one of json, ndjson or csv, json by default.
+// Supports methods:
+//   - GET - returns all metrics and metadata
+//   - POST - imports metrics and metadata from the body, mode query param is merge or replace, merge by default.
+//     Returns json with the number of imported and deleted records
+func (handler DumpHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	format, err := dump.ParseFormat(req.URL.Query().Get("format"))
+	if err != nil {
+		problem.Render(res, req, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), time.Minute)
+	defer cancel()
+
+	switch req.Method {
+	case http.MethodGet:
+		d, err := handler.service.Export(ctx)
+		if err != nil {
+			problem.Render(res, req, err)
+			return
+		}
+		res.Header().Set("Content-Type", format.ContentType())
+		res.Header().Set("Content-Disposition", `attachment; filename="metrics.`+string(format)+`"`)
+		res.WriteHeader(http.StatusOK)
+		if err := dump.Encode(res, format, d); err != nil {
+			logger.Errorf("error encoding metrics dump: %v", err)
+		}
+
+	case http.MethodPost:
+		mode, err := srv.ParseImportMode(req.URL.Query().Get("mode"))
+		if err != nil {
+			problem.Render(res, req, err)
+			return
+		}
+		d, err := dump.Decode(req.Body, format)
+		if err != nil {
+			problem.Render(res, req, err)
+			return
+		}
+		result, err := handler.service.Import(ctx, d, mode)
+		if err != nil {
+			problem.Render(res, req, err)
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		res.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(res).Encode(result); err != nil {
+			logger.Errorf("error encoding import result: %v", err)
+		}
+
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,73 @@
+package dumpmetrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dmitastr/yp_observability_service/internal/domain/dump"
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	srv "github.com/dmitastr/yp_observability_service/internal/domain/service"
+	"github.com/dmitastr/yp_observability_service/internal/mocks/service"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDumpHandler_Export(t *testing.T) {
+	delta := int64(5)
+	mockSrv := service.NewMockIService(gomock.NewController(t))
+	mockSrv.EXPECT().Export(gomock.Any()).Return(dump.Dump{
+		Metrics:  []models.Metrics{{ID: "PollCount", MType: "counter", Delta: &delta}},
+		Metadata: []models.Metadata{{Name: "PollCount", Help: "polls"}},
+	}, nil)
+
+	rr := httptest.NewRecorder()
+	NewHandler(mockSrv).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/export?format=ndjson", nil))
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/x-ndjson", rr.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="metrics.ndjson"`, rr.Header().Get("Content-Disposition"))
+	assert.Equal(t, `{"metric":{"id":"PollCount","type":"counter","delta":5}}
+{"metadata":{"name":"PollCount","help":"polls"}}
+`, rr.Body.String())
+}
+
+func TestDumpHandler_Import(t *testing.T) {
+	value := 1.5
+	mockSrv := service.NewMockIService(gomock.NewController(t))
+	mockSrv.EXPECT().Import(gomock.Any(), dump.Dump{Metrics: []models.Metrics{{ID: "Alloc", MType: "gauge", Value: &value}}}, srv.ImportReplace).
+		Return(srv.ImportResult{Metrics: 1, Deleted: 2}, nil)
+
+	body := "kind,name,type,value,help,unit,owner\nmetric,Alloc,gauge,1.5,,,\n"
+	rr := httptest.NewRecorder()
+	NewHandler(mockSrv).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/admin/import?format=csv&mode=replace", strings.NewReader(body)))
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"metrics":1,"metadata":0,"deleted":2}`, rr.Body.String())
+}
+
+func TestDumpHandler_Errors(t *testing.T) {
+	mockSrv := service.NewMockIService(gomock.NewController(t))
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		want   int
+	}{
+		{name: "unknown format", method: http.MethodGet, url: "/admin/export?format=xml", want: http.StatusBadRequest},
+		{name: "unknown mode", method: http.MethodPost, url: "/admin/import?mode=append", body: "{}", want: http.StatusBadRequest},
+		{name: "broken body", method: http.MethodPost, url: "/admin/import", body: "{", want: http.StatusBadRequest},
+		{name: "wrong method", method: http.MethodPut, url: "/admin/import", want: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			NewHandler(mockSrv).ServeHTTP(rr, httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body)))
+			assert.Equal(t, tt.want, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package exprquery
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/domain/expr"
+	srv "github.com/dmitastr/yp_observability_service/internal/domain/service"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/logger"
+	"github.com/dmitastr/yp_observability_service/internal/presentation/problem"
+)
+
+// QueryHandler handles requests evaluating expressions over stored metrics
+type QueryHandler struct {
+	service srv.IService
+}
+
+func NewHandler(s srv.IService) *QueryHandler {
+	return &QueryHandler{service: s}
+}
+
+// queryResponse is a value of expression, result of scalar type holds a single unnamed element
+type queryResponse struct {
+	Expr   string        `json:"expr"`
+	Type   string        `json:"type"`
+	Result []expr.Series `json:"result"`
+}
+
+// ServeHTTP accepts GET requests with expression in expr query param, like
+// /query?expr=rate(PollCount[1m])
+func (handler QueryHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	text := req.URL.Query().Get("expr")
+	if text == "" {
+		problem.Render(res, req, errs.New(errs.KindInvalidArgument, "expr is empty"))
+		return
+	}
+	node, err := expr.Parse(text)
+	if err != nil {
+		problem.Render(res, req, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), 10*time.Second)
+	defer cancel()
+	result, err := expr.NewEvaluator(handler.service, time.Now()).Eval(ctx, node)
+	if err != nil {
+		problem.Render(res, req, err)
+		return
+	}
+
+	response := queryResponse{Expr: node.String(), Type: "vector", Result: result.Vector}
+	if result.Scalar {
+		response.Type = "scalar"
+	}
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(res).Encode(response); err != nil {
+		logger.Errorf("error encoding query result: %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package exprquery
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/mocks/service"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryHandler_ServeHTTP(t *testing.T) {
+	alloc, sys := 4.0, 10.0
+	mockSrv := service.NewMockIService(gomock.NewController(t))
+	mockSrv.EXPECT().ListMetrics(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ any, query repository.ListQuery) ([]models.DescribedMetric, *repository.Cursor, error) {
+			if query.Filter.Pattern != nil {
+				assert.Equal(t, regexp.MustCompile("^Heap.*$").String(), query.Filter.Pattern.String())
+				return []models.DescribedMetric{{Metrics: models.Metrics{ID: "HeapAlloc", MType: "gauge", Value: &alloc}}}, nil, nil
+			}
+			assert.Equal(t, []string{"Sys"}, query.Filter.Names)
+			return []models.DescribedMetric{{Metrics: models.Metrics{ID: "Sys", MType: "gauge", Value: &sys}}}, nil, nil
+		}).Times(2)
+
+	rr := httptest.NewRecorder()
+	NewHandler(mockSrv).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/query?expr="+url.QueryEscape(`"Heap*" / Sys * 100`), nil))
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"expr":"((\"Heap*\" / Sys) * 100)","type":"vector","result":[{"name":"HeapAlloc","value":40}]}`, rr.Body.String())
+}
+
+func TestQueryHandler_Scalar(t *testing.T) {
+	rr := httptest.NewRecorder()
+	NewHandler(service.NewMockIService(gomock.NewController(t))).
+		ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/query?expr="+url.QueryEscape("(1 + 2) / 4"), nil))
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"expr":"((1 + 2) / 4)","type":"scalar","result":[{"value":0.75}]}`, rr.Body.String())
+}
+
+func TestQueryHandler_Errors(t *testing.T) {
+	mockSrv := service.NewMockIService(gomock.NewController(t))
+	mockSrv.EXPECT().ListMetrics(gomock.Any(), gomock.Any()).Return(nil, nil, errs.New(errs.KindUnavailable, "storage is down"))
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		want   int
+	}{
+		{name: "empty expression", method: http.MethodGet, url: "/query", want: http.StatusBadRequest},
+		{name: "syntax error", method: http.MethodGet, url: "/query?expr=sum(", want: http.StatusBadRequest},
+		{name: "storage error", method: http.MethodGet, url: "/query?expr=Alloc", want: http.StatusServiceUnavailable},
+		{name: "wrong method", method: http.MethodPost, url: "/query?expr=Alloc", want: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			NewHandler(mockSrv).ServeHTTP(rr, httptest.NewRequest(tt.method, tt.url, nil))
+			assert.Equal(t, tt.want, rr.Code)
+		})
+	}
+}
@@ -3,12 +3,16 @@ package getmetric
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/dmitastr/yp_observability_service/internal/common"
 	srv "github.com/dmitastr/yp_observability_service/internal/domain/service"
 	"github.com/dmitastr/yp_observability_service/internal/errs"
 	"github.com/dmitastr/yp_observability_service/internal/logger"
+	"github.com/dmitastr/yp_observability_service/internal/presentation/problem"
 	"github.com/dmitastr/yp_observability_service/internal/presentation/update"
 )
 
@@ -21,9 +25,16 @@ func NewHandler(s srv.IService) *GetMetricHandler {
 	return &GetMetricHandler{service: s}
 }
 
+// Kinds of counter rate requested with rate query param
+const (
+	rateInstant = "instant"
+	rateEWMA    = "ewma"
+)
+
 // ServeHTTP handles the request, supports methods:
 //   - POST - accept json data, returns json
-//   - GET - accept path params {mtype}/{name}, returns metrics value in the body
+//   - GET - accept path params {mtype}/{name}, returns metrics value in the body.
+//     With rate=instant or rate=ewma query param returns per second rate of the counter instead
 func (handler GetMetricHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	var upd update.MetricUpdate
 
@@ -31,10 +42,14 @@ func (handler GetMetricHandler) ServeHTTP(res http.ResponseWriter, req *http.Req
 	case http.MethodGet:
 		mtype := req.PathValue("mtype")
 		name := req.PathValue("name")
+		if req.URL.Query().Has("rate") {
+			handler.serveRate(res, req, mtype, name)
+			return
+		}
 		upd, _ = update.New(name, mtype, "1")
 	case http.MethodPost:
 		if err := json.NewDecoder(req.Body).Decode(&upd); err != nil {
-			http.Error(res, err.Error(), http.StatusNotFound)
+			problem.Render(res, req, errs.InvalidArgument(fmt.Errorf("error while reading request body: %w", err)))
 			return
 		}
 		upd.MetricValue = "1"
@@ -46,7 +61,7 @@ func (handler GetMetricHandler) ServeHTTP(res http.ResponseWriter, req *http.Req
 	logger.Infof("receive update=%s", upd)
 
 	if !upd.IsValid() {
-		http.Error(res, errs.ErrorWrongPath.Error(), http.StatusNotFound)
+		problem.Render(res, req, errs.ErrorWrongPath)
 		return
 	}
 
@@ -54,7 +69,7 @@ func (handler GetMetricHandler) ServeHTTP(res http.ResponseWriter, req *http.Req
 	defer cancel()
 	metric, err := handler.service.GetMetric(ctx, upd)
 	if err != nil {
-		http.Error(res, err.Error(), http.StatusNotFound)
+		problem.Render(res, req, err)
 		return
 	}
 
@@ -62,7 +77,7 @@ func (handler GetMetricHandler) ServeHTTP(res http.ResponseWriter, req *http.Req
 	case http.MethodGet:
 		valString, err := metric.GetValueString()
 		if err != nil {
-			http.Error(res, err.Error(), http.StatusInternalServerError)
+			problem.Render(res, req, err)
 			return
 		}
 		res.WriteHeader(http.StatusOK)
@@ -73,7 +88,7 @@ func (handler GetMetricHandler) ServeHTTP(res http.ResponseWriter, req *http.Req
 		res.Header().Set("Content-Type", "application/json")
 		res.WriteHeader(http.StatusOK)
 		if err := json.NewEncoder(res).Encode(&metric); err != nil {
-			http.Error(res, err.Error(), http.StatusNotFound)
+			logger.Errorf("error encoding metric: %v", err)
 			return
 		}
 		return
@@ -83,3 +98,35 @@ func (handler GetMetricHandler) ServeHTTP(res http.ResponseWriter, req *http.Req
 	}
 
 }
+
+// serveRate writes per second rate of the counter
+func (handler GetMetricHandler) serveRate(res http.ResponseWriter, req *http.Request, mtype, name string) {
+	kind := req.URL.Query().Get("rate")
+	if kind != rateInstant && kind != rateEWMA {
+		problem.Render(res, req, errs.InvalidArgument(fmt.Errorf("unknown rate '%s', expected instant or ewma", kind)))
+		return
+	}
+	if mtype != common.COUNTER {
+		problem.Render(res, req, errs.New(errs.KindInvalidArgument, "rate is computed only for counters"))
+		return
+	}
+	if name == "" {
+		problem.Render(res, req, errs.ErrorWrongPath)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), 3*time.Second)
+	defer cancel()
+	rate, err := handler.service.CounterRate(ctx, name)
+	if err != nil {
+		problem.Render(res, req, err)
+		return
+	}
+
+	value := rate.Instant
+	if kind == rateEWMA {
+		value = rate.EWMA
+	}
+	res.WriteHeader(http.StatusOK)
+	res.Write([]byte(strconv.FormatFloat(value, 'f', -1, 64)))
+}
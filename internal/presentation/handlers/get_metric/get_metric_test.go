@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
 	"github.com/dmitastr/yp_observability_service/internal/mocks/service"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -110,3 +111,39 @@ func TestGetMetricHandler_ServeHTTP(t *testing.T) {
 		})
 	}
 }
+
+func TestGetMetricHandler_Rate(t *testing.T) {
+	mockSrv := service.NewMockIService(gomock.NewController(t))
+	mockSrv.EXPECT().CounterRate(gomock.Any(), "PollCount").Return(models.CounterRate{Instant: 2.5, EWMA: 1.25}, nil).Times(2)
+	mockSrv.EXPECT().CounterRate(gomock.Any(), "Missing").Return(models.CounterRate{}, errs.ErrorMetricDoesNotExist)
+
+	tests := []struct {
+		name     string
+		url      string
+		mtype    string
+		metric   string
+		wantCode int
+		want     string
+	}{
+		{name: "instant", url: "/value/counter/PollCount?rate=instant", mtype: "counter", metric: "PollCount", wantCode: http.StatusOK, want: "2.5"},
+		{name: "ewma", url: "/value/counter/PollCount?rate=ewma", mtype: "counter", metric: "PollCount", wantCode: http.StatusOK, want: "1.25"},
+		{name: "missing counter", url: "/value/counter/Missing?rate=ewma", mtype: "counter", metric: "Missing", wantCode: http.StatusNotFound},
+		{name: "unknown rate", url: "/value/counter/PollCount?rate=avg", mtype: "counter", metric: "PollCount", wantCode: http.StatusBadRequest},
+		{name: "gauge", url: "/value/gauge/Alloc?rate=instant", mtype: "gauge", metric: "Alloc", wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			req.SetPathValue("mtype", tt.mtype)
+			req.SetPathValue("name", tt.metric)
+			rr := httptest.NewRecorder()
+
+			NewHandler(mockSrv).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantCode, rr.Code)
+			if tt.want != "" {
+				assert.Equal(t, tt.want, rr.Body.String())
+			}
+		})
+	}
+}
@@ -2,17 +2,30 @@ package listmetric
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"html/template"
 	"net/http"
-	"os"
-	"path/filepath"
-	"strings"
 	"time"
 
+	"github.com/dmitastr/yp_observability_service/internal/domain/live"
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
 	srv "github.com/dmitastr/yp_observability_service/internal/domain/service"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
 	"github.com/dmitastr/yp_observability_service/internal/logger"
+	"github.com/dmitastr/yp_observability_service/internal/presentation/problem"
+	"github.com/dmitastr/yp_observability_service/web"
 )
 
+// dashboard is parsed once, the template is embedded so parsing can fail only on a broken build
+var dashboard = template.Must(template.ParseFS(web.FS, "templates/index.html"))
+
+// dashboardData is rendered by the dashboard template
+type dashboardData struct {
+	Metrics     []models.DisplayMetric
+	HistorySize int
+}
+
 // ListMetricsHandler handles requests for getting a list of all metrics
 type ListMetricsHandler struct {
 	service srv.IService
@@ -22,46 +35,29 @@ func NewHandler(s srv.IService) *ListMetricsHandler {
 	return &ListMetricsHandler{service: s}
 }
 
-// ServeHTTP accept GET requests, fetching a list of all metrics from db and
-// rendering them as html table
+// ServeHTTP accept GET requests, fetching a list of all metrics with their recent values from db and
+// rendering them as html dashboard. The dashboard receives further changes from /subscribe
 func (handler ListMetricsHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodGet {
 		res.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
-	res.Header().Set("Content-Type", "text/html")
 
 	ctx, cancel := context.WithTimeout(req.Context(), 3*time.Second)
 	defer cancel()
 
 	metrics, err := handler.service.GetAll(ctx)
-	if err != nil {
-		logger.Errorf("error while getting metrics: %v", err)
-		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	if err != nil && !errors.Is(err, errs.ErrorMetricTableEmpty) {
+		problem.Render(res, req, fmt.Errorf("error while getting metrics: %w", err))
 		return
 	}
 	logger.Infof("Receive %d metrics from db", len(metrics))
-
-	wd, err := os.Getwd()
-	if err != nil {
-		logger.Errorf("error while getting working directory: %v", err)
-		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		return
-	}
-	parentPath := "./"
-	if strings.Contains(wd, "handlers") {
-		parentPath = "../../../../"
-	}
-	templatePath := filepath.Join(parentPath, "web", "templates", "index.html")
-	t, err := template.ParseFiles(templatePath)
-	if err != nil {
-		logger.Errorf("Template parsing error: %v", err)
-		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		return
+	if metrics == nil {
+		metrics = []models.DisplayMetric{}
 	}
 
 	res.Header().Set("Content-Type", "text/html")
-	err = t.Execute(res, metrics)
+	err = dashboard.Execute(res, dashboardData{Metrics: metrics, HistorySize: live.HistorySize})
 	if err != nil {
 		logger.Errorf("Template execution error: %v", err)
 		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
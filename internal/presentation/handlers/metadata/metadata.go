@@ -0,0 +1,82 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	srv "github.com/dmitastr/yp_observability_service/internal/domain/service"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/logger"
+	"github.com/dmitastr/yp_observability_service/internal/presentation/problem"
+)
+
+// MetadataHandler handles requests for reading and editing metric metadata
+type MetadataHandler struct {
+	service srv.IService
+}
+
+func NewHandler(s srv.IService) *MetadataHandler {
+	return &MetadataHandler{service: s}
+}
+
+// ServeHTTP handles the request, supports methods:
+//   - GET - without path param returns json list of all metadata, with path param {name} returns metadata of the metric
+//   - PUT - accept path param {name} and json metadata, replaces metadata of the metric
+func (handler MetadataHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(req.Context(), 3*time.Second)
+	defer cancel()
+	name := req.PathValue("name")
+
+	var result any
+	switch {
+	case req.Method == http.MethodGet && name == "":
+		list, err := handler.service.ListMetadata(ctx)
+		if err != nil {
+			problem.Render(res, req, err)
+			return
+		}
+		if list == nil {
+			list = []models.Metadata{}
+		}
+		result = list
+
+	case req.Method == http.MethodGet:
+		md, err := handler.service.GetMetadata(ctx, name)
+		if err != nil {
+			problem.Render(res, req, err)
+			return
+		}
+		result = md
+
+	case req.Method == http.MethodPut:
+		var md models.Metadata
+		if err := json.NewDecoder(req.Body).Decode(&md); err != nil {
+			problem.Render(res, req, errs.InvalidArgument(fmt.Errorf("error while reading request body: %w", err)))
+			return
+		}
+		if md.Name != "" && md.Name != name {
+			problem.Render(res, req, errs.New(errs.KindInvalidArgument, "metric name in body does not match the path"))
+			return
+		}
+		md.Name = name
+		if err := handler.service.SetMetadata(ctx, md); err != nil {
+			problem.Render(res, req, err)
+			return
+		}
+		result = md
+
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(res).Encode(result); err != nil {
+		logger.Errorf("error encoding metadata: %v", err)
+	}
+}
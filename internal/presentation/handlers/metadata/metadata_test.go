@@ -0,0 +1,97 @@
+package metadata
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/mocks/service"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadataHandler_ServeHTTP(t *testing.T) {
+	md := models.Metadata{Name: "OtherSys", Help: "memory of other runtime allocations", Unit: "bytes", Owner: "platform", Type: "gauge"}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		setup    func(m *service.MockIService)
+		wantCode int
+		want     string
+	}{
+		{
+			name:   "List",
+			method: http.MethodGet,
+			setup: func(m *service.MockIService) {
+				m.EXPECT().ListMetadata(gomock.Any()).Return([]models.Metadata{md}, nil)
+			},
+			wantCode: http.StatusOK,
+			want:     `[{"name":"OtherSys","help":"memory of other runtime allocations","unit":"bytes","owner":"platform","type":"gauge"}]`,
+		},
+		{
+			name:   "Get missing",
+			method: http.MethodGet,
+			path:   "Missing",
+			setup: func(m *service.MockIService) {
+				m.EXPECT().GetMetadata(gomock.Any(), "Missing").Return(nil, errs.ErrorMetadataDoesNotExist)
+			},
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:   "Put",
+			method: http.MethodPut,
+			path:   "OtherSys",
+			body:   `{"help":"memory of other runtime allocations","unit":"bytes","owner":"platform","type":"gauge"}`,
+			setup: func(m *service.MockIService) {
+				m.EXPECT().SetMetadata(gomock.Any(), md).Return(nil)
+			},
+			wantCode: http.StatusOK,
+			want:     `{"name":"OtherSys","help":"memory of other runtime allocations","unit":"bytes","owner":"platform","type":"gauge"}`,
+		},
+		{
+			name:     "Put with another name",
+			method:   http.MethodPut,
+			path:     "OtherSys",
+			body:     `{"name":"Alloc"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Put invalid json",
+			method:   http.MethodPut,
+			path:     "OtherSys",
+			body:     `{`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Wrong method",
+			method:   http.MethodPost,
+			path:     "OtherSys",
+			wantCode: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSrv := service.NewMockIService(gomock.NewController(t))
+			if tt.setup != nil {
+				tt.setup(mockSrv)
+			}
+
+			req := httptest.NewRequest(tt.method, "/meta/"+tt.path, strings.NewReader(tt.body))
+			req.SetPathValue("name", tt.path)
+			rr := httptest.NewRecorder()
+			NewHandler(mockSrv).ServeHTTP(rr, req)
+
+			require.Equal(t, tt.wantCode, rr.Code)
+			if tt.want != "" {
+				assert.JSONEq(t, tt.want, rr.Body.String())
+			}
+		})
+	}
+}
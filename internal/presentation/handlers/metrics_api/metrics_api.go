@@ -0,0 +1,93 @@
+package metricsapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	srv "github.com/dmitastr/yp_observability_service/internal/domain/service"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/logger"
+	"github.com/dmitastr/yp_observability_service/internal/presentation/problem"
+	"github.com/dmitastr/yp_observability_service/internal/presentation/query"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+)
+
+// MetricsAPIHandler handles requests for listing metrics as json
+type MetricsAPIHandler struct {
+	service srv.IService
+}
+
+func NewHandler(s srv.IService) *MetricsAPIHandler {
+	return &MetricsAPIHandler{service: s}
+}
+
+// listResponse is a page of metrics, NextCursor is empty on the last page
+type listResponse struct {
+	Metrics    []models.DescribedMetric `json:"metrics"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
+}
+
+// ServeHTTP accepts GET requests with optional query params:
+//   - type, prefix, regex - select metrics
+//   - sort - one of name, -name, type, -type, name by default
+//   - limit - page size
+//   - cursor - next_cursor returned with the previous page
+func (handler MetricsAPIHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	listQuery, err := parseListQuery(req)
+	if err != nil {
+		problem.Render(res, req, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), 10*time.Second)
+	defer cancel()
+	metrics, next, err := handler.service.ListMetrics(ctx, listQuery)
+	if err != nil {
+		problem.Render(res, req, err)
+		return
+	}
+
+	response := listResponse{Metrics: metrics}
+	if next != nil {
+		response.NextCursor = next.Encode()
+	}
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(res).Encode(response); err != nil {
+		logger.Errorf("error encoding metrics page: %v", err)
+	}
+}
+
+func parseListQuery(req *http.Request) (repository.ListQuery, error) {
+	values := req.URL.Query()
+	filter, err := query.Filter(values)
+	if err != nil {
+		return repository.ListQuery{}, err
+	}
+	sort, err := repository.ParseSort(values.Get("sort"))
+	if err != nil {
+		return repository.ListQuery{}, err
+	}
+	cursor, err := repository.DecodeCursor(values.Get("cursor"))
+	if err != nil {
+		return repository.ListQuery{}, err
+	}
+
+	listQuery := repository.ListQuery{Filter: filter, Sort: sort, Cursor: cursor}
+	if limit := values.Get("limit"); limit != "" {
+		if listQuery.Limit, err = strconv.Atoi(limit); err != nil || listQuery.Limit <= 0 {
+			return repository.ListQuery{}, errs.InvalidArgument(fmt.Errorf("limit must be a positive number, got '%s'", limit))
+		}
+	}
+	return listQuery, nil
+}
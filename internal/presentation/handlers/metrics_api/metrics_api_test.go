@@ -0,0 +1,55 @@
+package metricsapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/mocks/service"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsAPIHandler_ServeHTTP(t *testing.T) {
+	value := 1.5
+	metric := models.DescribedMetric{
+		Metrics: models.Metrics{ID: "Alloc", MType: "gauge", Value: &value},
+		Meta:    &models.Metadata{Name: "Alloc", Unit: "bytes"},
+	}
+	next := repository.Cursor{Sort: repository.SortByNameDesc, Name: "Alloc"}
+
+	ctrl := gomock.NewController(t)
+	mockSrv := service.NewMockIService(ctrl)
+	mockSrv.EXPECT().ListMetrics(gomock.Any(), repository.ListQuery{
+		Filter: repository.Filter{Type: "gauge", Prefix: "A"},
+		Sort:   repository.SortByNameDesc,
+		Limit:  1,
+		Cursor: &repository.Cursor{Sort: repository.SortByNameDesc, Name: "B"},
+	}).Return([]models.DescribedMetric{metric}, &next, nil)
+
+	cursor := repository.Cursor{Sort: repository.SortByNameDesc, Name: "B"}.Encode()
+	req := httptest.NewRequest(http.MethodGet, "/api/metrics?type=gauge&prefix=A&sort=-name&limit=1&cursor="+cursor, nil)
+	rr := httptest.NewRecorder()
+	NewHandler(mockSrv).ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"metrics":[{"id":"Alloc","type":"gauge","value":1.5,"meta":{"name":"Alloc","unit":"bytes"}}],"next_cursor":"`+next.Encode()+`"}`, rr.Body.String())
+}
+
+func TestMetricsAPIHandler_BadQuery(t *testing.T) {
+	for _, q := range []string{"?sort=value", "?limit=-1", "?limit=abc", "?cursor=not*base64", "?cursor=e30", "?regex=("} {
+		t.Run(q, func(t *testing.T) {
+			mockSrv := service.NewMockIService(gomock.NewController(t))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/metrics", nil)
+			req.URL.RawQuery = q[1:]
+			rr := httptest.NewRecorder()
+			NewHandler(mockSrv).ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package resetcounter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/common"
+	srv "github.com/dmitastr/yp_observability_service/internal/domain/service"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/logger"
+	"github.com/dmitastr/yp_observability_service/internal/presentation/problem"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+)
+
+// ResetCounterHandler handles the requests for resetting counters to zero
+type ResetCounterHandler struct {
+	service srv.IService
+}
+
+func NewHandler(s srv.IService) *ResetCounterHandler {
+	return &ResetCounterHandler{service: s}
+}
+
+// resetResult is a counter value before reset
+type resetResult struct {
+	Name     string `json:"name"`
+	Previous int64  `json:"previous_value"`
+}
+
+// ServeHTTP handles POST requests:
+//   - with path param {name} - resets a single counter
+//   - with query param prefix - resets counters with names starting with prefix
+//   - with query param all=true - resets all counters
+//
+// Returns json list of reset counters with their previous values
+func (handler ResetCounterHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), 10*time.Second)
+	defer cancel()
+	ctx = context.WithValue(ctx, common.SenderInfo{}, common.ExtractIP(req))
+
+	var results []resetResult
+	if name := req.PathValue("name"); name != "" {
+		previous, err := handler.service.ResetCounter(ctx, name)
+		if err != nil {
+			problem.Render(res, req, err)
+			return
+		}
+		results = append(results, resetResult{Name: name, Previous: previous})
+	} else {
+		filter, err := parseFilter(req)
+		if err != nil {
+			problem.Render(res, req, err)
+			return
+		}
+		previous, err := handler.service.ResetCounters(ctx, filter)
+		if err != nil {
+			problem.Render(res, req, err)
+			return
+		}
+		results = make([]resetResult, 0, len(previous))
+		for _, m := range previous {
+			result := resetResult{Name: m.ID}
+			if m.Delta != nil {
+				result.Previous = *m.Delta
+			}
+			results = append(results, result)
+		}
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(res).Encode(results); err != nil {
+		logger.Errorf("error encoding reset counters: %v", err)
+	}
+}
+
+// parseFilter reads bulk reset filter from query params. Resetting all counters must be requested explicitly
+func parseFilter(req *http.Request) (repository.Filter, error) {
+	query := req.URL.Query()
+	prefix, all := query.Get("prefix"), query.Get("all") == "true"
+	switch {
+	case prefix != "" && all:
+		return repository.Filter{}, errs.New(errs.KindInvalidArgument, "prefix and all can not be used together")
+	case prefix != "":
+		return repository.Filter{Prefix: prefix}, nil
+	case all:
+		return repository.Filter{}, nil
+	default:
+		return repository.Filter{}, errs.New(errs.KindInvalidArgument, "counter name, prefix or all=true is required")
+	}
+}
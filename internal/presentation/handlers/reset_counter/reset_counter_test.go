@@ -0,0 +1,69 @@
+package resetcounter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/mocks/service"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResetCounterHandler_Single(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockSrv := service.NewMockIService(ctrl)
+	mockSrv.EXPECT().ResetCounter(gomock.Any(), "PollCount").Return(int64(7), nil)
+	mockSrv.EXPECT().ResetCounter(gomock.Any(), "Missing").Return(int64(0), errs.ErrorMetricDoesNotExist)
+	handler := NewHandler(mockSrv)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/counters/PollCount/reset", nil)
+	req.SetPathValue("name", "PollCount")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	var results []resetResult
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&results))
+	assert.Equal(t, []resetResult{{Name: "PollCount", Previous: 7}}, results)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/counters/Missing/reset", nil)
+	req.SetPathValue("name", "Missing")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestResetCounterHandler_Bulk(t *testing.T) {
+	delta := int64(3)
+	tests := []struct {
+		name       string
+		query      string
+		wantFilter *repository.Filter
+		wantCode   int
+	}{
+		{name: "Prefix", query: "?prefix=quota.", wantFilter: &repository.Filter{Prefix: "quota."}, wantCode: http.StatusOK},
+		{name: "All", query: "?all=true", wantFilter: &repository.Filter{}, wantCode: http.StatusOK},
+		{name: "No selector", query: "", wantCode: http.StatusBadRequest},
+		{name: "Prefix with all", query: "?prefix=quota.&all=true", wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSrv := service.NewMockIService(gomock.NewController(t))
+			if tt.wantFilter != nil {
+				mockSrv.EXPECT().ResetCounters(gomock.Any(), *tt.wantFilter).
+					Return([]models.Metrics{{ID: "quota.a", MType: "counter", Delta: &delta}}, nil)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/counters/reset"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			NewHandler(mockSrv).ServeHTTP(rr, req)
+			assert.Equal(t, tt.wantCode, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package snapshots
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/logger"
+	"github.com/dmitastr/yp_observability_service/internal/presentation/problem"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+)
+
+// SnapshotsHandler handles admin requests for listing and restoring storage snapshots
+type SnapshotsHandler struct {
+	restorer repository.SnapshotRestorer
+}
+
+func NewHandler(restorer repository.SnapshotRestorer) *SnapshotsHandler {
+	return &SnapshotsHandler{restorer: restorer}
+}
+
+// ServeHTTP handles the request, supports methods:
+//   - GET - returns json list of retained snapshots, the newest first
+//   - POST - accept path param {name}, restores all metrics from the snapshot
+func (handler SnapshotsHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(req.Context(), 10*time.Second)
+	defer cancel()
+
+	switch req.Method {
+	case http.MethodGet:
+		snapshots, err := handler.restorer.ListSnapshots(ctx)
+		if err != nil {
+			problem.Render(res, req, err)
+			return
+		}
+		if snapshots == nil {
+			snapshots = []repository.SnapshotInfo{}
+		}
+		res.Header().Set("Content-Type", "application/json")
+		res.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(res).Encode(snapshots); err != nil {
+			logger.Errorf("error encoding snapshots list: %v", err)
+		}
+
+	case http.MethodPost:
+		name := req.PathValue("name")
+		if err := handler.restorer.RestoreSnapshot(ctx, name); err != nil {
+			problem.Render(res, req, err)
+			return
+		}
+		res.WriteHeader(http.StatusOK)
+
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,70 @@
+package snapshots
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRestorer struct {
+	snapshots []repository.SnapshotInfo
+	restored  []string
+}
+
+func (r *fakeRestorer) ListSnapshots(context.Context) ([]repository.SnapshotInfo, error) {
+	return r.snapshots, nil
+}
+
+func (r *fakeRestorer) RestoreSnapshot(_ context.Context, name string) error {
+	for _, info := range r.snapshots {
+		if info.Name == name {
+			r.restored = append(r.restored, name)
+			return nil
+		}
+	}
+	return errs.ErrorSnapshotDoesNotExist
+}
+
+func TestSnapshotsHandler_ServeHTTP(t *testing.T) {
+	restorer := &fakeRestorer{snapshots: []repository.SnapshotInfo{
+		{Name: "data-20260101T000000.000000000Z.json", CreatedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), Size: 10},
+	}}
+	handler := NewHandler(restorer)
+
+	tests := []struct {
+		name     string
+		method   string
+		snapshot string
+		wantCode int
+	}{
+		{name: "List", method: http.MethodGet, wantCode: http.StatusOK},
+		{name: "Restore", method: http.MethodPost, snapshot: "data-20260101T000000.000000000Z.json", wantCode: http.StatusOK},
+		{name: "Restore missing snapshot", method: http.MethodPost, snapshot: "data-missing.json", wantCode: http.StatusNotFound},
+		{name: "Wrong method", method: http.MethodDelete, wantCode: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "http://localhost", nil)
+			req.SetPathValue("name", tt.snapshot)
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+			assert.Equal(t, tt.wantCode, rr.Code)
+
+			if tt.method == http.MethodGet {
+				var snapshots []repository.SnapshotInfo
+				require.NoError(t, json.NewDecoder(rr.Body).Decode(&snapshots))
+				assert.Equal(t, restorer.snapshots, snapshots)
+			}
+		})
+	}
+	assert.Equal(t, []string{"data-20260101T000000.000000000Z.json"}, restorer.restored)
+}
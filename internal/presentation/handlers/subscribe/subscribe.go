@@ -0,0 +1,163 @@
+package subscribe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/domain/live"
+	srv "github.com/dmitastr/yp_observability_service/internal/domain/service"
+	"github.com/dmitastr/yp_observability_service/internal/logger"
+	"github.com/dmitastr/yp_observability_service/internal/presentation/problem"
+	"github.com/dmitastr/yp_observability_service/internal/presentation/query"
+	"github.com/gorilla/websocket"
+)
+
+// KeepAlive is the interval of comments or pings sent to an idle stream, so proxies do not close the connection
+var KeepAlive = 15 * time.Second
+
+// WriteTimeout limits writing a single WebSocket message
+var WriteTimeout = 10 * time.Second
+
+// CloseEvicted is the WebSocket close code sent to an evicted subscriber
+const CloseEvicted = 4000
+
+// evictedReason is sent to a subscriber evicted for falling behind
+const evictedReason = "subscriber is too slow, changes were dropped"
+
+// upgrader accepts WebSocket connections from the same origin or from clients not sending Origin
+var upgrader = websocket.Upgrader{}
+
+// SubscribeHandler streams changes of metrics to subscribers
+type SubscribeHandler struct {
+	service srv.IService
+}
+
+func NewHandler(s srv.IService) *SubscribeHandler {
+	return &SubscribeHandler{service: s}
+}
+
+// ServeHTTP handles GET requests with optional query params selecting metrics:
+//   - names - comma separated metric names, may be repeated
+//   - type, prefix, regex - like in /api/metrics
+//
+// WebSocket upgrade requests receive every change as json [live.Event] text message, other requests receive
+// server-sent events named "metrics" with the same data. A subscriber falling behind is evicted: the stream
+// gets an "evicted" event or the WebSocket is closed with [CloseEvicted] code. Changes made while a client
+// is disconnected are lost, so after reconnecting it should reload current values
+func (handler SubscribeHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	filter, err := query.Filter(req.URL.Query())
+	if err != nil {
+		problem.Render(res, req, err)
+		return
+	}
+	filter.Names = query.Names(req.URL.Query())
+
+	// canceling ctx ends the subscription and closes its events
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	subscription, err := handler.service.Subscribe(ctx, filter)
+	if err != nil {
+		problem.Render(res, req, err)
+		return
+	}
+
+	if websocket.IsWebSocketUpgrade(req) {
+		serveWebSocket(res, req, subscription, cancel)
+		return
+	}
+	serveEvents(res, subscription)
+}
+
+// serveEvents writes events to server-sent events stream until subscription ends
+func serveEvents(res http.ResponseWriter, subscription *live.Subscription) {
+	rc := http.NewResponseController(res)
+	res.Header().Set("Content-Type", "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		logger.Errorf("error flushing event stream: %v", err)
+		return
+	}
+
+	ticker := time.NewTicker(KeepAlive)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case event, ok := <-subscription.Events:
+			if !ok {
+				if subscription.Evicted() {
+					_, _ = fmt.Fprintf(res, "event: evicted\ndata: %s\n\n", evictedReason)
+					_ = rc.Flush()
+				}
+				return
+			}
+			data, encodeErr := json.Marshal(event)
+			if encodeErr != nil {
+				logger.Errorf("error encoding event: %v", encodeErr)
+				continue
+			}
+			_, err = fmt.Fprintf(res, "event: metrics\ndata: %s\n\n", data)
+		case <-ticker.C:
+			_, err = fmt.Fprint(res, ": keep-alive\n\n")
+		}
+		if err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// serveWebSocket writes events to WebSocket until subscription ends. Messages from the client are ignored,
+// closing the connection by the client cancels subscription
+func serveWebSocket(res http.ResponseWriter, req *http.Request, subscription *live.Subscription, cancel context.CancelFunc) {
+	conn, err := upgrader.Upgrade(res, req, nil)
+	if err != nil {
+		// upgrader has already replied with an error
+		logger.Errorf("error upgrading to websocket: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(KeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case event, ok := <-subscription.Events:
+			if !ok {
+				if subscription.Evicted() {
+					msg := websocket.FormatCloseMessage(CloseEvicted, evictedReason)
+					_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(WriteTimeout))
+				}
+				return
+			}
+			_ = conn.SetWriteDeadline(time.Now().Add(WriteTimeout))
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(WriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
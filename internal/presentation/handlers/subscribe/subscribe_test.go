@@ -0,0 +1,126 @@
+package subscribe
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/domain/live"
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/mocks/service"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func counterEvent(delta int64) live.Event {
+	return live.Event{
+		Time:    time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		Updated: []models.Metrics{{ID: "PollCount", MType: "counter", Delta: &delta}},
+	}
+}
+
+const eventData = `{"time":"2025-01-02T03:04:05Z","updated":[{"id":"PollCount","type":"counter","delta":5}]}`
+
+func TestSubscribeHandler_Events(t *testing.T) {
+	hub := live.NewHub(10)
+	ctx, cancel := context.WithCancel(t.Context())
+	mockSrv := service.NewMockIService(gomock.NewController(t))
+	mockSrv.EXPECT().Subscribe(gomock.Any(), repository.Filter{Names: []string{"PollCount", "Alloc", "Sys"}, Prefix: "P"}).
+		DoAndReturn(func(ctx context.Context, f repository.Filter) (*live.Subscription, error) {
+			subscription := hub.Subscribe(ctx, f)
+			hub.Publish(counterEvent(5))
+			// client disconnects after the event is published
+			cancel()
+			return subscription, nil
+		})
+
+	req := httptest.NewRequestWithContext(ctx, http.MethodGet, "/subscribe?names=PollCount,Alloc&names=Sys&prefix=P", nil)
+	rr := httptest.NewRecorder()
+	NewHandler(mockSrv).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/event-stream", rr.Header().Get("Content-Type"))
+	assert.True(t, rr.Flushed)
+	assert.Equal(t, "event: metrics\ndata: "+eventData+"\n\n", rr.Body.String())
+}
+
+func TestSubscribeHandler_EventsWithoutFilter(t *testing.T) {
+	hub := live.NewHub(10)
+	ctx, cancel := context.WithCancel(t.Context())
+	mockSrv := service.NewMockIService(gomock.NewController(t))
+	mockSrv.EXPECT().Subscribe(gomock.Any(), repository.Filter{}).
+		DoAndReturn(func(ctx context.Context, f repository.Filter) (*live.Subscription, error) {
+			subscription := hub.Subscribe(ctx, f)
+			hub.Publish(counterEvent(5))
+			cancel()
+			return subscription, nil
+		})
+
+	// /events clients do not pass a filter and receive all changes
+	rr := httptest.NewRecorder()
+	NewHandler(mockSrv).ServeHTTP(rr, httptest.NewRequestWithContext(ctx, http.MethodGet, "/events", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "event: metrics\ndata: "+eventData+"\n\n", rr.Body.String())
+}
+
+func TestSubscribeHandler_EventsEvicted(t *testing.T) {
+	hub := live.NewHub(1)
+	mockSrv := service.NewMockIService(gomock.NewController(t))
+	subscription := hub.Subscribe(t.Context(), repository.Filter{})
+	mockSrv.EXPECT().Subscribe(gomock.Any(), repository.Filter{}).Return(subscription, nil)
+	hub.Publish(counterEvent(5))
+	hub.Publish(counterEvent(6))
+
+	rr := httptest.NewRecorder()
+	NewHandler(mockSrv).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/subscribe", nil))
+
+	assert.Equal(t, "event: metrics\ndata: "+eventData+"\n\nevent: evicted\ndata: "+evictedReason+"\n\n", rr.Body.String())
+}
+
+func TestSubscribeHandler_WebSocket(t *testing.T) {
+	hub := live.NewHub(10)
+	mockSrv := service.NewMockIService(gomock.NewController(t))
+	mockSrv.EXPECT().Subscribe(gomock.Any(), repository.Filter{Names: []string{"PollCount"}}).
+		DoAndReturn(func(ctx context.Context, f repository.Filter) (*live.Subscription, error) {
+			return hub.Subscribe(ctx, f), nil
+		})
+	server := httptest.NewServer(NewHandler(mockSrv))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/subscribe?names=PollCount"
+	conn, _, err := websocket.DefaultDialer.DialContext(t.Context(), url, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	hub.Publish(counterEvent(5))
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	messageType, data, err := conn.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, websocket.TextMessage, messageType)
+	assert.JSONEq(t, eventData, string(data))
+}
+
+func TestSubscribeHandler_Errors(t *testing.T) {
+	mockSrv := service.NewMockIService(gomock.NewController(t))
+	mockSrv.EXPECT().Subscribe(gomock.Any(), gomock.Any()).Return(nil, errs.New(errs.KindUnavailable, "disabled"))
+
+	rr := httptest.NewRecorder()
+	NewHandler(mockSrv).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/subscribe", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+	rr = httptest.NewRecorder()
+	NewHandler(mockSrv).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/subscribe?regex=(", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = httptest.NewRecorder()
+	NewHandler(mockSrv).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/subscribe", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
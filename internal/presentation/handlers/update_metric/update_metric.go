@@ -7,9 +7,11 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/dmitastr/yp_observability_service/internal/common"
 	srv "github.com/dmitastr/yp_observability_service/internal/domain/service"
 	"github.com/dmitastr/yp_observability_service/internal/errs"
 	"github.com/dmitastr/yp_observability_service/internal/logger"
+	"github.com/dmitastr/yp_observability_service/internal/presentation/problem"
 	"github.com/dmitastr/yp_observability_service/internal/presentation/update"
 )
 
@@ -37,29 +39,27 @@ func (handler MetricHandler) ServeHTTP(res http.ResponseWriter, req *http.Reques
 
 	upd, err := update.New(name, mtype, value)
 	if err != nil {
-		err = fmt.Errorf("error creating update from request: %v", err)
-		http.Error(res, err.Error(), http.StatusBadRequest)
+		problem.Render(res, req, fmt.Errorf("error creating update from request: %w", err))
 		return
 	}
 
 	if upd.IsEmpty() {
 		if err := json.NewDecoder(req.Body).Decode(&upd); err != nil {
-			err = fmt.Errorf("error while reading request body: %v", err)
-			http.Error(res, err.Error(), http.StatusBadRequest)
+			problem.Render(res, req, errs.InvalidArgument(fmt.Errorf("error while reading request body: %w", err)))
 			return
 		}
 	} else if !upd.IsValid() {
-		http.Error(res, errs.ErrorWrongPath.Error(), http.StatusNotFound)
+		problem.Render(res, req, errs.ErrorWrongPath)
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(req.Context(), 3*time.Second)
 	defer cancel()
+	ctx = context.WithValue(ctx, common.SenderInfo{}, common.ExtractIP(req))
 
 	err = handler.service.ProcessUpdate(ctx, upd)
 	if err != nil {
-		err = fmt.Errorf("get error while processing update: %v", err)
-		http.Error(res, err.Error(), http.StatusBadRequest)
+		problem.Render(res, req, fmt.Errorf("get error while processing update: %w", err))
 		return
 	}
 
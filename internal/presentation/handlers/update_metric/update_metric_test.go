@@ -6,7 +6,9 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/dmitastr/yp_observability_service/internal/errs"
 	"github.com/dmitastr/yp_observability_service/internal/mocks/service"
+	"github.com/dmitastr/yp_observability_service/internal/presentation/problem"
 	_ "github.com/dmitastr/yp_observability_service/internal/presentation/update"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -16,25 +18,18 @@ func TestMetricHandler_ServeHTTP(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	errFunc := func(serviceErrOut bool) (err error) {
-		if serviceErrOut {
-			err = errors.New("mocked error")
-		}
-		return
-	}
-
 	type pathParam struct {
 		key   string
 		value string
 	}
 
 	tests := []struct {
-		name          string
-		method        string
-		url           string
-		wantCode      int
-		pathParams    []pathParam
-		serviceErrOut bool
+		name       string
+		method     string
+		url        string
+		wantCode   int
+		pathParams []pathParam
+		serviceErr error
 	}{
 		{
 			name:     "Valid request",
@@ -46,7 +41,6 @@ func TestMetricHandler_ServeHTTP(t *testing.T) {
 				{key: "mtype", value: "gauge"},
 				{key: "value", value: "10"},
 			},
-			serviceErrOut: false,
 		},
 		{
 			name:     "Get method",
@@ -58,7 +52,6 @@ func TestMetricHandler_ServeHTTP(t *testing.T) {
 				{key: "mtype", value: "gauge"},
 				{key: "value", value: "10"},
 			},
-			serviceErrOut: false,
 		},
 		{
 			name:     "Bad path - missing param",
@@ -70,19 +63,53 @@ func TestMetricHandler_ServeHTTP(t *testing.T) {
 				{key: "mtype", value: "gauge"},
 				{key: "value", value: "10"},
 			},
-			serviceErrOut: false,
+		},
+		{
+			name:     "Bad value",
+			method:   http.MethodPost,
+			url:      "/update/gauge/abc/none",
+			wantCode: http.StatusBadRequest,
+			pathParams: []pathParam{
+				{key: "name", value: "abc"},
+				{key: "mtype", value: "gauge"},
+				{key: "value", value: "none"},
+			},
 		},
 		{
 			name:     "Service returned an error",
 			method:   http.MethodPost,
 			url:      "/update/abc/10",
+			wantCode: http.StatusInternalServerError,
+			pathParams: []pathParam{
+				{key: "name", value: "abc"},
+				{key: "mtype", value: "gauge"},
+				{key: "value", value: "10"},
+			},
+			serviceErr: errors.New("mocked error"),
+		},
+		{
+			name:     "Service rejected an update",
+			method:   http.MethodPost,
+			url:      "/update/abc/10",
 			wantCode: http.StatusBadRequest,
 			pathParams: []pathParam{
 				{key: "name", value: "abc"},
 				{key: "mtype", value: "gauge"},
 				{key: "value", value: "10"},
 			},
-			serviceErrOut: true,
+			serviceErr: errs.ErrorMissingValue,
+		},
+		{
+			name:     "Storage is unavailable",
+			method:   http.MethodPost,
+			url:      "/update/abc/10",
+			wantCode: http.StatusServiceUnavailable,
+			pathParams: []pathParam{
+				{key: "name", value: "abc"},
+				{key: "mtype", value: "gauge"},
+				{key: "value", value: "10"},
+			},
+			serviceErr: errs.Unavailable(errors.New("connection refused")),
 		},
 	}
 	for _, tt := range tests {
@@ -90,9 +117,7 @@ func TestMetricHandler_ServeHTTP(t *testing.T) {
 			req := httptest.NewRequest(tt.method, tt.url, nil)
 
 			mockSrv := service.NewMockIService(ctrl)
-			errValue := errFunc(tt.serviceErrOut)
-
-			mockSrv.EXPECT().ProcessUpdate(gomock.Any(), gomock.Any()).Return(errValue).AnyTimes()
+			mockSrv.EXPECT().ProcessUpdate(gomock.Any(), gomock.Any()).Return(tt.serviceErr).AnyTimes()
 
 			handler := NewHandler(mockSrv)
 
@@ -102,6 +127,9 @@ func TestMetricHandler_ServeHTTP(t *testing.T) {
 			}
 			handler.ServeHTTP(rr, req)
 			assert.Equal(t, tt.wantCode, rr.Code)
+			if tt.wantCode != http.StatusOK && tt.wantCode != http.StatusMethodNotAllowed {
+				assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"))
+			}
 		})
 	}
 }
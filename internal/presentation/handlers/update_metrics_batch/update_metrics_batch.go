@@ -3,13 +3,16 @@ package updatemetricsbatch
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/dmitastr/yp_observability_service/internal/common"
 	"github.com/dmitastr/yp_observability_service/internal/domain/models"
 	srv "github.com/dmitastr/yp_observability_service/internal/domain/service"
-	"github.com/dmitastr/yp_observability_service/internal/logger"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/presentation/problem"
 )
 
 // BatchUpdateHandler handles requests for updating metric value or creating a new one for several metrics
@@ -31,8 +34,7 @@ func (handler BatchUpdateHandler) ServeHTTP(res http.ResponseWriter, req *http.R
 
 	var metrics []models.Metrics
 	if err := json.NewDecoder(req.Body).Decode(&metrics); err != nil {
-		logger.Errorf("error while decoding request body: %v", err)
-		http.Error(res, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		problem.Render(res, req, errs.InvalidArgument(fmt.Errorf("error while decoding request body: %w", err)))
 		return
 	}
 
@@ -40,10 +42,15 @@ func (handler BatchUpdateHandler) ServeHTTP(res http.ResponseWriter, req *http.R
 	defer cancel()
 
 	ctx = context.WithValue(ctx, common.SenderInfo{}, common.ExtractIP(req))
+	if key := req.Header.Get(common.IdempotencyHeaderKey); key != "" {
+		ctx = context.WithValue(ctx, common.IdempotencyKey{}, key)
+	}
 
 	if err := handler.service.BatchUpdate(ctx, metrics); err != nil {
-		logger.Errorf("error while batch metrics update: %v", err)
-		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		if errors.Is(err, errs.ErrorRequestInProgress) {
+			res.Header().Set("Retry-After", "1")
+		}
+		problem.Render(res, req, fmt.Errorf("error while batch metrics update: %w", err))
 		return
 	}
 
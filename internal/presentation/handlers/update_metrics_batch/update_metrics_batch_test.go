@@ -3,10 +3,13 @@ package updatemetricsbatch
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/dmitastr/yp_observability_service/internal/common"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
 	"github.com/dmitastr/yp_observability_service/internal/mocks/service"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -89,3 +92,19 @@ func TestBatchUpdateHandler_ServeHTTP(t *testing.T) {
 		})
 	}
 }
+
+func TestBatchUpdateHandler_InProgress(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSrv := service.NewMockIService(ctrl)
+	mockSrv.EXPECT().BatchUpdate(gomock.Any(), gomock.Any()).Return(fmt.Errorf("batch: %w", errs.ErrorRequestInProgress))
+
+	req := httptest.NewRequest(http.MethodPost, "/updates", bytes.NewBufferString(`[{"id": "abc", "type": "gauge", "value": 1.99}]`))
+	req.Header.Set(common.IdempotencyHeaderKey, "key")
+	rr := httptest.NewRecorder()
+	NewHandler(mockSrv).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Equal(t, "1", rr.Header().Get("Retry-After"))
+}
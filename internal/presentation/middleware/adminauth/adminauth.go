@@ -0,0 +1,35 @@
+package adminauth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/presentation/problem"
+)
+
+// Header carries the admin key of a request
+const Header = "X-Admin-Key"
+
+// AdminAuth is a middleware for administrative endpoints, e.g. deletion or import of metrics. Requests
+// without the configured key in [Header] are rejected
+type AdminAuth struct {
+	key []byte
+}
+
+func New(key string) *AdminAuth {
+	return &AdminAuth{key: []byte(key)}
+}
+
+// Handle passes requests with the admin key to next handler
+func (a *AdminAuth) Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		key := []byte(req.Header.Get(Header))
+		if len(a.key) == 0 || subtle.ConstantTimeCompare(key, a.key) != 1 {
+			problem.Render(res, req, errs.Unauthorized(errors.New("admin key is missing or invalid")))
+			return
+		}
+		next.ServeHTTP(res, req)
+	})
+}
@@ -0,0 +1,33 @@
+package adminauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminAuth_Handle(t *testing.T) {
+	ok := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {})
+	tests := []struct {
+		name, key, sent string
+		want            int
+	}{
+		{name: "valid key", key: "secret", sent: "secret", want: http.StatusOK},
+		{name: "invalid key", key: "secret", sent: "other", want: http.StatusUnauthorized},
+		{name: "missing key", key: "secret", want: http.StatusUnauthorized},
+		{name: "key is not configured", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/import", nil)
+			if tt.sent != "" {
+				req.Header.Set(Header, tt.sent)
+			}
+			res := httptest.NewRecorder()
+			New(tt.key).Handle(ok).ServeHTTP(res, req)
+			assert.Equal(t, tt.want, res.Code)
+		})
+	}
+}
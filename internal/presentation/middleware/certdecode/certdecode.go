@@ -6,11 +6,14 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
 
+	"github.com/dmitastr/yp_observability_service/internal/errs"
 	"github.com/dmitastr/yp_observability_service/internal/logger"
+	"github.com/dmitastr/yp_observability_service/internal/presentation/problem"
 )
 
 // CertDecoder is a middleware for decoding messages using private key
@@ -56,14 +59,12 @@ func (c *CertDecoder) Handle(next http.Handler) http.Handler {
 			defer r.Body.Close()
 
 			if err != nil {
-				logger.Infof("Failed to read request body: %v\n", err)
-				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				problem.Render(w, r, errs.InvalidArgument(fmt.Errorf("failed to read request body: %w", err)))
 				return
 			}
 			bodyDecoded, err := c.Decode(body)
 			if err != nil {
-				logger.Infof("Failed to decode body: %v\n", err)
-				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				problem.Render(w, r, errs.InvalidArgument(fmt.Errorf("failed to decode body: %w", err)))
 				return
 			}
 			r.Body = io.NopCloser(bytes.NewBuffer(bodyDecoded))
@@ -1,22 +1,28 @@
 package hash
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 
 	"github.com/dmitastr/yp_observability_service/internal/common"
 	serverenvconfig "github.com/dmitastr/yp_observability_service/internal/config/env_parser/server/server_env_config"
 	"github.com/dmitastr/yp_observability_service/internal/domain/signature"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
 	"github.com/dmitastr/yp_observability_service/internal/logger"
+	"github.com/dmitastr/yp_observability_service/internal/presentation/problem"
 )
 
 type writer struct {
 	http.ResponseWriter
 	Body       *bytes.Buffer
 	StatusCode *int
+	// streaming is set by the first flush, after it the response is written through unsigned
+	streaming bool
 }
 
 func newWriter(w http.ResponseWriter) *writer {
@@ -24,14 +30,55 @@ func newWriter(w http.ResponseWriter) *writer {
 }
 
 func (w *writer) Write(p []byte) (int, error) {
+	if w.streaming {
+		return w.ResponseWriter.Write(p)
+	}
 	w.Body.Write(p)
 	return len(p), nil
 }
 
 func (w *writer) WriteHeader(statusCode int) {
+	if w.streaming {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
 	w.StatusCode = &statusCode
 }
 
+// Flush writes buffered response through and stops buffering. Streamed responses like server-sent events
+// are not signed, their body is not known in advance
+func (w *writer) Flush() {
+	if !w.streaming {
+		w.streaming = true
+		statusCode := http.StatusOK
+		if w.StatusCode != nil {
+			statusCode = *w.StatusCode
+		}
+		w.ResponseWriter.WriteHeader(statusCode)
+		if _, err := w.ResponseWriter.Write(w.Body.Bytes()); err != nil {
+			logger.Errorf("error writing to original response body: %v", err)
+		}
+		w.Body.Reset()
+	}
+	if err := http.NewResponseController(w.ResponseWriter).Flush(); err != nil {
+		logger.Errorf("error flushing response: %v", err)
+	}
+}
+
+// Hijack takes over the connection, e.g. for WebSocket. The rest of the response is not signed
+func (w *writer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.streaming = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the original [http.ResponseWriter] for [http.ResponseController]
+func (w *writer) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 type SignedChecker struct {
 	HashSigner *signature.HashSigner
 }
@@ -51,24 +98,18 @@ func (s *SignedChecker) Handle(next http.Handler) http.Handler {
 		if hashRequest != "" {
 			bodyBytes, err := io.ReadAll(req.Body)
 			if err != nil {
-				err = fmt.Errorf("error getting body from request: %w", err)
-				logger.Error(err)
-				http.Error(res, err.Error(), http.StatusBadRequest)
+				problem.Render(res, req, errs.InvalidArgument(fmt.Errorf("error getting body from request: %w", err)))
 				return
 			}
 
 			hashActual, err := s.HashSigner.GenerateSignature(bodyBytes)
 			if err != nil {
-				err = fmt.Errorf("error generating hash: %w", err)
-				logger.Error(err)
-				http.Error(res, err.Error(), http.StatusBadRequest)
+				problem.Render(res, req, fmt.Errorf("error generating hash: %w", err))
 				return
 			}
 
 			if !s.HashSigner.Verify(hashRequest, hashActual) {
-				err := errors.New("hashes are not equal")
-				logger.Error(err)
-				http.Error(res, err.Error(), http.StatusBadRequest)
+				problem.Render(res, req, errs.Unauthorized(errors.New("hashes are not equal")))
 				return
 			}
 			logger.Info("hash signature verified")
@@ -76,6 +117,9 @@ func (s *SignedChecker) Handle(next http.Handler) http.Handler {
 		}
 
 		next.ServeHTTP(w, req)
+		if w.streaming {
+			return
+		}
 
 		respBody := w.Body.Bytes()
 		if keyExist {
@@ -1,6 +1,8 @@
 package requestlogger
 
 import (
+	"bufio"
+	"net"
 	"net/http"
 	"time"
 
@@ -44,6 +46,20 @@ func (rww LoggingResponseWriter) WriteHeader(statusCode int) {
 	rww.w.WriteHeader(statusCode)
 }
 
+// Hijack takes over the connection of the original [http.ResponseWriter], e.g. for WebSocket
+func (rww LoggingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(rww.w).Hijack()
+	if err == nil {
+		rww.ResponseData.StatusCode = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the original [http.ResponseWriter] for [http.ResponseController]
+func (rww LoggingResponseWriter) Unwrap() http.ResponseWriter {
+	return rww.w
+}
+
 // Handle middleware logs request method, URI and response status code, calculates time of execution
 // and response body size
 func Handle(h http.Handler) http.Handler {
@@ -0,0 +1,77 @@
+// Package problem renders errors as JSON problem details (RFC 9457)
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/logger"
+)
+
+const ContentType = "application/problem+json"
+
+// Details is a body of error response
+type Details struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Kind     string `json:"kind"`
+}
+
+// Status maps error kind to HTTP status code
+func Status(kind errs.Kind) int {
+	switch kind {
+	case errs.KindNotFound:
+		return http.StatusNotFound
+	case errs.KindInvalidArgument:
+		return http.StatusBadRequest
+	case errs.KindConflict:
+		return http.StatusConflict
+	case errs.KindUnavailable:
+		return http.StatusServiceUnavailable
+	case errs.KindUnauthorized:
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// New builds problem details for err. Messages of internal errors are not exposed to clients
+func New(req *http.Request, err error) Details {
+	kind := errs.KindOf(err)
+	status := Status(kind)
+	details := Details{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: err.Error(),
+		Kind:   kind.String(),
+	}
+	if kind == errs.KindInternal {
+		details.Detail = ""
+	}
+	if req != nil {
+		details.Instance = req.URL.Path
+	}
+	return details
+}
+
+// Render logs err and writes it to response with the status code of its kind
+func Render(res http.ResponseWriter, req *http.Request, err error) {
+	details := New(req, err)
+	if details.Status >= http.StatusInternalServerError {
+		logger.Errorf("request failed: %v", err)
+	} else {
+		logger.Infof("request rejected: %v", err)
+	}
+
+	res.Header().Set("Content-Type", ContentType)
+	res.Header().Set("X-Content-Type-Options", "nosniff")
+	res.WriteHeader(details.Status)
+	if err := json.NewEncoder(res).Encode(details); err != nil {
+		logger.Errorf("error writing problem details: %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantDetail string
+	}{
+		{name: "not found", err: errs.ErrorMetricDoesNotExist, wantStatus: http.StatusNotFound, wantDetail: "metric was not found"},
+		{name: "invalid argument", err: errs.InvalidArgument(errors.New("bad value")), wantStatus: http.StatusBadRequest, wantDetail: "bad value"},
+		{name: "conflict", err: errs.Conflict(errors.New("type mismatch")), wantStatus: http.StatusConflict, wantDetail: "type mismatch"},
+		{name: "unavailable", err: errs.Unavailable(errors.New("no connection")), wantStatus: http.StatusServiceUnavailable, wantDetail: "no connection"},
+		{name: "unauthorized", err: errs.Unauthorized(errors.New("bad hash")), wantStatus: http.StatusUnauthorized, wantDetail: "bad hash"},
+		{name: "internal error is hidden", err: errors.New("password=secret"), wantStatus: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/value/gauge/abc", nil)
+			rr := httptest.NewRecorder()
+			Render(rr, req, tt.err)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.Equal(t, ContentType, rr.Header().Get("Content-Type"))
+
+			var details Details
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&details))
+			assert.Equal(t, tt.wantStatus, details.Status)
+			assert.Equal(t, tt.wantDetail, details.Detail)
+			assert.Equal(t, errs.KindOf(tt.err).String(), details.Kind)
+			assert.Equal(t, "/value/gauge/abc", details.Instance)
+		})
+	}
+}
@@ -0,0 +1,38 @@
+// Package query parses query params shared by handlers selecting sets of metrics
+package query
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+)
+
+// Filter reads params type, prefix and regex. All of them are optional
+func Filter(values url.Values) (repository.Filter, error) {
+	filter := repository.Filter{Prefix: values.Get("prefix"), Type: values.Get("type")}
+	if pattern := values.Get("regex"); pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return filter, errs.InvalidArgument(fmt.Errorf("invalid regex: %w", err))
+		}
+		filter.Pattern = re
+	}
+	return filter, nil
+}
+
+// Names reads param names with comma separated metric names, it may be repeated. Returns nil when names are not set
+func Names(values url.Values) []string {
+	var names []string
+	for _, value := range values["names"] {
+		for name := range strings.SplitSeq(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
@@ -31,13 +31,13 @@ func New(name, mtype, valueStr string) (metric MetricUpdate, err error) {
 	case common.GAUGE:
 		meticValue, err := strconv.ParseFloat(valueStr, 64)
 		if err != nil {
-			return metric, err
+			return metric, errs.InvalidArgument(fmt.Errorf("invalid gauge value '%s': %w", valueStr, err))
 		}
 		metric.Value = &meticValue
 	case common.COUNTER:
 		meticValue, err := strconv.ParseInt(valueStr, 10, 64)
 		if err != nil {
-			return metric, err
+			return metric, errs.InvalidArgument(fmt.Errorf("invalid counter value '%s': %w", valueStr, err))
 		}
 		metric.Delta = &meticValue
 	default:
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+
+	"github.com/dmitastr/yp_observability_service/internal/common"
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+)
+
+// AggregateFunc is a function applied to a set of metrics
+type AggregateFunc string
+
+const (
+	AggregateSum   AggregateFunc = "sum"
+	AggregateAvg   AggregateFunc = "avg"
+	AggregateMin   AggregateFunc = "min"
+	AggregateMax   AggregateFunc = "max"
+	AggregateCount AggregateFunc = "count"
+	// AggregateTotal sums up counters
+	AggregateTotal AggregateFunc = "total"
+	// AggregateTopK selects metrics with the largest values
+	AggregateTopK AggregateFunc = "topk"
+)
+
+// ParseAggregateFunc checks function name
+func ParseAggregateFunc(name string) (AggregateFunc, error) {
+	switch f := AggregateFunc(name); f {
+	case AggregateSum, AggregateAvg, AggregateMin, AggregateMax, AggregateCount, AggregateTotal, AggregateTopK:
+		return f, nil
+	default:
+		return "", errs.InvalidArgument(fmt.Errorf("unknown function '%s', expected one of sum, avg, min, max, count, total, topk", name))
+	}
+}
+
+// MetricType returns type of metrics the function is applied to: gauges for sum, avg, min, max and count,
+// counters for total. Empty type means metrics of any type
+func (f AggregateFunc) MetricType() string {
+	switch f {
+	case AggregateTotal:
+		return common.COUNTER
+	case AggregateTopK:
+		return ""
+	default:
+		return common.GAUGE
+	}
+}
+
+// AggregateQuery applies Func to metrics selected by Filter. K limits the number of metrics selected by topk
+type AggregateQuery struct {
+	Func   AggregateFunc
+	Filter Filter
+	K      int
+}
+
+// Aggregation is a result of [AggregateQuery], Count is the number of metrics selected by filter.
+// Value is nil for avg, min and max of no metrics and for topk, which returns Top metrics instead
+type Aggregation struct {
+	Value *float64
+	Count int
+	Top   []models.Metrics
+}
+
+// Aggregator is implemented by storages computing aggregations themselves, without reading all selected metrics.
+// It returns [errors.ErrUnsupported] when the underlying storage can not aggregate
+type Aggregator interface {
+	Aggregate(context.Context, AggregateQuery) (Aggregation, error)
+}
+
+// CompareTop orders metrics for topk: by value descending, then by name
+func CompareTop(a, b models.Metrics) int {
+	va, _ := a.FloatValue()
+	vb, _ := b.FloatValue()
+	return cmp.Or(cmp.Compare(vb, va), cmp.Compare(a.ID, b.ID))
+}
@@ -1,11 +1,57 @@
 package repository
 
 import (
+	"context"
+	"time"
+
 	"github.com/dmitastr/yp_observability_service/internal/domain/models"
 )
 
+// Snapshot is a consistent copy of all metrics. Seq is a number of the last write-ahead log record
+// already included in the snapshot, records after it are replayed on load. Updated holds time of the last
+// update of metrics, it is empty in snapshots saved before retention was introduced
+type Snapshot struct {
+	Seq     uint64               `json:"seq"`
+	Metrics []models.Metrics     `json:"metrics"`
+	Updated map[string]time.Time `json:"updated,omitempty"`
+}
+
+// SnapshotInfo describes one of the retained timestamped snapshots
+type SnapshotInfo struct {
+	Name       string    `json:"name"`
+	CreatedAt  time.Time `json:"created_at"`
+	Size       int64     `json:"size"`
+	Compressed bool      `json:"compressed"`
+}
+
 type BackupManager interface {
-	RunBackup(func() []models.Metrics)
-	Load() ([]models.Metrics, error)
-	Flush([]models.Metrics) error
+	// Run saves snapshots periodically until ctx is canceled. It returns an error if backups keep failing
+	Run(ctx context.Context, snapshot func() Snapshot) error
+	Load() (Snapshot, error)
+	Flush(Snapshot) error
+	// Append writes updates to the write-ahead log and returns the number of the record,
+	// metrics are considered updated at the time of the record
+	Append([]models.Metrics) (uint64, error)
+	// Remove writes deletion of metrics to the write-ahead log and returns the number of the record
+	Remove([]string) (uint64, error)
+	// Replace writes metrics replacing the stored ones instead of being accumulated, time of their last update is kept
+	Replace([]models.Metrics) (uint64, error)
+	// List returns retained snapshots, the newest first
+	List() ([]SnapshotInfo, error)
+	// LoadSnapshot reads a retained snapshot by name and discards write-ahead log.
+	// Returned snapshot is numbered after all previously written records
+	LoadSnapshot(string) (Snapshot, error)
+	Close() error
+}
+
+// SnapshotRestorer is implemented by storages which can be rolled back to one of retained snapshots
+type SnapshotRestorer interface {
+	ListSnapshots(context.Context) ([]SnapshotInfo, error)
+	RestoreSnapshot(context.Context, string) error
+}
+
+// Runner is implemented by storages doing background work. Run blocks until ctx is canceled
+// and returns an error if the work can not be continued
+type Runner interface {
+	Run(ctx context.Context) error
 }
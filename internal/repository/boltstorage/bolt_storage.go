@@ -0,0 +1,384 @@
+package boltstorage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/dmitastr/yp_observability_service/internal/common"
+	serverenvconfig "github.com/dmitastr/yp_observability_service/internal/config/env_parser/server/server_env_config"
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/logger"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+)
+
+var (
+	metricsBucket  = []byte("metrics")
+	metadataBucket = []byte("metadata")
+)
+
+// openTimeout limits waiting for a file lock held by another process
+var openTimeout = time.Second
+
+// errNotOpened is returned when storage is used before Init
+var errNotOpened = errs.New(errs.KindUnavailable, "bolt storage is not opened")
+
+// record is a stored metric with the time of its last update. Records written before update time
+// was stored have zero UpdatedAt and are never purged by age
+type record struct {
+	models.Metrics
+	UpdatedAt time.Time `json:"updated_at,omitzero"`
+}
+
+// Bolt keeps metrics in an embedded bbolt database, one JSON encoded metric per key. Every write is
+// a transaction which is synced to disk before returning, so no updates are lost on crash
+type Bolt struct {
+	path string
+	db   *bolt.DB
+}
+
+func New(cfg *serverenvconfig.Config) *Bolt {
+	return &Bolt{path: *cfg.KVPath}
+}
+
+// Init opens database file, creating it with the directory if necessary. Migrations are not needed
+func (b *Bolt) Init(_ string) error {
+	if err := os.MkdirAll(filepath.Dir(b.path), 0755); err != nil {
+		return fmt.Errorf("error creating directory for '%s': %w", b.path, err)
+	}
+	db, err := bolt.Open(b.path, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return fmt.Errorf("error opening bolt database '%s': %w", b.path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{metricsBucket, metadataBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return fmt.Errorf("error creating bucket: %w", err)
+	}
+
+	b.db = db
+	logger.Infof("Bolt database '%s' opened", b.path)
+	return nil
+}
+
+// txKey holds transaction started by [Bolt.InTx] in context
+type txKey struct{}
+
+// InTx implements [repository.Transactor]. Operations check stored types before writing, so a rejected
+// one leaves no changes in the transaction
+func (b *Bolt) InTx(ctx context.Context, fnc func(context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*bolt.Tx); ok {
+		return fnc(ctx)
+	}
+	if b.db == nil {
+		return errNotOpened
+	}
+
+	ctx, committed := repository.WithCommitHooks(ctx)
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		return fnc(context.WithValue(ctx, txKey{}, tx))
+	})
+	if err == nil {
+		committed()
+	}
+	return err
+}
+
+func (b *Bolt) update(ctx context.Context, fnc func(*bolt.Bucket) error) error {
+	return b.updateBucket(ctx, metricsBucket, fnc)
+}
+
+func (b *Bolt) view(ctx context.Context, fnc func(*bolt.Bucket) error) error {
+	return b.viewBucket(ctx, metricsBucket, fnc)
+}
+
+// updateBucket runs fnc in a new write transaction or in the one of [Bolt.InTx]
+func (b *Bolt) updateBucket(ctx context.Context, name []byte, fnc func(*bolt.Bucket) error) error {
+	if tx, ok := ctx.Value(txKey{}).(*bolt.Tx); ok {
+		return fnc(tx.Bucket(name))
+	}
+	if b.db == nil {
+		return errNotOpened
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return fnc(tx.Bucket(name))
+	})
+}
+
+// viewBucket runs fnc in a new read transaction or in the write one of [Bolt.InTx], a read transaction
+// opened while the write one is running in the same goroutine can deadlock on remapping of the file
+func (b *Bolt) viewBucket(ctx context.Context, name []byte, fnc func(*bolt.Bucket) error) error {
+	if tx, ok := ctx.Value(txKey{}).(*bolt.Tx); ok {
+		return fnc(tx.Bucket(name))
+	}
+	if b.db == nil {
+		return errNotOpened
+	}
+	return b.db.View(func(tx *bolt.Tx) error {
+		return fnc(tx.Bucket(name))
+	})
+}
+
+func decode(key, data []byte) (rec record, err error) {
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return rec, fmt.Errorf("error decoding metric '%s': %w", key, err)
+	}
+	return rec, nil
+}
+
+func get(bucket *bolt.Bucket, name string) (*models.Metrics, error) {
+	data := bucket.Get([]byte(name))
+	if data == nil {
+		return nil, nil
+	}
+	rec, err := decode([]byte(name), data)
+	if err != nil {
+		return nil, err
+	}
+	return &rec.Metrics, nil
+}
+
+// checkTypes rejects updates which change types of stored metrics within the write transaction
+func checkTypes(bucket *bolt.Bucket, metrics ...models.Metrics) error {
+	return repository.CheckTypes(metrics, func(name string) (string, bool, error) {
+		metric, err := get(bucket, name)
+		if err != nil || metric == nil {
+			return "", false, err
+		}
+		return metric.MType, true, nil
+	})
+}
+
+// put saves metric, adding counter delta to the stored counter. Types must be checked before
+func put(bucket *bolt.Bucket, metric models.Metrics) (models.Metrics, error) {
+	exist, err := get(bucket, metric.ID)
+	if err != nil {
+		return metric, err
+	}
+	if exist != nil && metric.MType == common.COUNTER && exist.MType == common.COUNTER && exist.Delta != nil {
+		delta := *exist.Delta
+		if metric.Delta != nil {
+			delta += *metric.Delta
+		}
+		metric.Delta = &delta
+	}
+
+	data, err := json.Marshal(record{Metrics: metric, UpdatedAt: time.Now().UTC()})
+	if err != nil {
+		return metric, fmt.Errorf("error encoding metric '%s': %w", metric.ID, err)
+	}
+	return metric, bucket.Put([]byte(metric.ID), data)
+}
+
+func (b *Bolt) Update(ctx context.Context, metric models.Metrics) error {
+	return b.update(ctx, func(bucket *bolt.Bucket) error {
+		if err := checkTypes(bucket, metric); err != nil {
+			return err
+		}
+		_, err := put(bucket, metric)
+		return err
+	})
+}
+
+func (b *Bolt) BulkUpdate(ctx context.Context, metrics []models.Metrics) error {
+	return b.update(ctx, func(bucket *bolt.Bucket) error {
+		if err := checkTypes(bucket, metrics...); err != nil {
+			return err
+		}
+		for _, metric := range metrics {
+			if _, err := put(bucket, metric); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *Bolt) Increment(ctx context.Context, name string, delta int64) (total int64, err error) {
+	err = b.update(ctx, func(bucket *bolt.Bucket) error {
+		update := models.Metrics{ID: name, MType: common.COUNTER, Delta: &delta}
+		if err := checkTypes(bucket, update); err != nil {
+			return err
+		}
+		metric, err := put(bucket, update)
+		total = *metric.Delta
+		return err
+	})
+	return total, err
+}
+
+func (b *Bolt) Get(ctx context.Context, name string) (metric *models.Metrics, err error) {
+	err = b.view(ctx, func(bucket *bolt.Bucket) error {
+		metric, err = get(bucket, name)
+		return err
+	})
+	if err == nil && metric == nil {
+		err = errs.ErrorMetricDoesNotExist
+	}
+	return metric, err
+}
+
+func (b *Bolt) GetByID(ctx context.Context, names []string) (metrics []models.Metrics, err error) {
+	err = b.view(ctx, func(bucket *bolt.Bucket) error {
+		for _, name := range names {
+			metric, err := get(bucket, name)
+			if err != nil {
+				return err
+			}
+			if metric != nil {
+				metrics = append(metrics, *metric)
+			}
+		}
+		return nil
+	})
+	return metrics, err
+}
+
+func (b *Bolt) GetAll(ctx context.Context) (metrics []models.Metrics, err error) {
+	err = b.view(ctx, func(bucket *bolt.Bucket) error {
+		return bucket.ForEach(func(key, data []byte) error {
+			rec, err := decode(key, data)
+			if err != nil {
+				return err
+			}
+			metrics = append(metrics, rec.Metrics)
+			return nil
+		})
+	})
+	return metrics, err
+}
+
+// List reads a page of metrics. Keys are ordered by name, so pages sorted by name are read starting
+// from the cursor up to the limit, other orders require a full scan
+func (b *Bolt) List(ctx context.Context, query repository.ListQuery) (page repository.Page, err error) {
+	ordered := query.Sort == repository.SortByName || query.Sort == ""
+	err = b.view(ctx, func(bucket *bolt.Bucket) error {
+		c := bucket.Cursor()
+		key, data := c.First()
+		if ordered && query.Cursor != nil {
+			key, data = c.Seek([]byte(query.Cursor.Name))
+			if key != nil && string(key) == query.Cursor.Name {
+				key, data = c.Next()
+			}
+		}
+
+		var metrics []models.Metrics
+		for ; key != nil; key, data = c.Next() {
+			rec, err := decode(key, data)
+			if err != nil {
+				return err
+			}
+			if !query.Filter.Match(rec.Metrics, rec.UpdatedAt) {
+				continue
+			}
+			metrics = append(metrics, rec.Metrics)
+			if ordered && query.Limit > 0 && len(metrics) > query.Limit {
+				break
+			}
+		}
+
+		if ordered {
+			page = repository.NewPage(metrics, query)
+		} else {
+			page = repository.Paginate(metrics, query)
+		}
+		return nil
+	})
+	return page, err
+}
+
+// Delete removes metrics selected by filter in a single transaction
+func (b *Bolt) Delete(ctx context.Context, filter repository.Filter) (names []string, err error) {
+	if filter.IsEmpty() {
+		return nil, errs.ErrorEmptyFilter
+	}
+	err = b.update(ctx, func(bucket *bolt.Bucket) error {
+		// keys can not be deleted while iterating with ForEach
+		err := bucket.ForEach(func(key, data []byte) error {
+			rec, err := decode(key, data)
+			if err != nil {
+				return err
+			}
+			if filter.Match(rec.Metrics, rec.UpdatedAt) {
+				names = append(names, string(key))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if err := bucket.Delete([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// ResetCounters sets selected counters to zero in a single transaction keeping time of their last update
+func (b *Bolt) ResetCounters(ctx context.Context, filter repository.Filter) (previous []models.Metrics, err error) {
+	err = b.update(ctx, func(bucket *bolt.Bucket) error {
+		var reset []record
+		err := bucket.ForEach(func(key, data []byte) error {
+			rec, err := decode(key, data)
+			if err != nil {
+				return err
+			}
+			if rec.MType == common.COUNTER && filter.Match(rec.Metrics, rec.UpdatedAt) {
+				reset = append(reset, rec)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, rec := range reset {
+			previous = append(previous, rec.Metrics)
+			var zero int64
+			rec.Delta = &zero
+			data, err := json.Marshal(rec)
+			if err != nil {
+				return fmt.Errorf("error encoding metric '%s': %w", rec.ID, err)
+			}
+			if err := bucket.Put([]byte(rec.ID), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return previous, nil
+}
+
+func (b *Bolt) Ping(ctx context.Context) error {
+	return b.view(ctx, func(*bolt.Bucket) error { return nil })
+}
+
+func (b *Bolt) Close() error {
+	if b.db == nil {
+		return nil
+	}
+	logger.Info("Closing bolt database")
+	return b.db.Close()
+}
@@ -0,0 +1,159 @@
+package boltstorage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	serverenvconfig "github.com/dmitastr/yp_observability_service/internal/config/env_parser/server/server_env_config"
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/mocks/testhelpers"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+	"github.com/dmitastr/yp_observability_service/internal/repository/conformance"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStorage(t *testing.T, path string) *Bolt {
+	t.Helper()
+	storage := New(&serverenvconfig.Config{KVPath: &path})
+	require.NoError(t, storage.Init(""))
+	return storage
+}
+
+func TestBolt_UpdateGet(t *testing.T) {
+	storage := newTestStorage(t, filepath.Join(t.TempDir(), "metrics.db"))
+	defer storage.Close()
+
+	require.NoError(t, storage.Update(t.Context(), testhelpers.Gauge("Alloc", 1)))
+	require.NoError(t, storage.Update(t.Context(), testhelpers.Gauge("Alloc", 2)))
+	require.NoError(t, storage.BulkUpdate(t.Context(), []models.Metrics{testhelpers.Counter("PollCount", 1), testhelpers.Counter("PollCount", 2)}))
+
+	metric, err := storage.Get(t.Context(), "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, testhelpers.Gauge("Alloc", 2), *metric)
+
+	metric, err = storage.Get(t.Context(), "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, testhelpers.Counter("PollCount", 3), *metric)
+
+	_, err = storage.Get(t.Context(), "Missing")
+	assert.ErrorIs(t, err, errs.ErrorMetricDoesNotExist)
+
+	metrics, err := storage.GetByID(t.Context(), []string{"PollCount", "Missing"})
+	require.NoError(t, err)
+	assert.Equal(t, []models.Metrics{testhelpers.Counter("PollCount", 3)}, metrics)
+}
+
+func TestBolt_ConcurrentIncrement(t *testing.T) {
+	storage := newTestStorage(t, filepath.Join(t.TempDir(), "metrics.db"))
+	defer storage.Close()
+
+	const workers, updates = 8, 20
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range updates {
+				_, err := storage.Increment(t.Context(), "PollCount", 1)
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	total, err := storage.Increment(t.Context(), "PollCount", 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(workers*updates), total)
+}
+
+func TestBolt_Durability(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "metrics.db")
+	storage := newTestStorage(t, path)
+	require.NoError(t, storage.BulkUpdate(t.Context(), []models.Metrics{testhelpers.Gauge("Alloc", 5), testhelpers.Counter("PollCount", 7)}))
+	require.NoError(t, storage.Close())
+
+	reopened := newTestStorage(t, path)
+	defer reopened.Close()
+	metrics, err := reopened.GetAll(t.Context())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []models.Metrics{testhelpers.Gauge("Alloc", 5), testhelpers.Counter("PollCount", 7)}, metrics)
+}
+
+func TestBolt_NotOpened(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.db")
+	storage := New(&serverenvconfig.Config{KVPath: &path})
+	assert.Error(t, storage.Ping(t.Context()))
+	assert.NoError(t, storage.Close())
+}
+
+func TestBolt_InTx(t *testing.T) {
+	storage := newTestStorage(t, filepath.Join(t.TempDir(), "metrics.db"))
+	defer storage.Close()
+	require.NoError(t, storage.Update(t.Context(), testhelpers.Counter("Alloc", 1)))
+
+	replace := func(ctx context.Context) error {
+		names, err := storage.Delete(ctx, repository.Filter{Names: []string{"Alloc"}})
+		require.NoError(t, err)
+		require.Equal(t, []string{"Alloc"}, names)
+		_, err = storage.Get(ctx, "Alloc")
+		require.ErrorIs(t, err, errs.ErrorMetricDoesNotExist, "deletion must be visible within transaction")
+		return storage.Update(ctx, testhelpers.Gauge("Alloc", 2))
+	}
+
+	err := storage.InTx(t.Context(), func(ctx context.Context) error {
+		require.NoError(t, replace(ctx))
+		return errors.New("error")
+	})
+	require.Error(t, err)
+	metric, err := storage.Get(t.Context(), "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, testhelpers.Counter("Alloc", 1), *metric, "failed transaction must be rolled back")
+
+	committed := false
+	require.NoError(t, storage.InTx(t.Context(), func(ctx context.Context) error {
+		repository.OnCommit(ctx, func() { committed = true })
+		return replace(ctx)
+	}))
+	assert.True(t, committed)
+	metric, err = storage.Get(t.Context(), "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, testhelpers.Gauge("Alloc", 2), *metric)
+}
+
+func TestBolt_Conformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) repository.Database {
+		return newTestStorage(t, filepath.Join(t.TempDir(), "metrics.db"))
+	})
+}
+
+func TestBolt_Metadata(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.db")
+	storage := newTestStorage(t, path)
+
+	_, err := storage.GetMetadata(t.Context(), "OtherSys")
+	assert.ErrorIs(t, err, errs.ErrorMetadataDoesNotExist)
+
+	md := models.Metadata{Name: "OtherSys", Help: "other allocations", Unit: "bytes"}
+	require.NoError(t, storage.PutMetadata(t.Context(), models.Metadata{Name: "Alloc", Unit: "bytes"}))
+	require.NoError(t, storage.PutMetadata(t.Context(), md))
+	require.NoError(t, storage.Close())
+
+	storage = newTestStorage(t, path)
+	defer storage.Close()
+	got, err := storage.GetMetadata(t.Context(), "OtherSys")
+	require.NoError(t, err)
+	assert.Equal(t, md, *got)
+
+	list, err := storage.ListMetadata(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, []models.Metadata{{Name: "Alloc", Unit: "bytes"}, md}, list)
+
+	list, err = storage.GetMetadataByNames(t.Context(), []string{"OtherSys", "Missing", "Alloc", "OtherSys"})
+	require.NoError(t, err)
+	assert.Equal(t, []models.Metadata{{Name: "Alloc", Unit: "bytes"}, md}, list)
+}
@@ -0,0 +1,79 @@
+package boltstorage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+)
+
+// GetMetadata implements [repository.MetadataStore], metadata is kept in a separate bucket
+func (b *Bolt) GetMetadata(ctx context.Context, name string) (md *models.Metadata, err error) {
+	err = b.viewBucket(ctx, metadataBucket, func(bucket *bolt.Bucket) error {
+		data := bucket.Get([]byte(name))
+		if data == nil {
+			return errs.ErrorMetadataDoesNotExist
+		}
+		md = &models.Metadata{}
+		if err := json.Unmarshal(data, md); err != nil {
+			return fmt.Errorf("error decoding metadata '%s': %w", name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return md, nil
+}
+
+// ListMetadata returns metadata sorted by metric name
+func (b *Bolt) ListMetadata(ctx context.Context) (list []models.Metadata, err error) {
+	err = b.viewBucket(ctx, metadataBucket, func(bucket *bolt.Bucket) error {
+		return bucket.ForEach(func(key, data []byte) error {
+			var md models.Metadata
+			if err := json.Unmarshal(data, &md); err != nil {
+				return fmt.Errorf("error decoding metadata '%s': %w", key, err)
+			}
+			list = append(list, md)
+			return nil
+		})
+	})
+	return list, err
+}
+
+// GetMetadataByNames returns metadata of the metrics sorted by metric name
+func (b *Bolt) GetMetadataByNames(ctx context.Context, names []string) (list []models.Metadata, err error) {
+	names = slices.Clone(names)
+	slices.Sort(names)
+	names = slices.Compact(names)
+	err = b.viewBucket(ctx, metadataBucket, func(bucket *bolt.Bucket) error {
+		for _, name := range names {
+			data := bucket.Get([]byte(name))
+			if data == nil {
+				continue
+			}
+			var md models.Metadata
+			if err := json.Unmarshal(data, &md); err != nil {
+				return fmt.Errorf("error decoding metadata '%s': %w", name, err)
+			}
+			list = append(list, md)
+		}
+		return nil
+	})
+	return list, err
+}
+
+func (b *Bolt) PutMetadata(ctx context.Context, md models.Metadata) error {
+	data, err := json.Marshal(md)
+	if err != nil {
+		return fmt.Errorf("error encoding metadata '%s': %w", md.Name, err)
+	}
+	return b.updateBucket(ctx, metadataBucket, func(bucket *bolt.Bucket) error {
+		return bucket.Put([]byte(md.Name), data)
+	})
+}
@@ -0,0 +1,464 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/logger"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+	"golang.org/x/sync/errgroup"
+)
+
+// resubscribeDelay is a pause before subscribing again after notifier failed
+var resubscribeDelay = 5 * time.Second
+
+// resubscribeAttempts limits subscriptions failed in a row before listening stops with error. A subscription
+// which lasted at least [resubscribeDelay] is considered established and resets the count
+var resubscribeAttempts = 5
+
+// publishTimeout limits broadcasting of changes left when publishing stops
+var publishTimeout = 5 * time.Second
+
+type entry struct {
+	metric    models.Metrics
+	expiresAt time.Time
+}
+
+// Cache implements [repository.Database] and keeps metrics read from the underlying storage in memory
+// for ttl. Writes go straight to the storage and invalidate cached metrics by name. With [repository.ChangeNotifier]
+// set, names of written metrics are broadcast to other replicas in background, which invalidate their caches
+// as well. Broadcasting and listening run within [Cache.Run]
+type Cache struct {
+	db       repository.Database
+	ttl      time.Duration
+	notifier repository.ChangeNotifier
+
+	mu      sync.RWMutex
+	metrics map[string]entry
+	// all holds metrics read by the last GetAll, metrics with names in stale are read again on the next one
+	all    map[string]models.Metrics
+	stale  map[string]bool
+	allExp time.Time
+	// generation is increased on every invalidation. A metric read before invalidation of its name
+	// or of all metrics is not cached after it
+	generation  uint64
+	invalidated map[string]uint64
+	cleared     uint64
+
+	// changes holds names waiting to be broadcast, changedAll means that all metrics could change
+	changesMu  sync.Mutex
+	changes    map[string]bool
+	changedAll bool
+	wake       chan struct{}
+
+	now func() time.Time
+}
+
+func New(db repository.Database, ttl time.Duration) *Cache {
+	return &Cache{
+		db:          db,
+		ttl:         ttl,
+		metrics:     make(map[string]entry),
+		invalidated: make(map[string]uint64),
+		changes:     make(map[string]bool),
+		wake:        make(chan struct{}, 1),
+		now:         time.Now,
+	}
+}
+
+// WithNotifier enables invalidation of cache across replicas
+func (c *Cache) WithNotifier(notifier repository.ChangeNotifier) *Cache {
+	c.notifier = notifier
+	return c
+}
+
+// Init initializes underlying storage
+func (c *Cache) Init(migrationDir string) error {
+	return c.db.Init(migrationDir)
+}
+
+// Run broadcasts changes to other replicas and listens for their changes until context is canceled, along with
+// background work of the underlying storage. Changes made after Run returns are seen by other replicas once
+// their caches expire
+func (c *Cache) Run(ctx context.Context) error {
+	g, ctx := errgroup.WithContext(ctx)
+	if runner, ok := c.db.(repository.Runner); ok {
+		g.Go(func() error { return runner.Run(ctx) })
+	}
+	if c.notifier != nil {
+		g.Go(func() error { return c.listen(ctx) })
+		g.Go(func() error { return c.broadcast(ctx) })
+	}
+	return g.Wait()
+}
+
+// InTx runs fnc in a transaction of the underlying storage if it supports them, otherwise fnc is called directly
+func (c *Cache) InTx(ctx context.Context, fnc func(context.Context) error) error {
+	if transactor, ok := c.db.(repository.Transactor); ok {
+		return transactor.InTx(ctx, fnc)
+	}
+	return fnc(ctx)
+}
+
+// listen subscribes to changes of other replicas, subscription is renewed after it is lost
+func (c *Cache) listen(ctx context.Context) error {
+	failures := 0
+	for {
+		started := time.Now()
+		err := c.notifier.Subscribe(ctx, c.invalidate)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if time.Since(started) >= resubscribeDelay {
+			failures = 0
+		}
+		failures++
+		if failures == resubscribeAttempts {
+			return fmt.Errorf("cache is unable to subscribe to change notifications: %w", err)
+		}
+		logger.Errorf("cache lost change notifications subscription: %v", err)
+		// notifications could be missed while subscription was down
+		c.invalidate(nil)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(resubscribeDelay):
+		}
+	}
+}
+
+// broadcast publishes changes queued by writes, changes queued while publishing are sent together next time
+func (c *Cache) broadcast(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			publishCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), publishTimeout)
+			defer cancel()
+			c.publishChanges(publishCtx)
+			return nil
+		case <-c.wake:
+			c.publishChanges(ctx)
+		}
+	}
+}
+
+func (c *Cache) publishChanges(ctx context.Context) {
+	c.changesMu.Lock()
+	names := slices.Collect(maps.Keys(c.changes))
+	all := c.changedAll
+	c.changes, c.changedAll = make(map[string]bool), false
+	c.changesMu.Unlock()
+
+	if len(names) == 0 && !all {
+		return
+	}
+	if all {
+		names = nil
+	}
+	if err := c.notifier.Publish(ctx, names); err != nil {
+		logger.Errorf("error publishing metrics change: %v", err)
+	}
+}
+
+// invalidate removes metrics with given names from cache, empty list removes all of them
+func (c *Cache) invalidate(names []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	if len(names) == 0 {
+		c.cleared = c.generation
+		c.metrics = make(map[string]entry)
+		c.invalidated = make(map[string]uint64)
+		c.all = nil
+		return
+	}
+	for _, name := range names {
+		delete(c.metrics, name)
+		c.invalidated[name] = c.generation
+		if c.all != nil {
+			c.stale[name] = true
+		}
+	}
+}
+
+// changed invalidates local cache and queues names for other replicas. Within a transaction metrics are
+// invalidated again after commit, since values read meanwhile are not changed yet, and are queued only then
+func (c *Cache) changed(ctx context.Context, names []string) {
+	c.invalidate(names)
+	committed := func() {
+		c.invalidate(names)
+		c.queue(names)
+	}
+	if !repository.OnCommit(ctx, committed) {
+		c.queue(names)
+	}
+}
+
+// queue adds names to changes waiting to be broadcast, empty list means that all metrics could change
+func (c *Cache) queue(names []string) {
+	if c.notifier == nil {
+		return
+	}
+	c.changesMu.Lock()
+	c.changedAll = c.changedAll || len(names) == 0
+	for _, name := range names {
+		c.changes[name] = true
+	}
+	c.changesMu.Unlock()
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+func clone(m models.Metrics) models.Metrics {
+	if m.Value != nil {
+		value := *m.Value
+		m.Value = &value
+	}
+	if m.Delta != nil {
+		delta := *m.Delta
+		m.Delta = &delta
+	}
+	return m
+}
+
+func (c *Cache) currentGeneration() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.generation
+}
+
+// fresh reports whether metric read at generation was not invalidated since then, c.mu must be held
+func (c *Cache) fresh(generation uint64, name string) bool {
+	return c.cleared <= generation && c.invalidated[name] <= generation
+}
+
+// store caches metrics which were not invalidated since they were read
+func (c *Cache) store(generation uint64, metrics ...models.Metrics) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := c.now().Add(c.ttl)
+	for _, m := range metrics {
+		if c.fresh(generation, m.ID) {
+			c.metrics[m.ID] = entry{metric: clone(m), expiresAt: expiresAt}
+		}
+	}
+}
+
+func (c *Cache) lookup(name string) (models.Metrics, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	e, ok := c.metrics[name]
+	if !ok || !c.now().Before(e.expiresAt) {
+		return models.Metrics{}, false
+	}
+	return clone(e.metric), true
+}
+
+func (c *Cache) Update(ctx context.Context, metric models.Metrics) error {
+	err := c.db.Update(ctx, metric)
+	c.changed(ctx, []string{metric.ID})
+	return err
+}
+
+func (c *Cache) BulkUpdate(ctx context.Context, metrics []models.Metrics) error {
+	err := c.db.BulkUpdate(ctx, metrics)
+	names := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		names = append(names, m.ID)
+	}
+	c.changed(ctx, names)
+	return err
+}
+
+func (c *Cache) Increment(ctx context.Context, name string, delta int64) (int64, error) {
+	total, err := c.db.Increment(ctx, name, delta)
+	c.changed(ctx, []string{name})
+	return total, err
+}
+
+// List is not cached, pages depend on query and are not invalidated by name
+func (c *Cache) List(ctx context.Context, query repository.ListQuery) (repository.Page, error) {
+	return c.db.List(ctx, query)
+}
+
+// Aggregate is not cached, it is computed by the underlying storage if it can aggregate,
+// otherwise [errors.ErrUnsupported] is returned
+func (c *Cache) Aggregate(ctx context.Context, query repository.AggregateQuery) (repository.Aggregation, error) {
+	aggregator, ok := c.db.(repository.Aggregator)
+	if !ok {
+		return repository.Aggregation{}, errors.ErrUnsupported
+	}
+	return aggregator.Aggregate(ctx, query)
+}
+
+func (c *Cache) Delete(ctx context.Context, filter repository.Filter) ([]string, error) {
+	names, err := c.db.Delete(ctx, filter)
+	if len(names) > 0 {
+		c.changed(ctx, names)
+	}
+	return names, err
+}
+
+func (c *Cache) ResetCounters(ctx context.Context, filter repository.Filter) ([]models.Metrics, error) {
+	previous, err := c.db.ResetCounters(ctx, filter)
+	if len(previous) > 0 {
+		names := make([]string, 0, len(previous))
+		for _, m := range previous {
+			names = append(names, m.ID)
+		}
+		c.changed(ctx, names)
+	}
+	return previous, err
+}
+
+func (c *Cache) Get(ctx context.Context, name string) (*models.Metrics, error) {
+	if metric, ok := c.lookup(name); ok {
+		return &metric, nil
+	}
+
+	generation := c.currentGeneration()
+	metric, err := c.db.Get(ctx, name)
+	if err != nil || metric == nil {
+		return metric, err
+	}
+	c.store(generation, *metric)
+	return metric, nil
+}
+
+func (c *Cache) GetByID(ctx context.Context, names []string) ([]models.Metrics, error) {
+	metrics := make([]models.Metrics, 0, len(names))
+	for _, name := range names {
+		metric, ok := c.lookup(name)
+		if !ok {
+			return c.getByID(ctx, names)
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics, nil
+}
+
+func (c *Cache) getByID(ctx context.Context, names []string) ([]models.Metrics, error) {
+	generation := c.currentGeneration()
+	metrics, err := c.db.GetByID(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+	c.store(generation, metrics...)
+	return metrics, nil
+}
+
+// GetAll reads all metrics once per ttl, metrics changed since then are read by name
+func (c *Cache) GetAll(ctx context.Context) ([]models.Metrics, error) {
+	c.mu.RLock()
+	if c.all == nil || !c.now().Before(c.allExp) {
+		generation := c.generation
+		c.mu.RUnlock()
+		return c.readAll(ctx, generation)
+	}
+	all := make(map[string]models.Metrics, len(c.all))
+	for name, m := range c.all {
+		all[name] = clone(m)
+	}
+	stale := slices.Collect(maps.Keys(c.stale))
+	generation := c.generation
+	c.mu.RUnlock()
+
+	if len(stale) > 0 {
+		metrics, err := c.db.GetByID(ctx, stale)
+		if err != nil {
+			return nil, err
+		}
+		c.refreshAll(generation, stale, metrics)
+		c.store(generation, metrics...)
+		for _, name := range stale {
+			delete(all, name)
+		}
+		for _, m := range metrics {
+			all[m.ID] = m
+		}
+	}
+
+	metrics := slices.Collect(maps.Values(all))
+	slices.SortFunc(metrics, func(a, b models.Metrics) int { return strings.Compare(a.ID, b.ID) })
+	return metrics, nil
+}
+
+func (c *Cache) readAll(ctx context.Context, generation uint64) ([]models.Metrics, error) {
+	metrics, err := c.db.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if c.cleared <= generation {
+		c.all = make(map[string]models.Metrics, len(metrics))
+		for _, m := range metrics {
+			c.all[m.ID] = clone(m)
+		}
+		// metrics changed while reading are read again next time
+		c.stale = make(map[string]bool)
+		for name, invalidated := range c.invalidated {
+			if invalidated > generation {
+				c.stale[name] = true
+			}
+		}
+		c.allExp = c.now().Add(c.ttl)
+	}
+	c.mu.Unlock()
+	c.store(generation, metrics...)
+	return metrics, nil
+}
+
+// refreshAll replaces stale metrics with the ones read at generation, metrics which were not read are deleted
+func (c *Cache) refreshAll(generation uint64, stale []string, metrics []models.Metrics) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.all == nil {
+		return
+	}
+	read := make(map[string]models.Metrics, len(metrics))
+	for _, m := range metrics {
+		read[m.ID] = m
+	}
+	for _, name := range stale {
+		if !c.fresh(generation, name) {
+			continue
+		}
+		delete(c.stale, name)
+		if m, ok := read[name]; ok {
+			c.all[name] = clone(m)
+		} else {
+			delete(c.all, name)
+		}
+	}
+}
+
+func (c *Cache) Ping(ctx context.Context) error {
+	return c.db.Ping(ctx)
+}
+
+// Close closes notifier if it holds a connection and underlying storage
+func (c *Cache) Close() error {
+	if closer, ok := c.notifier.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			logger.Errorf("error closing change notifier: %v", err)
+		}
+	}
+	return c.db.Close()
+}
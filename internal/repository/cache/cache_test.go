@@ -0,0 +1,205 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	serverenvconfig "github.com/dmitastr/yp_observability_service/internal/config/env_parser/server/server_env_config"
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/mocks/storage"
+	"github.com/dmitastr/yp_observability_service/internal/mocks/testhelpers"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+	"github.com/dmitastr/yp_observability_service/internal/repository/conformance"
+	"github.com/dmitastr/yp_observability_service/internal/repository/memstorage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeNotifier struct {
+	mu         sync.Mutex
+	published  [][]string
+	subscribed chan func([]string)
+	err        error
+}
+
+func (n *fakeNotifier) Publish(_ context.Context, names []string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.published = append(n.published, names)
+	return nil
+}
+
+func (n *fakeNotifier) Published() [][]string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.published
+}
+
+func (n *fakeNotifier) Subscribe(ctx context.Context, fnc func([]string)) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.subscribed <- fnc
+	<-ctx.Done()
+	return nil
+}
+
+func TestCache_GetIsCached(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	db := storage.NewMockDatabase(ctrl)
+
+	stored := testhelpers.Gauge("Alloc", 1)
+	db.EXPECT().Get(gomock.Any(), "Alloc").Return(&stored, nil).Times(1)
+
+	c := New(db, time.Minute)
+	for range 3 {
+		metric, err := c.Get(t.Context(), "Alloc")
+		require.NoError(t, err)
+		assert.Equal(t, stored, *metric)
+	}
+
+	metric, _ := c.Get(t.Context(), "Alloc")
+	*metric.Value = 100
+	cached, _ := c.Get(t.Context(), "Alloc")
+	assert.Equal(t, float64(1), *cached.Value, "cached metric must not be changed by caller")
+}
+
+func TestCache_Expiration(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	db := storage.NewMockDatabase(ctrl)
+
+	stored := testhelpers.Gauge("Alloc", 1)
+	db.EXPECT().Get(gomock.Any(), "Alloc").Return(&stored, nil).Times(2)
+
+	now := time.Now()
+	c := New(db, time.Minute)
+	c.now = func() time.Time { return now }
+
+	_, err := c.Get(t.Context(), "Alloc")
+	require.NoError(t, err)
+	now = now.Add(2 * time.Minute)
+	_, err = c.Get(t.Context(), "Alloc")
+	require.NoError(t, err)
+}
+
+func TestCache_WriteInvalidates(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	db := storage.NewMockDatabase(ctrl)
+
+	before, after, other := testhelpers.Gauge("Alloc", 1), testhelpers.Gauge("Alloc", 2), testhelpers.Counter("PollCount", 1)
+	gomock.InOrder(
+		db.EXPECT().GetAll(gomock.Any()).Return([]models.Metrics{before, other}, nil),
+		db.EXPECT().Update(gomock.Any(), after).Return(nil),
+		db.EXPECT().GetByID(gomock.Any(), []string{"Alloc"}).Return([]models.Metrics{after}, nil),
+		db.EXPECT().Delete(gomock.Any(), repository.Filter{Names: []string{"PollCount"}}).Return([]string{"PollCount"}, nil),
+		db.EXPECT().GetByID(gomock.Any(), []string{"PollCount"}).Return(nil, nil),
+	)
+
+	c := New(db, time.Minute)
+	all, err := c.GetAll(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, []models.Metrics{before, other}, all)
+
+	metric, err := c.Get(t.Context(), "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, before, *metric, "metrics from GetAll must be cached")
+
+	require.NoError(t, c.Update(t.Context(), after))
+	all, err = c.GetAll(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, []models.Metrics{after, other}, all, "only changed metrics must be read again")
+
+	_, err = c.Delete(t.Context(), repository.Filter{Names: []string{"PollCount"}})
+	require.NoError(t, err)
+	all, err = c.GetAll(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, []models.Metrics{after}, all)
+	all, err = c.GetAll(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, []models.Metrics{after}, all)
+}
+
+func TestCache_Notifications(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	db := storage.NewMockDatabase(ctrl)
+
+	stored := testhelpers.Gauge("Alloc", 1)
+	db.EXPECT().Get(gomock.Any(), "Alloc").Return(&stored, nil).Times(2)
+	db.EXPECT().Increment(gomock.Any(), "PollCount", int64(1)).Return(int64(1), nil)
+
+	notifier := &fakeNotifier{subscribed: make(chan func([]string), 1)}
+	c := New(db, time.Minute).WithNotifier(notifier)
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error, 1)
+	go func() { done <- c.Run(ctx) }()
+	invalidate := <-notifier.subscribed
+
+	_, err := c.Get(t.Context(), "Alloc")
+	require.NoError(t, err)
+
+	invalidate([]string{"Alloc"})
+	_, err = c.Get(t.Context(), "Alloc")
+	require.NoError(t, err)
+
+	_, err = c.Increment(t.Context(), "PollCount", 1)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([][]string{{"PollCount"}}, notifier.Published())
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestCache_RunFailsWithoutSubscription(t *testing.T) {
+	delay := resubscribeDelay
+	resubscribeDelay = time.Millisecond
+	defer func() { resubscribeDelay = delay }()
+
+	ctrl := gomock.NewController(t)
+	notifier := &fakeNotifier{err: errors.New("error")}
+	c := New(storage.NewMockDatabase(ctrl), time.Minute).WithNotifier(notifier)
+	assert.ErrorIs(t, c.Run(t.Context()), notifier.err)
+}
+
+func TestCache_NotifiesAfterCommit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	db := storage.NewMockDatabase(ctrl)
+
+	before, after := testhelpers.Gauge("Alloc", 1), testhelpers.Gauge("Alloc", 2)
+	gomock.InOrder(
+		db.EXPECT().Update(gomock.Any(), after).Return(nil),
+		db.EXPECT().Get(gomock.Any(), "Alloc").Return(&before, nil),
+		db.EXPECT().Get(gomock.Any(), "Alloc").Return(&after, nil),
+	)
+
+	c := New(db, time.Minute).WithNotifier(&fakeNotifier{})
+	txCtx, committed := repository.WithCommitHooks(t.Context())
+	require.NoError(t, c.Update(txCtx, after))
+	assert.Empty(t, c.changes, "replicas must not be notified before commit")
+
+	// value read before commit is the previous one
+	metric, err := c.Get(t.Context(), "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, before, *metric)
+
+	committed()
+	assert.Equal(t, map[string]bool{"Alloc": true}, c.changes)
+	metric, err = c.Get(t.Context(), "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, after, *metric, "value read before commit must not stay cached")
+}
+
+func TestCache_Conformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) repository.Database {
+		interval, restore := 1, false
+		inner := memstorage.NewStorage(&serverenvconfig.Config{StoreInterval: &interval, Restore: &restore}, testhelpers.NopBackupManager{})
+		c := New(inner, time.Minute)
+		require.NoError(t, c.Init(""))
+		return c
+	})
+}
@@ -0,0 +1,11 @@
+package repository
+
+import "context"
+
+// ChangeNotifier broadcasts names of changed metrics between server replicas sharing the same storage
+type ChangeNotifier interface {
+	// Publish notifies all subscribers that metrics were changed, empty list means that all metrics could change
+	Publish(context.Context, []string) error
+	// Subscribe calls the function with names of changed metrics until context is done
+	Subscribe(context.Context, func([]string)) error
+}
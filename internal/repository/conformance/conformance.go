@@ -0,0 +1,290 @@
+// Package conformance contains tests which pin down behavior shared by all [repository.Database]
+// implementations. Every implementation runs them from its own tests with [Run]
+package conformance
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/common"
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/mocks/testhelpers"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Factory returns a new initialized and empty storage. It is closed by the suite
+type Factory func(t *testing.T) repository.Database
+
+// Run runs the suite, each test gets a new storage from newDB
+func Run(t *testing.T, newDB Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, db repository.Database)
+	}{
+		{name: "MissingMetric", test: testMissingMetric},
+		{name: "GaugeReplaced", test: testGaugeReplaced},
+		{name: "CounterAccumulated", test: testCounterAccumulated},
+		{name: "BulkUpdateDuplicates", test: testBulkUpdateDuplicates},
+		{name: "GetByID", test: testGetByID},
+		{name: "TypeConflict", test: testTypeConflict},
+		{name: "ConcurrentCounterUpdates", test: testConcurrentCounterUpdates},
+		{name: "Delete", test: testDelete},
+		{name: "DeleteStale", test: testDeleteStale},
+		{name: "ResetCounters", test: testResetCounters},
+		{name: "List", test: testList},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newDB(t)
+			defer func() {
+				assert.NoError(t, db.Close())
+			}()
+			tt.test(t, db)
+		})
+	}
+}
+
+func testMissingMetric(t *testing.T, db repository.Database) {
+	_, err := db.Get(t.Context(), "Missing")
+	assert.ErrorIs(t, err, errs.ErrorMetricDoesNotExist)
+
+	metrics, err := db.GetByID(t.Context(), []string{"Missing"})
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+
+	metrics, err = db.GetAll(t.Context())
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+}
+
+func testGaugeReplaced(t *testing.T, db repository.Database) {
+	require.NoError(t, db.Update(t.Context(), testhelpers.Gauge("Alloc", 1)))
+	require.NoError(t, db.Update(t.Context(), testhelpers.Gauge("Alloc", 2.5)))
+
+	metric, err := db.Get(t.Context(), "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, testhelpers.Gauge("Alloc", 2.5), *metric)
+}
+
+func testCounterAccumulated(t *testing.T, db repository.Database) {
+	require.NoError(t, db.Update(t.Context(), testhelpers.Counter("PollCount", 1)))
+	require.NoError(t, db.BulkUpdate(t.Context(), []models.Metrics{testhelpers.Counter("PollCount", 2)}))
+	total, err := db.Increment(t.Context(), "PollCount", 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), total)
+
+	total, err = db.Increment(t.Context(), "NewCount", 4)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), total, "increment creates a missing counter")
+
+	metric, err := db.Get(t.Context(), "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, testhelpers.Counter("PollCount", 6), *metric)
+}
+
+func testBulkUpdateDuplicates(t *testing.T, db repository.Database) {
+	require.NoError(t, db.BulkUpdate(t.Context(), []models.Metrics{
+		testhelpers.Gauge("Alloc", 1), testhelpers.Counter("PollCount", 1), testhelpers.Gauge("Alloc", 2), testhelpers.Counter("PollCount", 2),
+	}))
+
+	metrics, err := db.GetAll(t.Context())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []models.Metrics{testhelpers.Gauge("Alloc", 2), testhelpers.Counter("PollCount", 3)}, metrics)
+}
+
+func testGetByID(t *testing.T, db repository.Database) {
+	require.NoError(t, db.BulkUpdate(t.Context(), []models.Metrics{
+		testhelpers.Gauge("A", 1), testhelpers.Gauge("B", 2), testhelpers.Gauge("C", 3), testhelpers.Counter("D", 4), testhelpers.Gauge("E", 5),
+	}))
+
+	metrics, err := db.GetByID(t.Context(), []string{"B", "D", "Missing"})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []models.Metrics{testhelpers.Gauge("B", 2), testhelpers.Counter("D", 4)}, metrics)
+}
+
+// testTypeConflict checks that metric name is unique: updates of another type are rejected without
+// writing anything, a metric changes its type after being deleted and counter starts from the new delta
+func testTypeConflict(t *testing.T, db repository.Database) {
+	require.NoError(t, db.BulkUpdate(t.Context(), []models.Metrics{testhelpers.Counter("Metric", 5), testhelpers.Gauge("Alloc", 1)}))
+
+	var conflict *repository.TypeConflictError
+	require.ErrorAs(t, db.Update(t.Context(), testhelpers.Gauge("Metric", 1.5)), &conflict)
+	assert.Equal(t, []repository.TypeConflict{{Name: "Metric", Stored: "counter", Received: "gauge"}}, conflict.Conflicts)
+	_, err := db.Increment(t.Context(), "Alloc", 2)
+	assert.ErrorIs(t, err, errs.ErrorTypeConflict)
+
+	err = db.BulkUpdate(t.Context(), []models.Metrics{testhelpers.Gauge("Alloc", 2), testhelpers.Counter("Alloc", 1), testhelpers.Counter("Metric", 1)})
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, []string{"Alloc"}, conflict.Names())
+	err = db.BulkUpdate(t.Context(), []models.Metrics{testhelpers.Gauge("New", 1), testhelpers.Gauge("Metric", 1)})
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, []string{"Metric"}, conflict.Names())
+
+	metrics, err := db.GetAll(t.Context())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []models.Metrics{testhelpers.Counter("Metric", 5), testhelpers.Gauge("Alloc", 1)}, metrics, "conflicting batches are not written")
+
+	_, err = db.Delete(t.Context(), repository.Filter{Names: []string{"Metric"}})
+	require.NoError(t, err)
+	require.NoError(t, db.Update(t.Context(), testhelpers.Gauge("Metric", 1.5)))
+	metric, err := db.Get(t.Context(), "Metric")
+	require.NoError(t, err)
+	assert.Equal(t, testhelpers.Gauge("Metric", 1.5), *metric)
+}
+
+func testConcurrentCounterUpdates(t *testing.T, db repository.Database) {
+	const workers, updates = 8, 25
+
+	var wg sync.WaitGroup
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range updates {
+				var err error
+				switch (i + j) % 3 {
+				case 0:
+					_, err = db.Increment(t.Context(), "PollCount", 1)
+				case 1:
+					err = db.Update(t.Context(), testhelpers.Counter("PollCount", 1))
+				default:
+					err = db.BulkUpdate(t.Context(), []models.Metrics{testhelpers.Counter("PollCount", 1), testhelpers.Gauge(fmt.Sprintf("Gauge%d", i), float64(j))})
+				}
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	metric, err := db.Get(t.Context(), "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, testhelpers.Counter("PollCount", workers*updates), *metric)
+
+	metrics, err := db.GetAll(t.Context())
+	require.NoError(t, err)
+	assert.Len(t, metrics, workers+1)
+}
+
+func deleted(t *testing.T, db repository.Database, filter repository.Filter) []string {
+	names, err := db.Delete(t.Context(), filter)
+	require.NoError(t, err)
+	return names
+}
+
+func testDelete(t *testing.T, db repository.Database) {
+	require.NoError(t, db.BulkUpdate(t.Context(), []models.Metrics{
+		testhelpers.Gauge("host1.cpu", 1), testhelpers.Counter("host1.requests", 2), testhelpers.Gauge("host2.cpu", 3), testhelpers.Counter("host2.requests", 4),
+		testhelpers.Gauge("Alloc", 5), testhelpers.Counter("PollCount", 6),
+	}))
+
+	_, err := db.Delete(t.Context(), repository.Filter{})
+	assert.ErrorIs(t, err, errs.ErrorEmptyFilter, "empty filter must not delete everything")
+
+	assert.Empty(t, deleted(t, db, repository.Filter{Names: []string{"Alloc"}, Type: common.COUNTER}))
+	assert.Equal(t, []string{"Alloc"}, deleted(t, db, repository.Filter{Names: []string{"Alloc", "Missing"}, Type: common.GAUGE}))
+	_, err = db.Get(t.Context(), "Alloc")
+	assert.ErrorIs(t, err, errs.ErrorMetricDoesNotExist)
+
+	assert.ElementsMatch(t, []string{"host1.cpu", "host1.requests"}, deleted(t, db, repository.Filter{Prefix: "host1."}))
+	// \z is Go syntax only, storages must not hand the pattern to another regexp engine
+	assert.Empty(t, deleted(t, db, repository.Filter{Pattern: regexp.MustCompile(`^host\d+\.req\z`)}))
+	assert.Equal(t, []string{"host2.requests"}, deleted(t, db, repository.Filter{Pattern: regexp.MustCompile(`^host\d+\.req\w*\z`)}))
+
+	metrics, err := db.GetAll(t.Context())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []models.Metrics{testhelpers.Gauge("host2.cpu", 3), testhelpers.Counter("PollCount", 6)}, metrics)
+
+	total, err := db.Increment(t.Context(), "host1.requests", 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total, "deleted counter starts from scratch")
+}
+
+func testDeleteStale(t *testing.T, db repository.Database) {
+	require.NoError(t, db.BulkUpdate(t.Context(), []models.Metrics{testhelpers.Gauge("Alloc", 1), testhelpers.Counter("PollCount", 2)}))
+
+	assert.Empty(t, deleted(t, db, repository.Filter{UpdatedBefore: time.Now().Add(-time.Hour)}))
+	assert.ElementsMatch(t, []string{"Alloc", "PollCount"}, deleted(t, db, repository.Filter{UpdatedBefore: time.Now().Add(time.Hour)}))
+
+	metrics, err := db.GetAll(t.Context())
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+}
+
+func testResetCounters(t *testing.T, db repository.Database) {
+	require.NoError(t, db.BulkUpdate(t.Context(), []models.Metrics{
+		testhelpers.Counter("quota.a", 3), testhelpers.Counter("quota.b", 4), testhelpers.Counter("PollCount", 5), testhelpers.Gauge("quota.gauge", 1),
+	}))
+
+	previous, err := db.ResetCounters(t.Context(), repository.Filter{Prefix: "quota."})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []models.Metrics{testhelpers.Counter("quota.a", 3), testhelpers.Counter("quota.b", 4)}, previous)
+
+	total, err := db.Increment(t.Context(), "quota.a", 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total, "counter continues from zero")
+
+	previous, err = db.ResetCounters(t.Context(), repository.Filter{})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []models.Metrics{testhelpers.Counter("quota.a", 2), testhelpers.Counter("quota.b", 0), testhelpers.Counter("PollCount", 5)}, previous)
+
+	metrics, err := db.GetAll(t.Context())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []models.Metrics{
+		testhelpers.Counter("quota.a", 0), testhelpers.Counter("quota.b", 0), testhelpers.Counter("PollCount", 0), testhelpers.Gauge("quota.gauge", 1),
+	}, metrics, "gauges are not reset")
+
+	assert.Empty(t, deleted(t, db, repository.Filter{UpdatedBefore: time.Now().Add(-time.Hour)}))
+}
+
+// listAll reads all pages of query and returns names of listed metrics
+func listAll(t *testing.T, db repository.Database, query repository.ListQuery) (names []string, pages int) {
+	for {
+		page, err := db.List(t.Context(), query)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(page.Metrics), query.Limit)
+		for _, m := range page.Metrics {
+			names = append(names, m.ID)
+		}
+		pages++
+		if page.Next == nil {
+			return names, pages
+		}
+		cursor, err := repository.DecodeCursor(page.Next.Encode())
+		require.NoError(t, err)
+		query.Cursor = cursor
+	}
+}
+
+func testList(t *testing.T, db repository.Database) {
+	require.NoError(t, db.BulkUpdate(t.Context(), []models.Metrics{
+		testhelpers.Gauge("b", 1), testhelpers.Counter("a", 1), testhelpers.Gauge("host.c", 1), testhelpers.Counter("host.d", 1), testhelpers.Gauge("E", 1), testhelpers.Counter("f", 1), testhelpers.Gauge("_g", 1),
+	}))
+
+	names, pages := listAll(t, db, repository.ListQuery{Sort: repository.SortByName, Limit: 2})
+	assert.Equal(t, []string{"E", "_g", "a", "b", "f", "host.c", "host.d"}, names)
+	assert.Equal(t, 4, pages)
+
+	names, _ = listAll(t, db, repository.ListQuery{Sort: repository.SortByNameDesc, Limit: 3})
+	assert.Equal(t, []string{"host.d", "host.c", "f", "b", "a", "_g", "E"}, names)
+
+	names, _ = listAll(t, db, repository.ListQuery{Sort: repository.SortByType, Limit: 2})
+	assert.Equal(t, []string{"a", "f", "host.d", "E", "_g", "b", "host.c"}, names)
+
+	names, _ = listAll(t, db, repository.ListQuery{Sort: repository.SortByTypeDesc, Limit: 4})
+	assert.Equal(t, []string{"host.c", "b", "_g", "E", "host.d", "f", "a"}, names)
+
+	names, pages = listAll(t, db, repository.ListQuery{Filter: repository.Filter{Prefix: "host."}, Sort: repository.SortByName, Limit: 2})
+	assert.Equal(t, []string{"host.c", "host.d"}, names)
+	assert.Equal(t, 1, pages, "no empty page after the last one")
+
+	names, _ = listAll(t, db, repository.ListQuery{
+		Filter: repository.Filter{Type: common.GAUGE, Pattern: regexp.MustCompile(`^[a-z]`)}, Sort: repository.SortByName, Limit: 10,
+	})
+	assert.Equal(t, []string{"b", "host.c"}, names)
+}
@@ -6,12 +6,25 @@ import (
 	"github.com/dmitastr/yp_observability_service/internal/domain/models"
 )
 
+// Database stores metrics. Gauge values are replaced on update, counter deltas are added
+// to the stored value atomically by the storage itself. A metric is identified by its name: updates
+// which change metric type are rejected with [*TypeConflictError] atomically with the write, a metric
+// changes its type only after being deleted
 type Database interface {
 	Update(context.Context, models.Metrics) error
 	BulkUpdate(context.Context, []models.Metrics) error
+	// Increment atomically adds delta to the counter with the given name and returns its new value
+	Increment(context.Context, string, int64) (int64, error)
 	GetAll(context.Context) ([]models.Metrics, error)
 	Get(context.Context, string) (*models.Metrics, error)
 	GetByID(context.Context, []string) ([]models.Metrics, error)
+	// List returns a page of metrics selected by query filter in query order
+	List(context.Context, ListQuery) (Page, error)
+	// Delete removes metrics selected by filter and returns their names. Empty filter is rejected
+	Delete(context.Context, Filter) ([]string, error)
+	// ResetCounters atomically sets counters selected by filter to zero and returns their previous values.
+	// Empty filter selects all counters, gauges are never selected. Reset does not count as an update
+	ResetCounters(context.Context, Filter) ([]models.Metrics, error)
 	Close() error
 	Init(string) error
 	Ping(context.Context) error
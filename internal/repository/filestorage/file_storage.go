@@ -1,67 +1,546 @@
 package filestorage
 
 import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/dmitastr/yp_observability_service/internal/common"
 	serverenvconfig "github.com/dmitastr/yp_observability_service/internal/config/env_parser/server/server_env_config"
 	"github.com/dmitastr/yp_observability_service/internal/domain/models"
 	"github.com/dmitastr/yp_observability_service/internal/logger"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
 )
 
+// walRecord is a single line of the write-ahead log. Deleted metrics are removed before updates are applied,
+// so a metric both deleted and updated by a record is replaced. Time is set for updates only,
+// replaced metrics keep time of their last update
+type walRecord struct {
+	Seq     uint64           `json:"seq"`
+	Metrics []models.Metrics `json:"metrics"`
+	Deleted []string         `json:"deleted,omitempty"`
+	Time    time.Time        `json:"time,omitzero"`
+}
+
+// FileStorage keeps metrics snapshot in FileName and updates made after the snapshot in a write-ahead log
+// next to it. Snapshot is replaced atomically: it is written to a temporary file, synced and renamed.
+// Log is split into segments: a new one is started after each snapshot and segments included into
+// a snapshot are removed
 type FileStorage struct {
 	StoreInterval int
 	FileName      string
+	// Keep is a number of timestamped snapshots retained on periodic backups, 0 disables them
+	Keep     int
+	Compress bool
+
+	// period is a time between periodic backups
+	period time.Duration
+	// flushMu serializes snapshot writes, flushedSeq is used to drop snapshots older than the saved one
+	flushMu    sync.Mutex
+	flushedSeq uint64
+
+	mu  sync.Mutex
+	wal *os.File
+	// walBase is a number of the last record before the current segment
+	walBase uint64
+	seq     uint64
+	// restored is set when the log was loaded, otherwise segments left from the previous run are archived
+	restored bool
 }
 
 func New(cfg *serverenvconfig.Config) *FileStorage {
-	return &FileStorage{StoreInterval: *cfg.StoreInterval, FileName: *cfg.FileStoragePath}
+	fs := &FileStorage{
+		StoreInterval: *cfg.StoreInterval,
+		FileName:      *cfg.FileStoragePath,
+		period:        time.Duration(*cfg.StoreInterval) * time.Second,
+	}
+	if cfg.SnapshotKeep != nil {
+		fs.Keep = *cfg.SnapshotKeep
+	}
+	if cfg.SnapshotGzip != nil {
+		fs.Compress = *cfg.SnapshotGzip
+	}
+	return fs
+}
+
+// Init creates the directory of the snapshot file, the log and metadata are written next to it
+func (fs *FileStorage) Init() error {
+	if err := os.MkdirAll(filepath.Dir(fs.FileName), 0755); err != nil {
+		return fmt.Errorf("error creating directory for '%s': %w", fs.FileName, err)
+	}
+	return nil
+}
+
+// walPrefix returns common prefix of log segments: data.json -> data.json.wal-
+func (fs *FileStorage) walPrefix() string {
+	return fs.FileName + ".wal-"
+}
+
+// segmentName returns name of the log segment holding records after base
+func (fs *FileStorage) segmentName(base uint64) string {
+	return fmt.Sprintf("%s%0*d", fs.walPrefix(), segmentDigits, base)
 }
 
-func (fs *FileStorage) SaveData(fnc func() []models.Metrics) {
-	ticker := time.NewTicker(time.Duration(fs.StoreInterval) * time.Second)
-	for range ticker.C {
-		metrics := fnc()
-		if err := fs.Flush(metrics); err != nil {
-			logger.Errorf("Error while saving data to a file: %v", err)
+// segmentDigits is a width of record number in names of log segments, so they are sorted by name
+const segmentDigits = 20
+
+type walSegment struct {
+	name string
+	base uint64
+}
+
+// segments returns log segments ordered by their records. Log written before segments were introduced
+// is the first one
+func (fs *FileStorage) segments() ([]walSegment, error) {
+	dir := filepath.Dir(fs.FileName)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error listing write-ahead log segments: %w", err)
+	}
+
+	legacy, prefix := filepath.Base(fs.FileName)+".wal", filepath.Base(fs.walPrefix())
+	var segments []walSegment
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if entry.Name() == legacy {
+			segments = append(segments, walSegment{name: filepath.Join(dir, legacy)})
+			continue
+		}
+		digits, ok := strings.CutPrefix(entry.Name(), prefix)
+		if !ok || len(digits) != segmentDigits {
+			continue
 		}
+		base, err := strconv.ParseUint(digits, 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, walSegment{name: filepath.Join(dir, entry.Name()), base: base})
 	}
+
+	slices.SortStableFunc(segments, func(a, b walSegment) int {
+		return cmp.Compare(a.base, b.base)
+	})
+	return segments, nil
 }
 
-func (fs *FileStorage) RunBackup(fnc func() []models.Metrics) {
-	go fs.SaveData(fnc)
+// Run saves snapshot and rotates timestamped copies every period until ctx is canceled. Failed backups
+// are logged and retried with the next period, updates are kept in the write-ahead log meanwhile,
+// so the server keeps serving while backup is failing
+func (fs *FileStorage) Run(ctx context.Context, fnc func() repository.Snapshot) error {
+	if fs.period <= 0 {
+		return nil
+	}
+	ticker := time.NewTicker(fs.period)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		snapshot := fnc()
+		if err := fs.Flush(snapshot); err != nil {
+			failures++
+			logger.Errorf("Error while saving data to a file, %d failures in a row: %v", failures, err)
+			continue
+		}
+		if failures > 0 {
+			logger.Infof("Periodic backup recovered after %d failures", failures)
+			failures = 0
+		}
+		if err := fs.rotate(snapshot); err != nil {
+			logger.Errorf("Error while rotating snapshots: %v", err)
+		}
+	}
+}
+
+// writeAtomic writes file with a temporary file in the same directory which is renamed after it is synced,
+// so a crash never leaves a partially written file
+func writeAtomic(name string, write func(io.Writer) error) error {
+	dir := filepath.Dir(name)
+	tmp, err := os.CreateTemp(dir, filepath.Base(name)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file for '%s': %w", name, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error syncing file '%s': %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error closing file '%s': %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf("error renaming '%s' to '%s': %w", tmp.Name(), name, err)
+	}
+	return syncDir(dir)
 }
 
-func (fs *FileStorage) createFile() *os.File {
-	file, err := os.Create(fs.FileName)
+// syncDir makes rename durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
 	if err != nil {
-		logger.Errorf("error while creating file '%s': %v", fs.FileName, err)
+		return fmt.Errorf("error opening directory '%s': %w", dir, err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("error syncing directory '%s': %w", dir, err)
 	}
-	return file
+	return nil
 }
 
-func (fs *FileStorage) Flush(metrics []models.Metrics) error {
-	file := fs.createFile()
-	defer file.Close()
-	if err := json.NewEncoder(file).Encode(metrics); err != nil {
+// Flush atomically replaces snapshot file and removes log records included into the snapshot.
+// Snapshot taken before the saved one is skipped, so a slow periodic backup never overwrites newer data
+func (fs *FileStorage) Flush(snapshot repository.Snapshot) error {
+	fs.flushMu.Lock()
+	defer fs.flushMu.Unlock()
+	if snapshot.Seq < fs.flushedSeq {
+		return nil
+	}
+
+	err := writeAtomic(fs.FileName, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(snapshot)
+	})
+	if err != nil {
 		logger.Error(err)
 		return err
 	}
+
+	fs.flushedSeq = snapshot.Seq
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.rotateWAL(snapshot.Seq)
+}
+
+// openWAL starts a new log segment after the last record, segments left from the previous run are archived
+// unless the log was loaded. Must be called with mu locked
+func (fs *FileStorage) openWAL() error {
+	if fs.wal != nil {
+		return nil
+	}
+	if !fs.restored {
+		if err := fs.archiveWAL(); err != nil {
+			return err
+		}
+		fs.restored = true
+	}
+
+	// loaded records are numbered up to seq, so an existing segment with this name holds
+	// a partially written record at most
+	name := fs.segmentName(fs.seq)
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening write-ahead log '%s': %w", name, err)
+	}
+	fs.wal, fs.walBase = file, fs.seq
 	return nil
 }
 
-func (fs *FileStorage) Load() (metrics []models.Metrics, err error) {
-	file, err := os.Open(fs.FileName)
+// archiveWAL renames log segments, so they are not replayed anymore but are kept for manual recovery.
+// Must be called with mu locked
+func (fs *FileStorage) archiveWAL() error {
+	segments, err := fs.segments()
+	if err != nil || len(segments) == 0 {
+		return err
+	}
+
+	suffix := ".archived-" + time.Now().UTC().Format(snapshotTimeFormat)
+	for _, segment := range segments {
+		if err := os.Rename(segment.name, segment.name+suffix); err != nil {
+			return fmt.Errorf("error archiving write-ahead log '%s': %w", segment.name, err)
+		}
+	}
+	logger.Infof("Archived %d write-ahead log segments which were not restored", len(segments))
+	return syncDir(filepath.Dir(fs.FileName))
+}
+
+// rotateWAL closes the current segment if it has records, so the next record starts a new one,
+// and removes segments with records up to seq only. Must be called with mu locked
+func (fs *FileStorage) rotateWAL(seq uint64) error {
+	if err := fs.openWAL(); err != nil {
+		return err
+	}
+	if fs.walBase < fs.seq {
+		if err := fs.wal.Close(); err != nil {
+			logger.Errorf("error closing write-ahead log: %v", err)
+		}
+		fs.wal = nil
+	}
+
+	segments, err := fs.segments()
 	if err != nil {
-		logger.Infof("error while opening file '%s': %s", fs.FileName, err)
-		return metrics, err
+		return err
+	}
+	for i, segment := range segments {
+		// segment ends where the next one starts, the last one ends with the last record
+		end := fs.seq
+		if i+1 < len(segments) {
+			end = segments[i+1].base
+		}
+		if end > seq {
+			break
+		}
+		if fs.wal != nil && segment.name == fs.wal.Name() {
+			continue
+		}
+		if err := os.Remove(segment.name); err != nil {
+			return fmt.Errorf("error removing write-ahead log '%s': %w", segment.name, err)
+		}
+	}
+	return nil
+}
+
+// Append writes updates to the log and syncs it to disk before returning
+func (fs *FileStorage) Append(metrics []models.Metrics) (uint64, error) {
+	return fs.appendRecord(walRecord{Metrics: metrics, Time: time.Now()})
+}
+
+// Remove writes deletion of metrics to the log and syncs it to disk before returning
+func (fs *FileStorage) Remove(names []string) (uint64, error) {
+	return fs.appendRecord(walRecord{Deleted: names})
+}
+
+// Replace writes metrics replacing the stored ones to the log and syncs it to disk before returning
+func (fs *FileStorage) Replace(metrics []models.Metrics) (uint64, error) {
+	names := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		names = append(names, m.ID)
+	}
+	return fs.appendRecord(walRecord{Deleted: names, Metrics: metrics})
+}
+
+// appendRecord numbers record and writes it to the log
+func (fs *FileStorage) appendRecord(record walRecord) (uint64, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.openWAL(); err != nil {
+		return 0, err
+	}
+
+	record.Seq = fs.seq + 1
+	line, err := json.Marshal(record)
+	if err != nil {
+		return 0, fmt.Errorf("error encoding write-ahead log record: %w", err)
+	}
+	if _, err := fs.wal.Write(append(line, '\n')); err != nil {
+		return 0, fmt.Errorf("error writing to write-ahead log: %w", err)
+	}
+	if err := fs.wal.Sync(); err != nil {
+		return 0, fmt.Errorf("error syncing write-ahead log: %w", err)
+	}
+	fs.seq = record.Seq
+	return record.Seq, nil
+}
+
+// readWAL reads all complete records of the log segments
+func (fs *FileStorage) readWAL() ([]walRecord, error) {
+	segments, err := fs.segments()
+	if err != nil {
+		return nil, err
+	}
+
+	var records []walRecord
+	for _, segment := range segments {
+		read, err := readSegment(segment.name)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, read...)
+	}
+	return records, nil
+}
+
+// readSegment reads all complete records of the log segment, a partially written last line is ignored
+func readSegment(name string) ([]walRecord, error) {
+	file, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening write-ahead log '%s': %w", name, err)
 	}
 	defer file.Close()
 
-	if err = json.NewDecoder(file).Decode(&metrics); err != nil {
+	var records []walRecord
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(bytes.TrimSpace(line)) > 0 {
+				logger.Warnf("skipping incomplete write-ahead log record: %s", line)
+			}
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading write-ahead log '%s': %w", name, err)
+		}
+
+		var record walRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, fmt.Errorf("error decoding write-ahead log record: %w", err)
+		}
+		records = append(records, record)
+	}
+}
+
+// loadSnapshot reads snapshot file. Files written before the log was introduced hold a plain list of metrics
+func (fs *FileStorage) loadSnapshot() (snapshot repository.Snapshot, err error) {
+	data, err := os.ReadFile(fs.FileName)
+	if errors.Is(err, os.ErrNotExist) {
+		logger.Infof("snapshot file '%s' does not exist", fs.FileName)
+		return snapshot, nil
+	}
+	if err != nil {
+		return snapshot, fmt.Errorf("error reading file '%s': %w", fs.FileName, err)
+	}
+
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		err = json.Unmarshal(data, &snapshot.Metrics)
+	} else if len(data) > 0 {
+		err = json.Unmarshal(data, &snapshot)
+	}
+	if err != nil {
+		return snapshot, fmt.Errorf("error decoding file '%s': %w", fs.FileName, err)
+	}
+	return snapshot, nil
+}
+
+// Load reads the snapshot and replays log records written after it
+func (fs *FileStorage) Load() (repository.Snapshot, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	snapshot, err := fs.loadSnapshot()
+	if err != nil {
+		logger.Error(err)
+		return snapshot, err
+	}
+	records, err := fs.readWAL()
+	if err != nil {
 		logger.Error(err)
-		return
+		return snapshot, err
+	}
+
+	state := make(map[string]models.Metrics, len(snapshot.Metrics))
+	order := make([]string, 0, len(snapshot.Metrics))
+	for _, m := range snapshot.Metrics {
+		state[m.ID] = m
+		order = append(order, m.ID)
+	}
+
+	updated := make(map[string]time.Time, len(snapshot.Metrics))
+	for name, t := range snapshot.Updated {
+		updated[name] = t
+	}
+
+	replayed := 0
+	for _, record := range records {
+		if record.Seq <= snapshot.Seq {
+			continue
+		}
+		for _, name := range record.Deleted {
+			if _, ok := state[name]; ok {
+				delete(state, name)
+				order = slices.DeleteFunc(order, func(id string) bool { return id == name })
+			}
+		}
+		for _, upd := range record.Metrics {
+			exist, ok := state[upd.ID]
+			if !ok {
+				order = append(order, upd.ID)
+			} else if upd.MType == common.COUNTER && exist.MType == common.COUNTER && exist.Delta != nil && upd.Delta != nil {
+				upd.UpdateDelta(*exist.Delta)
+			}
+			state[upd.ID] = upd
+			if !record.Time.IsZero() {
+				updated[upd.ID] = record.Time
+			}
+		}
+		snapshot.Seq = record.Seq
+		replayed++
 	}
-	return
+	if replayed > 0 {
+		logger.Infof("Replayed %d write-ahead log records", replayed)
+	}
+
+	snapshot.Metrics = make([]models.Metrics, 0, len(order))
+	snapshot.Updated = nil
+	for _, id := range order {
+		snapshot.Metrics = append(snapshot.Metrics, state[id])
+		if t, ok := updated[id]; ok {
+			if snapshot.Updated == nil {
+				snapshot.Updated = make(map[string]time.Time, len(order))
+			}
+			snapshot.Updated[id] = t
+		}
+	}
+	fs.seq = snapshot.Seq
+	fs.restored = true
+	return snapshot, nil
+}
+
+// Close closes write-ahead log
+func (fs *FileStorage) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.wal == nil {
+		return nil
+	}
+	err := fs.wal.Close()
+	fs.wal = nil
+	return err
+}
+
+func (fs *FileStorage) metadataName() string {
+	return fs.FileName + ".meta"
+}
+
+// LoadMetadata reads metadata file, missing file means no metadata
+func (fs *FileStorage) LoadMetadata() ([]models.Metadata, error) {
+	data, err := os.ReadFile(fs.metadataName())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading file '%s': %w", fs.metadataName(), err)
+	}
+
+	var metadata []models.Metadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("error decoding file '%s': %w", fs.metadataName(), err)
+	}
+	return metadata, nil
+}
+
+// SaveMetadata atomically replaces metadata file
+func (fs *FileStorage) SaveMetadata(metadata []models.Metadata) error {
+	return writeAtomic(fs.metadataName(), func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(metadata)
+	})
 }
@@ -0,0 +1,493 @@
+package filestorage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	serverenvconfig "github.com/dmitastr/yp_observability_service/internal/config/env_parser/server/server_env_config"
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/mocks/testhelpers"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+	"github.com/dmitastr/yp_observability_service/internal/repository/conformance"
+	"github.com/dmitastr/yp_observability_service/internal/repository/memstorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newConfig(path string, interval int, restore bool) *serverenvconfig.Config {
+	return &serverenvconfig.Config{FileStoragePath: &path, StoreInterval: &interval, Restore: &restore}
+}
+
+func TestFileStorage_FlushLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	fs := New(newConfig(path, 1, true))
+
+	snapshot := repository.Snapshot{Seq: 3, Metrics: []models.Metrics{testhelpers.Gauge("Alloc", 1), testhelpers.Counter("PollCount", 2)}}
+	require.NoError(t, fs.Flush(snapshot))
+
+	loaded, err := New(newConfig(path, 1, true)).Load()
+	require.NoError(t, err)
+	assert.Equal(t, snapshot, loaded)
+
+	matches, _ := filepath.Glob(path + ".tmp-*")
+	assert.Empty(t, matches, "temporary files must be removed")
+}
+
+func TestFileStorage_LoadLegacyFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"id":"PollCount","type":"counter","delta":5}]`), 0644))
+
+	loaded, err := New(newConfig(path, 1, true)).Load()
+	require.NoError(t, err)
+	assert.Equal(t, []models.Metrics{testhelpers.Counter("PollCount", 5)}, loaded.Metrics)
+}
+
+func TestFileStorage_LoadMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+
+	loaded, err := New(newConfig(path, 1, true)).Load()
+	require.NoError(t, err)
+	assert.Empty(t, loaded.Metrics)
+}
+
+func TestFileStorage_ReplayWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	fs := New(newConfig(path, 1, true))
+	_, err := fs.Load()
+	require.NoError(t, err)
+
+	seq, err := fs.Append([]models.Metrics{testhelpers.Counter("PollCount", 1), testhelpers.Gauge("Alloc", 1)})
+	require.NoError(t, err)
+	require.NoError(t, fs.Flush(repository.Snapshot{Seq: seq, Metrics: []models.Metrics{testhelpers.Counter("PollCount", 1), testhelpers.Gauge("Alloc", 1)}}))
+	segment := fs.segmentName(seq)
+
+	_, err = fs.Append([]models.Metrics{testhelpers.Counter("PollCount", 2)})
+	require.NoError(t, err)
+	_, err = fs.Append([]models.Metrics{testhelpers.Gauge("Alloc", 5), testhelpers.Counter("PollCount", 3)})
+	require.NoError(t, err)
+
+	// crash: no flush, last record is written partially
+	f, err := os.OpenFile(segment, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"seq":4,"metrics":[{"id":"PollC`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	loaded, err := New(newConfig(path, 1, true)).Load()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), loaded.Seq)
+	assert.ElementsMatch(t, []models.Metrics{testhelpers.Counter("PollCount", 6), testhelpers.Gauge("Alloc", 5)}, loaded.Metrics)
+}
+
+func TestFileStorage_ReplayWALDeletionAndReset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	fs := New(newConfig(path, 1, true))
+	require.NoError(t, fs.Flush(repository.Snapshot{Metrics: []models.Metrics{testhelpers.Counter("PollCount", 1), testhelpers.Gauge("Alloc", 1)}}))
+	_, err := fs.Load()
+	require.NoError(t, err)
+
+	_, err = fs.Remove([]string{"PollCount"})
+	require.NoError(t, err)
+	_, err = fs.Append([]models.Metrics{testhelpers.Counter("PollCount", 2)})
+	require.NoError(t, err)
+	_, err = fs.Remove([]string{"Alloc"})
+	require.NoError(t, err)
+	_, err = fs.Replace([]models.Metrics{testhelpers.Counter("PollCount", 0)})
+	require.NoError(t, err)
+	_, err = fs.Append([]models.Metrics{testhelpers.Counter("PollCount", 3)})
+	require.NoError(t, err)
+	require.NoError(t, fs.Close())
+
+	loaded, err := New(newConfig(path, 1, true)).Load()
+	require.NoError(t, err)
+	assert.Equal(t, []models.Metrics{testhelpers.Counter("PollCount", 3)}, loaded.Metrics)
+}
+
+func TestFileStorage_WALDiscardedWithoutRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	fs := New(newConfig(path, 1, true))
+	_, err := fs.Append([]models.Metrics{testhelpers.Counter("PollCount", 1)})
+	require.NoError(t, err)
+	require.NoError(t, fs.Close())
+
+	fs = New(newConfig(path, 1, false))
+	_, err = fs.Append([]models.Metrics{testhelpers.Counter("PollCount", 2)})
+	require.NoError(t, err)
+	require.NoError(t, fs.Close())
+
+	loaded, err := New(newConfig(path, 1, true)).Load()
+	require.NoError(t, err)
+	assert.Equal(t, []models.Metrics{testhelpers.Counter("PollCount", 2)}, loaded.Metrics)
+
+	// log of the previous run is kept for manual recovery
+	archived, err := filepath.Glob(path + ".wal-*.archived-*")
+	require.NoError(t, err)
+	require.Len(t, archived, 1)
+	records, err := readSegment(archived[0])
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, []models.Metrics{testhelpers.Counter("PollCount", 1)}, records[0].Metrics)
+}
+
+func TestFileStorage_FlushRotatesWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	fs := New(newConfig(path, 1, true))
+	_, err := fs.Load()
+	require.NoError(t, err)
+
+	_, err = fs.Append([]models.Metrics{testhelpers.Counter("PollCount", 1)})
+	require.NoError(t, err)
+	seq, err := fs.Append([]models.Metrics{testhelpers.Counter("PollCount", 2)})
+	require.NoError(t, err)
+
+	// snapshot taken before the last record: the segment is still needed
+	require.NoError(t, fs.Flush(repository.Snapshot{Seq: seq - 1, Metrics: []models.Metrics{testhelpers.Counter("PollCount", 1)}}))
+	_, err = fs.Append([]models.Metrics{testhelpers.Counter("PollCount", 3)})
+	require.NoError(t, err)
+	segments, err := fs.segments()
+	require.NoError(t, err)
+	assert.Equal(t, []walSegment{{name: fs.segmentName(0)}, {name: fs.segmentName(seq), base: seq}}, segments)
+
+	require.NoError(t, fs.Flush(repository.Snapshot{Seq: seq, Metrics: []models.Metrics{testhelpers.Counter("PollCount", 3)}}))
+	segments, err = fs.segments()
+	require.NoError(t, err)
+	assert.Equal(t, []walSegment{{name: fs.segmentName(seq), base: seq}}, segments)
+	require.NoError(t, fs.Close())
+
+	loaded, err := New(newConfig(path, 1, true)).Load()
+	require.NoError(t, err)
+	assert.Equal(t, []models.Metrics{testhelpers.Counter("PollCount", 6)}, loaded.Metrics)
+}
+
+func TestFileStorage_ReplayLegacyWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	require.NoError(t, os.WriteFile(path+".wal", []byte(`{"seq":1,"metrics":[{"id":"PollCount","type":"counter","delta":5}]}`+"\n"), 0644))
+
+	fs := New(newConfig(path, 1, true))
+	loaded, err := fs.Load()
+	require.NoError(t, err)
+	assert.Equal(t, []models.Metrics{testhelpers.Counter("PollCount", 5)}, loaded.Metrics)
+
+	// legacy log is removed once it is included into a snapshot
+	require.NoError(t, fs.Flush(loaded))
+	require.NoError(t, fs.Close())
+	assert.NoFileExists(t, path+".wal")
+}
+
+func TestFileStorage_MemstorageCrashRecovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	cfg := newConfig(path, 300, true)
+
+	storage := memstorage.NewStorage(cfg, New(cfg))
+	require.NoError(t, storage.Init(""))
+	for range 3 {
+		_, err := storage.Increment(t.Context(), "PollCount", 1)
+		require.NoError(t, err)
+	}
+	require.NoError(t, storage.Update(t.Context(), testhelpers.Gauge("Alloc", 10)))
+	// crash: storage is not closed, periodic backup has not happened yet
+
+	restored := memstorage.NewStorage(cfg, New(cfg))
+	require.NoError(t, restored.Init(""))
+	metric, err := restored.Get(t.Context(), "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), *metric.Delta)
+
+	_, err = restored.Increment(t.Context(), "PollCount", 1)
+	require.NoError(t, err)
+	require.NoError(t, restored.Close())
+
+	final, err := New(cfg).Load()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []models.Metrics{testhelpers.Counter("PollCount", 4), testhelpers.Gauge("Alloc", 10)}, final.Metrics)
+}
+
+func TestFileStorage_MemstorageRestoreKeepsUpdateTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	cfg := newConfig(path, 300, true)
+	hourAgo := time.Now().Add(-time.Hour).UTC()
+
+	fs := New(cfg)
+	require.NoError(t, fs.Flush(repository.Snapshot{
+		Seq:     1,
+		Metrics: []models.Metrics{testhelpers.Gauge("Stale", 1), testhelpers.Gauge("Legacy", 2), testhelpers.Counter("Reset", 3)},
+		Updated: map[string]time.Time{"Stale": hourAgo, "Reset": hourAgo},
+	}))
+	require.NoError(t, fs.Init())
+	_, err := fs.Replace([]models.Metrics{testhelpers.Counter("Reset", 0)})
+	require.NoError(t, err)
+	_, err = fs.Append([]models.Metrics{testhelpers.Gauge("Fresh", 4)})
+	require.NoError(t, err)
+	require.NoError(t, fs.Close())
+
+	storage := memstorage.NewStorage(cfg, New(cfg))
+	require.NoError(t, storage.Init(""))
+	deleted, err := storage.Delete(t.Context(), repository.Filter{UpdatedBefore: time.Now().Add(-time.Minute)})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"Stale", "Reset"}, deleted, "restart must not reset retention clock")
+
+	metrics, err := storage.GetAll(t.Context())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []models.Metrics{testhelpers.Gauge("Legacy", 2), testhelpers.Gauge("Fresh", 4)}, metrics,
+		"metrics without saved time are considered updated on load")
+}
+
+func TestFileStorage_InitCreatesDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "data", "data.json")
+	cfg := newConfig(path, 300, false)
+
+	fs := New(cfg)
+	require.NoError(t, fs.Init())
+	storage := memstorage.NewStorage(cfg, fs)
+	require.NoError(t, storage.Init(""))
+	require.NoError(t, storage.Update(t.Context(), testhelpers.Gauge("Alloc", 10)))
+	_, err := storage.Increment(t.Context(), "PollCount", 1)
+	require.NoError(t, err)
+	require.NoError(t, storage.Close())
+
+	loaded, err := New(cfg).Load()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []models.Metrics{testhelpers.Gauge("Alloc", 10), testhelpers.Counter("PollCount", 1)}, loaded.Metrics)
+}
+
+func TestFileStorage_RotateKeepsLastSnapshots(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "data.json")
+		fs := New(newConfig(path, 1, true))
+		fs.Keep, fs.Compress = 2, compress
+
+		for i := range 4 {
+			require.NoError(t, fs.rotate(repository.Snapshot{Seq: uint64(i), Metrics: []models.Metrics{testhelpers.Counter("PollCount", int64(i))}}))
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(path), "other.json"), []byte("{}"), 0644))
+
+		snapshots, err := fs.List()
+		require.NoError(t, err)
+		require.Len(t, snapshots, 2)
+		assert.True(t, snapshots[0].CreatedAt.After(snapshots[1].CreatedAt), "newest snapshot must be first")
+		assert.Equal(t, compress, snapshots[0].Compressed)
+
+		loaded, err := fs.LoadSnapshot(snapshots[1].Name)
+		require.NoError(t, err)
+		assert.Equal(t, []models.Metrics{testhelpers.Counter("PollCount", 2)}, loaded.Metrics)
+	}
+}
+
+func TestFileStorage_LoadSnapshotRejectsUnknownNames(t *testing.T) {
+	dir := t.TempDir()
+	fs := New(newConfig(filepath.Join(dir, "data.json"), 1, true))
+
+	for _, name := range []string{"data.json", "data.json.wal", "../data-20260101T000000.000000000Z.json", "data-20260101T000000.000000000Z.json"} {
+		_, err := fs.LoadSnapshot(name)
+		assert.ErrorIs(t, err, errs.ErrorSnapshotDoesNotExist, name)
+	}
+}
+
+func TestFileStorage_MemstorageRestoreSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	cfg := newConfig(path, 300, true)
+
+	fs := New(cfg)
+	fs.Keep = 3
+	storage := memstorage.NewStorage(cfg, fs)
+	require.NoError(t, storage.Init(""))
+	require.NoError(t, storage.Update(t.Context(), testhelpers.Gauge("Alloc", 1)))
+	require.NoError(t, fs.rotate(repository.Snapshot{Metrics: []models.Metrics{testhelpers.Gauge("Alloc", 1)}}))
+	require.NoError(t, storage.Update(t.Context(), testhelpers.Gauge("Alloc", 2)))
+
+	snapshots, err := storage.ListSnapshots(t.Context())
+	require.NoError(t, err)
+	require.Len(t, snapshots, 1)
+	require.NoError(t, storage.RestoreSnapshot(t.Context(), snapshots[0].Name))
+
+	metric, err := storage.Get(t.Context(), "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, float64(1), *metric.Value)
+
+	// updates made after restore are replayed on top of the restored state
+	_, err = storage.Increment(t.Context(), "PollCount", 1)
+	require.NoError(t, err)
+
+	restored := memstorage.NewStorage(cfg, New(cfg))
+	require.NoError(t, restored.Init(""))
+	all, err := restored.GetAll(t.Context())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []models.Metrics{testhelpers.Gauge("Alloc", 1), testhelpers.Counter("PollCount", 1)}, all)
+}
+
+func TestFileStorage_RestoreSnapshotAtStartup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	fs := New(newConfig(path, 300, true))
+	fs.Keep = 1
+	require.NoError(t, fs.rotate(repository.Snapshot{Metrics: []models.Metrics{testhelpers.Gauge("Alloc", 1)}}))
+	require.NoError(t, fs.Flush(repository.Snapshot{Metrics: []models.Metrics{testhelpers.Gauge("Alloc", 2)}}))
+	snapshots, err := fs.List()
+	require.NoError(t, err)
+	require.Len(t, snapshots, 1)
+
+	cfg := newConfig(path, 300, true)
+	cfg.RestoreSnapshot = &snapshots[0].Name
+	storage := memstorage.NewStorage(cfg, New(cfg))
+	require.NoError(t, storage.Init(""))
+
+	metric, err := storage.Get(t.Context(), "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, float64(1), *metric.Value)
+}
+
+func TestFileStorage_RunStopsOnCancel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	fs := New(newConfig(path, 1, true))
+	fs.period = time.Millisecond
+
+	ctx, cancel := context.WithCancel(t.Context())
+	saved := make(chan struct{}, 1)
+	done := make(chan error)
+	go func() {
+		done <- fs.Run(ctx, func() repository.Snapshot {
+			select {
+			case saved <- struct{}{}:
+			default:
+			}
+			return repository.Snapshot{Metrics: []models.Metrics{testhelpers.Gauge("Alloc", 1)}}
+		})
+	}()
+
+	<-saved
+	cancel()
+	require.NoError(t, <-done)
+
+	loaded, err := fs.Load()
+	require.NoError(t, err)
+	assert.Equal(t, []models.Metrics{testhelpers.Gauge("Alloc", 1)}, loaded.Metrics)
+}
+
+func TestFileStorage_RunKeepsGoingAfterFailures(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "missing")
+	fs := New(newConfig(filepath.Join(dir, "data.json"), 1, true))
+	fs.period = time.Millisecond
+
+	ctx, cancel := context.WithCancel(t.Context())
+	var mu sync.Mutex
+	attempts := 0
+	done := make(chan error)
+	go func() {
+		done <- fs.Run(ctx, func() repository.Snapshot {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts++
+			return repository.Snapshot{Metrics: []models.Metrics{testhelpers.Gauge("Alloc", 1)}}
+		})
+	}()
+
+	// backup directory is missing, so backups fail until it is created
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return attempts > 5
+	}, time.Second, time.Millisecond)
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	assert.Eventually(t, func() bool {
+		loaded, err := fs.Load()
+		return err == nil && len(loaded.Metrics) == 1
+	}, time.Second, time.Millisecond, "backup is saved after failures")
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestFileStorage_FlushSkipsStaleSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	fs := New(newConfig(path, 1, true))
+
+	require.NoError(t, fs.Flush(repository.Snapshot{Seq: 5, Metrics: []models.Metrics{testhelpers.Counter("PollCount", 5)}}))
+	require.NoError(t, fs.Flush(repository.Snapshot{Seq: 3, Metrics: []models.Metrics{testhelpers.Counter("PollCount", 3)}}))
+
+	loaded, err := New(newConfig(path, 1, true)).Load()
+	require.NoError(t, err)
+	assert.Equal(t, []models.Metrics{testhelpers.Counter("PollCount", 5)}, loaded.Metrics)
+}
+
+func TestFileStorage_MemstorageGracefulShutdown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	cfg := newConfig(path, 1, true)
+
+	fs := New(cfg)
+	fs.period = time.Millisecond
+	storage := memstorage.NewStorage(cfg, fs)
+	require.NoError(t, storage.Init(""))
+
+	done := make(chan error)
+	go func() {
+		done <- storage.Run(t.Context())
+	}()
+
+	const workers, updates = 8, 50
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range updates {
+				_, err := storage.Increment(t.Context(), "PollCount", 1)
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.NoError(t, storage.Close())
+	require.NoError(t, <-done)
+
+	// no write-ahead log replay: all updates must be in the final snapshot
+	segments, err := New(cfg).segments()
+	require.NoError(t, err)
+	for _, segment := range segments {
+		require.NoError(t, os.Remove(segment.name))
+	}
+	loaded, err := New(cfg).Load()
+	require.NoError(t, err)
+	assert.Equal(t, []models.Metrics{testhelpers.Counter("PollCount", workers*updates)}, loaded.Metrics)
+}
+
+func TestFileStorage_MemstorageConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) repository.Database {
+		cfg := newConfig(filepath.Join(t.TempDir(), "data.json"), 300, true)
+		storage := memstorage.NewStorage(cfg, New(cfg))
+		require.NoError(t, storage.Init(""))
+		return storage
+	})
+}
+
+func TestFileStorage_MetadataRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	cfg := newConfig(path, 300, true)
+
+	registry := memstorage.NewMetadataRegistry(New(cfg))
+	require.NoError(t, registry.Init())
+	md := models.Metadata{Name: "OtherSys", Help: "other allocations", Unit: "bytes", Owner: "platform", Type: "gauge"}
+	require.NoError(t, registry.PutMetadata(t.Context(), md))
+	require.NoError(t, registry.PutMetadata(t.Context(), models.Metadata{Name: "Alloc"}))
+
+	registry = memstorage.NewMetadataRegistry(New(cfg))
+	require.NoError(t, registry.Init())
+	got, err := registry.GetMetadata(t.Context(), "OtherSys")
+	require.NoError(t, err)
+	assert.Equal(t, md, *got)
+
+	list, err := registry.ListMetadata(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, []models.Metadata{{Name: "Alloc"}, md}, list)
+
+	list, err = registry.GetMetadataByNames(t.Context(), []string{"OtherSys", "Missing", "OtherSys"})
+	require.NoError(t, err)
+	assert.Equal(t, []models.Metadata{md}, list)
+
+	_, err = registry.GetMetadata(t.Context(), "Missing")
+	assert.ErrorIs(t, err, errs.ErrorMetadataDoesNotExist)
+}
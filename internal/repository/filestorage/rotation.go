@@ -0,0 +1,169 @@
+package filestorage
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/logger"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+)
+
+// snapshotTimeFormat is used in names of timestamped snapshots, so they are sorted by creation time
+const snapshotTimeFormat = "20060102T150405.000000000Z"
+
+const (
+	snapshotExt     = ".json"
+	snapshotGzipExt = ".json.gz"
+)
+
+// snapshotPrefix returns common prefix of timestamped snapshots: data.json -> data-
+func (fs *FileStorage) snapshotPrefix() string {
+	base := filepath.Base(fs.FileName)
+	return strings.TrimSuffix(base, filepath.Ext(base)) + "-"
+}
+
+// parseSnapshotName checks that name belongs to a timestamped snapshot and returns its creation time
+func (fs *FileStorage) parseSnapshotName(name string) (createdAt time.Time, compressed bool, ok bool) {
+	rest, found := strings.CutPrefix(name, fs.snapshotPrefix())
+	if !found {
+		return
+	}
+	if ts, found := strings.CutSuffix(rest, snapshotGzipExt); found {
+		rest, compressed = ts, true
+	} else if ts, found := strings.CutSuffix(rest, snapshotExt); found {
+		rest = ts
+	} else {
+		return
+	}
+
+	createdAt, err := time.Parse(snapshotTimeFormat, rest)
+	return createdAt, compressed, err == nil
+}
+
+// rotate saves a timestamped copy of snapshot and removes the oldest copies exceeding Keep
+func (fs *FileStorage) rotate(snapshot repository.Snapshot) error {
+	if fs.Keep <= 0 {
+		return nil
+	}
+
+	ext := snapshotExt
+	if fs.Compress {
+		ext = snapshotGzipExt
+	}
+	name := fs.snapshotPrefix() + time.Now().UTC().Format(snapshotTimeFormat) + ext
+	path := filepath.Join(filepath.Dir(fs.FileName), name)
+
+	err := writeAtomic(path, func(w io.Writer) error {
+		if !fs.Compress {
+			return json.NewEncoder(w).Encode(snapshot)
+		}
+		gw := gzip.NewWriter(w)
+		if err := json.NewEncoder(gw).Encode(snapshot); err != nil {
+			return err
+		}
+		return gw.Close()
+	})
+	if err != nil {
+		return fmt.Errorf("error saving snapshot '%s': %w", name, err)
+	}
+
+	snapshots, err := fs.List()
+	if err != nil {
+		return err
+	}
+	for _, info := range snapshots[min(fs.Keep, len(snapshots)):] {
+		if err := os.Remove(filepath.Join(filepath.Dir(fs.FileName), info.Name)); err != nil {
+			logger.Errorf("error removing old snapshot '%s': %v", info.Name, err)
+		}
+	}
+	return nil
+}
+
+// List returns retained timestamped snapshots, the newest first
+func (fs *FileStorage) List() ([]repository.SnapshotInfo, error) {
+	entries, err := os.ReadDir(filepath.Dir(fs.FileName))
+	if err != nil {
+		return nil, fmt.Errorf("error listing snapshots: %w", err)
+	}
+
+	var snapshots []repository.SnapshotInfo
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		createdAt, compressed, ok := fs.parseSnapshotName(entry.Name())
+		if !ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, repository.SnapshotInfo{
+			Name:       entry.Name(),
+			CreatedAt:  createdAt,
+			Size:       info.Size(),
+			Compressed: compressed,
+		})
+	}
+
+	slices.SortFunc(snapshots, func(a, b repository.SnapshotInfo) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return snapshots, nil
+}
+
+// LoadSnapshot reads a timestamped snapshot. Write-ahead log holds updates made after the latest snapshot,
+// so it is archived and the loaded snapshot becomes a new starting point. Snapshot gets the next record
+// number, so snapshots of the state before restore are older than it and are not flushed anymore
+func (fs *FileStorage) LoadSnapshot(name string) (snapshot repository.Snapshot, err error) {
+	_, compressed, ok := fs.parseSnapshotName(name)
+	if !ok || filepath.Base(name) != name {
+		return snapshot, fmt.Errorf("snapshot '%s': %w", name, errs.ErrorSnapshotDoesNotExist)
+	}
+
+	file, err := os.Open(filepath.Join(filepath.Dir(fs.FileName), name))
+	if os.IsNotExist(err) {
+		return snapshot, fmt.Errorf("snapshot '%s': %w", name, errs.ErrorSnapshotDoesNotExist)
+	}
+	if err != nil {
+		return snapshot, fmt.Errorf("error opening snapshot '%s': %w", name, err)
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if compressed {
+		gr, err := gzip.NewReader(file)
+		if err != nil {
+			return snapshot, fmt.Errorf("error reading compressed snapshot '%s': %w", name, err)
+		}
+		defer gr.Close()
+		reader = gr
+	}
+	if err := json.NewDecoder(reader).Decode(&snapshot); err != nil {
+		return snapshot, fmt.Errorf("error decoding snapshot '%s': %w", name, err)
+	}
+
+	fs.flushMu.Lock()
+	defer fs.flushMu.Unlock()
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.wal != nil {
+		if err := fs.wal.Close(); err != nil {
+			logger.Errorf("error closing write-ahead log: %v", err)
+		}
+		fs.wal = nil
+	}
+	fs.restored = false
+	fs.seq = max(fs.seq, fs.flushedSeq) + 1
+	snapshot.Seq = fs.seq
+	return snapshot, fs.openWAL()
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+)
+
+// Filter selects metrics by name, type and time of the last update. Empty fields are not checked,
+// a metric is selected when it matches all the set fields
+type Filter struct {
+	Names  []string
+	Type   string
+	Prefix string
+	// Pattern is matched against the whole name or its part like regexp.MatchString
+	Pattern *regexp.Regexp
+	// UpdatedBefore selects metrics which were not updated since the given moment
+	UpdatedBefore time.Time
+}
+
+// IsEmpty reports that filter selects all metrics
+func (f Filter) IsEmpty() bool {
+	return f.Names == nil && f.Type == "" && f.Prefix == "" && f.Pattern == nil && f.UpdatedBefore.IsZero()
+}
+
+// Match reports that metric updated at the given moment is selected by filter.
+// Metric with unknown update time is never selected by UpdatedBefore
+func (f Filter) Match(metric models.Metrics, updatedAt time.Time) bool {
+	if f.Names != nil && !slices.Contains(f.Names, metric.ID) {
+		return false
+	}
+	if f.Type != "" && f.Type != metric.MType {
+		return false
+	}
+	if f.Prefix != "" && !strings.HasPrefix(metric.ID, f.Prefix) {
+		return false
+	}
+	if f.Pattern != nil && !f.Pattern.MatchString(metric.ID) {
+		return false
+	}
+	if !f.UpdatedBefore.IsZero() && (updatedAt.IsZero() || !updatedAt.Before(f.UpdatedBefore)) {
+		return false
+	}
+	return true
+}
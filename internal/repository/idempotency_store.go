@@ -0,0 +1,28 @@
+package repository
+
+import "context"
+
+// IdempotencyState is a state of a request with the given idempotency key
+type IdempotencyState int
+
+const (
+	// IdempotencyReserved means the key was not seen before or has expired and is now reserved by the caller
+	IdempotencyReserved IdempotencyState = iota
+	// IdempotencyPending means a request with the key is being applied
+	IdempotencyPending
+	// IdempotencyDone means a request with the key was applied successfully
+	IdempotencyDone
+)
+
+// IdempotencyStore remembers keys of already applied requests, so replayed requests are not applied twice.
+// Keys are reserved as pending and marked done once the request is applied, a request which failed
+// to apply releases its key. Pending keys of requests which never finished expire like done ones
+type IdempotencyStore interface {
+	// Reserve saves the key as pending and returns [IdempotencyReserved] if it was not seen before or has
+	// already expired, otherwise the state of the key is returned
+	Reserve(context.Context, string) (IdempotencyState, error)
+	// Complete marks the pending key done
+	Complete(context.Context, string) error
+	// Release removes the key, so a request which failed to apply can be retried
+	Release(context.Context, string) error
+}
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+)
+
+// Sort is an order of listed metrics. Metrics of the same type are ordered by name
+type Sort string
+
+const (
+	SortByName     Sort = "name"
+	SortByNameDesc Sort = "-name"
+	SortByType     Sort = "type"
+	SortByTypeDesc Sort = "-type"
+)
+
+// ParseSort checks sort name, empty name means [SortByName]
+func ParseSort(name string) (Sort, error) {
+	switch sort := Sort(name); sort {
+	case "":
+		return SortByName, nil
+	case SortByName, SortByNameDesc, SortByType, SortByTypeDesc:
+		return sort, nil
+	default:
+		return "", errs.InvalidArgument(fmt.Errorf("unknown sort '%s', expected one of name, -name, type, -type", name))
+	}
+}
+
+// Descending reports that sort order is reversed
+func (s Sort) Descending() bool {
+	return strings.HasPrefix(string(s), "-")
+}
+
+// Compare compares metrics in sort order
+func (s Sort) Compare(a, b models.Metrics) int {
+	c := cmp.Compare(a.ID, b.ID)
+	if s == SortByType || s == SortByTypeDesc {
+		c = cmp.Or(cmp.Compare(a.MType, b.MType), c)
+	}
+	if s.Descending() {
+		return -c
+	}
+	return c
+}
+
+// Cursor points to the last metric of a page, the next page starts after it. It is passed to clients
+// as an opaque string
+type Cursor struct {
+	Sort Sort   `json:"s"`
+	Type string `json:"t,omitempty"`
+	Name string `json:"n"`
+}
+
+// CursorAfter returns cursor pointing to metric
+func CursorAfter(sort Sort, metric models.Metrics) Cursor {
+	cursor := Cursor{Sort: sort, Name: metric.ID}
+	if sort == SortByType || sort == SortByTypeDesc {
+		cursor.Type = metric.MType
+	}
+	return cursor
+}
+
+// Encode returns opaque representation of cursor
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses opaque cursor, empty string means the first page
+func DecodeCursor(s string) (*Cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errs.InvalidArgument(fmt.Errorf("invalid cursor: %w", err))
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, errs.InvalidArgument(fmt.Errorf("invalid cursor: %w", err))
+	}
+	if _, err := ParseSort(string(cursor.Sort)); err != nil || cursor.Sort == "" {
+		return nil, errs.New(errs.KindInvalidArgument, "invalid cursor: unknown sort")
+	}
+	return &cursor, nil
+}
+
+// After reports that metric is placed after cursor in sort order
+func (c Cursor) After(metric models.Metrics) bool {
+	return c.Sort.Compare(metric, models.Metrics{ID: c.Name, MType: c.Type}) > 0
+}
+
+// ListQuery selects a page of metrics matching filter. Cursor must have the same sort as the query
+type ListQuery struct {
+	Filter Filter
+	Sort   Sort
+	Limit  int
+	Cursor *Cursor
+}
+
+// Page is a part of listed metrics. Next is nil on the last page
+type Page struct {
+	Metrics []models.Metrics
+	Next    *Cursor
+}
+
+// Paginate builds a page from metrics matching query filter in any order. It is used by storages
+// without ordered indexes
+func Paginate(metrics []models.Metrics, query ListQuery) Page {
+	if query.Cursor != nil {
+		metrics = slices.DeleteFunc(metrics, func(m models.Metrics) bool { return !query.Cursor.After(m) })
+	}
+	slices.SortFunc(metrics, query.Sort.Compare)
+	return NewPage(metrics, query)
+}
+
+// NewPage cuts ordered metrics following the cursor to the query limit, Next is set if there are more of them
+func NewPage(metrics []models.Metrics, query ListQuery) Page {
+	if query.Limit <= 0 || len(metrics) <= query.Limit {
+		return Page{Metrics: metrics}
+	}
+	metrics = metrics[:query.Limit]
+	next := CursorAfter(query.Sort, metrics[len(metrics)-1])
+	return Page{Metrics: metrics, Next: &next}
+}
@@ -0,0 +1,93 @@
+package memstorage
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+)
+
+type idempotencyEntry struct {
+	key       string
+	expiresAt time.Time
+	done      bool
+}
+
+// IdempotencyCache is an LRU implementation of [repository.IdempotencyStore]. It keeps at most capacity keys,
+// the least recently reserved keys are evicted first
+type IdempotencyCache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	items    map[string]*list.Element
+	order    *list.List
+	now      func() time.Time
+}
+
+func NewIdempotencyCache(capacity int, ttl time.Duration) *IdempotencyCache {
+	return &IdempotencyCache{
+		capacity: capacity,
+		ttl:      ttl,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+// Reserve returns the state of key if it is stored and not expired, otherwise saves it as pending
+func (c *IdempotencyCache) Reserve(_ context.Context, key string) (repository.IdempotencyState, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*idempotencyEntry)
+		if now.Before(entry.expiresAt) {
+			if entry.done {
+				return repository.IdempotencyDone, nil
+			}
+			return repository.IdempotencyPending, nil
+		}
+		entry.expiresAt = now.Add(c.ttl)
+		entry.done = false
+		c.order.MoveToFront(elem)
+		return repository.IdempotencyReserved, nil
+	}
+
+	elem := c.order.PushFront(&idempotencyEntry{key: key, expiresAt: now.Add(c.ttl)})
+	c.items[key] = elem
+
+	for c.capacity > 0 && c.order.Len() > c.capacity {
+		c.removeElement(c.order.Back())
+	}
+	return repository.IdempotencyReserved, nil
+}
+
+// Complete marks key done, evicted key is not saved again
+func (c *IdempotencyCache) Complete(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*idempotencyEntry).done = true
+	}
+	return nil
+}
+
+// Release removes key from cache
+func (c *IdempotencyCache) Release(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+	return nil
+}
+
+func (c *IdempotencyCache) removeElement(elem *list.Element) {
+	entry := c.order.Remove(elem).(*idempotencyEntry)
+	delete(c.items, entry.key)
+}
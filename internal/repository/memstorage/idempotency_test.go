@@ -0,0 +1,58 @@
+package memstorage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotencyCache_Reserve(t *testing.T) {
+	now := time.Now()
+	cache := NewIdempotencyCache(2, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	state, err := cache.Reserve(t.Context(), "a")
+	assert.NoError(t, err)
+	assert.Equal(t, repository.IdempotencyReserved, state)
+
+	state, _ = cache.Reserve(t.Context(), "a")
+	assert.Equal(t, repository.IdempotencyPending, state, "key must not be reserved twice")
+
+	assert.NoError(t, cache.Complete(t.Context(), "a"))
+	state, _ = cache.Reserve(t.Context(), "a")
+	assert.Equal(t, repository.IdempotencyDone, state)
+
+	now = now.Add(2 * time.Minute)
+	state, _ = cache.Reserve(t.Context(), "a")
+	assert.Equal(t, repository.IdempotencyReserved, state, "expired key must be reserved again")
+	state, _ = cache.Reserve(t.Context(), "a")
+	assert.Equal(t, repository.IdempotencyPending, state, "key reserved again is pending")
+}
+
+func TestIdempotencyCache_Release(t *testing.T) {
+	cache := NewIdempotencyCache(2, time.Minute)
+
+	state, _ := cache.Reserve(t.Context(), "a")
+	assert.Equal(t, repository.IdempotencyReserved, state)
+	assert.NoError(t, cache.Release(t.Context(), "a"))
+
+	state, _ = cache.Reserve(t.Context(), "a")
+	assert.Equal(t, repository.IdempotencyReserved, state)
+}
+
+func TestIdempotencyCache_Evict(t *testing.T) {
+	cache := NewIdempotencyCache(2, time.Minute)
+
+	for _, key := range []string{"a", "b", "c"} {
+		state, _ := cache.Reserve(t.Context(), key)
+		assert.Equal(t, repository.IdempotencyReserved, state)
+	}
+
+	state, _ := cache.Reserve(t.Context(), "a")
+	assert.Equal(t, repository.IdempotencyReserved, state, "least recent key must be evicted")
+	state, _ = cache.Reserve(t.Context(), "c")
+	assert.Equal(t, repository.IdempotencyPending, state)
+	assert.NoError(t, cache.Complete(t.Context(), "b"), "evicted key is not completed")
+}
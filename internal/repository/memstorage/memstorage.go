@@ -3,9 +3,11 @@ package memstorage
 import (
 	"context"
 	"fmt"
-	"slices"
+	"maps"
 	"sync"
+	"time"
 
+	"github.com/dmitastr/yp_observability_service/internal/common"
 	serverenvconfig "github.com/dmitastr/yp_observability_service/internal/config/env_parser/server/server_env_config"
 	"github.com/dmitastr/yp_observability_service/internal/domain/models"
 	"github.com/dmitastr/yp_observability_service/internal/errs"
@@ -37,100 +39,331 @@ func ModelToEntity(metric models.Metrics) MetricEntity {
 
 type Storage struct {
 	sync.Mutex
-	Metrics       map[string]models.Metrics
+	Metrics map[string]models.Metrics
+	// updated holds time of the last update of metrics, it is saved with snapshots
+	updated       map[string]time.Time
 	BackupManager backupmanager.BackupManager
 	StreamWrite   bool
 	Restore       bool
+	// RestoreFrom is a name of timestamped snapshot loaded at startup instead of the latest state
+	RestoreFrom string
+	// seq is a number of the last write-ahead log record applied to Metrics
+	seq uint64
+
+	// runMu guards state of periodic backup, Close stops it before the final flush
+	runMu     sync.Mutex
+	cancelRun context.CancelFunc
+	runDone   chan struct{}
+	closed    bool
 }
 
 func NewStorage(cfg *serverenvconfig.Config, bm backupmanager.BackupManager) *Storage {
-	storage := Storage{Metrics: make(map[string]models.Metrics)}
+	storage := Storage{Metrics: make(map[string]models.Metrics), updated: make(map[string]time.Time)}
 	if *cfg.StoreInterval == 0 {
 		storage.StreamWrite = true
 	}
 	storage.Restore = *cfg.Restore
 	storage.BackupManager = bm
+	if cfg.RestoreSnapshot != nil {
+		storage.RestoreFrom = *cfg.RestoreSnapshot
+	}
 
 	return &storage
 }
 
 func (storage *Storage) Init(_ string) error {
-	if !storage.StreamWrite {
-		storage.BackupManager.RunBackup(storage.toList)
-	}
-
-	if storage.Restore {
-		metrics, err := storage.BackupManager.Load()
+	if storage.RestoreFrom != "" {
+		if err := storage.restore(storage.RestoreFrom); err != nil {
+			return fmt.Errorf("error restoring snapshot: %w", err)
+		}
+	} else if storage.Restore {
+		snapshot, err := storage.BackupManager.Load()
 		if err != nil {
 			return fmt.Errorf("error loading metrics from file backup: %w", err)
 		}
-		storage.Metrics = storage.fromList(metrics)
+		storage.Lock()
+		storage.replace(snapshot)
+		storage.Unlock()
+	}
+	return nil
+}
+
+// Run saves periodic backups until ctx is canceled or storage is closed
+func (storage *Storage) Run(ctx context.Context) error {
+	if storage.StreamWrite {
+		return nil
+	}
+
+	storage.runMu.Lock()
+	if storage.closed {
+		storage.runMu.Unlock()
+		return nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	storage.cancelRun, storage.runDone = cancel, done
+	storage.runMu.Unlock()
+
+	defer close(done)
+	defer cancel()
+	return storage.BackupManager.Run(ctx, storage.snapshot)
+}
+
+// stopRun stops periodic backup and waits until it returns
+func (storage *Storage) stopRun() {
+	storage.runMu.Lock()
+	storage.closed = true
+	cancel, done := storage.cancelRun, storage.runDone
+	storage.runMu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
 	}
+}
+
+// ListSnapshots returns timestamped snapshots which storage can be restored from
+func (storage *Storage) ListSnapshots(ctx context.Context) ([]backupmanager.SnapshotInfo, error) {
+	return storage.BackupManager.List()
+}
 
+// RestoreSnapshot replaces all metrics with the content of timestamped snapshot
+func (storage *Storage) RestoreSnapshot(ctx context.Context, name string) error {
+	return storage.restore(name)
+}
+
+// restore loads snapshot and saves it as the current state, so it is not lost on restart
+func (storage *Storage) restore(name string) error {
+	storage.Lock()
+	defer storage.Unlock()
+
+	snapshot, err := storage.BackupManager.LoadSnapshot(name)
+	if err != nil {
+		return err
+	}
+	if err := storage.BackupManager.Flush(snapshot); err != nil {
+		return fmt.Errorf("error saving restored snapshot: %w", err)
+	}
+	storage.replace(snapshot)
+	logger.Infof("Restored %d metrics from snapshot '%s'", len(snapshot.Metrics), name)
 	return nil
 }
 
-func (storage *Storage) fromList(metrics []models.Metrics) map[string]models.Metrics {
-	mapping := make(map[string]models.Metrics)
-	for _, metric := range metrics {
-		mapping[metric.ID] = metric
+// replace sets all metrics from snapshot. Metrics without saved time of update, e.g. from snapshots
+// saved before retention was introduced, are considered updated on load. Must be called with storage locked
+func (storage *Storage) replace(snapshot backupmanager.Snapshot) {
+	now := time.Now()
+	storage.Metrics = make(map[string]models.Metrics, len(snapshot.Metrics))
+	storage.updated = make(map[string]time.Time, len(snapshot.Metrics))
+	for _, metric := range snapshot.Metrics {
+		storage.Metrics[metric.ID] = metric
+		updated, ok := snapshot.Updated[metric.ID]
+		if !ok {
+			updated = now
+		}
+		storage.updated[metric.ID] = updated
 	}
-	return mapping
+	storage.seq = snapshot.Seq
 }
 
 func (storage *Storage) Update(ctx context.Context, newMetric models.Metrics) error {
 	logger.Infof("Get new data: %s", newMetric.String())
 	storage.Lock()
 	defer storage.Unlock()
-	if metric, ok := storage.Metrics[newMetric.ID]; ok {
-		if metric.Delta != nil {
-			newMetric.UpdateDelta(*metric.Delta)
-		}
+
+	if err := storage.checkTypes(newMetric); err != nil {
+		return err
 	}
-	storage.Metrics[newMetric.ID] = newMetric
-	if storage.StreamWrite {
-		metrics := storage.toList()
-		if err := storage.BackupManager.Flush(metrics); err != nil {
-			logger.Error(err)
-		}
+	if err := storage.writeAhead(newMetric); err != nil {
+		return err
 	}
-	return nil
+	storage.apply(newMetric)
+	return storage.streamWrite()
 }
 
 func (storage *Storage) BulkUpdate(ctx context.Context, metrics []models.Metrics) error {
 	logger.Infof("Get %d new metrics", len(metrics))
+	storage.Lock()
+	defer storage.Unlock()
+
+	if err := storage.checkTypes(metrics...); err != nil {
+		return err
+	}
+	if err := storage.writeAhead(metrics...); err != nil {
+		return err
+	}
 	for _, metric := range metrics {
-		err := storage.Update(ctx, metric)
+		storage.apply(metric)
+	}
+	return storage.streamWrite()
+}
+
+func (storage *Storage) Increment(ctx context.Context, name string, delta int64) (int64, error) {
+	storage.Lock()
+	defer storage.Unlock()
+
+	update := models.Metrics{ID: name, MType: common.COUNTER, Delta: &delta}
+	if err := storage.checkTypes(update); err != nil {
+		return 0, err
+	}
+	if err := storage.writeAhead(update); err != nil {
+		return 0, err
+	}
+	metric := storage.apply(update)
+	return *metric.Delta, storage.streamWrite()
+}
+
+// checkTypes rejects updates which change types of stored metrics. Must be called with storage locked
+func (storage *Storage) checkTypes(metrics ...models.Metrics) error {
+	return backupmanager.CheckTypes(metrics, func(name string) (string, bool, error) {
+		metric, ok := storage.Metrics[name]
+		return metric.MType, ok, nil
+	})
+}
+
+// writeAhead logs updates before they are applied, so they survive a crash between periodic backups.
+// Must be called with storage locked
+func (storage *Storage) writeAhead(metrics ...models.Metrics) error {
+	if storage.StreamWrite {
+		return nil
+	}
+	seq, err := storage.BackupManager.Append(metrics)
+	if err != nil {
+		return fmt.Errorf("error writing updates to write-ahead log: %w", err)
+	}
+	storage.seq = seq
+	return nil
+}
+
+// apply saves metric, adding counter delta to the stored counter. Metric of another type is replaced,
+// it is only possible when replaying log records written before types were checked. Must be called with storage locked
+func (storage *Storage) apply(newMetric models.Metrics) models.Metrics {
+	if metric, ok := storage.Metrics[newMetric.ID]; ok && newMetric.MType == common.COUNTER &&
+		metric.MType == common.COUNTER && metric.Delta != nil {
+		delta := *metric.Delta
+		if newMetric.Delta != nil {
+			delta += *newMetric.Delta
+		}
+		newMetric.Delta = &delta
+	}
+	storage.Metrics[newMetric.ID] = newMetric
+	storage.updated[newMetric.ID] = time.Now()
+	return newMetric
+}
+
+// Delete removes metrics selected by filter, deletion is logged like updates
+func (storage *Storage) Delete(ctx context.Context, filter backupmanager.Filter) ([]string, error) {
+	if filter.IsEmpty() {
+		return nil, errs.ErrorEmptyFilter
+	}
+	storage.Lock()
+	defer storage.Unlock()
+
+	var names []string
+	for name, metric := range storage.Metrics {
+		if filter.Match(metric, storage.updated[name]) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	if !storage.StreamWrite {
+		seq, err := storage.BackupManager.Remove(names)
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("error writing deletion to write-ahead log: %w", err)
 		}
+		storage.seq = seq
 	}
+	for _, name := range names {
+		delete(storage.Metrics, name)
+		delete(storage.updated, name)
+	}
+	logger.Infof("Deleted %d metrics", len(names))
+	return names, storage.streamWrite()
+}
 
-	if storage.StreamWrite {
-		metrics := storage.toList()
-		if err := storage.BackupManager.Flush(metrics); err != nil {
-			return err
+// ResetCounters sets selected counters to zero keeping time of their last update, reset is logged
+// as replacement, so it is not accumulated on replay
+func (storage *Storage) ResetCounters(ctx context.Context, filter backupmanager.Filter) ([]models.Metrics, error) {
+	storage.Lock()
+	defer storage.Unlock()
+
+	var previous, zeros []models.Metrics
+	for name, metric := range storage.Metrics {
+		if metric.MType != common.COUNTER || !filter.Match(metric, storage.updated[name]) {
+			continue
+		}
+		var zero int64
+		previous = append(previous, metric)
+		zeros = append(zeros, models.Metrics{ID: name, MType: common.COUNTER, Delta: &zero})
+	}
+	if len(zeros) == 0 {
+		return nil, nil
+	}
+
+	if !storage.StreamWrite {
+		seq, err := storage.BackupManager.Replace(zeros)
+		if err != nil {
+			return nil, fmt.Errorf("error writing counters reset to write-ahead log: %w", err)
 		}
+		storage.seq = seq
+	}
+	for _, metric := range zeros {
+		storage.Metrics[metric.ID] = metric
+	}
+	return previous, storage.streamWrite()
+}
 
+// streamWrite flushes all metrics to backup when there is no backup interval. Must be called with storage locked
+func (storage *Storage) streamWrite() error {
+	if !storage.StreamWrite {
+		return nil
+	}
+	if err := storage.BackupManager.Flush(backupmanager.Snapshot{Metrics: storage.toList(), Updated: maps.Clone(storage.updated)}); err != nil {
+		logger.Error(err)
+		return err
 	}
 	return nil
 }
 
 func (storage *Storage) GetAll(ctx context.Context) ([]models.Metrics, error) {
+	storage.Lock()
+	defer storage.Unlock()
 	return storage.toList(), nil
 }
 
 func (storage *Storage) GetByID(ctx context.Context, names []string) ([]models.Metrics, error) {
-	metrics := storage.toList()
-	for i, metric := range metrics {
-		if !slices.Contains(names, metric.ID) {
-			metrics = append(metrics[:i], metrics[i+1:]...)
+	storage.Lock()
+	defer storage.Unlock()
+
+	var metrics []models.Metrics
+	for _, name := range names {
+		if metric, ok := storage.Metrics[name]; ok {
+			metrics = append(metrics, metric)
 		}
 	}
 	return metrics, nil
 }
 
+func (storage *Storage) List(ctx context.Context, query backupmanager.ListQuery) (backupmanager.Page, error) {
+	storage.Lock()
+	var metrics []models.Metrics
+	for name, metric := range storage.Metrics {
+		if query.Filter.Match(metric, storage.updated[name]) {
+			metrics = append(metrics, metric)
+		}
+	}
+	storage.Unlock()
+
+	return backupmanager.Paginate(metrics, query), nil
+}
+
 func (storage *Storage) Get(ctx context.Context, key string) (*models.Metrics, error) {
+	storage.Lock()
+	defer storage.Unlock()
+
 	if metric, ok := storage.Metrics[key]; ok {
 		logger.Infof("Found metric: %s", metric)
 		return &metric, nil
@@ -138,6 +371,13 @@ func (storage *Storage) Get(ctx context.Context, key string) (*models.Metrics, e
 	return nil, errs.ErrorMetricDoesNotExist
 }
 
+// snapshot returns a list of all metrics with the last applied log record holding storage lock
+func (storage *Storage) snapshot() backupmanager.Snapshot {
+	storage.Lock()
+	defer storage.Unlock()
+	return backupmanager.Snapshot{Seq: storage.seq, Metrics: storage.toList(), Updated: maps.Clone(storage.updated)}
+}
+
 func (storage *Storage) toList() (lst []models.Metrics) {
 	for _, metric := range storage.Metrics {
 		lst = append(lst, metric)
@@ -145,12 +385,13 @@ func (storage *Storage) toList() (lst []models.Metrics) {
 	return
 }
 
+// Close stops periodic backup, saves the final snapshot and closes backup
 func (storage *Storage) Close() error {
-	metrics := storage.toList()
-	if err := storage.BackupManager.Flush(metrics); err != nil {
+	storage.stopRun()
+	if err := storage.BackupManager.Flush(storage.snapshot()); err != nil {
 		return fmt.Errorf("error saving metrics to file backup: %w", err)
 	}
-	return nil
+	return storage.BackupManager.Close()
 }
 
 func (storage *Storage) Ping(ctx context.Context) error {
@@ -0,0 +1,69 @@
+package memstorage
+
+import (
+	"sync"
+	"testing"
+
+	serverenvconfig "github.com/dmitastr/yp_observability_service/internal/config/env_parser/server/server_env_config"
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/mocks/testhelpers"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+	"github.com/dmitastr/yp_observability_service/internal/repository/conformance"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStorage() *Storage {
+	interval := 1
+	restore := false
+	return NewStorage(&serverenvconfig.Config{StoreInterval: &interval, Restore: &restore}, testhelpers.NopBackupManager{})
+}
+
+func TestStorage_ConcurrentCounterUpdates(t *testing.T) {
+	storage := newTestStorage()
+
+	workers, iterations := 8, 100
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range iterations {
+				if w%2 == 0 {
+					_, err := storage.Increment(t.Context(), "PollCount", 1)
+					assert.NoError(t, err)
+					continue
+				}
+				delta := int64(1)
+				m := models.Metrics{ID: "PollCount", MType: "counter", Delta: &delta}
+				assert.NoError(t, storage.BulkUpdate(t.Context(), []models.Metrics{m}))
+			}
+		}()
+	}
+	wg.Wait()
+
+	metric, err := storage.Get(t.Context(), "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(workers*iterations), *metric.Delta)
+}
+
+func TestStorage_UpdateGaugeReplaces(t *testing.T) {
+	storage := newTestStorage()
+
+	for _, v := range []float64{1, 2} {
+		value := v
+		require.NoError(t, storage.Update(t.Context(), models.Metrics{ID: "Alloc", MType: "gauge", Value: &value}))
+	}
+
+	metric, err := storage.Get(t.Context(), "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, float64(2), *metric.Value)
+}
+
+func TestStorage_Conformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) repository.Database {
+		storage := newTestStorage()
+		require.NoError(t, storage.Init(""))
+		return storage
+	})
+}
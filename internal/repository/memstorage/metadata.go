@@ -0,0 +1,119 @@
+package memstorage
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+)
+
+// MetadataBackup saves metadata of the registry, the whole registry is saved on every change
+type MetadataBackup interface {
+	LoadMetadata() ([]models.Metadata, error)
+	SaveMetadata([]models.Metadata) error
+}
+
+// MetadataRegistry is an in-memory implementation of [repository.MetadataStore]. With backup set,
+// metadata is loaded on Init and saved before PutMetadata returns
+type MetadataRegistry struct {
+	mu       sync.RWMutex
+	metadata map[string]models.Metadata
+	backup   MetadataBackup
+}
+
+func NewMetadataRegistry(backup MetadataBackup) *MetadataRegistry {
+	return &MetadataRegistry{metadata: make(map[string]models.Metadata), backup: backup}
+}
+
+// Init loads metadata from backup
+func (r *MetadataRegistry) Init() error {
+	if r.backup == nil {
+		return nil
+	}
+	list, err := r.backup.LoadMetadata()
+	if err != nil {
+		return fmt.Errorf("error loading metadata: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, md := range list {
+		r.metadata[md.Name] = md
+	}
+	return nil
+}
+
+func (r *MetadataRegistry) GetMetadata(_ context.Context, name string) (*models.Metadata, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	md, ok := r.metadata[name]
+	if !ok {
+		return nil, errs.ErrorMetadataDoesNotExist
+	}
+	return &md, nil
+}
+
+// ListMetadata returns metadata sorted by metric name
+func (r *MetadataRegistry) ListMetadata(context.Context) ([]models.Metadata, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.list(), nil
+}
+
+// GetMetadataByNames returns metadata of the metrics sorted by metric name
+func (r *MetadataRegistry) GetMetadataByNames(_ context.Context, names []string) ([]models.Metadata, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var list []models.Metadata
+	for _, name := range names {
+		if md, ok := r.metadata[name]; ok {
+			list = append(list, md)
+		}
+	}
+	return sortedUnique(list), nil
+}
+
+func (r *MetadataRegistry) PutMetadata(_ context.Context, md models.Metadata) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	prev, existed := r.metadata[md.Name]
+	r.metadata[md.Name] = md
+	if r.backup == nil {
+		return nil
+	}
+	if err := r.backup.SaveMetadata(r.list()); err != nil {
+		if existed {
+			r.metadata[md.Name] = prev
+		} else {
+			delete(r.metadata, md.Name)
+		}
+		return fmt.Errorf("error saving metadata: %w", err)
+	}
+	return nil
+}
+
+// list must be called with mu locked
+func (r *MetadataRegistry) list() []models.Metadata {
+	list := make([]models.Metadata, 0, len(r.metadata))
+	for _, md := range r.metadata {
+		list = append(list, md)
+	}
+	return sortedUnique(list)
+}
+
+// sortedUnique sorts metadata by metric name and drops repeated names
+func sortedUnique(list []models.Metadata) []models.Metadata {
+	slices.SortFunc(list, func(a, b models.Metadata) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return slices.CompactFunc(list, func(a, b models.Metadata) bool {
+		return a.Name == b.Name
+	})
+}
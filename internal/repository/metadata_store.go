@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+)
+
+// MetadataStore keeps metadata of metrics by metric name. Metadata is independent of metric values:
+// it can be set before a metric is reported and is kept when the metric is deleted
+type MetadataStore interface {
+	// GetMetadata returns [errs.ErrorMetadataDoesNotExist] when metadata was not set
+	GetMetadata(context.Context, string) (*models.Metadata, error)
+	ListMetadata(context.Context) ([]models.Metadata, error)
+	// GetMetadataByNames returns metadata of the metrics sorted by metric name, names without metadata are skipped
+	GetMetadataByNames(context.Context, []string) ([]models.Metadata, error)
+	// PutMetadata replaces metadata of the metric
+	PutMetadata(context.Context, models.Metadata) error
+}
@@ -0,0 +1,120 @@
+package postgresstorage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/logger"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+	"github.com/jackc/pgx/v5"
+)
+
+const reserveKeyQuery string = `INSERT INTO idempotency_keys (key, created_at, done)
+	VALUES (@key, now(), false)
+	ON CONFLICT (key) DO NOTHING`
+
+// keyStateQuery reads state of the key which was not reserved
+const keyStateQuery string = `SELECT done FROM idempotency_keys WHERE key = @key`
+
+const purgeKeysQuery string = `DELETE FROM idempotency_keys WHERE created_at < now() - make_interval(secs => @ttl)`
+
+// purgeInterval limits how long expired keys are kept before [IdempotencyStore.Run] purges them
+var purgeInterval = time.Minute
+
+// IdempotencyStore implements [repository.IdempotencyStore] on top of idempotency_keys table. Keys older
+// than ttl are expired, they are purged by [IdempotencyStore.Run] and block replays until then.
+// Keys share transactions with the metrics storage, see [IdempotencyStore.InTx]
+type IdempotencyStore struct {
+	pg  *Postgres
+	ttl time.Duration
+}
+
+func NewIdempotencyStore(pg *Postgres, ttl time.Duration) *IdempotencyStore {
+	return &IdempotencyStore{pg: pg, ttl: ttl}
+}
+
+// Reserve inserts key into the table as pending, returns the state of the key if it already exists
+func (s *IdempotencyStore) Reserve(ctx context.Context, key string) (repository.IdempotencyState, error) {
+	var state repository.IdempotencyState
+	fun := func(tx pgx.Tx) error {
+		args := pgx.NamedArgs{"key": key}
+		tag, err := tx.Exec(ctx, reserveKeyQuery, args)
+		if err != nil {
+			return fmt.Errorf("unable to reserve idempotency key: %w", err)
+		}
+		if tag.RowsAffected() == 1 {
+			state = repository.IdempotencyReserved
+			return nil
+		}
+
+		var done bool
+		if err := tx.QueryRow(ctx, keyStateQuery, args).Scan(&done); err != nil {
+			return fmt.Errorf("unable to read idempotency key state: %w", err)
+		}
+		state = repository.IdempotencyPending
+		if done {
+			state = repository.IdempotencyDone
+		}
+		return nil
+	}
+	err := s.pg.ExecuteTX(ctx, s.pg.db, fun)
+	return state, err
+}
+
+// Complete marks key done, within [IdempotencyStore.InTx] it is done only if the transaction is committed
+func (s *IdempotencyStore) Complete(ctx context.Context, key string) error {
+	fun := func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `UPDATE idempotency_keys SET done = true WHERE key = @key`, pgx.NamedArgs{"key": key}); err != nil {
+			return fmt.Errorf("unable to complete idempotency key: %w", err)
+		}
+		return nil
+	}
+	return s.pg.ExecuteTX(ctx, s.pg.db, fun)
+}
+
+// Release deletes key from the table
+func (s *IdempotencyStore) Release(ctx context.Context, key string) error {
+	fun := func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM idempotency_keys WHERE key = @key`, pgx.NamedArgs{"key": key}); err != nil {
+			return fmt.Errorf("unable to release idempotency key: %w", err)
+		}
+		return nil
+	}
+	return s.pg.ExecuteTX(ctx, s.pg.db, fun)
+}
+
+// InTx runs fnc in a transaction of the metrics storage, so the key can be completed atomically with the request
+func (s *IdempotencyStore) InTx(ctx context.Context, fnc func(context.Context) error) error {
+	return s.pg.InTx(ctx, fnc)
+}
+
+// Run purges expired keys until context is canceled
+func (s *IdempotencyStore) Run(ctx context.Context) error {
+	interval := purgeInterval
+	if s.ttl > 0 {
+		interval = min(interval, s.ttl)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := s.purge(ctx); err != nil {
+				logger.Errorf("error purging expired idempotency keys: %v", err)
+			}
+		}
+	}
+}
+
+func (s *IdempotencyStore) purge(ctx context.Context) error {
+	fun := func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, purgeKeysQuery, pgx.NamedArgs{"ttl": s.ttl.Seconds()}); err != nil {
+			return fmt.Errorf("unable to purge expired idempotency keys: %w", err)
+		}
+		return nil
+	}
+	return s.pg.ExecuteTX(ctx, s.pg.db, fun)
+}
@@ -0,0 +1,100 @@
+package postgresstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/jackc/pgx/v5"
+)
+
+const putMetadataQuery string = `INSERT INTO metric_metadata (name, help, unit, owner, mtype)
+	VALUES (@name, @help, @unit, @owner, @mtype)
+	ON CONFLICT ON CONSTRAINT metric_metadata_pkey DO UPDATE SET
+	help = EXCLUDED.help,
+	unit = EXCLUDED.unit,
+	owner = EXCLUDED.owner,
+	mtype = EXCLUDED.mtype,
+	updated_at = now()`
+
+const selectMetadataQuery string = `SELECT name, help, unit, owner, mtype FROM metric_metadata`
+
+// MetadataStore implements [repository.MetadataStore] on top of metric_metadata table
+type MetadataStore struct {
+	pg *Postgres
+}
+
+func NewMetadataStore(pg *Postgres) *MetadataStore {
+	return &MetadataStore{pg: pg}
+}
+
+func (s *MetadataStore) GetMetadata(ctx context.Context, name string) (*models.Metadata, error) {
+	var md models.Metadata
+	fun := func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, selectMetadataQuery+` WHERE name = @name`, pgx.NamedArgs{"name": name})
+		if err != nil {
+			return fmt.Errorf("unable to query metadata: %w", err)
+		}
+		md, err = pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[models.Metadata])
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errs.ErrorMetadataDoesNotExist
+		}
+		if err != nil {
+			return fmt.Errorf("unable to query metadata: %w", err)
+		}
+		return nil
+	}
+	if err := s.pg.ExecuteTX(ctx, s.pg.db, fun); err != nil {
+		return nil, err
+	}
+	return &md, nil
+}
+
+// ListMetadata returns metadata sorted by metric name
+func (s *MetadataStore) ListMetadata(ctx context.Context) ([]models.Metadata, error) {
+	var list []models.Metadata
+	fun := func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, selectMetadataQuery+` ORDER BY name`)
+		if err != nil {
+			return fmt.Errorf("unable to query metadata: %w", err)
+		}
+		list, err = pgx.CollectRows(rows, pgx.RowToStructByName[models.Metadata])
+		if err != nil {
+			return fmt.Errorf("unable to query metadata: %w", err)
+		}
+		return nil
+	}
+	err := s.pg.ExecuteTX(ctx, s.pg.db, fun)
+	return list, err
+}
+
+// GetMetadataByNames returns metadata of the metrics sorted by metric name
+func (s *MetadataStore) GetMetadataByNames(ctx context.Context, names []string) ([]models.Metadata, error) {
+	var list []models.Metadata
+	fun := func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, selectMetadataQuery+` WHERE name = ANY (@names) ORDER BY name`, pgx.NamedArgs{"names": names})
+		if err != nil {
+			return fmt.Errorf("unable to query metadata: %w", err)
+		}
+		list, err = pgx.CollectRows(rows, pgx.RowToStructByName[models.Metadata])
+		if err != nil {
+			return fmt.Errorf("unable to query metadata: %w", err)
+		}
+		return nil
+	}
+	err := s.pg.ExecuteTX(ctx, s.pg.db, fun)
+	return list, err
+}
+
+func (s *MetadataStore) PutMetadata(ctx context.Context, md models.Metadata) error {
+	fun := func(tx pgx.Tx) error {
+		args := pgx.NamedArgs{"name": md.Name, "help": md.Help, "unit": md.Unit, "owner": md.Owner, "mtype": md.Type}
+		if _, err := tx.Exec(ctx, putMetadataQuery, args); err != nil {
+			return fmt.Errorf("unable to save metadata: %w", err)
+		}
+		return nil
+	}
+	return s.pg.ExecuteTX(ctx, s.pg.db, fun)
+}
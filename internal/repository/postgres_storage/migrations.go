@@ -0,0 +1,150 @@
+package postgresstorage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/dmitastr/yp_observability_service/migrations"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// MigrationStatus is the schema version applied to database and the latest version of migrations.
+// Version is zero when no migration was applied, Dirty means the last migration failed in the middle
+type MigrationStatus struct {
+	Version uint
+	Latest  uint
+	Dirty   bool
+}
+
+func (s MigrationStatus) String() string {
+	text := fmt.Sprintf("schema version: %d of %d", s.Version, s.Latest)
+	switch {
+	case s.Dirty:
+		text += " (dirty)"
+	case s.Version < s.Latest:
+		text += fmt.Sprintf(" (%d pending)", s.Latest-s.Version)
+	case s.Version > s.Latest:
+		text += " (newer than migrations)"
+	}
+	return text
+}
+
+// Migrator applies schema migrations to database
+type Migrator struct {
+	m      *migrate.Migrate
+	source source.Driver
+}
+
+// NewMigrator connects to database by url and reads migrations from migrationDir url, like file://migrations,
+// embedded migrations are used when it is empty. Migrator must be closed after use
+func NewMigrator(dbURL, migrationDir string) (*Migrator, error) {
+	var src source.Driver
+	var err error
+	if migrationDir == "" {
+		src, err = iofs.New(migrations.FS, ".")
+	} else {
+		src, err = source.Open(migrationDir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read migrations: %w", err)
+	}
+
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("unable to connect to database: %w", err), src.Close())
+	}
+	driver, err := postgres.WithInstance(db, &postgres.Config{})
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("unable to create migration driver: %w", err), db.Close(), src.Close())
+	}
+	m, err := migrate.NewWithInstance("migrations", src, "postgres", driver)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("unable to create migrator: %w", err), driver.Close(), src.Close())
+	}
+	return &Migrator{m: m, source: src}, nil
+}
+
+// Up applies all pending migrations
+func (mg *Migrator) Up() error {
+	if err := mg.m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("migration up failed: %w", err)
+	}
+	return nil
+}
+
+// Down rolls back the given number of applied migrations, all of them when steps is not positive
+func (mg *Migrator) Down(steps int) error {
+	var err error
+	if steps > 0 {
+		err = mg.m.Steps(-steps)
+	} else {
+		err = mg.m.Down()
+	}
+	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("migration down failed: %w", err)
+	}
+	return nil
+}
+
+// Force sets schema version and clears dirty state without running migrations. It is used to recover
+// after a failed migration was fixed by hand, version 0 means no migration was applied
+func (mg *Migrator) Force(version uint) error {
+	v := int(version)
+	if version == 0 {
+		v = database.NilVersion
+	}
+	if err := mg.m.Force(v); err != nil {
+		return fmt.Errorf("unable to force schema version %d: %w", version, err)
+	}
+	return nil
+}
+
+// Status returns the applied schema version and the latest version of migrations
+func (mg *Migrator) Status() (MigrationStatus, error) {
+	latest, err := latestVersion(mg.source)
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+	version, dirty, err := mg.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return MigrationStatus{Latest: latest}, nil
+	}
+	if err != nil {
+		return MigrationStatus{}, fmt.Errorf("unable to read schema version: %w", err)
+	}
+	return MigrationStatus{Version: version, Latest: latest, Dirty: dirty}, nil
+}
+
+// latestVersion returns the version of the last migration of source, zero when there are no migrations
+func latestVersion(src source.Driver) (uint, error) {
+	version, err := src.First()
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("unable to read migrations: %w", err)
+	}
+	for {
+		next, err := src.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("unable to read migrations: %w", err)
+		}
+		version = next
+	}
+}
+
+// Close closes migration source and database connection, the connection is owned by migration driver
+func (mg *Migrator) Close() error {
+	sourceErr, dbErr := mg.m.Close()
+	return errors.Join(sourceErr, dbErr)
+}
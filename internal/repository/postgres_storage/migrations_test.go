@@ -0,0 +1,52 @@
+package postgresstorage
+
+import (
+	"testing"
+
+	"github.com/dmitastr/yp_observability_service/migrations"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatestVersion(t *testing.T) {
+	open := func(t *testing.T, url string) source.Driver {
+		src, err := source.Open(url)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = src.Close() })
+		return src
+	}
+
+	embedded, err := iofs.New(migrations.FS, ".")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = embedded.Close() })
+
+	version, err := latestVersion(embedded)
+	require.NoError(t, err)
+	assert.Equal(t, uint(7), version)
+
+	version, err = latestVersion(open(t, "file://../../../migrations/testdata"))
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), version)
+
+	version, err = latestVersion(open(t, "file://"+t.TempDir()))
+	require.NoError(t, err)
+	assert.Equal(t, uint(0), version)
+}
+
+func TestMigrationStatus_String(t *testing.T) {
+	tests := []struct {
+		status MigrationStatus
+		want   string
+	}{
+		{MigrationStatus{Version: 6, Latest: 6}, "schema version: 6 of 6"},
+		{MigrationStatus{Version: 4, Latest: 6}, "schema version: 4 of 6 (2 pending)"},
+		{MigrationStatus{Latest: 6}, "schema version: 0 of 6 (6 pending)"},
+		{MigrationStatus{Version: 3, Latest: 6, Dirty: true}, "schema version: 3 of 6 (dirty)"},
+		{MigrationStatus{Version: 7, Latest: 6}, "schema version: 7 of 6 (newer than migrations)"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.status.String())
+	}
+}
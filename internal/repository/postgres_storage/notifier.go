@@ -0,0 +1,130 @@
+package postgresstorage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/logger"
+	"github.com/jackc/pgx/v5"
+)
+
+// notifyChannel is a name of postgres channel for metric change notifications
+const notifyChannel string = "metrics_changed"
+
+// closeTimeout limits closing of the listening connection after subscription ends
+var closeTimeout = 5 * time.Second
+
+// maxNotifyPayload is a bit less than postgres limit of 8000 bytes for a notification payload
+const maxNotifyPayload int = 7900
+
+// Notifier implements [repository.ChangeNotifier] with postgres LISTEN/NOTIFY. Payload of notification
+// is a json list of metric names, empty list invalidates all metrics. Notifications are sent over a dedicated
+// connection, so subscribers of the same notifier skip them by its backend PID
+type Notifier struct {
+	pg *Postgres
+
+	mu   sync.Mutex
+	conn *pgx.Conn
+	// pid is a backend PID of conn, zero without connection
+	pid atomic.Uint32
+}
+
+func NewNotifier(pg *Postgres) *Notifier {
+	return &Notifier{pg: pg}
+}
+
+// Publish sends notification over the publishing connection, the connection is opened on first use
+// and reopened after failure
+func (n *Notifier) Publish(ctx context.Context, names []string) error {
+	payload, err := json.Marshal(names)
+	if err != nil {
+		return fmt.Errorf("unable to encode notification payload: %w", err)
+	}
+	if len(payload) > maxNotifyPayload || len(names) == 0 {
+		payload = []byte("[]")
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.conn == nil {
+		pooled, err := n.pg.db.Acquire(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to acquire connection for publishing: %w", err)
+		}
+		n.conn = pooled.Hijack()
+		n.pid.Store(n.conn.PgConn().PID())
+	}
+	if _, err := n.conn.Exec(ctx, `SELECT pg_notify($1, $2)`, notifyChannel, string(payload)); err != nil {
+		n.closeConn()
+		return fmt.Errorf("unable to send notification: %w", err)
+	}
+	return nil
+}
+
+// Close closes the publishing connection, it is opened again by the next Publish
+func (n *Notifier) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.conn != nil {
+		n.closeConn()
+	}
+	return nil
+}
+
+// closeConn closes the publishing connection, n.mu must be held
+func (n *Notifier) closeConn() {
+	// notifications of the closed connection still being delivered are not skipped, the backend PID
+	// can be given to a connection of another replica
+	n.pid.Store(0)
+	closeConn(n.conn)
+	n.conn = nil
+}
+
+func closeConn(conn *pgx.Conn) {
+	closeCtx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+	if err := conn.Close(closeCtx); err != nil {
+		logger.Errorf("error closing notifier connection: %v", err)
+	}
+}
+
+// Subscribe holds a dedicated connection listening for notifications until context is done. The connection
+// is taken out of the pool and closed on return, so a listening connection is never reused by queries.
+// Notifications published by n are skipped
+func (n *Notifier) Subscribe(ctx context.Context, fnc func([]string)) error {
+	pooled, err := n.pg.db.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to acquire connection for listening: %w", err)
+	}
+	conn := pooled.Hijack()
+	defer closeConn(conn)
+
+	if _, err := conn.Exec(ctx, "LISTEN "+notifyChannel); err != nil {
+		return fmt.Errorf("unable to listen channel %s: %w", notifyChannel, err)
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("error waiting for notification: %w", err)
+		}
+
+		if notification.PID == n.pid.Load() {
+			continue
+		}
+
+		var names []string
+		if err := json.Unmarshal([]byte(notification.Payload), &names); err != nil {
+			logger.Errorf("unable to decode notification payload=%s: %v", notification.Payload, err)
+			names = nil
+		}
+		fnc(names)
+	}
+}
@@ -2,15 +2,17 @@ package postgresstorage
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
 	"time"
 
+	"github.com/dmitastr/yp_observability_service/internal/common"
 	serverenvconfig "github.com/dmitastr/yp_observability_service/internal/config/env_parser/server/server_env_config"
 	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
 	"github.com/dmitastr/yp_observability_service/internal/logger"
-	"github.com/dmitastr/yp_observability_service/internal/repository/postgres_storage/pg_err_classifier"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+	pgerrors "github.com/dmitastr/yp_observability_service/internal/repository/postgres_storage/pg_err_classifier"
 	"github.com/jackc/pgx/v5/pgtype"
 
 	"github.com/jackc/pgx/v5"
@@ -19,10 +21,6 @@ import (
 
 	"github.com/failsafe-go/failsafe-go"
 	"github.com/failsafe-go/failsafe-go/retrypolicy"
-
-	"github.com/golang-migrate/migrate/v4"
-	"github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
 )
 
 // Conn abstracts pgx transactions creators: pgx.Conn and pgxpool.Pool.
@@ -43,23 +41,127 @@ var linearBackOff = func(attempt, slope, rise int) time.Duration {
 	return time.Duration(slope*attempt+rise) * time.Second
 }
 
+// copyThreshold is a batch size starting from which metrics are loaded with COPY into a staging table
+// and merged with a single statement instead of queueing an upsert per metric
+var copyThreshold int = 500
+
 type ExecuteWithRetryFunc func(pgx.Tx) error
 
 type Postgres struct {
 	db          *pgxpool.Pool
 	retryPolicy retrypolicy.RetryPolicy[any]
+	// autoMigrate enables applying pending migrations on Init
+	autoMigrate bool
 }
 
+// query upserts a metric: gauge value is replaced and counter delta is added to the stored one
+// within the same statement, so concurrent updates of a counter are not lost. Metric of another type
+// is not updated, the row is locked and no rows are affected then
 const query string = `INSERT INTO metrics (name, mtype, value, delta) 
 	VALUES (@name, @mtype, @value, @delta) 
 	ON CONFLICT ON CONSTRAINT metrics_pkey DO UPDATE SET 
-	value = @value, 
-    delta = @delta `
+	value = EXCLUDED.value, 
+	updated_at = now(), 
+	delta = CASE WHEN EXCLUDED.mtype = 'counter' 
+		THEN COALESCE(metrics.delta, 0) + EXCLUDED.delta 
+		ELSE EXCLUDED.delta END 
+	WHERE metrics.mtype = EXCLUDED.mtype`
+
+const incrementQuery string = `INSERT INTO metrics (name, mtype, delta) 
+	VALUES (@name, 'counter', @delta) 
+	ON CONFLICT ON CONSTRAINT metrics_pkey DO UPDATE SET 
+	updated_at = now(), 
+	delta = COALESCE(metrics.delta, 0) + EXCLUDED.delta 
+	WHERE metrics.mtype = 'counter' 
+	RETURNING delta`
+
+const createStagingQuery string = `CREATE TEMP TABLE IF NOT EXISTS metrics_staging 
+	(ord integer NOT NULL, name text NOT NULL, mtype text NOT NULL, value double precision, delta bigint) 
+	ON COMMIT DELETE ROWS`
+
+// mergeStagingQuery collapses duplicates from the staging table before upsert: the last gauge value wins
+// and counter deltas are summed up. Types within the batch are checked before, so there is a single row
+// per name. Metrics of another type are not updated like in [query]
+const mergeStagingQuery string = `INSERT INTO metrics (name, mtype, value, delta) 
+	SELECT name, mtype, 
+		(array_agg(value ORDER BY ord DESC))[1], 
+		CASE WHEN mtype = 'counter' 
+			THEN SUM(delta)::bigint 
+			ELSE (array_agg(delta ORDER BY ord DESC))[1] END 
+	FROM metrics_staging 
+	GROUP BY name, mtype 
+	ON CONFLICT ON CONSTRAINT metrics_pkey DO UPDATE SET 
+	value = EXCLUDED.value, 
+	updated_at = now(), 
+	delta = CASE WHEN EXCLUDED.mtype = 'counter' 
+		THEN COALESCE(metrics.delta, 0) + EXCLUDED.delta 
+		ELSE EXCLUDED.delta END 
+	WHERE metrics.mtype = EXCLUDED.mtype`
+
+// filterCondition selects metrics matching all set filter fields, unset fields are passed as NULL.
+// Pattern is not part of it, see [Postgres.filterArgs]
+const filterCondition string = `(@names::text[] IS NULL OR name = ANY (@names)) 
+	AND (@mtype::text IS NULL OR mtype = @mtype) 
+	AND (@prefix::text IS NULL OR starts_with(name, @prefix)) 
+	AND (@before::timestamptz IS NULL OR updated_at < @before)`
+
+const filterNamesQuery string = `SELECT name FROM metrics WHERE ` + filterCondition
+
+const deleteQuery string = `DELETE FROM metrics WHERE ` + filterCondition + ` RETURNING name`
+
+const listQuery string = `SELECT name, mtype, value, delta FROM metrics WHERE ` + filterCondition
+
+// listOrders holds ORDER BY clause and cursor condition for each sort. Names are compared bytewise
+// like in other storages, regardless of the database collation
+var listOrders = map[repository.Sort]struct{ order, after string }{
+	repository.SortByName: {
+		order: `name COLLATE "C"`,
+		after: `name COLLATE "C" > @cursor_name`,
+	},
+	repository.SortByNameDesc: {
+		order: `name COLLATE "C" DESC`,
+		after: `name COLLATE "C" < @cursor_name`,
+	},
+	repository.SortByType: {
+		order: `mtype COLLATE "C", name COLLATE "C"`,
+		after: `(mtype COLLATE "C", name COLLATE "C") > (@cursor_type, @cursor_name)`,
+	},
+	repository.SortByTypeDesc: {
+		order: `mtype COLLATE "C" DESC, name COLLATE "C" DESC`,
+		after: `(mtype COLLATE "C", name COLLATE "C") < (@cursor_type, @cursor_name)`,
+	},
+}
+
+// resetQuery sets selected counters to zero and returns their previous values. Rows are locked before
+// they are read, so concurrent increments are either included into the previous value or applied after reset
+const resetQuery string = `WITH old AS (
+		SELECT name, delta FROM metrics WHERE mtype = 'counter' AND ` + filterCondition + ` FOR UPDATE
+	)
+	UPDATE metrics SET delta = 0 FROM old WHERE metrics.name = old.name 
+	RETURNING metrics.name, metrics.mtype, metrics.value, old.delta`
+
+// aggregateExprs compute aggregate functions over selected metrics, the type of metrics is selected by filter
+var aggregateExprs = map[repository.AggregateFunc]string{
+	repository.AggregateSum:   `COALESCE(sum(value), 0)`,
+	repository.AggregateAvg:   `avg(value)`,
+	repository.AggregateMin:   `min(value)`,
+	repository.AggregateMax:   `max(value)`,
+	repository.AggregateCount: `count(*)::double precision`,
+	repository.AggregateTotal: `COALESCE(sum(delta), 0)::double precision`,
+}
+
+const aggregateQuery string = `SELECT %s, count(*) FROM metrics WHERE ` + filterCondition
+
+// topQuery counts all selected metrics with a window function, it is computed before LIMIT
+const topQuery string = `SELECT name, mtype, value, delta, count(*) OVER () FROM metrics WHERE ` + filterCondition + ` 
+	ORDER BY COALESCE(value, delta::double precision) DESC, name COLLATE "C" LIMIT @k`
+
+var stagingColumns = []string{"ord", "name", "mtype", "value", "delta"}
 
 func NewPG(ctx context.Context, cfg *serverenvconfig.Config) (*Postgres, error) {
 	dbConfig, err := pgxpool.ParseConfig(*cfg.DBUrl)
 	if err != nil {
-		logger.Fatalf("Failed to parse memstorage config: %v", err)
+		return nil, fmt.Errorf("failed to parse db url: %w", err)
 	}
 	dbConfig.ConnConfig.Tracer = &tracelog.TraceLog{
 		Logger:   logger.GetLogger(),
@@ -85,36 +187,43 @@ func NewPG(ctx context.Context, cfg *serverenvconfig.Config) (*Postgres, error)
 	}).WithMaxRetries(maxErrorRetries).
 		WithDelayFunc(delayFunc).Build()
 
-	pg := &Postgres{db: pool, retryPolicy: retry}
+	pg := &Postgres{db: pool, retryPolicy: retry, autoMigrate: cfg.AutoMigrate == nil || *cfg.AutoMigrate}
 
 	return pg, nil
 }
 
-func (pg *Postgres) Init(migrationDir string) error {
-	db, err := sql.Open("postgres", pg.db.Config().ConnString())
+// Init applies pending migrations from migrationDir url, embedded migrations are used when it is empty.
+// Without auto migration it only checks that the schema is up to date. Dirty schema is never migrated,
+// it must be fixed by hand and forced to a version
+func (pg *Postgres) Init(migrationDir string) (err error) {
+	migrator, err := NewMigrator(pg.db.Config().ConnString(), migrationDir)
 	if err != nil {
-		logger.Fatalf("Unable to connect to memstorage: %v", err)
+		return err
 	}
+	defer func() { err = errors.Join(err, migrator.Close()) }()
 
-	driver, err := postgres.WithInstance(db, &postgres.Config{})
+	status, err := migrator.Status()
 	if err != nil {
-		logger.Fatal(err)
+		return err
 	}
-
-	m, err := migrate.NewWithDatabaseInstance(migrationDir, "postgres", driver)
-	if err != nil {
-		logger.Fatal(err)
+	logger.Infof("Database %s", status)
+	switch {
+	case status.Dirty:
+		return fmt.Errorf("database schema is dirty at version %d, fix it and run migrate force", status.Version)
+	case status.Version > status.Latest:
+		logger.Warnf("Database schema version %d is newer than %d known to this build", status.Version, status.Latest)
+		return nil
+	case status.Version == status.Latest:
+		return nil
+	case !pg.autoMigrate:
+		return fmt.Errorf("database schema version %d is behind %d and auto migration is disabled, run migrate up", status.Version, status.Latest)
 	}
 
-	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
-		logger.Fatalf("Migration up failed: %v", err)
-	}
-	if err := db.Close(); err != nil {
+	if err := migrator.Up(); err != nil {
 		return err
 	}
-	logger.Info("Migration up completed successfully")
+	logger.Infof("Database schema migrated from version %d to %d", status.Version, status.Latest)
 	return nil
-
 }
 
 func (pg *Postgres) Ping(ctx context.Context) error {
@@ -127,15 +236,44 @@ func (pg *Postgres) Close() error {
 	return nil
 }
 
+// txKey holds transaction started by [Postgres.InTx] in context
+type txKey struct{}
+
+// InTx implements [repository.Transactor], the transaction is retried as a whole on transient errors
+func (pg *Postgres) InTx(ctx context.Context, fnc func(context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return fnc(ctx)
+	}
+
+	var committed func()
+	err := pg.ExecuteTX(ctx, pg.db, func(tx pgx.Tx) error {
+		// hooks of a failed attempt are dropped with it
+		txCtx, hooks := repository.WithCommitHooks(ctx)
+		committed = hooks
+		return fnc(context.WithValue(txCtx, txKey{}, tx))
+	})
+	if err == nil {
+		committed()
+	}
+	return err
+}
+
+// ExecuteTX runs fnc in a transaction retrying transient errors. Connection failures and transient errors
+// left after all retries are marked as [errs.KindUnavailable]. Within [Postgres.InTx] fnc runs in a savepoint
+// of the started transaction instead and is not retried, so a failed call leaves no changes in it
 func (pg *Postgres) ExecuteTX(ctx context.Context, conn Conn, fnc ExecuteWithRetryFunc) error {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return executeInSavepoint(ctx, tx, fnc)
+	}
+
 	// nolint: wrapcheck
-	return failsafe.NewExecutor(pg.retryPolicy).
+	err := failsafe.NewExecutor(pg.retryPolicy).
 		WithContext(ctx).
 		RunWithExecution(func(exec failsafe.Execution[any]) (err error) { //nolint:contextcheck
 			ctx := exec.Context()
 			tx, err := conn.Begin(ctx)
 			if err != nil {
-				return fmt.Errorf("failed to begin tx: %w", err)
+				return errs.Unavailable(fmt.Errorf("failed to begin tx: %w", err))
 			}
 
 			defer tx.Rollback(ctx)
@@ -150,23 +288,103 @@ func (pg *Postgres) ExecuteTX(ctx context.Context, conn Conn, fnc ExecuteWithRet
 
 			return err
 		})
+	if pgerrors.NewPostgresErrorClassifier().Classify(err) == pgerrors.Retriable && errs.KindOf(err) == errs.KindInternal {
+		return errs.Unavailable(err)
+	}
+	return err
+}
+
+func executeInSavepoint(ctx context.Context, tx pgx.Tx, fnc ExecuteWithRetryFunc) error {
+	savepoint, err := tx.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create savepoint: %w", err)
+	}
+
+	defer savepoint.Rollback(ctx)
+
+	if err := fnc(savepoint); err != nil {
+		return err
+	}
+	if err := savepoint.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to release savepoint: %w", err)
+	}
+	return nil
+}
+
+// typeConflicts reads types of metrics which were not updated by upsert and returns [*repository.TypeConflictError].
+// Upsert locks rows it did not update, so their types can not change until the transaction ends
+func (pg *Postgres) typeConflicts(ctx context.Context, tx pgx.Tx, metrics []models.Metrics) error {
+	names := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		names = append(names, m.ID)
+	}
+	stored, err := pg.getByIDWithinTx(ctx, names, tx)
+	if err != nil {
+		return fmt.Errorf("unable to query metric types: %w", err)
+	}
+	types := make(map[string]string, len(stored))
+	for _, m := range stored {
+		types[m.ID] = m.MType
+	}
+	err = repository.CheckTypes(metrics, func(name string) (string, bool, error) {
+		mtype, ok := types[name]
+		return mtype, ok, nil
+	})
+	if err == nil {
+		return errors.New("upsert skipped metrics without type conflicts")
+	}
+	return err
 }
 
 func (pg *Postgres) Update(ctx context.Context, metric models.Metrics) error {
 	fun := func(tx pgx.Tx) error {
 		args := metric.ToNamedArgs()
 
-		if _, err := tx.Exec(ctx, query, args); err != nil {
-			tx.Rollback(ctx)
+		tag, err := tx.Exec(ctx, query, args)
+		if err != nil {
 			logger.Errorf("unable to insert row: %v", err)
 			return err
 		}
+		if tag.RowsAffected() == 0 {
+			return pg.typeConflicts(ctx, tx, []models.Metrics{metric})
+		}
 		return nil
 	}
 	return pg.ExecuteTX(ctx, pg.db, fun)
 }
 
+func (pg *Postgres) Increment(ctx context.Context, name string, delta int64) (int64, error) {
+	var total int64
+	fun := func(tx pgx.Tx) error {
+		args := pgx.NamedArgs{"name": name, "delta": delta}
+		err := tx.QueryRow(ctx, incrementQuery, args).Scan(&total)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return pg.typeConflicts(ctx, tx, []models.Metrics{{ID: name, MType: common.COUNTER, Delta: &delta}})
+		}
+		if err != nil {
+			return fmt.Errorf("unable to increment counter: %w", err)
+		}
+		return nil
+	}
+	err := pg.ExecuteTX(ctx, pg.db, fun)
+	return total, err
+}
+
+// BulkUpdate saves metrics in a single transaction. Batches of at least [copyThreshold] metrics
+// are loaded with COPY, smaller ones are sent as a batch of upserts. Types within the batch are checked
+// before writing, types of stored metrics are checked by upserts
 func (pg *Postgres) BulkUpdate(ctx context.Context, metrics []models.Metrics) error {
+	notStored := func(string) (string, bool, error) { return "", false, nil }
+	if err := repository.CheckTypes(metrics, notStored); err != nil {
+		return err
+	}
+	if len(metrics) >= copyThreshold {
+		return pg.copyUpdate(ctx, metrics)
+	}
+	return pg.batchUpdate(ctx, metrics)
+}
+
+func (pg *Postgres) batchUpdate(ctx context.Context, metrics []models.Metrics) error {
 	fun := func(tx pgx.Tx) error {
 		batch := &pgx.Batch{}
 		for _, metric := range metrics {
@@ -175,20 +393,232 @@ func (pg *Postgres) BulkUpdate(ctx context.Context, metrics []models.Metrics) er
 		}
 		br := tx.SendBatch(ctx, batch)
 
+		conflict := false
 		for range metrics {
-			_, err := br.Exec()
+			tag, err := br.Exec()
 			if err != nil {
 				return fmt.Errorf("batch exec failed at item: %w", err)
 			}
+			conflict = conflict || tag.RowsAffected() == 0
 		}
 		if err := br.Close(); err != nil {
 			return fmt.Errorf("failed to close batch results: %w", err)
 		}
+		if conflict {
+			return pg.typeConflicts(ctx, tx, metrics)
+		}
 		return nil
 	}
 	return pg.ExecuteTX(ctx, pg.db, fun)
 }
 
+func (pg *Postgres) copyUpdate(ctx context.Context, metrics []models.Metrics) error {
+	names := make(map[string]bool, len(metrics))
+	for _, m := range metrics {
+		names[m.ID] = true
+	}
+	fun := func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, createStagingQuery); err != nil {
+			return fmt.Errorf("failed to create staging table: %w", err)
+		}
+
+		rows := pgx.CopyFromSlice(len(metrics), func(i int) ([]any, error) {
+			m := metrics[i]
+			return []any{i, m.ID, m.MType, m.Value, m.Delta}, nil
+		})
+		if _, err := tx.CopyFrom(ctx, pgx.Identifier{"metrics_staging"}, stagingColumns, rows); err != nil {
+			return fmt.Errorf("failed to copy metrics to staging table: %w", err)
+		}
+
+		tag, err := tx.Exec(ctx, mergeStagingQuery)
+		if err != nil {
+			return fmt.Errorf("failed to merge staging table: %w", err)
+		}
+		if tag.RowsAffected() < int64(len(names)) {
+			return pg.typeConflicts(ctx, tx, metrics)
+		}
+		return nil
+	}
+	return pg.ExecuteTX(ctx, pg.db, fun)
+}
+
+// filterArgs passes filter fields for [filterCondition]. Postgres regular expressions differ from
+// the Go ones, so the pattern is matched in Go against the names selected by other fields and
+// the matched names are passed instead
+func (pg *Postgres) filterArgs(ctx context.Context, tx pgx.Tx, filter repository.Filter) (pgx.NamedArgs, error) {
+	args := pgx.NamedArgs{"names": filter.Names, "mtype": nil, "prefix": nil, "before": nil}
+	if filter.Type != "" {
+		args["mtype"] = filter.Type
+	}
+	if filter.Prefix != "" {
+		args["prefix"] = filter.Prefix
+	}
+	if !filter.UpdatedBefore.IsZero() {
+		args["before"] = filter.UpdatedBefore
+	}
+	if filter.Pattern == nil {
+		return args, nil
+	}
+
+	rows, err := tx.Query(ctx, filterNamesQuery, args)
+	if err != nil {
+		return nil, fmt.Errorf("unable to select metric names: %w", err)
+	}
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("unable to select metric names: %w", err)
+	}
+	matched := make([]string, 0, len(names))
+	for _, name := range names {
+		if filter.Pattern.MatchString(name) {
+			matched = append(matched, name)
+		}
+	}
+	args["names"] = matched
+	return args, nil
+}
+
+// Delete removes metrics selected by filter
+func (pg *Postgres) Delete(ctx context.Context, filter repository.Filter) ([]string, error) {
+	if filter.IsEmpty() {
+		return nil, errs.ErrorEmptyFilter
+	}
+
+	var names []string
+	fun := func(tx pgx.Tx) error {
+		args, err := pg.filterArgs(ctx, tx, filter)
+		if err != nil {
+			return err
+		}
+		rows, err := tx.Query(ctx, deleteQuery, args)
+		if err != nil {
+			return fmt.Errorf("unable to delete metrics: %w", err)
+		}
+		names, err = pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return fmt.Errorf("unable to delete metrics: %w", err)
+		}
+		return nil
+	}
+	err := pg.ExecuteTX(ctx, pg.db, fun)
+	return names, err
+}
+
+// List selects a page with WHERE, ORDER BY and LIMIT, one extra row tells whether there is the next page
+func (pg *Postgres) List(ctx context.Context, query repository.ListQuery) (repository.Page, error) {
+	sort := query.Sort
+	if sort == "" {
+		sort = repository.SortByName
+	}
+	order, ok := listOrders[sort]
+	if !ok {
+		return repository.Page{}, errs.InvalidArgument(fmt.Errorf("unknown sort '%s'", sort))
+	}
+
+	sql := listQuery
+	if query.Cursor != nil {
+		sql += ` AND ` + order.after
+	}
+	sql += ` ORDER BY ` + order.order
+	if query.Limit > 0 {
+		sql += ` LIMIT @limit`
+	}
+
+	var metrics []models.Metrics
+	fun := func(tx pgx.Tx) error {
+		args, err := pg.filterArgs(ctx, tx, query.Filter)
+		if err != nil {
+			return err
+		}
+		if query.Cursor != nil {
+			args["cursor_name"] = query.Cursor.Name
+			args["cursor_type"] = query.Cursor.Type
+		}
+		if query.Limit > 0 {
+			args["limit"] = query.Limit + 1
+		}
+		rows, err := tx.Query(ctx, sql, args)
+		if err != nil {
+			return fmt.Errorf("unable to list metrics: %w", err)
+		}
+		metrics, err = pgx.CollectRows(rows, pgx.RowToStructByName[models.Metrics])
+		if err != nil {
+			return fmt.Errorf("unable to list metrics: %w", err)
+		}
+		return nil
+	}
+	if err := pg.ExecuteTX(ctx, pg.db, fun); err != nil {
+		return repository.Page{}, err
+	}
+	return repository.NewPage(metrics, query), nil
+}
+
+// Aggregate computes aggregate function in the database, topk returns only the selected metrics
+func (pg *Postgres) Aggregate(ctx context.Context, query repository.AggregateQuery) (repository.Aggregation, error) {
+	var result repository.Aggregation
+	fun := func(tx pgx.Tx) error {
+		args, err := pg.filterArgs(ctx, tx, query.Filter)
+		if err != nil {
+			return err
+		}
+		if query.Func == repository.AggregateTopK {
+			args["k"] = query.K
+			rows, err := tx.Query(ctx, topQuery, args)
+			if err != nil {
+				return fmt.Errorf("unable to aggregate metrics: %w", err)
+			}
+			defer rows.Close()
+			var top []models.Metrics
+			var count int
+			for rows.Next() {
+				var m models.Metrics
+				if err := rows.Scan(&m.ID, &m.MType, &m.Value, &m.Delta, &count); err != nil {
+					return fmt.Errorf("unable to aggregate metrics: %w", err)
+				}
+				top = append(top, m)
+			}
+			result = repository.Aggregation{Top: top, Count: count}
+			return rows.Err()
+		}
+
+		expr, ok := aggregateExprs[query.Func]
+		if !ok {
+			return errs.InvalidArgument(fmt.Errorf("unknown function '%s'", query.Func))
+		}
+		var value *float64
+		var count int
+		if err := tx.QueryRow(ctx, fmt.Sprintf(aggregateQuery, expr), args).Scan(&value, &count); err != nil {
+			return fmt.Errorf("unable to aggregate metrics: %w", err)
+		}
+		result = repository.Aggregation{Value: value, Count: count}
+		return nil
+	}
+	err := pg.ExecuteTX(ctx, pg.db, fun)
+	return result, err
+}
+
+// ResetCounters sets selected counters to zero, time of their last update is kept
+func (pg *Postgres) ResetCounters(ctx context.Context, filter repository.Filter) ([]models.Metrics, error) {
+	var previous []models.Metrics
+	fun := func(tx pgx.Tx) error {
+		args, err := pg.filterArgs(ctx, tx, filter)
+		if err != nil {
+			return err
+		}
+		rows, err := tx.Query(ctx, resetQuery, args)
+		if err != nil {
+			return fmt.Errorf("unable to reset counters: %w", err)
+		}
+		previous, err = pgx.CollectRows(rows, pgx.RowToStructByName[models.Metrics])
+		if err != nil {
+			return fmt.Errorf("unable to reset counters: %w", err)
+		}
+		return nil
+	}
+	err := pg.ExecuteTX(ctx, pg.db, fun)
+	return previous, err
+}
+
 func (pg *Postgres) Get(ctx context.Context, name string) (*models.Metrics, error) {
 	var metric *models.Metrics
 	fun := func(tx pgx.Tx) error {
@@ -261,8 +691,11 @@ func (pg *Postgres) getWithinTx(ctx context.Context, name string, conn Cursor) (
 	query := `SELECT name, mtype, value, delta FROM metrics WHERE name=@name`
 
 	err := conn.QueryRow(ctx, query, pgx.NamedArgs{"name": name}).Scan(&metric.ID, &metric.MType, &metric.Value, &metric.Delta)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errs.ErrorMetricDoesNotExist
+	}
 	if err != nil {
-		return nil, fmt.Errorf("unable to query metrics: %v", err)
+		return nil, fmt.Errorf("unable to query metrics: %w", err)
 	}
 	return &metric, nil
 }
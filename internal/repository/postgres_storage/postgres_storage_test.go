@@ -2,12 +2,19 @@ package postgresstorage
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	serverenvconfig "github.com/dmitastr/yp_observability_service/internal/config/env_parser/server/server_env_config"
 	"github.com/dmitastr/yp_observability_service/internal/domain/models"
 	"github.com/dmitastr/yp_observability_service/internal/mocks/testhelpers"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+	"github.com/dmitastr/yp_observability_service/internal/repository/conformance"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -29,7 +36,7 @@ func (suite *MetricsRepoTestSuite) SetupSuite() {
 	if err != nil {
 		suite.T().Log("Error database instance", err)
 	}
-	if err := db.Init("file://../../../migrations"); err != nil {
+	if err := db.Init(""); err != nil {
 		suite.T().Log("Error migrating with prod data", err)
 	}
 	if err := db.Init("file://../../../migrations/testdata"); err != nil {
@@ -101,3 +108,312 @@ func (suite *MetricsRepoTestSuite) TestGetAll() {
 func TestPostgresRepoTestSuite(t *testing.T) {
 	suite.Run(t, new(MetricsRepoTestSuite))
 }
+
+func (suite *MetricsRepoTestSuite) TestConcurrentIncrement() {
+	t := suite.T()
+
+	workers, iterations := 8, 20
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range iterations {
+				_, err := suite.repository.Increment(suite.ctx, "concurrent_counter", 1)
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	mGot, err := suite.repository.Get(suite.ctx, "concurrent_counter")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(workers*iterations), *mGot.Delta)
+}
+
+func (suite *MetricsRepoTestSuite) TestBulkUpdateAccumulatesCounter() {
+	t := suite.T()
+	m := models.Metrics{ID: "bulk_counter", MType: "counter"}
+	m.UpdateDelta(5)
+
+	assert.NoError(t, suite.repository.BulkUpdate(suite.ctx, []models.Metrics{m, m}))
+	assert.NoError(t, suite.repository.Update(suite.ctx, m))
+
+	mGot, err := suite.repository.Get(suite.ctx, "bulk_counter")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(15), *mGot.Delta)
+}
+
+func (suite *MetricsRepoTestSuite) TestCopyUpdate() {
+	t := suite.T()
+	first, last := 1.5, 2.5
+	c := models.Metrics{ID: "copy_counter", MType: "counter"}
+	c.UpdateDelta(3)
+
+	metrics := []models.Metrics{
+		{ID: "copy_gauge", MType: "gauge", Value: &first},
+		c,
+		{ID: "copy_gauge", MType: "gauge", Value: &last},
+		c,
+	}
+	assert.NoError(t, suite.repository.copyUpdate(suite.ctx, metrics))
+	assert.NoError(t, suite.repository.copyUpdate(suite.ctx, metrics))
+
+	gauge, err := suite.repository.Get(suite.ctx, "copy_gauge")
+	assert.NoError(t, err)
+	assert.Equal(t, last, *gauge.Value)
+
+	counter, err := suite.repository.Get(suite.ctx, "copy_counter")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(12), *counter.Delta)
+}
+
+func (suite *MetricsRepoTestSuite) TestCopyUpdateTypeConflict() {
+	t := suite.T()
+	value := 1.0
+	stored := models.Metrics{ID: "copy_conflict", MType: "gauge", Value: &value}
+	require.NoError(t, suite.repository.Update(suite.ctx, stored))
+
+	c := models.Metrics{ID: "copy_conflict", MType: "counter"}
+	c.UpdateDelta(1)
+	other := models.Metrics{ID: "copy_other", MType: "gauge", Value: &value}
+	var conflict *repository.TypeConflictError
+	require.ErrorAs(t, suite.repository.copyUpdate(suite.ctx, []models.Metrics{other, c}), &conflict)
+	assert.Equal(t, []string{"copy_conflict"}, conflict.Names())
+
+	metrics, err := suite.repository.GetByID(suite.ctx, []string{"copy_conflict", "copy_other"})
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Metrics{stored}, metrics, "conflicting batch is not written")
+}
+
+func generateMetrics(n int) []models.Metrics {
+	metrics := make([]models.Metrics, 0, n)
+	for i := range n {
+		m := models.Metrics{ID: fmt.Sprintf("bench_%d", i)}
+		if i%2 == 0 {
+			value := float64(i)
+			m.MType, m.Value = "gauge", &value
+		} else {
+			m.MType = "counter"
+			m.UpdateDelta(int64(i))
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+func BenchmarkBulkUpdate(b *testing.B) {
+	ctx := context.Background()
+	if !testhelpers.ProviderAvailable(ctx) {
+		b.Skip("docker is not available")
+	}
+	pgContainer, err := testhelpers.CreatePostgresContainer(ctx)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() {
+		_ = pgContainer.Terminate(ctx)
+	}()
+
+	db, err := NewPG(ctx, &serverenvconfig.Config{DBUrl: &pgContainer.ConnectionString})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Init(""); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, size := range []int{100, 1000, 10000} {
+		metrics := generateMetrics(size)
+		b.Run(fmt.Sprintf("batch/%d", size), func(b *testing.B) {
+			for b.Loop() {
+				if err := db.batchUpdate(ctx, metrics); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("copy/%d", size), func(b *testing.B) {
+			for b.Loop() {
+				if err := db.copyUpdate(ctx, metrics); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func (suite *MetricsRepoTestSuite) TestAggregate() {
+	t := suite.T()
+	a, b := 10.0, 30.0
+	hits := int64(7)
+	require.NoError(t, suite.repository.BulkUpdate(suite.ctx, []models.Metrics{
+		{ID: "agg.a", MType: "gauge", Value: &a},
+		{ID: "agg.b", MType: "gauge", Value: &b},
+		{ID: "agg.hits", MType: "counter", Delta: &hits},
+	}))
+
+	gauges := repository.Filter{Prefix: "agg.", Type: "gauge"}
+	for fun, want := range map[repository.AggregateFunc]float64{
+		repository.AggregateSum: 40, repository.AggregateAvg: 20, repository.AggregateMin: 10,
+		repository.AggregateMax: 30, repository.AggregateCount: 2,
+	} {
+		result, err := suite.repository.Aggregate(suite.ctx, repository.AggregateQuery{Func: fun, Filter: gauges})
+		require.NoError(t, err, fun)
+		require.NotNil(t, result.Value, fun)
+		assert.InDelta(t, want, *result.Value, 1e-9, fun)
+		assert.Equal(t, 2, result.Count, fun)
+	}
+
+	result, err := suite.repository.Aggregate(suite.ctx, repository.AggregateQuery{
+		Func: repository.AggregateTotal, Filter: repository.Filter{Prefix: "agg.", Type: "counter"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 7.0, *result.Value)
+
+	result, err = suite.repository.Aggregate(suite.ctx, repository.AggregateQuery{
+		Func: repository.AggregateMax, Filter: repository.Filter{Prefix: "agg.none", Type: "gauge"},
+	})
+	require.NoError(t, err)
+	assert.Nil(t, result.Value)
+	assert.Zero(t, result.Count)
+
+	result, err = suite.repository.Aggregate(suite.ctx, repository.AggregateQuery{
+		Func: repository.AggregateTopK, K: 2, Filter: repository.Filter{Prefix: "agg."},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Count)
+	assert.Equal(t, []models.Metrics{
+		{ID: "agg.b", MType: "gauge", Value: &b},
+		{ID: "agg.a", MType: "gauge", Value: &a},
+	}, result.Top)
+}
+
+func (suite *MetricsRepoTestSuite) TestConformance() {
+	// other tests of the suite share the database, their metrics are restored afterwards
+	saved, err := suite.repository.GetAll(suite.ctx)
+	require.NoError(suite.T(), err)
+	defer func() {
+		_, err := suite.repository.db.Exec(suite.ctx, "TRUNCATE metrics")
+		require.NoError(suite.T(), err)
+		require.NoError(suite.T(), suite.repository.BulkUpdate(suite.ctx, saved))
+	}()
+
+	conformance.Run(suite.T(), func(t *testing.T) repository.Database {
+		_, err := suite.repository.db.Exec(suite.ctx, "TRUNCATE metrics")
+		require.NoError(t, err)
+		return nopCloser{suite.repository}
+	})
+}
+
+// nopCloser keeps shared database open after a conformance test
+type nopCloser struct {
+	*Postgres
+}
+
+func (nopCloser) Close() error { return nil }
+
+func (suite *MetricsRepoTestSuite) TestNotifierClosesListeningConnection() {
+	t := suite.T()
+	// replica shares the database with notifier like another server
+	notifier, replica := NewNotifier(suite.repository), NewNotifier(suite.repository)
+	defer notifier.Close()
+	defer replica.Close()
+
+	ctx, cancel := context.WithCancel(suite.ctx)
+	received := make(chan []string, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- notifier.Subscribe(ctx, func(names []string) {
+			select {
+			case received <- names:
+			default:
+			}
+		})
+	}()
+
+	assert.Eventually(t, func() bool {
+		_ = notifier.Publish(suite.ctx, []string{"own"})
+		_ = replica.Publish(suite.ctx, []string{"metric"})
+		select {
+		case names := <-received:
+			return assert.Equal(t, []string{"metric"}, names, "own notifications must be skipped")
+		default:
+			return false
+		}
+	}, 5*time.Second, 50*time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+
+	var listening int
+	err := suite.repository.db.QueryRow(suite.ctx,
+		`SELECT count(*) FROM pg_stat_activity WHERE query LIKE 'LISTEN%' AND pid <> pg_backend_pid()`).Scan(&listening)
+	require.NoError(t, err)
+	assert.Zero(t, listening, "listening connection must not be returned to the pool")
+}
+
+func (suite *MetricsRepoTestSuite) TestIdempotencyKeyCompletedInTransaction() {
+	t := suite.T()
+	store := NewIdempotencyStore(suite.repository, time.Minute)
+	state, err := store.Reserve(suite.ctx, "tx_key")
+	require.NoError(t, err)
+	require.Equal(t, repository.IdempotencyReserved, state)
+
+	counter, gauge := testhelpers.Counter("tx_metric", 1), testhelpers.Gauge("tx_metric", 1)
+	apply := func(ctx context.Context) error {
+		require.NoError(t, suite.repository.BulkUpdate(ctx, []models.Metrics{counter}))
+		// failed operation is rolled back alone and does not fail the transaction
+		var conflict *repository.TypeConflictError
+		require.ErrorAs(t, suite.repository.Update(ctx, gauge), &conflict)
+		return store.Complete(ctx, "tx_key")
+	}
+
+	err = store.InTx(suite.ctx, func(ctx context.Context) error {
+		require.NoError(t, apply(ctx))
+		return errors.New("error")
+	})
+	require.Error(t, err)
+	state, err = store.Reserve(suite.ctx, "tx_key")
+	require.NoError(t, err)
+	assert.Equal(t, repository.IdempotencyPending, state, "key must not be completed by failed transaction")
+	m, err := suite.repository.Get(suite.ctx, "tx_metric")
+	require.NoError(t, err)
+	assert.Nil(t, m, "batch of failed transaction must be rolled back")
+
+	require.NoError(t, store.InTx(suite.ctx, apply))
+	state, err = store.Reserve(suite.ctx, "tx_key")
+	require.NoError(t, err)
+	assert.Equal(t, repository.IdempotencyDone, state)
+	m, err = suite.repository.Get(suite.ctx, "tx_metric")
+	require.NoError(t, err)
+	assert.Equal(t, counter, *m)
+}
+
+func (suite *MetricsRepoTestSuite) TestIdempotencyPurge() {
+	t := suite.T()
+	store := NewIdempotencyStore(suite.repository, time.Millisecond)
+	_, err := store.Reserve(suite.ctx, "expired_key")
+	require.NoError(t, err)
+
+	time.Sleep(10 * time.Millisecond)
+	state, err := store.Reserve(suite.ctx, "expired_key")
+	require.NoError(t, err)
+	assert.Equal(t, repository.IdempotencyPending, state, "expired key is kept until purged")
+
+	require.NoError(t, store.purge(suite.ctx))
+	state, err = store.Reserve(suite.ctx, "expired_key")
+	require.NoError(t, err)
+	assert.Equal(t, repository.IdempotencyReserved, state)
+}
+
+func (suite *MetricsRepoTestSuite) TestGetMetadataByNames() {
+	t := suite.T()
+	store := NewMetadataStore(suite.repository)
+	md := models.Metadata{Name: "md_gauge", Unit: "bytes", Type: "gauge"}
+	require.NoError(t, store.PutMetadata(suite.ctx, md))
+	require.NoError(t, store.PutMetadata(suite.ctx, models.Metadata{Name: "md_other"}))
+
+	list, err := store.GetMetadataByNames(suite.ctx, []string{"md_gauge", "md_missing"})
+	require.NoError(t, err)
+	assert.Equal(t, []models.Metadata{md}, list)
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"sync"
+)
+
+// Transactor is implemented by storages which can apply several operations atomically. Operations called
+// with the context passed to fnc join the transaction, which is committed if fnc returns nil. Calls of InTx
+// with such context join the running transaction as well. Operations stay atomic within the transaction, a failed
+// one leaves no changes in it
+type Transactor interface {
+	InTx(ctx context.Context, fnc func(context.Context) error) error
+}
+
+type commitHooksKey struct{}
+
+type commitHooks struct {
+	mu   sync.Mutex
+	fncs []func()
+}
+
+// WithCommitHooks returns context of a new transaction and a function which runs hooks added with [OnCommit]
+// once the transaction is committed
+func WithCommitHooks(ctx context.Context) (context.Context, func()) {
+	hooks := &commitHooks{}
+	committed := func() {
+		hooks.mu.Lock()
+		fncs := hooks.fncs
+		hooks.fncs = nil
+		hooks.mu.Unlock()
+		for _, fnc := range fncs {
+			fnc()
+		}
+	}
+	return context.WithValue(ctx, commitHooksKey{}, hooks), committed
+}
+
+// OnCommit defers fnc until the transaction of ctx is committed, fnc is dropped if the transaction fails.
+// Returns false if ctx has no transaction, then the caller should run fnc itself
+func OnCommit(ctx context.Context, fnc func()) bool {
+	hooks, ok := ctx.Value(commitHooksKey{}).(*commitHooks)
+	if !ok {
+		return false
+	}
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	hooks.fncs = append(hooks.fncs, fnc)
+	return true
+}
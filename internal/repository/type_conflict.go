@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+)
+
+// TypeConflict is an update with a type different from the type of the stored metric
+// or of a previous update of the same batch
+type TypeConflict struct {
+	Name     string
+	Stored   string
+	Received string
+}
+
+// TypeConflictError is returned by storages for updates which change metric types. Storage checks
+// types within the same write, nothing is written when any update conflicts
+type TypeConflictError struct {
+	Conflicts []TypeConflict
+}
+
+func (e *TypeConflictError) Error() string {
+	c := e.Conflicts[0]
+	text := fmt.Sprintf("metric %s is %s, received %s", c.Name, c.Stored, c.Received)
+	if len(e.Conflicts) > 1 {
+		text += fmt.Sprintf(" and %d more conflicts", len(e.Conflicts)-1)
+	}
+	return text + ": " + errs.ErrorTypeConflict.Error()
+}
+
+func (e *TypeConflictError) Unwrap() error {
+	return errs.ErrorTypeConflict
+}
+
+// Names returns names of conflicting metrics without duplicates
+func (e *TypeConflictError) Names() []string {
+	seen := make(map[string]bool, len(e.Conflicts))
+	var names []string
+	for _, c := range e.Conflicts {
+		if !seen[c.Name] {
+			seen[c.Name] = true
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+// CheckTypes compares types of updates with stored types returned by lookup and with each other.
+// Lookup is called once per name and reports false for metrics which are not stored.
+// Returns [*TypeConflictError] listing all conflicts or nil
+func CheckTypes(metrics []models.Metrics, lookup func(name string) (string, bool, error)) error {
+	types := make(map[string]string, len(metrics))
+	var conflicts []TypeConflict
+	for _, m := range metrics {
+		mtype, ok := types[m.ID]
+		if !ok {
+			var err error
+			if mtype, ok, err = lookup(m.ID); err != nil {
+				return err
+			}
+		}
+		if ok && mtype != m.MType {
+			conflicts = append(conflicts, TypeConflict{Name: m.ID, Stored: mtype, Received: m.MType})
+		}
+		types[m.ID] = m.MType
+	}
+	if len(conflicts) > 0 {
+		return &TypeConflictError{Conflicts: conflicts}
+	}
+	return nil
+}
+
+// TypeConflictNotifier is implemented by storages which accept updates before they are written, e.g. buffers.
+// Updates found conflicting when they are written are dropped and passed to fnc
+type TypeConflictNotifier interface {
+	OnTypeConflicts(fnc func(context.Context, []TypeConflict))
+}
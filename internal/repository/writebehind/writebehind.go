@@ -0,0 +1,529 @@
+package writebehind
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dmitastr/yp_observability_service/internal/common"
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/logger"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+)
+
+// flushTimeout limits time of a single flush to the underlying storage
+var flushTimeout = 10 * time.Second
+
+// pendingLimitFactor limits the number of buffered metrics to a multiple of the flush size, so the buffer
+// does not grow without bound while the underlying storage is down. defaultMaxPending is the limit
+// for a buffer flushed only by interval
+var (
+	pendingLimitFactor = 10
+	defaultMaxPending  = 100000
+)
+
+// errBufferFull is returned for updates of new metrics while the buffer holds maxPending metrics
+var errBufferFull = errs.New(errs.KindUnavailable, "write buffer is full, storage is not available")
+
+// Buffer implements [repository.Database] and keeps updates in memory before writing them to the underlying
+// storage. Updates of the same metric are coalesced: the last value wins for gauges and deltas are summed up
+// for counters. Buffer is flushed with a single BulkUpdate every interval or when it holds maxSize metrics.
+// Updates of new metrics are rejected while the buffer holds maxPending metrics.
+//
+// Stored state of a metric is read once, when the metric is updated through the buffer for the first time,
+// and is kept up to date after every flush. So types of updates are checked, counter totals are computed
+// and written metrics are read without requests to the storage. Buffer assumes it is the only writer
+// of metrics it has seen
+type Buffer struct {
+	db         repository.Database
+	interval   time.Duration
+	maxSize    int
+	maxPending int
+
+	// flushMu serializes flushes, reads and writes do not wait for them
+	flushMu sync.Mutex
+	mu      sync.Mutex
+	// known holds stored values of metrics updated through the buffer, nil if metric is not stored
+	known   map[string]*models.Metrics
+	pending map[string]models.Metrics
+	// flushing holds metrics being written by flush, they are neither pending nor stored yet
+	flushing map[string]models.Metrics
+	// onConflict receives buffered updates dropped by flush because of type conflicts
+	onConflict func(context.Context, []repository.TypeConflict)
+
+	flushCh chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	started bool
+	once    sync.Once
+}
+
+func New(db repository.Database, interval time.Duration, maxSize int) *Buffer {
+	maxPending := defaultMaxPending
+	if maxSize > 0 {
+		maxPending = maxSize * pendingLimitFactor
+	}
+	return &Buffer{
+		db:         db,
+		interval:   interval,
+		maxSize:    maxSize,
+		maxPending: maxPending,
+		known:      make(map[string]*models.Metrics),
+		pending:    make(map[string]models.Metrics),
+		flushCh:    make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// Init initializes underlying storage and starts background flushing
+func (b *Buffer) Init(migrationDir string) error {
+	if err := b.db.Init(migrationDir); err != nil {
+		return err
+	}
+	b.started = true
+	go b.run()
+	return nil
+}
+
+// OnTypeConflicts sets receiver of buffered updates dropped by flush because the stored metric
+// has another type, e.g. when it was replaced by another replica
+func (b *Buffer) OnTypeConflicts(fnc func(context.Context, []repository.TypeConflict)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onConflict = fnc
+}
+
+// Run runs background work of the underlying storage if it has any
+func (b *Buffer) Run(ctx context.Context) error {
+	if runner, ok := b.db.(repository.Runner); ok {
+		return runner.Run(ctx)
+	}
+	return nil
+}
+
+func (b *Buffer) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		case <-b.flushCh:
+		}
+		if err := b.Flush(context.Background()); err != nil {
+			logger.Errorf("error flushing write buffer: %v", err)
+		}
+	}
+}
+
+// Flush writes all buffered metrics to the underlying storage. If writing fails, metrics are returned
+// to the buffer and will be written with the next flush. Metrics whose type was changed in the storage
+// after they were buffered, e.g. by another replica, are dropped and reported to [Buffer.OnTypeConflicts]
+func (b *Buffer) Flush(ctx context.Context) error {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	batch := b.pending
+	if len(batch) == 0 {
+		b.mu.Unlock()
+		return nil
+	}
+	b.pending = make(map[string]models.Metrics)
+	b.flushing = batch
+	b.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, flushTimeout)
+	defer cancel()
+	err := b.db.BulkUpdate(ctx, values(batch))
+	var dropped []repository.TypeConflict
+	var conflict *repository.TypeConflictError
+	// every retry drops at least one metric, so the loop ends
+	for errors.As(err, &conflict) {
+		dropped = append(dropped, conflict.Conflicts...)
+		b.mu.Lock()
+		for _, c := range conflict.Conflicts {
+			delete(batch, c.Name)
+		}
+		b.mu.Unlock()
+		if len(batch) == 0 {
+			err = nil
+			break
+		}
+		err = b.db.BulkUpdate(ctx, values(batch))
+	}
+
+	b.mu.Lock()
+	b.flushing = nil
+	if err == nil {
+		for id, m := range batch {
+			b.store(id, m)
+		}
+	} else {
+		for id, m := range batch {
+			if newer, ok := b.pending[id]; ok {
+				m = coalesce(m, newer)
+			}
+			b.pending[id] = m
+		}
+	}
+	// stored state of dropped metrics is unknown, it is read again on the next update
+	for _, c := range dropped {
+		if _, ok := b.pending[c.Name]; !ok {
+			delete(b.known, c.Name)
+		}
+	}
+	onConflict := b.onConflict
+	b.mu.Unlock()
+
+	if len(dropped) > 0 {
+		for _, c := range dropped {
+			logger.Errorf("Dropping buffered metric %s: stored one is %s, buffered %s", c.Name, c.Stored, c.Received)
+		}
+		if onConflict != nil {
+			onConflict(ctx, dropped)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error writing %d buffered metrics: %w", len(batch), err)
+	}
+	logger.Infof("Flushed %d buffered metrics", len(batch))
+	return nil
+}
+
+// store applies flushed update to the known stored value. Must be called with mu locked
+func (b *Buffer) store(name string, m models.Metrics) {
+	if stored := b.known[name]; stored != nil {
+		m = coalesce(*stored, m)
+	}
+	b.known[name] = &m
+}
+
+func values(metrics map[string]models.Metrics) []models.Metrics {
+	list := make([]models.Metrics, 0, len(metrics))
+	for _, m := range metrics {
+		list = append(list, m)
+	}
+	return list
+}
+
+// coalesce merges a newer update into an older one of the same metric and type
+func coalesce(older, newer models.Metrics) models.Metrics {
+	if newer.MType != common.COUNTER || older.Delta == nil {
+		return newer
+	}
+	delta := *older.Delta
+	if newer.Delta != nil {
+		delta += *newer.Delta
+	}
+	newer.Delta = &delta
+	return newer
+}
+
+// view returns the current value of metric: known stored value with flushing and pending updates applied.
+// Must be called with mu locked
+func (b *Buffer) view(name string) (models.Metrics, bool) {
+	var metric models.Metrics
+	found := false
+	if stored := b.known[name]; stored != nil {
+		metric, found = *stored, true
+	}
+	for _, updates := range []map[string]models.Metrics{b.flushing, b.pending} {
+		m, ok := updates[name]
+		if !ok {
+			continue
+		}
+		if found {
+			m = coalesce(metric, m)
+		}
+		metric, found = m, true
+	}
+	return metric, found
+}
+
+// isKnown tells whether metric was updated through the buffer. Must be called with mu locked
+func (b *Buffer) isKnown(name string) bool {
+	_, ok := b.known[name]
+	return ok
+}
+
+// load reads stored state of metrics seen for the first time
+func (b *Buffer) load(ctx context.Context, metrics []models.Metrics) error {
+	b.mu.Lock()
+	var names []string
+	for _, m := range metrics {
+		if !b.isKnown(m.ID) {
+			names = append(names, m.ID)
+		}
+	}
+	b.mu.Unlock()
+
+	if len(names) == 0 {
+		return nil
+	}
+	stored, err := b.db.GetByID(ctx, names)
+	if err != nil {
+		return fmt.Errorf("error reading stored metrics: %w", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, name := range names {
+		if !b.isKnown(name) {
+			b.known[name] = nil
+		}
+	}
+	for _, m := range stored {
+		// metric could be updated and flushed by a concurrent write after it was read
+		if b.known[m.ID] == nil {
+			if _, ok := b.view(m.ID); !ok {
+				b.known[m.ID] = &m
+			}
+		}
+	}
+	return nil
+}
+
+// enqueue checks types of metrics and buffers all of them, or none when they do not fit into the buffer
+func (b *Buffer) enqueue(ctx context.Context, metrics ...models.Metrics) error {
+	if err := b.load(ctx, metrics); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	err := repository.CheckTypes(metrics, func(name string) (string, bool, error) {
+		m, ok := b.view(name)
+		return m.MType, ok, nil
+	})
+	if err != nil {
+		b.mu.Unlock()
+		return err
+	}
+	added := make(map[string]bool)
+	for _, m := range metrics {
+		if _, ok := b.pending[m.ID]; !ok {
+			added[m.ID] = true
+		}
+	}
+	if len(added) > 0 && len(b.pending)+len(added) > b.maxPending {
+		b.mu.Unlock()
+		return errBufferFull
+	}
+	for _, m := range metrics {
+		if exist, ok := b.pending[m.ID]; ok {
+			m = coalesce(exist, m)
+		}
+		b.pending[m.ID] = m
+	}
+	full := b.maxSize > 0 && len(b.pending) >= b.maxSize
+	b.mu.Unlock()
+
+	if full {
+		select {
+		case b.flushCh <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (b *Buffer) Update(ctx context.Context, metric models.Metrics) error {
+	return b.enqueue(ctx, metric)
+}
+
+func (b *Buffer) BulkUpdate(ctx context.Context, metrics []models.Metrics) error {
+	return b.enqueue(ctx, metrics...)
+}
+
+// Increment buffers delta and returns the stored counter value increased by all buffered deltas
+func (b *Buffer) Increment(ctx context.Context, name string, delta int64) (int64, error) {
+	if err := b.enqueue(ctx, models.Metrics{ID: name, MType: common.COUNTER, Delta: &delta}); err != nil {
+		return 0, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	metric, _ := b.view(name)
+	if metric.Delta == nil {
+		return 0, nil
+	}
+	return *metric.Delta, nil
+}
+
+// Get returns metrics updated through the buffer from memory and reads other ones from the storage
+func (b *Buffer) Get(ctx context.Context, name string) (*models.Metrics, error) {
+	b.mu.Lock()
+	if b.isKnown(name) {
+		metric, ok := b.view(name)
+		b.mu.Unlock()
+		if !ok {
+			return nil, errs.ErrorMetricDoesNotExist
+		}
+		return &metric, nil
+	}
+	b.mu.Unlock()
+
+	return b.db.Get(ctx, name)
+}
+
+func (b *Buffer) GetByID(ctx context.Context, names []string) ([]models.Metrics, error) {
+	found := make(map[string]models.Metrics, len(names))
+	var unknown []string
+	b.mu.Lock()
+	for _, name := range names {
+		if !b.isKnown(name) {
+			unknown = append(unknown, name)
+		} else if metric, ok := b.view(name); ok {
+			found[name] = metric
+		}
+	}
+	b.mu.Unlock()
+
+	if len(unknown) > 0 {
+		stored, err := b.db.GetByID(ctx, unknown)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range stored {
+			found[m.ID] = m
+		}
+	}
+
+	metrics := make([]models.Metrics, 0, len(found))
+	for _, name := range names {
+		if m, ok := found[name]; ok {
+			metrics = append(metrics, m)
+			delete(found, name)
+		}
+	}
+	return metrics, nil
+}
+
+// GetAll reads metrics from the storage and replaces the ones updated through the buffer with their current values
+func (b *Buffer) GetAll(ctx context.Context) ([]models.Metrics, error) {
+	stored, err := b.db.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	metrics := make([]models.Metrics, 0, len(stored)+len(b.pending))
+	seen := make(map[string]bool, len(stored))
+	for _, m := range stored {
+		seen[m.ID] = true
+		if b.isKnown(m.ID) {
+			current, ok := b.view(m.ID)
+			if !ok {
+				continue
+			}
+			m = current
+		}
+		metrics = append(metrics, m)
+	}
+	for name := range b.known {
+		if seen[name] {
+			continue
+		}
+		if m, ok := b.view(name); ok {
+			metrics = append(metrics, m)
+		}
+	}
+	return metrics, nil
+}
+
+// List flushes the buffer, so listed pages are consistent, and lists metrics of the underlying storage
+func (b *Buffer) List(ctx context.Context, query repository.ListQuery) (repository.Page, error) {
+	if err := b.Flush(ctx); err != nil {
+		return repository.Page{}, err
+	}
+	return b.db.List(ctx, query)
+}
+
+// Delete flushes the buffer, so buffered updates of selected metrics are deleted with them,
+// and removes metrics from the underlying storage
+func (b *Buffer) Delete(ctx context.Context, filter repository.Filter) ([]string, error) {
+	if filter.IsEmpty() {
+		return nil, errs.ErrorEmptyFilter
+	}
+	if err := b.Flush(ctx); err != nil {
+		return nil, err
+	}
+	deleted, err := b.db.Delete(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, name := range deleted {
+		if !b.isKnown(name) {
+			continue
+		}
+		b.known[name] = nil
+		// updates buffered after flush recreate the metric
+		if _, ok := b.view(name); !ok {
+			delete(b.known, name)
+		}
+	}
+	return deleted, nil
+}
+
+// ResetCounters flushes the buffer, so buffered deltas are included into previous values,
+// and resets counters in the underlying storage
+func (b *Buffer) ResetCounters(ctx context.Context, filter repository.Filter) ([]models.Metrics, error) {
+	if err := b.Flush(ctx); err != nil {
+		return nil, err
+	}
+	previous, err := b.db.ResetCounters(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, m := range previous {
+		if b.isKnown(m.ID) {
+			var zero int64
+			b.known[m.ID] = &models.Metrics{ID: m.ID, MType: common.COUNTER, Delta: &zero}
+		}
+	}
+	return previous, nil
+}
+
+// Aggregate flushes the buffer, so buffered updates are aggregated, and aggregates in the underlying storage.
+// Returns [errors.ErrUnsupported] if the underlying storage can not aggregate
+func (b *Buffer) Aggregate(ctx context.Context, query repository.AggregateQuery) (repository.Aggregation, error) {
+	aggregator, ok := b.db.(repository.Aggregator)
+	if !ok {
+		return repository.Aggregation{}, errors.ErrUnsupported
+	}
+	if err := b.Flush(ctx); err != nil {
+		return repository.Aggregation{}, err
+	}
+	return aggregator.Aggregate(ctx, query)
+}
+
+func (b *Buffer) Ping(ctx context.Context) error {
+	return b.db.Ping(ctx)
+}
+
+// Close stops background flushing, drains the buffer and closes underlying storage
+func (b *Buffer) Close() error {
+	var flushErr error
+	b.once.Do(func() {
+		close(b.stop)
+		if b.started {
+			<-b.done
+		}
+		flushErr = b.Flush(context.Background())
+	})
+	return errors.Join(flushErr, b.db.Close())
+}
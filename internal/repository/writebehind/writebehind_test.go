@@ -0,0 +1,285 @@
+package writebehind
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	serverenvconfig "github.com/dmitastr/yp_observability_service/internal/config/env_parser/server/server_env_config"
+	"github.com/dmitastr/yp_observability_service/internal/domain/models"
+	"github.com/dmitastr/yp_observability_service/internal/errs"
+	"github.com/dmitastr/yp_observability_service/internal/mocks/storage"
+	"github.com/dmitastr/yp_observability_service/internal/mocks/testhelpers"
+	"github.com/dmitastr/yp_observability_service/internal/repository"
+	"github.com/dmitastr/yp_observability_service/internal/repository/conformance"
+	"github.com/dmitastr/yp_observability_service/internal/repository/memstorage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newStorage returns a mock storage without stored metrics, types of buffered updates are checked against it
+func newStorage(t *testing.T) *storage.MockDatabase {
+	db := storage.NewMockDatabase(gomock.NewController(t))
+	db.EXPECT().GetByID(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	return db
+}
+
+func TestBuffer_FlushCoalesces(t *testing.T) {
+	db := newStorage(t)
+
+	var flushed []models.Metrics
+	db.EXPECT().BulkUpdate(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, metrics []models.Metrics) error {
+		flushed = metrics
+		return nil
+	}).Times(1)
+
+	buffer := New(db, time.Hour, 0)
+	require.NoError(t, buffer.Update(t.Context(), testhelpers.Gauge("Alloc", 1)))
+	require.NoError(t, buffer.Update(t.Context(), testhelpers.Gauge("Alloc", 2)))
+	require.NoError(t, buffer.BulkUpdate(t.Context(), []models.Metrics{testhelpers.Counter("PollCount", 1), testhelpers.Counter("PollCount", 2)}))
+	require.NoError(t, buffer.Flush(t.Context()))
+
+	assert.ElementsMatch(t, []models.Metrics{testhelpers.Gauge("Alloc", 2), testhelpers.Counter("PollCount", 3)}, flushed)
+
+	// nothing left to flush
+	require.NoError(t, buffer.Flush(t.Context()))
+}
+
+func TestBuffer_FlushFailureKeepsMetrics(t *testing.T) {
+	db := newStorage(t)
+
+	var flushed []models.Metrics
+	gomock.InOrder(
+		db.EXPECT().BulkUpdate(gomock.Any(), gomock.Any()).Return(errors.New("db is down")),
+		db.EXPECT().BulkUpdate(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, metrics []models.Metrics) error {
+			flushed = metrics
+			return nil
+		}),
+	)
+
+	buffer := New(db, time.Hour, 0)
+	require.NoError(t, buffer.Update(t.Context(), testhelpers.Counter("PollCount", 1)))
+	assert.Error(t, buffer.Flush(t.Context()))
+
+	require.NoError(t, buffer.Update(t.Context(), testhelpers.Counter("PollCount", 2)))
+	require.NoError(t, buffer.Flush(t.Context()))
+	assert.Equal(t, []models.Metrics{testhelpers.Counter("PollCount", 3)}, flushed)
+}
+
+func TestBuffer_ReadsMergePending(t *testing.T) {
+	db := storage.NewMockDatabase(gomock.NewController(t))
+	stored := testhelpers.Counter("PollCount", 10)
+	// stored state is read once, on the first update of a metric
+	db.EXPECT().GetByID(gomock.Any(), []string{"PollCount"}).Return([]models.Metrics{stored}, nil).Times(1)
+	db.EXPECT().GetByID(gomock.Any(), []string{"Alloc"}).Return(nil, nil).Times(1)
+	db.EXPECT().GetAll(gomock.Any()).Return([]models.Metrics{stored, testhelpers.Gauge("Sys", 1)}, nil).AnyTimes()
+	db.EXPECT().BulkUpdate(gomock.Any(), []models.Metrics{testhelpers.Counter("PollCount", 5)}).Return(nil)
+
+	buffer := New(db, time.Hour, 0)
+	total, err := buffer.Increment(t.Context(), "PollCount", 5)
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), total)
+	require.NoError(t, buffer.Flush(t.Context()))
+	total, err = buffer.Increment(t.Context(), "PollCount", 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(16), total, "flushed deltas are added to the known total")
+
+	require.NoError(t, buffer.Update(t.Context(), testhelpers.Gauge("Alloc", 1)))
+	metric, err := buffer.Get(t.Context(), "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, testhelpers.Gauge("Alloc", 1), *metric)
+
+	metrics, err := buffer.GetByID(t.Context(), []string{"PollCount", "Alloc"})
+	require.NoError(t, err)
+	assert.Equal(t, []models.Metrics{testhelpers.Counter("PollCount", 16), testhelpers.Gauge("Alloc", 1)}, metrics)
+
+	all, err := buffer.GetAll(t.Context())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []models.Metrics{testhelpers.Counter("PollCount", 16), testhelpers.Gauge("Alloc", 1), testhelpers.Gauge("Sys", 1)}, all)
+}
+
+func TestBuffer_ReadsDoNotWaitForFlush(t *testing.T) {
+	db := newStorage(t)
+	started, release := make(chan struct{}), make(chan struct{})
+	db.EXPECT().BulkUpdate(gomock.Any(), gomock.Any()).DoAndReturn(func(context.Context, []models.Metrics) error {
+		close(started)
+		<-release
+		return nil
+	})
+
+	buffer := New(db, time.Hour, 0)
+	require.NoError(t, buffer.Update(t.Context(), testhelpers.Counter("PollCount", 2)))
+	flushed := make(chan error)
+	go func() { flushed <- buffer.Flush(t.Context()) }()
+	<-started
+
+	total, err := buffer.Increment(t.Context(), "PollCount", 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), total, "in-flight batch is visible")
+	metric, err := buffer.Get(t.Context(), "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, testhelpers.Counter("PollCount", 5), *metric)
+
+	close(release)
+	require.NoError(t, <-flushed)
+	assert.Equal(t, map[string]models.Metrics{"PollCount": testhelpers.Counter("PollCount", 3)}, buffer.pending)
+	metric, err = buffer.Get(t.Context(), "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, testhelpers.Counter("PollCount", 5), *metric)
+}
+
+func TestBuffer_GetReturnsStorageErrors(t *testing.T) {
+	db := storage.NewMockDatabase(gomock.NewController(t))
+	db.EXPECT().GetByID(gomock.Any(), gomock.Any()).Return(nil, errors.New("db is down")).AnyTimes()
+	db.EXPECT().Get(gomock.Any(), "PollCount").Return(nil, errors.New("db is down")).AnyTimes()
+
+	buffer := New(db, time.Hour, 0)
+	_, err := buffer.Increment(t.Context(), "PollCount", 5)
+	assert.ErrorContains(t, err, "db is down", "buffered delta alone is not the counter total")
+	assert.Empty(t, buffer.pending)
+	_, err = buffer.Get(t.Context(), "PollCount")
+	assert.ErrorContains(t, err, "db is down")
+}
+
+func TestBuffer_RejectsNewMetricsWhenFull(t *testing.T) {
+	db := newStorage(t)
+	db.EXPECT().BulkUpdate(gomock.Any(), gomock.Any()).Return(errors.New("db is down")).AnyTimes()
+
+	// flushing is not started, so the buffer only grows
+	buffer := New(db, time.Hour, 1)
+	for i := range pendingLimitFactor {
+		require.NoError(t, buffer.Update(t.Context(), testhelpers.Gauge(fmt.Sprintf("Gauge%d", i), 1)))
+	}
+	assert.Error(t, buffer.Flush(t.Context()))
+
+	err := buffer.BulkUpdate(t.Context(), []models.Metrics{testhelpers.Gauge("Gauge0", 2), testhelpers.Gauge("New", 1)})
+	assert.Equal(t, errs.KindUnavailable, errs.KindOf(err))
+	_, err = buffer.Increment(t.Context(), "NewCounter", 1)
+	assert.Equal(t, errs.KindUnavailable, errs.KindOf(err))
+
+	require.NoError(t, buffer.Update(t.Context(), testhelpers.Gauge("Gauge0", 3)), "buffered metrics are still coalesced")
+	assert.Len(t, buffer.pending, pendingLimitFactor)
+	assert.Equal(t, testhelpers.Gauge("Gauge0", 3), buffer.pending["Gauge0"])
+}
+
+func TestBuffer_RejectsTypeChanges(t *testing.T) {
+	db := storage.NewMockDatabase(gomock.NewController(t))
+	db.EXPECT().GetByID(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, names []string) ([]models.Metrics, error) {
+		if slices.Contains(names, "Stored") {
+			return []models.Metrics{testhelpers.Gauge("Stored", 1)}, nil
+		}
+		return nil, nil
+	}).AnyTimes()
+
+	buffer := New(db, time.Hour, 0)
+	var conflict *repository.TypeConflictError
+	err := buffer.Update(t.Context(), testhelpers.Counter("Stored", 1))
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, []repository.TypeConflict{{Name: "Stored", Stored: "gauge", Received: "counter"}}, conflict.Conflicts)
+
+	require.NoError(t, buffer.Update(t.Context(), testhelpers.Gauge("Buffered", 1)))
+	_, err = buffer.Increment(t.Context(), "Buffered", 1)
+	assert.ErrorIs(t, err, errs.ErrorTypeConflict)
+
+	err = buffer.BulkUpdate(t.Context(), []models.Metrics{testhelpers.Gauge("New", 1), testhelpers.Counter("Other", 1), testhelpers.Counter("New", 1)})
+	assert.ErrorIs(t, err, errs.ErrorTypeConflict)
+	assert.Len(t, buffer.pending, 1, "conflicting batch is not buffered")
+}
+
+func TestBuffer_FlushDropsConflicts(t *testing.T) {
+	db := newStorage(t)
+	conflict := &repository.TypeConflictError{Conflicts: []repository.TypeConflict{{Name: "Alloc", Stored: "counter", Received: "gauge"}}}
+	gomock.InOrder(
+		db.EXPECT().BulkUpdate(gomock.Any(), gomock.Any()).Return(conflict),
+		db.EXPECT().BulkUpdate(gomock.Any(), []models.Metrics{testhelpers.Counter("PollCount", 1)}).Return(nil),
+	)
+
+	buffer := New(db, time.Hour, 0)
+	var reported []repository.TypeConflict
+	buffer.OnTypeConflicts(func(_ context.Context, conflicts []repository.TypeConflict) {
+		reported = append(reported, conflicts...)
+	})
+	require.NoError(t, buffer.BulkUpdate(t.Context(), []models.Metrics{testhelpers.Gauge("Alloc", 1), testhelpers.Counter("PollCount", 1)}))
+	require.NoError(t, buffer.Flush(t.Context()))
+	assert.Empty(t, buffer.pending)
+	assert.Equal(t, conflict.Conflicts, reported, "dropped updates are reported")
+	assert.NotContains(t, buffer.known, "Alloc", "stored state of dropped metric is read again")
+}
+
+func TestBuffer_FlushOnSize(t *testing.T) {
+	db := newStorage(t)
+
+	flushed := make(chan []models.Metrics, 1)
+	db.EXPECT().Init(gomock.Any()).Return(nil)
+	db.EXPECT().BulkUpdate(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, metrics []models.Metrics) error {
+		flushed <- metrics
+		return nil
+	}).Times(1)
+	db.EXPECT().Close().Return(nil)
+
+	buffer := New(db, time.Hour, 2)
+	require.NoError(t, buffer.Init(""))
+	require.NoError(t, buffer.BulkUpdate(t.Context(), []models.Metrics{testhelpers.Gauge("a", 1), testhelpers.Gauge("b", 2)}))
+
+	select {
+	case metrics := <-flushed:
+		assert.Len(t, metrics, 2)
+	case <-time.After(time.Second):
+		t.Fatal("buffer was not flushed after reaching max size")
+	}
+	require.NoError(t, buffer.Close())
+}
+
+func TestBuffer_CloseDrains(t *testing.T) {
+	db := newStorage(t)
+
+	gomock.InOrder(
+		db.EXPECT().Init(gomock.Any()).Return(nil),
+		db.EXPECT().BulkUpdate(gomock.Any(), []models.Metrics{testhelpers.Counter("PollCount", 1)}).Return(nil),
+		db.EXPECT().Close().Return(nil),
+	)
+
+	buffer := New(db, time.Hour, 0)
+	require.NoError(t, buffer.Init(""))
+	require.NoError(t, buffer.Update(t.Context(), testhelpers.Counter("PollCount", 1)))
+	require.NoError(t, buffer.Close())
+}
+
+// aggregator is a storage computing aggregations itself
+type aggregator struct {
+	*storage.MockDatabase
+}
+
+func (aggregator) Aggregate(context.Context, repository.AggregateQuery) (repository.Aggregation, error) {
+	return repository.Aggregation{Count: 1}, nil
+}
+
+func TestBuffer_Aggregate(t *testing.T) {
+	db := newStorage(t)
+	query := repository.AggregateQuery{Func: repository.AggregateSum}
+
+	_, err := New(db, time.Hour, 0).Aggregate(t.Context(), query)
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+
+	db.EXPECT().BulkUpdate(gomock.Any(), []models.Metrics{testhelpers.Gauge("a", 1)}).Return(nil)
+	buffer := New(aggregator{db}, time.Hour, 0)
+	require.NoError(t, buffer.Update(t.Context(), testhelpers.Gauge("a", 1)))
+	result, err := buffer.Aggregate(t.Context(), query)
+	require.NoError(t, err, "buffer is flushed before aggregating")
+	assert.Equal(t, 1, result.Count)
+}
+
+func TestBuffer_Conformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) repository.Database {
+		interval, restore := 1, false
+		inner := memstorage.NewStorage(&serverenvconfig.Config{StoreInterval: &interval, Restore: &restore}, testhelpers.NopBackupManager{})
+		// small buffer is flushed concurrently with updates and reads
+		buffer := New(inner, time.Hour, 3)
+		require.NoError(t, buffer.Init(""))
+		return buffer
+	})
+}
@@ -0,0 +1,4 @@
+ALTER TABLE metrics DROP CONSTRAINT metrics_pkey;
+ALTER TABLE metrics ADD CONSTRAINT metrics_pkey PRIMARY KEY (name, mtype);
+
+CREATE INDEX IF NOT EXISTS idx_metrics_name ON metrics(name);
@@ -0,0 +1,17 @@
+-- metric name identifies a metric regardless of its type. Names stored with several types must be resolved
+-- by hand before migrating, rows are never deleted here
+DO $$
+DECLARE
+    duplicates text;
+BEGIN
+    SELECT string_agg(name, ', ' ORDER BY name) INTO duplicates
+    FROM (SELECT name FROM metrics GROUP BY name HAVING count(*) > 1) d;
+    IF duplicates IS NOT NULL THEN
+        RAISE EXCEPTION 'metrics stored with several types: %. Delete the unwanted rows and force version 2 before migrating', duplicates;
+    END IF;
+END $$;
+
+ALTER TABLE metrics DROP CONSTRAINT metrics_pkey;
+ALTER TABLE metrics ADD CONSTRAINT metrics_pkey PRIMARY KEY (name);
+
+DROP INDEX IF EXISTS idx_metrics_name;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_metrics_updated_at;
+
+ALTER TABLE metrics DROP COLUMN IF EXISTS updated_at;
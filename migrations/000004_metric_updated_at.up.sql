@@ -0,0 +1,4 @@
+-- time of the last update is used to purge metrics which are not reported anymore
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS updated_at timestamptz NOT NULL DEFAULT now();
+
+CREATE INDEX IF NOT EXISTS idx_metrics_updated_at ON metrics(updated_at);
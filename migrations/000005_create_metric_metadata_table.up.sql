@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS metric_metadata
+(
+    name text NOT NULL,
+    help text NOT NULL DEFAULT '',
+    unit text NOT NULL DEFAULT '',
+    owner text NOT NULL DEFAULT '',
+    mtype text NOT NULL DEFAULT '',
+    updated_at timestamptz NOT NULL DEFAULT now(),
+    CONSTRAINT metric_metadata_pkey PRIMARY KEY (name)
+);
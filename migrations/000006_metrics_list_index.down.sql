@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_metrics_mtype_name_c;
+DROP INDEX IF EXISTS idx_metrics_name_c;
@@ -0,0 +1,3 @@
+-- pages are ordered bytewise regardless of the database collation
+CREATE INDEX IF NOT EXISTS idx_metrics_name_c ON metrics(name COLLATE "C");
+CREATE INDEX IF NOT EXISTS idx_metrics_mtype_name_c ON metrics(mtype COLLATE "C", name COLLATE "C");
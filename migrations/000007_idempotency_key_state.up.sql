@@ -0,0 +1,2 @@
+-- keys saved before have no state, they are considered applied
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS done boolean NOT NULL DEFAULT true;
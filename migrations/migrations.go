@@ -0,0 +1,9 @@
+// Package migrations embeds postgres schema migrations, so the server applies them regardless of working directory
+package migrations
+
+import "embed"
+
+// FS holds up and down migrations named like 000001_create_metrics_table.up.sql
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,225 @@
+// Dashboard renders metrics embedded into the page and applies changes received from /subscribe
+(() => {
+    'use strict';
+
+    const root = document.getElementById('dashboard');
+    const historySize = Number(root.dataset.historySize) || 60;
+    const search = document.getElementById('search');
+    const typeFilter = document.getElementById('type');
+    const grouping = document.getElementById('group');
+    const status = document.getElementById('status');
+    const columns = ['Name', 'Type', 'Value', 'Rate/s', 'EWMA/s', 'Trend', 'Unit', 'Description', 'Owner'];
+
+    // metrics by name: {name, type, value, help, unit, owner, rate: {instant, ewma}, history: [numbers], changed}
+    const metrics = new Map();
+    const collapsed = new Set();
+
+    for (const m of JSON.parse(document.getElementById('initial-metrics').textContent)) {
+        metrics.set(m.name, {...m, history: (m.history || []).map(s => s.v)});
+    }
+
+    const valueOf = m => m.type === 'counter' ? m.delta : m.value;
+
+    // formatRate shortens rate to 4 significant digits
+    const formatRate = v => v === undefined ? '' : String(Number(v.toPrecision(4)));
+
+    // groupOf returns name prefix before the first separator or the first word of a CamelCase name
+    function groupOf(name) {
+        const sep = name.search(/[._:/-]/);
+        if (sep > 0) {
+            return name.slice(0, sep);
+        }
+        const word = name.match(/^[A-Z]+(?![a-z])|^[A-Z]?[a-z0-9]+/);
+        return word ? word[0] : name;
+    }
+
+    function sparkline(values) {
+        const ns = 'http://www.w3.org/2000/svg';
+        const width = 120, height = 24;
+        const svg = document.createElementNS(ns, 'svg');
+        svg.setAttribute('class', 'sparkline');
+        svg.setAttribute('width', width);
+        svg.setAttribute('height', height);
+        if (values.length < 2) {
+            return svg;
+        }
+
+        const min = Math.min(...values), max = Math.max(...values);
+        const span = max - min || 1;
+        const step = width / (historySize - 1);
+        const points = values.map((v, i) => {
+            const x = width - (values.length - 1 - i) * step;
+            const y = height - 2 - (v - min) / span * (height - 4);
+            return `${x.toFixed(1)},${y.toFixed(1)}`;
+        });
+        const line = document.createElementNS(ns, 'polyline');
+        line.setAttribute('points', points.join(' '));
+        svg.appendChild(line);
+        const title = document.createElementNS(ns, 'title');
+        title.textContent = `min ${min}, max ${max}`;
+        svg.appendChild(title);
+        return svg;
+    }
+
+    function row(m) {
+        const tr = document.createElement('tr');
+        if (m.changed) {
+            tr.className = 'changed';
+            m.changed = false;
+        }
+        const rate = m.rate || {};
+        const cells = [[m.name], [m.type], [m.value, 'value'], [formatRate(rate.instant), 'value'], [formatRate(rate.ewma), 'value'],
+            [null], [m.unit], [m.help], [m.owner]];
+        for (const [text, cls] of cells) {
+            const td = document.createElement('td');
+            if (cls) {
+                td.className = cls;
+            }
+            if (text === null) {
+                td.appendChild(sparkline(m.history));
+            } else {
+                td.textContent = text || '';
+            }
+            tr.appendChild(td);
+        }
+        return tr;
+    }
+
+    function matches(m) {
+        const query = search.value.trim().toLowerCase();
+        if (typeFilter.value && m.type !== typeFilter.value) {
+            return false;
+        }
+        return !query || [m.name, m.help, m.owner].some(s => s && s.toLowerCase().includes(query));
+    }
+
+    function groupHeader(group, count) {
+        const tr = document.createElement('tr');
+        const th = document.createElement('th');
+        th.className = 'group';
+        th.colSpan = columns.length;
+        th.textContent = `${collapsed.has(group) ? '▸' : '▾'} ${group} (${count})`;
+        th.addEventListener('click', () => {
+            collapsed.has(group) ? collapsed.delete(group) : collapsed.add(group);
+            render();
+        });
+        tr.appendChild(th);
+        return tr;
+    }
+
+    function render() {
+        scheduled = false;
+        const visible = [...metrics.values()].filter(matches).sort((a, b) => a.name < b.name ? -1 : a.name > b.name ? 1 : 0);
+
+        const table = document.createElement('table');
+        const header = table.createTHead().insertRow();
+        for (const column of columns) {
+            const th = document.createElement('th');
+            th.textContent = column;
+            header.appendChild(th);
+        }
+
+        if (visible.length === 0) {
+            const td = table.createTBody().insertRow().insertCell();
+            td.colSpan = columns.length;
+            td.className = 'empty';
+            td.textContent = metrics.size === 0 ? 'No metrics yet' : 'No metrics match the filter';
+        } else if (grouping.checked) {
+            const groups = new Map();
+            for (const m of visible) {
+                const group = groupOf(m.name);
+                groups.has(group) ? groups.get(group).push(m) : groups.set(group, [m]);
+            }
+            for (const [group, members] of groups) {
+                const body = table.createTBody();
+                body.appendChild(groupHeader(group, members.length));
+                if (!collapsed.has(group)) {
+                    members.forEach(m => body.appendChild(row(m)));
+                }
+            }
+        } else {
+            const body = table.createTBody();
+            visible.forEach(m => body.appendChild(row(m)));
+        }
+        root.replaceChildren(table);
+    }
+
+    let scheduled = false;
+    function scheduleRender() {
+        if (!scheduled) {
+            scheduled = true;
+            requestAnimationFrame(render);
+        }
+    }
+
+    function apply(event) {
+        for (const update of event.updated || []) {
+            const value = valueOf(update);
+            let m = metrics.get(update.id);
+            if (!m || m.type !== update.type) {
+                m = {...m, name: update.id, type: update.type, history: [], rate: undefined};
+                metrics.set(update.id, m);
+            }
+            m.value = String(value);
+            m.rate = (event.rates || {})[update.id] || m.rate;
+            m.changed = true;
+            m.history.push(value);
+            if (m.history.length > historySize) {
+                m.history.splice(0, m.history.length - historySize);
+            }
+        }
+        for (const name of event.deleted || []) {
+            metrics.delete(name);
+        }
+        scheduleRender();
+    }
+
+    // reload fetches current values, changes published while the stream was disconnected are lost
+    async function reload() {
+        const seen = new Set();
+        let cursor = '';
+        do {
+            const url = '/api/metrics?limit=1000' + (cursor ? '&cursor=' + encodeURIComponent(cursor) : '');
+            const response = await fetch(url);
+            if (!response.ok) {
+                return;
+            }
+            const page = await response.json();
+            for (const d of page.metrics) {
+                seen.add(d.id);
+                const m = metrics.get(d.id);
+                const meta = d.meta || {};
+                const fields = {name: d.id, type: d.type, value: String(valueOf(d)), help: meta.help, unit: meta.unit, owner: meta.owner};
+                metrics.set(d.id, m && m.type === d.type ? Object.assign(m, fields) : {...fields, history: []});
+            }
+            cursor = page.next_cursor || '';
+        } while (cursor);
+        for (const name of [...metrics.keys()]) {
+            if (!seen.has(name)) {
+                metrics.delete(name);
+            }
+        }
+        scheduleRender();
+    }
+
+    function setStatus(text) {
+        status.textContent = text;
+        status.className = 'status ' + text;
+    }
+
+    function connect() {
+        const source = new EventSource('/subscribe');
+        source.addEventListener('metrics', e => apply(JSON.parse(e.data)));
+        source.onopen = () => {
+            setStatus('live');
+            reload().catch(err => console.error('error reloading metrics', err));
+        };
+        source.onerror = () => setStatus(source.readyState === EventSource.CLOSED ? 'unavailable' : 'offline');
+    }
+
+    search.addEventListener('input', scheduleRender);
+    typeFilter.addEventListener('change', scheduleRender);
+    grouping.addEventListener('change', scheduleRender);
+    render();
+    connect();
+})();
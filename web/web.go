@@ -0,0 +1,9 @@
+// Package web holds the dashboard templates and static assets embedded into the server binary
+package web
+
+import "embed"
+
+// FS contains templates and static directories
+//
+//go:embed templates static
+var FS embed.FS